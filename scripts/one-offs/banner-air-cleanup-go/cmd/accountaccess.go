@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// secureAccessReport is the --access-report path. Every site's diffs are
+// collected and the file is written once all sites are done.
+var (
+	secureAccessReport string
+	accessDiffs        []AccessDiff
+)
+
+// AccountAccess is what an account could do at one point in time.
+type AccountAccess struct {
+	Roles        []string `json:"roles"`
+	Capabilities []string `json:"capabilities"`
+	Sessions     int      `json:"sessions"`
+	SessionIPs   []string `json:"session_ips,omitempty"`
+	// password is the stored hash, only compared and never written out.
+	password string
+}
+
+// AccessDiff is an account's access before and after secure-accounts, and
+// what changed in between.
+type AccessDiff struct {
+	Site                string        `json:"site"`
+	UserID              string        `json:"user_id"`
+	Login               string        `json:"user_login"`
+	Before              AccountAccess `json:"before"`
+	After               AccountAccess `json:"after"`
+	PasswordReset       bool          `json:"password_reset"`
+	RolesRemoved        []string      `json:"roles_removed,omitempty"`
+	CapabilitiesRemoved []string      `json:"capabilities_removed,omitempty"`
+	SessionsEnded       int           `json:"sessions_ended"`
+	CheckedAt           time.Time     `json:"checked_at"`
+}
+
+// accountAccess reads an account's roles, capabilities, sessions and
+// password hash from the live site.
+func accountAccess(ctx context.Context, id string) (AccountAccess, error) {
+	var access AccountAccess
+	a, err := getAccount(ctx, id)
+	if err != nil {
+		return access, err
+	}
+	access.Roles = slices.Clone([]string(a.Roles))
+	sort.Strings(access.Roles)
+
+	out, err := runWPCommand(ctx, []string{"user", "list-caps", id, "--format=json"})
+	if err != nil {
+		return access, fmt.Errorf("listing capabilities: %w", err)
+	}
+	var caps []struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal([]byte(out), &caps); err != nil {
+		return access, fmt.Errorf("parsing capabilities: %w", err)
+	}
+	for _, c := range caps {
+		if !slices.Contains(access.Capabilities, c.Name) {
+			access.Capabilities = append(access.Capabilities, c.Name)
+		}
+	}
+	sort.Strings(access.Capabilities)
+
+	out, err = runWPCommand(ctx, []string{"user", "meta", "get", id, "session_tokens", "--format=json"})
+	if err == nil && strings.TrimSpace(out) != "" {
+		var sessions map[string]json.RawMessage
+		if json.Unmarshal([]byte(out), &sessions) == nil {
+			access.Sessions = len(sessions)
+		}
+	}
+	access.SessionIPs = sessionIPs(ctx, id)
+
+	if out, err = runWPCommand(ctx, []string{"user", "get", id, "--field=user_pass"}); err != nil {
+		return access, fmt.Errorf("reading password hash: %w", err)
+	}
+	access.password = strings.TrimSpace(out)
+	return access, nil
+}
+
+// diffAccess compares an account's access before and after it was secured.
+func diffAccess(a Author, before, after AccountAccess) AccessDiff {
+	d := AccessDiff{
+		Site: dockerContainer, UserID: a.ID, Login: a.Login,
+		Before: before, After: after,
+		PasswordReset: before.password != after.password,
+		SessionsEnded: max(before.Sessions-after.Sessions, 0),
+		CheckedAt:     time.Now().UTC(),
+	}
+	for _, r := range before.Roles {
+		if !slices.Contains(after.Roles, r) {
+			d.RolesRemoved = append(d.RolesRemoved, r)
+		}
+	}
+	for _, c := range before.Capabilities {
+		if !slices.Contains(after.Capabilities, c) {
+			d.CapabilitiesRemoved = append(d.CapabilitiesRemoved, c)
+		}
+	}
+	return d
+}
+
+// summary describes the diff in one line for the log.
+func (d AccessDiff) summary() string {
+	var parts []string
+	if d.PasswordReset {
+		parts = append(parts, "password reset")
+	} else {
+		parts = append(parts, "password NOT changed")
+	}
+	parts = append(parts, fmt.Sprintf("sessions %d -> %d", d.Before.Sessions, d.After.Sessions))
+	if len(d.RolesRemoved) > 0 {
+		parts = append(parts, "roles removed: "+strings.Join(d.RolesRemoved, ", "))
+	} else {
+		parts = append(parts, "roles unchanged ("+firstNonEmpty(strings.Join(d.After.Roles, "/"), "none")+")")
+	}
+	if len(d.CapabilitiesRemoved) > 0 {
+		parts = append(parts, fmt.Sprintf("%d capabilities removed", len(d.CapabilitiesRemoved)))
+	} else {
+		parts = append(parts, fmt.Sprintf("%d capabilities unchanged", len(d.After.Capabilities)))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func writeAccessReport(path string, diffs []AccessDiff) error {
+	data, err := json.MarshalIndent(map[string]any{
+		"generated_at": time.Now().UTC(),
+		"accounts":     diffs,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing access report %s: %w", path, err)
+	}
+	log.Printf("Wrote the before/after access of %d account(s) to %s", len(diffs), path)
+	return nil
+}
@@ -0,0 +1,234 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	secureWhere        string
+	secureUsers        []string
+	secureExcludeUsers []string
+	secureDryRun       bool
+	secureNotifyUsers  bool
+	secureUnreviewed   bool
+)
+
+var secureAccountsCmd = &cobra.Command{
+	Use:   "secure-accounts",
+	Short: "Reset the passwords and end the sessions of accounts that published spam.",
+	Long: `Locks spammers out of every account that published a Spam finding in the
+store that was approved for cleanup or already cleaned, plus any given with
+--user: each account's password is reset to a random one with wp user
+reset-password, and its login sessions are ended by deleting its
+session_tokens user meta, so a stolen cookie stops working too. Every
+affected account is logged with its roles and the IPs of the sessions ended.
+
+Unreviewed findings are only AI verdicts, and spam injected into the site is
+often attributed to the owner's account, so they are left out unless
+--unreviewed is given. Accounts with the administrator role are never
+secured for their findings alone; name them with --user.
+
+Each account's roles, capabilities and sessions are read before and after,
+and the difference, including whether the password hash changed, is written
+to --access-report as proof of exactly what access was revoked.
+
+Accounts keep their posts and roles; demote or delete them by hand once
+reviewed. An administrator naming their own account with --user is locked
+out as well.
+
+Users are not emailed their new password unless --notify-users is given.
+With --window it only runs inside the maintenance window. Use --sites to
+secure a fleet.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if storePath == "" && len(secureUsers) == 0 {
+			fatal("--store-path or --user is required for secure-accounts.")
+		}
+		forEachSite(runSecureAccounts)
+		if secureAccessReport != "" && len(accessDiffs) > 0 {
+			if err := writeAccessReport(secureAccessReport, accessDiffs); err != nil {
+				fatal(err)
+			}
+		}
+	},
+}
+
+func init() {
+	secureAccountsCmd.Flags().StringVar(&secureWhere, "where", "", "Extra SQL filter over the Spam findings whose authors are secured, e.g. \"first_seen >= '2024-06-01'\".")
+	secureAccountsCmd.Flags().BoolVar(&secureUnreviewed, "unreviewed", false, "Also secure the authors of Spam findings not yet approved for cleanup.")
+	secureAccountsCmd.Flags().StringArrayVar(&secureUsers, "user", nil, "Also secure this account, by ID, login or email. Repeatable.")
+	secureAccountsCmd.Flags().StringArrayVar(&secureExcludeUsers, "exclude-user", nil, "Never secure this account, by ID or login. Repeatable.")
+	secureAccountsCmd.Flags().BoolVar(&secureDryRun, "dry-run", false, "List the accounts that would be secured without changing anything.")
+	secureAccountsCmd.Flags().BoolVar(&secureNotifyUsers, "notify-users", false, "Email each user their new password instead of resetting it silently.")
+	secureAccountsCmd.Flags().StringVar(&secureAccessReport, "access-report", "account-access.json", "Output JSON with each account's roles, capabilities and sessions before and after (empty to skip).")
+	rootCmd.AddCommand(secureAccountsCmd)
+}
+
+func runSecureAccounts() {
+	ctx := context.Background()
+	if !secureDryRun {
+		if err := checkWindow(time.Now()); err != nil {
+			log.Printf("Skipping secure-accounts on %s: %v", dockerContainer, err)
+			return
+		}
+	}
+
+	refs := append([]string(nil), secureUsers...)
+	if storePath != "" {
+		authors, err := flaggedAuthors()
+		if err != nil {
+			fatalf("Failed to select flagged accounts: %v", err)
+		}
+		refs = append(refs, authors...)
+	}
+
+	var accounts []Author
+	seen := make(map[string]bool)
+	for i, ref := range refs {
+		a, err := getAccount(ctx, ref)
+		if err != nil {
+			log.Printf("Warning: skipping account %s on %s: %v", ref, dockerContainer, err)
+			continue
+		}
+		if seen[a.ID] || slices.Contains(secureExcludeUsers, a.ID) || slices.Contains(secureExcludeUsers, a.Login) {
+			continue
+		}
+		seen[a.ID] = true
+		// Refs after the --user ones are the authors of findings.
+		if i >= len(secureUsers) && slices.Contains(a.Roles, "administrator") {
+			log.Printf("Warning: not securing %s on %s: administrators are only secured when named with --user.", accountLabel(a), dockerContainer)
+			continue
+		}
+		accounts = append(accounts, a)
+	}
+	if len(accounts) == 0 {
+		log.Printf("No flagged accounts to secure on %s.", dockerContainer)
+		return
+	}
+
+	if secureDryRun {
+		for _, a := range accounts {
+			log.Printf("Would reset the password and end the sessions of %s.", accountLabel(a))
+		}
+		return
+	}
+
+	before := make(map[string]AccountAccess)
+	if secureAccessReport != "" {
+		for _, a := range accounts {
+			access, err := accountAccess(ctx, a.ID)
+			if err != nil {
+				log.Printf("Warning: could not record the access of %s before securing it: %v", accountLabel(a), err)
+				continue
+			}
+			before[a.ID] = access
+		}
+	}
+
+	// One call resets every password, so no account keeps working while
+	// the others are being locked.
+	ids := make([]string, len(accounts))
+	for i, a := range accounts {
+		ids[i] = a.ID
+	}
+	reset := append([]string{"user", "reset-password"}, ids...)
+	if !secureNotifyUsers {
+		reset = append(reset, "--skip-email")
+	}
+	if _, err := runWPCommand(ctx, reset); err != nil {
+		log.Printf("Warning: could not reset passwords on %s: %v", dockerContainer, err)
+		return
+	}
+	for _, a := range accounts {
+		// wp user meta delete fails for a missing meta, so the sessions are
+		// only deleted when there are any; sessions without an IP count too.
+		out, err := runWPCommand(ctx, []string{"user", "meta", "get", a.ID, "session_tokens", "--format=json"})
+		if err != nil {
+			log.Printf("Warning: reset the password of %s, but could not read its sessions to end them: %v", accountLabel(a), err)
+			continue
+		}
+		if out = strings.TrimSpace(out); out == "" || out == `""` {
+			log.Printf("Reset the password of %s; no active sessions.", accountLabel(a))
+			continue
+		}
+		if _, err := runWPCommand(ctx, []string{"user", "meta", "delete", a.ID, "session_tokens"}); err != nil {
+			log.Printf("Warning: reset the password of %s, but could not end its sessions: %v", accountLabel(a), err)
+			continue
+		}
+		sessions := "ended its sessions"
+		if ips := parseSessionIPs(out); len(ips) > 0 {
+			sessions = "ended sessions from " + strings.Join(ips, ", ")
+		}
+		log.Printf("Reset the password of %s; %s.", accountLabel(a), sessions)
+	}
+	for _, a := range accounts {
+		b, ok := before[a.ID]
+		if !ok {
+			continue
+		}
+		after, err := accountAccess(ctx, a.ID)
+		if err != nil {
+			log.Printf("Warning: could not record the access of %s after securing it: %v", accountLabel(a), err)
+			continue
+		}
+		d := diffAccess(a, b, after)
+		log.Printf("Access of %s: %s.", accountLabel(a), d.summary())
+		accessDiffs = append(accessDiffs, d)
+	}
+	log.Printf("Secured %d account(s) on %s.", len(accounts), dockerContainer)
+}
+
+// flaggedAuthors returns the IDs of the authors of the site's Spam findings
+// that were approved for cleanup or cleaned, or with --unreviewed of all of
+// them.
+func flaggedAuthors() ([]string, error) {
+	db, err := openStore(storePath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	where := siteFilter(dockerContainer) + " AND classification = 'Spam'"
+	if !secureUnreviewed {
+		where += " AND review_state IN ('approved', 'cleaned')"
+	}
+	if strings.TrimSpace(secureWhere) != "" {
+		where += " AND (" + secureWhere + ")"
+	}
+	spam, err := queryFindings(db, where)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, p := range spam {
+		if p.AuthorID != "" && p.AuthorID != "0" && !slices.Contains(ids, p.AuthorID) {
+			ids = append(ids, p.AuthorID)
+		}
+	}
+	return ids, nil
+}
+
+// getAccount looks an account up on the live site, which also catches
+// accounts deleted since the run that flagged them.
+func getAccount(ctx context.Context, ref string) (Author, error) {
+	output, err := runWPCommand(ctx, []string{"user", "get", ref, "--fields=ID,display_name,user_email,user_login,roles", "--format=json"})
+	if err != nil {
+		return Author{}, err
+	}
+	var a Author
+	if err := json.Unmarshal([]byte(output), &a); err != nil {
+		return Author{}, fmt.Errorf("parsing user: %w", err)
+	}
+	return a, nil
+}
+
+func accountLabel(a Author) string {
+	return fmt.Sprintf("user %s (%s, %s)", a.ID, firstNonEmpty(a.Login, a.Email), firstNonEmpty(strings.Join(a.Roles, "/"), "no role"))
+}
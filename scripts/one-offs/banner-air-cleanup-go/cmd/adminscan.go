@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	scanAdmin          bool
+	renderAdminNotices bool
+)
+
+// suspiciousTitlePattern matches page titles that imitate WordPress internals
+// or name common web shells, which attackers use to hide admin backdoors.
+var suspiciousTitlePattern = regexp.MustCompile(`(?i)wp-config|wp-login|wp-admin|wp-includes|\.php\b|^\s*admin\s*$|\bshell\b|\bwso\b|filesman|uploader|index of /`)
+
+// adminAjaxExploitPattern matches markup that posts to admin-ajax.php from
+// inside content, as injected by several plugin exploits.
+var adminAjaxExploitPattern = regexp.MustCompile(`(?is)(<form[^>]+admin-ajax\.php|admin-ajax\.php\?action=|<script[^>]*>.*admin-ajax\.php)`)
+
+// adminNoticesPHP finds the file and source of each admin_notices callback
+// by reflection, so injected notices can be traced to a plugin without
+// running them: the callbacks are plugin and theme code, possibly the very
+// malware being looked for. Only with --render-admin-notices (the %t) is
+// each callback also called and its output captured. Notices that are only
+// hooked during admin_init are not seen.
+const adminNoticesPHP = `$render = %t;
+require_once ABSPATH . 'wp-admin/includes/admin.php';
+if ($render && function_exists('set_current_screen')) { set_current_screen('dashboard'); }
+$out = array();
+global $wp_filter;
+if (isset($wp_filter['admin_notices'])) {
+	foreach ($wp_filter['admin_notices']->callbacks as $cbs) {
+		foreach ($cbs as $id => $cb) {
+			$file = ''; $line = 0; $source = '';
+			try {
+				$f = $cb['function'];
+				if (is_array($f)) { $r = new ReflectionMethod($f[0], $f[1]); }
+				elseif (is_string($f) && strpos($f, '::') !== false) { $r = new ReflectionMethod($f); }
+				else { $r = new ReflectionFunction($f); }
+				$file = (string) $r->getFileName();
+				$line = (int) $r->getStartLine();
+				if ($file !== '' && is_readable($file)) {
+					$lines = array_slice(file($file), $line - 1, $r->getEndLine() - $line + 1);
+					$source = substr(implode('', $lines), 0, 65536);
+				}
+			} catch (Throwable $e) {}
+			$html = '';
+			if ($render) {
+				ob_start();
+				try { call_user_func($cb['function']); } catch (Throwable $e) {}
+				$html = ob_get_clean();
+			}
+			$out[] = array('callback' => $id, 'file' => $file, 'line' => $line, 'source' => $source, 'html' => $html);
+		}
+	}
+}
+echo wp_json_encode($out);`
+
+// AdminNotice is one admin_notices callback: where it is defined, its source
+// and, with --render-admin-notices, what it printed.
+type AdminNotice struct {
+	Callback string `json:"callback"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Source   string `json:"source"`
+	HTML     string `json:"html"`
+}
+
+// text is what is checked for injected content: the rendered notice, or
+// without rendering the callback's source, whose string literals carry the
+// markup it would print.
+func (n AdminNotice) text() string {
+	if renderAdminNotices {
+		return n.HTML
+	}
+	return n.Source
+}
+
+// Component names the plugin, mu-plugin or theme that defines the callback.
+func (n AdminNotice) Component() string {
+	for _, dir := range []string{"/mu-plugins/", "/plugins/", "/themes/"} {
+		if i := strings.Index(n.File, dir); i >= 0 {
+			rest := n.File[i+len(dir):]
+			if slug, _, ok := strings.Cut(rest, "/"); ok {
+				return strings.TrimSuffix(dir[1:len(dir)-1], "s") + ":" + slug
+			}
+			return strings.TrimSuffix(dir[1:len(dir)-1], "s") + ":" + rest
+		}
+	}
+	if n.File == "" {
+		return "unknown"
+	}
+	return "core"
+}
+
+// pageRecord is a page of any status with its content, as listed for the
+// hidden page scan.
+type pageRecord struct {
+	ID      int    `json:"ID"`
+	Title   string `json:"post_title"`
+	Status  string `json:"post_status"`
+	Date    string `json:"post_date"`
+	GUID    string `json:"guid"`
+	Content string `json:"post_content"`
+}
+
+// findHiddenAdminPages checks pages of every status, including drafts and
+// private pages the normal extraction never sees.
+func findHiddenAdminPages(ctx context.Context) ([]Finding, error) {
+	output, err := runWPCommand(ctx, []string{"post", "list", "--post_type=page", "--post_status=any",
+		"--fields=ID,post_title,post_status,post_date,guid,post_content", "--format=json"})
+	if err != nil {
+		return nil, err
+	}
+	var pages []pageRecord
+	if err := json.Unmarshal([]byte(output), &pages); err != nil {
+		return nil, fmt.Errorf("parsing page list: %w", err)
+	}
+
+	var findings []Finding
+	for _, p := range pages {
+		var reasons []string
+		classification := "Uncertain"
+		if strings.TrimSpace(p.Title) == "" {
+			reasons = append(reasons, "empty title")
+		} else if suspiciousTitlePattern.MatchString(p.Title) {
+			reasons = append(reasons, fmt.Sprintf("title %q imitates an admin or system file", p.Title))
+		}
+		if adminAjaxExploitPattern.MatchString(p.Content) {
+			reasons = append(reasons, "content contains admin-ajax exploit markup")
+			classification = "Spam"
+		}
+		if len(reasons) == 0 {
+			continue
+		}
+		findings = append(findings, Finding{
+			Site:           dockerContainer,
+			Type:           "hidden-admin-page",
+			Subject:        postSubject(p.ID),
+			PostID:         p.ID,
+			Title:          p.Title,
+			Classification: classification,
+			Detail:         fmt.Sprintf("%s page from %s: %s", p.Status, p.Date, strings.Join(reasons, "; ")),
+		})
+	}
+	return findings, nil
+}
+
+// findInjectedAdminNotices flags admin notices that link off-site, mention
+// spam keywords or hide markup, grouped by the component that adds them.
+func findInjectedAdminNotices(ctx context.Context, own map[string]bool) ([]Finding, error) {
+	output, err := runWPScript(ctx, "admin-notices.php", fmt.Sprintf(adminNoticesPHP, renderAdminNotices))
+	if err != nil {
+		return nil, err
+	}
+	var notices []AdminNotice
+	if err := json.Unmarshal([]byte(output), &notices); err != nil {
+		return nil, fmt.Errorf("parsing admin notices: %w", err)
+	}
+
+	var findings []Finding
+	for _, n := range notices {
+		text := n.text()
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		var reasons []string
+		var external []string
+		for _, d := range extractLinkDomains(text) {
+			if !own[d] && d != "wordpress.org" && !strings.HasSuffix(d, ".wordpress.org") {
+				external = append(external, d)
+			}
+		}
+		if len(external) > 0 {
+			sort.Strings(external)
+			reasons = append(reasons, "links to "+strings.Join(external, ", "))
+		}
+		if kw := spamKeywordPattern.FindString(text); kw != "" {
+			reasons = append(reasons, "mentions "+strings.ToLower(kw))
+		}
+		if hiddenMarkupPattern.MatchString(text) {
+			reasons = append(reasons, "hidden or scripted markup")
+		}
+		if len(reasons) == 0 {
+			continue
+		}
+		classification := "Uncertain"
+		if len(reasons) > 1 {
+			classification = "Spam"
+		}
+		findings = append(findings, Finding{
+			Site:           dockerContainer,
+			Type:           "admin-notice-injection",
+			Subject:        n.Component() + ":" + n.Callback,
+			Title:          n.Component(),
+			Classification: classification,
+			Detail:         fmt.Sprintf("%s (%s:%d)", strings.Join(reasons, "; "), n.File, n.Line),
+		})
+	}
+	return findings, nil
+}
+
+// runAdminScan runs both admin checks; a failure in one does not stop the
+// other.
+func runAdminScan(ctx context.Context, posts []Post) []Finding {
+	log.Println("Scanning for hidden admin pages and injected admin notices...")
+	var findings []Finding
+	pages, err := findHiddenAdminPages(ctx)
+	if err != nil {
+		log.Printf("Warning: hidden page scan failed: %v", err)
+	}
+	findings = append(findings, pages...)
+
+	notices, err := findInjectedAdminNotices(ctx, siteHosts(posts))
+	if err != nil {
+		log.Printf("Warning: admin notice scan failed: %v", err)
+	}
+	findings = append(findings, notices...)
+	log.Printf("Admin scan: %d hidden page(s), %d injected notice(s).", len(pages), len(notices))
+	return findings
+}
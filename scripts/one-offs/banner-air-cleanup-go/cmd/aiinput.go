@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AI input truncation strategies for --ai-input-strategy.
+const (
+	inputStrategyHead     = "head"
+	inputStrategyHeadTail = "head+tail"
+	inputStrategySmart    = "smart"
+)
+
+var (
+	aiMaxInputChars int
+	aiInputStrategy string
+)
+
+// spamKeywords are terms that commonly mark injected spam, as regular
+// expressions; --industry adds and drops some.
+var spamKeywords = []string{"casino", "poker", "slots?", "betting", "viagra", "cialis", "pharmacy", "pills", "payday", "loans?",
+	"crypto", "bitcoin", "forex", "porn", "escort", "dating", "replica", "essay", "seo services", "backlinks?"}
+
+// spamKeywordPattern matches spamKeywords, or the active industry pack's
+// list, used to pick which parts of long content are worth sending to the
+// model.
+var spamKeywordPattern = keywordPattern(spamKeywords)
+
+// activeSpamKeywords is the list spamKeywordPattern was built from.
+var activeSpamKeywords = spamKeywords
+
+// elision joins the pieces of cut content; it counts towards the limit.
+const elision = "\n[...]\n"
+
+// smartWindow is how many characters of context are kept on each side of a
+// link or keyword in the smart strategy.
+const smartWindow = 120
+
+func validateInputStrategy(strategy string) error {
+	switch strategy {
+	case inputStrategyHead, inputStrategyHeadTail, inputStrategySmart:
+		return nil
+	}
+	return fmt.Errorf("unknown AI input strategy %q; expected head, head+tail or smart", strategy)
+}
+
+// prepareAIInput cuts content down to at most limit characters using the
+// given strategy. Content that already fits is sent unchanged.
+func prepareAIInput(content string, limit int, strategy string) string {
+	runes := []rune(content)
+	if limit <= 0 || len(runes) <= limit {
+		return content
+	}
+	sepLen := len([]rune(elision))
+	if strategy != inputStrategyHead && limit <= 2*sepLen {
+		strategy = inputStrategyHead
+	}
+	switch strategy {
+	case inputStrategyHeadTail:
+		half := (limit - sepLen) / 2
+		return string(runes[:half]) + elision + string(runes[len(runes)-(limit-sepLen-half):])
+	case inputStrategySmart:
+		return smartExtract(runes, limit)
+	default:
+		return string(runes[:limit])
+	}
+}
+
+// smartExtract keeps the opening of the content, then windows around links
+// and spam keywords (where footer injections usually hide), then the tail,
+// until the character budget is spent.
+func smartExtract(runes []rune, limit int) string {
+	type span struct{ start, end int }
+	text := string(runes)
+
+	// Regex offsets are bytes; map them to rune positions.
+	runeAt := make([]int, len(text)+1)
+	r := 0
+	for i := range text {
+		runeAt[i] = r
+		r++
+	}
+	runeAt[len(text)] = r
+
+	sepLen := len([]rune(elision))
+	head := span{0, min(limit/4, len(runes))}
+	var hits []span
+	for _, loc := range append(linkPattern.FindAllStringIndex(text, -1), spamKeywordPattern.FindAllStringIndex(text, -1)...) {
+		start, end := runeAt[loc[0]], runeAt[loc[1]]
+		hits = append(hits, span{max(0, start-smartWindow), min(len(runes), end+smartWindow)})
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].start < hits[j].start })
+
+	spans := []span{head}
+	budget := limit - (head.end - head.start)
+	for _, h := range hits {
+		last := &spans[len(spans)-1]
+		if h.start <= last.end {
+			grow := min(max(0, h.end-last.end), budget)
+			last.end += grow
+			budget -= grow
+		} else if budget > sepLen {
+			budget -= sepLen
+			end := min(h.end, h.start+budget)
+			spans = append(spans, span{h.start, end})
+			budget -= end - h.start
+		}
+		if budget <= 0 {
+			break
+		}
+	}
+	if last := spans[len(spans)-1]; budget > 0 && last.end < len(runes) {
+		if start := len(runes) - budget; start <= last.end {
+			spans[len(spans)-1].end = len(runes)
+		} else if budget > sepLen {
+			spans = append(spans, span{len(runes) - (budget - sepLen), len(runes)})
+		}
+	}
+
+	parts := make([]string, 0, len(spans))
+	for _, s := range spans {
+		parts = append(parts, string(runes[s.start:s.end]))
+	}
+	return strings.Join(parts, elision)
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+var aiMaxOutputChars int
+
+// strictInstruction is appended to the prompt when a first response had to be
+// aborted, to steer the retry back to the expected format.
+const strictInstruction = `
+
+IMPORTANT: Your previous answer was rejected. Reply with the JSON object only,
+starting with "{" and ending with "}". No markdown, no preamble, no notes. Keep
+the justification to one short sentence.`
+
+// abortedResponse reports a streamed response that was cut off before it
+// finished.
+type abortedResponse struct {
+	Reason string
+	Text   string
+}
+
+func (e *abortedResponse) Error() string {
+	return fmt.Sprintf("response aborted: %s", e.Reason)
+}
+
+// offFormat returns why a partial response should be abandoned, or "" if it
+// still looks like it is heading towards a JSON object within the limit.
+func offFormat(partial string, maxChars int) string {
+	if maxChars > 0 && len([]rune(partial)) > maxChars {
+		return fmt.Sprintf("longer than %d characters", maxChars)
+	}
+	body := strings.TrimLeft(partial, " \n\t`")
+	if body == "" {
+		return ""
+	}
+	if strings.HasPrefix("json", strings.ToLower(body)) {
+		return "" // still inside a ```json fence
+	}
+	if after, ok := strings.CutPrefix(body, "json"); ok {
+		body = strings.TrimLeft(after, " \n\t")
+		if body == "" {
+			return ""
+		}
+	}
+	if body[0] != '{' {
+		return "does not start with a JSON object"
+	}
+	return ""
+}
+
+// streamAIResponse streams a generation and stops reading as soon as the text
+// runs long or goes off-format, so malformed answers cost as few tokens as
+// possible. It returns the text and the model version reported by the API,
+// adding the reported token counts to usage.
+func streamAIResponse(ctx context.Context, client *genai.Client, model, prompt string, usage *AIUsage) (string, string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var text strings.Builder
+	var modelVersion string
+	var promptTokens, outputTokens int64
+	defer func() {
+		usage.PromptTokens.Add(promptTokens)
+		usage.OutputTokens.Add(outputTokens)
+	}()
+	for chunk, err := range client.Models.GenerateContentStream(ctx, model, genai.Text(prompt), nil) {
+		if err != nil {
+			return "", modelVersion, err
+		}
+		if chunk.ModelVersion != "" {
+			modelVersion = chunk.ModelVersion
+		}
+		if m := chunk.UsageMetadata; m != nil {
+			// Each chunk reports running totals; keep the latest.
+			promptTokens, outputTokens = int64(m.PromptTokenCount), int64(m.CandidatesTokenCount)
+		}
+		text.WriteString(chunk.Text())
+		if reason := offFormat(text.String(), aiMaxOutputChars); reason != "" {
+			return "", modelVersion, &abortedResponse{Reason: reason, Text: text.String()}
+		}
+	}
+	return text.String(), modelVersion, nil
+}
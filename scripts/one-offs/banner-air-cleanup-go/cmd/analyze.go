@@ -0,0 +1,304 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var analyzeCmd = &cobra.Command{
+	Use:   "analyze",
+	Short: "Re-run AI analysis for posts in the retry queue.",
+	Long: `Re-analyzes only the posts listed in --retry-file (written by a previous run
+whenever the AI step failed) and merges the new classifications into
+--output-csv-path, and into --store-path when given, by post ID. Posts that
+fail again stay in the retry file.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runAnalyze()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(analyzeCmd)
+}
+
+func runAnalyze() {
+	ctx := context.Background()
+	queued, retryAfter, err := readRetryFile(retryFilePath)
+	if err != nil {
+		fatalf("Failed to read retry queue: %v", err)
+	}
+	if len(queued) == 0 {
+		log.Printf("Retry queue %s is empty.", retryFilePath)
+		return
+	}
+	if time.Now().Before(retryAfter) {
+		log.Printf("Warning: posts were queued because the AI quota ran out; it resets at %s, so they may fail again.", retryAfter.Format(time.RFC3339))
+	}
+	log.Printf("Re-analyzing %d post(s) from %s...", len(queued), retryFilePath)
+
+	genaiClient, err := newAIClient(ctx)
+	if err != nil {
+		fatal(err)
+	}
+	for i := range queued {
+		// The rest stay queued as they are; another attempt would only fail.
+		if aiUnavailable() {
+			log.Printf("Warning: the AI provider is unavailable; leaving %d post(s) queued.", len(queued)-i)
+			break
+		}
+		analyzePost(ctx, genaiClient, &queued[i])
+	}
+
+	// The store is the record of truth, so it is updated before the CSV.
+	if storePath != "" {
+		db, err := openStore(storePath)
+		if err != nil {
+			fatalf("Failed to open store: %v", err)
+		}
+		defer db.Close()
+		now := time.Now().UTC().Format(time.RFC3339)
+		for _, p := range queued {
+			if _, err := db.Exec(`UPDATE findings SET classification = ?, justification = ?, prompt_hash = ?, model_version = ?,
+				`+flaggedAtUpdate+` WHERE site = ? AND post_id = ?`,
+				p.AIClassification, p.AIJustification, p.AIPromptHash, p.AIModelVersion,
+				p.AIClassification, now, p.Site, p.ID); err != nil {
+				fatalf("Failed to update store for post %d: %v", p.ID, err)
+			}
+		}
+	}
+
+	merged, err := mergeIntoCSV(outputCSVPath, queued)
+	if err != nil {
+		fatalf("Failed to merge results into %s: %v", outputCSVPath, err)
+	}
+	log.Printf("Merged %d result(s) into %s", merged, outputCSVPath)
+
+	remaining := failedAnalyses(queued)
+	if len(remaining) == 0 {
+		if err := os.Remove(retryFilePath); err != nil {
+			log.Printf("Warning: could not remove %s: %v", retryFilePath, err)
+		}
+		log.Println("All queued posts analyzed successfully.")
+		return
+	}
+	if err := writeRetryFile(retryFilePath, remaining, genaiClient.Quota().exhaustedUntil()); err != nil {
+		fatalf("Failed to write retry queue: %v", err)
+	}
+	log.Printf("%d post(s) still failing; left in %s", len(remaining), retryFilePath)
+	logQuota(genaiClient, len(remaining))
+}
+
+func failedAnalyses(posts []Post) []Post {
+	var failed []Post
+	for _, p := range posts {
+		if p.AIClassification == "Error" || p.AIFallback {
+			failed = append(failed, p)
+		}
+	}
+	return failed
+}
+
+// RetryEntry is one line of the retry queue file. RetryAfter is set when the
+// post was queued because the AI quota ran out, to when it resets.
+type RetryEntry struct {
+	Post       Post   `json:"post"`
+	Error      string `json:"error"`
+	FailedAt   string `json:"failed_at"`
+	RetryAfter string `json:"retry_after,omitempty"`
+}
+
+func writeRetryFile(path string, posts []Post, retryAfter time.Time) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	enc := json.NewEncoder(file)
+	now := time.Now().UTC().Format(time.RFC3339)
+	var after string
+	if !retryAfter.IsZero() {
+		after = retryAfter.UTC().Format(time.RFC3339)
+	}
+	for _, p := range posts {
+		if err := enc.Encode(RetryEntry{Post: p, Error: p.AIJustification, FailedAt: now, RetryAfter: after}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readRetryFile returns the queued posts and the latest retry_after among
+// them.
+func readRetryFile(path string) ([]Post, time.Time, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer file.Close()
+
+	var posts []Post
+	var retryAfter time.Time
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry RetryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, time.Time{}, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		posts = append(posts, entry.Post)
+		if t, err := time.Parse(time.RFC3339, entry.RetryAfter); err == nil && t.After(retryAfter) {
+			retryAfter = t
+		}
+	}
+	return posts, retryAfter, scanner.Err()
+}
+
+// mergeIntoCSV replaces the AI columns of rows in an existing output CSV with
+// the given results, matching rows by post ID. An output split with
+// --max-rows-per-file is merged into each part listed in its index.
+func mergeIntoCSV(path string, results []Post) (int, error) {
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return mergeIntoCSVFile(path, results)
+	}
+	file, err := os.Open(indexPath(path))
+	if os.IsNotExist(err) {
+		return 0, fmt.Errorf("neither %s nor its index %s exists", path, indexPath(path))
+	}
+	if err != nil {
+		return 0, err
+	}
+	index, err := csv.NewReader(file).ReadAll()
+	file.Close()
+	if err != nil {
+		return 0, fmt.Errorf("reading %s: %w", indexPath(path), err)
+	}
+	merged := 0
+	for _, rec := range index[min(1, len(index)):] {
+		if len(rec) < 2 {
+			return merged, fmt.Errorf("%s: malformed row %q", indexPath(path), rec)
+		}
+		n, err := mergeIntoCSVFile(filepath.Join(filepath.Dir(path), rec[1]), results)
+		merged += n
+		if err != nil {
+			return merged, err
+		}
+	}
+	return merged, nil
+}
+
+func mergeIntoCSVFile(path string, results []Post) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	records, err := csv.NewReader(file).ReadAll()
+	file.Close()
+	if err != nil {
+		return 0, err
+	}
+	if len(records) == 0 {
+		return 0, fmt.Errorf("%s has no header row", path)
+	}
+
+	col := make(map[string]int)
+	for i, h := range records[0] {
+		col[h] = i
+	}
+	for _, h := range []string{"post_id", "ai_classification", "ai_justification"} {
+		if _, ok := col[h]; !ok {
+			return 0, fmt.Errorf("%s has no %s column", path, h)
+		}
+	}
+
+	byID := make(map[string]Post, len(results))
+	for _, p := range results {
+		byID[strconv.Itoa(p.ID)] = p
+	}
+	merged := 0
+	for _, rec := range records[1:] {
+		if p, ok := byID[rec[col["post_id"]]]; ok {
+			rec[col["ai_classification"]] = p.AIClassification
+			rec[col["ai_justification"]] = p.AIJustification
+			// Outputs written before results were stamped lack these columns.
+			if i, ok := col["ai_prompt_hash"]; ok {
+				rec[i] = p.AIPromptHash
+			}
+			if i, ok := col["ai_model_version"]; ok {
+				rec[i] = p.AIModelVersion
+			}
+			merged++
+		}
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+	writer := csv.NewWriter(out)
+	for _, rec := range records {
+		validRecord(rec) // rows written by older versions may hold cut characters
+	}
+	if err := writer.WriteAll(records); err != nil {
+		return 0, err
+	}
+	return merged, nil
+}
+
+// previousResults holds stored AI results by post ID when
+// --reanalyze-if-prompt-changed is set; workers only read it.
+var previousResults map[int]Post
+
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// isCurrentResult reports whether a stored result was produced by the current
+// prompt and model from the same content, so it can be reused as is.
+func isCurrentResult(prev, post Post) bool {
+	switch prev.AIClassification {
+	case "", "N/A", "Error":
+		return false
+	}
+	return prev.AIPromptHash == promptHash() && prev.ContentHash == post.ContentHash
+}
+
+func loadPreviousResults(path string) map[int]Post {
+	db, err := openStore(path)
+	if err != nil {
+		fatalf("Failed to open store: %v", err)
+	}
+	defer db.Close()
+
+	stored, err := queryFindings(db, siteFilter(dockerContainer))
+	if err != nil {
+		fatalf("Failed to load previous results: %v", err)
+	}
+	results := make(map[int]Post, len(stored))
+	stale := 0
+	for _, p := range stored {
+		results[p.ID] = p
+		if p.AIPromptHash != promptHash() {
+			stale++
+		}
+	}
+	log.Printf("Loaded %d stored result(s); %d were produced with a different prompt or model.", len(results), stale)
+	return results
+}
@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A taxonomy archive is flagged once at least spamArchiveMinPosts of its
+// analyzed posts are Spam and they make up spamArchiveUncertain of them;
+// from spamArchiveSpam it is classified Spam.
+const (
+	spamArchiveMinPosts  = 3
+	spamArchiveUncertain = 0.5
+	spamArchiveSpam      = 0.8
+)
+
+var cleanupSpamTerms bool
+
+// termsPHP lists the categories and tags with the IDs of every object
+// assigned to them. get_objects_in_term is used rather than GROUP_CONCAT,
+// which MySQL cuts off at 1024 characters.
+const termsPHP = `$out = array();
+foreach (get_terms(array('taxonomy' => array('category', 'post_tag'), 'hide_empty' => false)) as $t) {
+	$link = get_term_link($t);
+	$out[] = array(
+		'term_id' => $t->term_id,
+		'taxonomy' => $t->taxonomy,
+		'name' => $t->name,
+		'slug' => $t->slug,
+		'count' => $t->count,
+		'link' => is_wp_error($link) ? '' : $link,
+		'post_ids' => array_map('intval', get_objects_in_term($t->term_id, $t->taxonomy)),
+	);
+}
+echo wp_json_encode($out);`
+
+// Term is a category or tag and the posts assigned to it.
+type Term struct {
+	ID       int    `json:"term_id"`
+	Taxonomy string `json:"taxonomy"`
+	Name     string `json:"name"`
+	Slug     string `json:"slug"`
+	Count    int    `json:"count"`
+	Link     string `json:"link"`
+	PostIDs  []int  `json:"post_ids"`
+}
+
+// termSubject identifies a term in typed findings, e.g. term:post_tag:57.
+func termSubject(taxonomy string, id int) string {
+	return fmt.Sprintf("term:%s:%d", taxonomy, id)
+}
+
+// parseTermSubject is the inverse of termSubject.
+func parseTermSubject(subject string) (taxonomy string, id int, ok bool) {
+	parts := strings.Split(subject, ":")
+	if len(parts) != 3 || parts[0] != "term" {
+		return "", 0, false
+	}
+	id, err := strconv.Atoi(parts[2])
+	return parts[1], id, err == nil
+}
+
+func getTerms(ctx context.Context) ([]Term, error) {
+	output, err := runWPScript(ctx, "terms.php", termsPHP)
+	if err != nil {
+		return nil, err
+	}
+	var terms []Term
+	if err := json.Unmarshal([]byte(output), &terms); err != nil {
+		return nil, fmt.Errorf("parsing term list: %w", err)
+	}
+	return terms, nil
+}
+
+// detectSpamArchives flags categories and tags whose analyzed posts are
+// mostly spam. Their archive pages stay listed in sitemaps and search results
+// even after the posts are gone, so cleanup --delete-spam-terms removes the
+// emptied terms.
+func detectSpamArchives(ctx context.Context, posts []Post) []Finding {
+	classification := make(map[int]string, len(posts))
+	flagged := 0
+	for _, p := range posts {
+		classification[p.ID] = p.AIClassification
+		if p.AIClassification == "Spam" {
+			flagged++
+		}
+	}
+	if flagged < spamArchiveMinPosts {
+		return nil
+	}
+	terms, err := getTerms(ctx)
+	if err != nil {
+		log.Printf("Warning: could not check categories and tags for spam archives: %v", err)
+		return nil
+	}
+
+	var findings []Finding
+	for _, t := range terms {
+		var analyzed, spam int
+		for _, id := range t.PostIDs {
+			c, ok := classification[id]
+			if !ok {
+				continue
+			}
+			analyzed++
+			if c == "Spam" {
+				spam++
+			}
+		}
+		if spam < spamArchiveMinPosts || float64(spam) < spamArchiveUncertain*float64(analyzed) {
+			continue
+		}
+		class := "Uncertain"
+		if float64(spam) >= spamArchiveSpam*float64(analyzed) {
+			class = "Spam"
+		}
+		label := "Tag"
+		if t.Taxonomy == "category" {
+			label = "Category"
+		}
+		detail := fmt.Sprintf("%d of %d analyzed posts are spam (%d assigned in total)", spam, analyzed, len(t.PostIDs))
+		if t.Link != "" {
+			detail += "; archive " + t.Link
+		}
+		findings = append(findings, Finding{
+			Site:           dockerContainer,
+			Type:           "spam-archive",
+			Subject:        termSubject(t.Taxonomy, t.ID),
+			Title:          fmt.Sprintf("%s: %s", label, t.Name),
+			Classification: class,
+			Detail:         detail,
+		})
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Subject < findings[j].Subject })
+	if len(findings) > 0 {
+		log.Printf("%d category or tag archive(s) on %s are dominated by spam.", len(findings), dockerContainer)
+	}
+	return findings
+}
+
+// cleanSpamArchives deletes the terms of Spam archive findings that no
+// longer have any published posts. Terms that still hold posts are kept and
+// reported, since deleting them would unassign those posts.
+func cleanSpamArchives(ctx context.Context, db *sql.DB) {
+	archives, err := queryTypedFindings(db, siteFilter(dockerContainer)+" AND type = 'spam-archive' AND classification = 'Spam'")
+	if err != nil {
+		log.Printf("Warning: could not load spam archives: %v", err)
+		return
+	}
+	for _, f := range archives {
+		taxonomy, id, ok := parseTermSubject(f.Subject)
+		if !ok {
+			continue
+		}
+		term := fmt.Sprintf("%s %d (%s)", taxonomy, id, f.Title)
+		out, err := runWPCommand(ctx, []string{"term", "get", taxonomy, strconv.Itoa(id), "--field=count"})
+		if err != nil {
+			continue // already deleted
+		}
+		count := strings.TrimSpace(out)
+		if cleanupDryRun {
+			log.Printf("Would delete spam archive %s if no published posts remain (%s now).", term, count)
+			continue
+		}
+		if count != "0" {
+			log.Printf("Keeping %s: %s published post(s) are still assigned.", term, count)
+			continue
+		}
+		if _, err := runWPCommand(ctx, []string{"term", "delete", taxonomy, strconv.Itoa(id)}); err != nil {
+			log.Printf("Warning: could not delete %s: %v", term, err)
+			continue
+		}
+		log.Printf("Deleted empty spam archive %s.", term)
+	}
+}
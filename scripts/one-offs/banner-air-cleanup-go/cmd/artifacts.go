@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	artifactsList       bool
+	artifactsHoneytoken bool
+)
+
+var cleanupArtifactsCmd = &cobra.Command{
+	Use:   "cleanup-artifacts",
+	Short: "Remove everything the tool left in a site's container.",
+	Long: `Lists what the tool has written into each site's container and removes it,
+then lists again and fails if anything is left, so a client's environment is
+left as it was found:
+
+  workspace   a ` + workspacePrefix + `* directory holding uploaded
+              scripts (eval-file PHP, file lists), left behind when a run
+              was killed before it could remove it
+  mu-plugin   the ` + noindexPluginFile + ` mu-plugin installed by
+              "noindex --apply"
+  honeytoken  the marker page and option planted by "honeytoken plant", as
+              recorded in --store-path; only removed with --honeytoken, since
+              it is meant to stay between audits
+
+Run it when no scan is running against the container: a live run's workspace
+is removed too. The HubStack Companion mu-plugin is deployed with the site,
+not by this tool, and is left alone. With --list nothing is removed.
+
+Listing and removing run PHP inline with wp eval, so the command leaves no
+workspace of its own behind.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if artifactsHoneytoken && storePath == "" {
+			fatal("--store-path is required with --honeytoken.")
+		}
+		remaining := 0
+		forEachSite(func() {
+			remaining += runCleanupArtifacts()
+		})
+		if remaining > 0 && !artifactsList {
+			fatalf("%d artifact(s) could not be removed.", remaining)
+		}
+	},
+}
+
+func init() {
+	cleanupArtifactsCmd.Flags().BoolVar(&artifactsList, "list", false, "Only list the artifacts found.")
+	cleanupArtifactsCmd.Flags().BoolVar(&artifactsHoneytoken, "honeytoken", false, "Also remove the site's honeytoken and forget it in --store-path.")
+	rootCmd.AddCommand(cleanupArtifactsCmd)
+}
+
+// artifact is something the tool left in a site.
+type artifact struct {
+	Kind string // "workspace", "mu-plugin" or "honeytoken"
+	Name string
+}
+
+func (a artifact) String() string { return a.Kind + " " + a.Name }
+
+// runCleanupArtifacts lists and removes the current site's artifacts and
+// returns how many are left that should have been removed, or with --list
+// how many were found.
+func runCleanupArtifacts() int {
+	ctx := context.Background()
+	var h *Honeytoken
+	if storePath != "" {
+		db, err := openStoreReadOnly(storePath)
+		if err != nil {
+			fatalf("Failed to open store: %v", err)
+		}
+		h, err = loadHoneytoken(db, dockerContainer)
+		db.Close()
+		if err != nil {
+			fatalf("Failed to read honeytoken: %v", err)
+		}
+	}
+
+	found, err := findArtifacts(ctx, h)
+	if err != nil {
+		fatalf("Failed to list artifacts in %s: %v", dockerContainer, err)
+	}
+	if len(found) == 0 {
+		log.Printf("No tool artifacts in %s.", dockerContainer)
+		return 0
+	}
+	logArtifacts(fmt.Sprintf("Found %d tool artifact(s) in %s:", len(found), dockerContainer), found)
+	if artifactsList {
+		return len(found)
+	}
+
+	for _, a := range found {
+		switch a.Kind {
+		case "workspace":
+			(&Workspace{Container: dockerContainer, Dir: a.Name}).remove()
+		case "mu-plugin":
+			if _, err := runWPCommand(ctx, []string{"eval", removeNoindexPluginPHP}); err != nil {
+				log.Printf("Warning: could not remove %s from %s: %v", a.Name, dockerContainer, err)
+				continue
+			}
+			log.Printf("Removed %s from %s.", a.Name, dockerContainer)
+		}
+	}
+	if h != nil && artifactsHoneytoken {
+		runHoneytokenRemove()
+	}
+
+	left, err := findArtifacts(ctx, h)
+	if err != nil {
+		fatalf("Failed to list artifacts in %s after removing them: %v", dockerContainer, err)
+	}
+	var failed, kept []artifact
+	for _, a := range left {
+		if a.Kind == "honeytoken" && !artifactsHoneytoken {
+			kept = append(kept, a)
+			continue
+		}
+		failed = append(failed, a)
+	}
+	if len(kept) > 0 {
+		logArtifacts(fmt.Sprintf("Kept %d honeytoken artifact(s) in %s; use --honeytoken to remove them:", len(kept), dockerContainer), kept)
+	}
+	if len(failed) == 0 && len(kept) > 0 {
+		log.Printf("No other tool artifacts left in %s.", dockerContainer)
+		return 0
+	}
+	if len(failed) == 0 {
+		log.Printf("No tool artifacts left in %s.", dockerContainer)
+		return 0
+	}
+	logArtifacts(fmt.Sprintf("Warning: %d tool artifact(s) left in %s:", len(failed), dockerContainer), failed)
+	return len(failed)
+}
+
+// findArtifacts lists the workspaces and the noindex mu-plugin in the
+// container and, given the site's recorded honeytoken, whichever of its page
+// and option still exist.
+func findArtifacts(ctx context.Context, h *Honeytoken) ([]artifact, error) {
+	var found []artifact
+	// Simulated sites run wp-cli in process and have no file system.
+	if !simulate {
+		out, err := dockerExec(ctx, dockerContainer, "find", path.Dir(workspacePrefix), "-maxdepth", "1", "-name", path.Base(workspacePrefix)+"*")
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range strings.Fields(out) {
+			if strings.HasPrefix(dir, workspacePrefix) {
+				found = append(found, artifact{Kind: "workspace", Name: dir})
+			}
+		}
+		php := fmt.Sprintf(`$f = WPMU_PLUGIN_DIR . '/%s'; if (file_exists($f)) { echo $f; }`, noindexPluginFile)
+		out, err = runWPCommand(ctx, []string{"eval", php})
+		if err != nil {
+			return nil, fmt.Errorf("looking for the noindex mu-plugin: %w", err)
+		}
+		if plugin := strings.TrimSpace(out); plugin != "" {
+			found = append(found, artifact{Kind: "mu-plugin", Name: plugin})
+		}
+	}
+	if h == nil {
+		return found, nil
+	}
+	_, err := getMarkerPage(ctx, h.PostID)
+	switch {
+	case err == nil:
+		found = append(found, artifact{Kind: "honeytoken", Name: "page " + strconv.Itoa(h.PostID)})
+	case !errors.Is(err, errMarkerMissing):
+		return nil, fmt.Errorf("reading marker page %d: %w", h.PostID, err)
+	}
+	if _, ok, err := getMarkerOption(ctx, h.OptionName); err != nil {
+		return nil, fmt.Errorf("reading marker option %s: %w", h.OptionName, err)
+	} else if ok {
+		found = append(found, artifact{Kind: "honeytoken", Name: "option " + h.OptionName})
+	}
+	return found, nil
+}
+
+func logArtifacts(heading string, artifacts []artifact) {
+	log.Print(heading)
+	for _, a := range artifacts {
+		log.Printf("  %s", a)
+	}
+}
@@ -0,0 +1,356 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Attestations are in-toto v1 statements with a SLSA v1 provenance predicate,
+// signed as DSSE envelopes with an Ed25519 key, so they can also be checked
+// with standard tooling, e.g. cosign verify-blob-attestation --key.
+const (
+	inTotoStatementType  = "https://in-toto.io/Statement/v1"
+	slsaProvenanceType   = "https://slsa.dev/provenance/v1"
+	inTotoPayloadType    = "application/vnd.in-toto+json"
+	attestationBuildType = "https://github.com/ciwebgroup/wp-hubstack/banner-air-cleanup/run/v1"
+)
+
+var (
+	attestationKeyPath  string
+	attestKeygenOutput  string
+	attestVerifyKeyPath string
+)
+
+// attestationKey is the loaded --attestation-key, nil when runs are not
+// attested.
+var attestationKey ed25519.PrivateKey
+
+var attestCmd = &cobra.Command{
+	Use:   "attest",
+	Short: "Create keys for, and verify, signed attestations of run outputs.",
+	Long: `With --attestation-key, every run signs its outputs: next to the run
+manifest it writes NAME.intoto.jsonl, an in-toto statement listing the
+SHA-256 of the manifest and of every file the run wrote, with SLSA provenance
+(site, run tag, tool version, start and finish), signed with the key. A client
+holding the public key can then show that a report is the one the run
+produced and was not altered afterwards.
+
+  attest keygen --output attestation.key
+  banner-air-cleanup --attestation-key attestation.key ...
+  attest verify run-manifest.intoto.jsonl --public-key attestation.pub`,
+}
+
+var attestKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Create an Ed25519 signing key and its public key.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runAttestKeygen()
+	},
+}
+
+var attestVerifyCmd = &cobra.Command{
+	Use:   "verify ATTESTATION",
+	Short: "Check an attestation's signature and that its files are unchanged.",
+	Long: `Checks the signature of an attestation with --public-key, then hashes every
+file it lists and compares the result. Relative file names are resolved from
+the current directory, as they were written. Exits 1 when the signature is
+invalid or any file is missing or changed.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runAttestVerify(args[0])
+	},
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&attestationKeyPath, "attestation-key", "", "Ed25519 key (PEM, from \"attest keygen\") to sign an attestation of the run manifest and outputs with.")
+	attestKeygenCmd.Flags().StringVar(&attestKeygenOutput, "output", "attestation.key", "Where to write the signing key; the public key goes next to it as .pub.")
+	attestVerifyCmd.Flags().StringVar(&attestVerifyKeyPath, "public-key", "", "Public key (PEM) the attestation must be signed with.")
+	attestVerifyCmd.MarkFlagRequired("public-key")
+	attestCmd.AddCommand(attestKeygenCmd, attestVerifyCmd)
+	rootCmd.AddCommand(attestCmd)
+}
+
+// InTotoStatement is an in-toto v1 statement about the files in Subject.
+type InTotoStatement struct {
+	Type          string         `json:"_type"`
+	Subject       []AttestedFile `json:"subject"`
+	PredicateType string         `json:"predicateType"`
+	Predicate     SLSAProvenance `json:"predicate"`
+}
+
+type AttestedFile struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// SLSAProvenance is the part of SLSA v1 provenance a run can fill in.
+type SLSAProvenance struct {
+	BuildDefinition struct {
+		BuildType          string         `json:"buildType"`
+		ExternalParameters map[string]any `json:"externalParameters"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID      string            `json:"id"`
+			Version map[string]string `json:"version,omitempty"`
+		} `json:"builder"`
+		Metadata struct {
+			InvocationID string    `json:"invocationId"`
+			StartedOn    time.Time `json:"startedOn"`
+			FinishedOn   time.Time `json:"finishedOn"`
+		} `json:"metadata"`
+	} `json:"runDetails"`
+}
+
+// DSSEEnvelope is a signed in-toto statement.
+type DSSEEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     string          `json:"payload"`
+	Signatures  []DSSESignature `json:"signatures"`
+}
+
+type DSSESignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// attestationPath is where the attestation of a run manifest is written.
+func attestationPath(manifestPath string) string {
+	return strings.TrimSuffix(manifestPath, ".json") + ".intoto.jsonl"
+}
+
+func loadAttestationKey(path string) (ed25519.PrivateKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading attestation key: %w", err)
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s is not a PEM private key", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	ed, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 key", path)
+	}
+	return ed, nil
+}
+
+func loadAttestationPublicKey(path string) (ed25519.PublicKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading public key: %w", err)
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("%s is not a PEM public key", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	ed, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 key", path)
+	}
+	return ed, nil
+}
+
+// attestationKeyID identifies a key by the SHA-256 of its PKIX encoding.
+func attestationKeyID(pub ed25519.PublicKey) string {
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// dssePAE is DSSE's pre-authentication encoding, the bytes actually signed.
+func dssePAE(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+func hashFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// writeAttestation signs the manifest at manifestPath and the outputs it
+// lists, and writes the envelope next to the manifest.
+func writeAttestation(manifestPath string, manifest *RunManifest) (string, error) {
+	statement := InTotoStatement{Type: inTotoStatementType, PredicateType: slsaProvenanceType}
+	seen := map[string]bool{}
+	for _, path := range append([]string{manifestPath}, manifest.Outputs...) {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		digest, err := hashFile(path)
+		if err != nil {
+			return "", fmt.Errorf("hashing %s: %w", path, err)
+		}
+		statement.Subject = append(statement.Subject, AttestedFile{Name: path, Digest: map[string]string{"sha256": digest}})
+	}
+
+	p := &statement.Predicate
+	p.BuildDefinition.BuildType = attestationBuildType
+	p.BuildDefinition.ExternalParameters = map[string]any{
+		"site":    manifest.Site,
+		"run_tag": manifest.RunTag,
+		"profile": activeProfile.Name,
+		"args":    os.Args[1:],
+	}
+	p.RunDetails.Builder.ID = attestationBuildType
+	if info, ok := debug.ReadBuildInfo(); ok {
+		p.RunDetails.Builder.Version = map[string]string{"banner-air-cleanup": info.Main.Version, "go": info.GoVersion}
+	}
+	p.RunDetails.Metadata.InvocationID = manifest.RunTag
+	p.RunDetails.Metadata.StartedOn = manifest.StartedAt.UTC()
+	p.RunDetails.Metadata.FinishedOn = manifest.FinishedAt.UTC()
+
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		return "", err
+	}
+	pub := attestationKey.Public().(ed25519.PublicKey)
+	envelope := DSSEEnvelope{
+		PayloadType: inTotoPayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures: []DSSESignature{{
+			KeyID: attestationKeyID(pub),
+			Sig:   base64.StdEncoding.EncodeToString(ed25519.Sign(attestationKey, dssePAE(inTotoPayloadType, payload))),
+		}},
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return "", err
+	}
+	path := attestationPath(manifestPath)
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return "", fmt.Errorf("writing attestation %s: %w", path, err)
+	}
+	return path, nil
+}
+
+func runAttestKeygen() {
+	path := attestKeygenOutput
+	pubPath := strings.TrimSuffix(path, ".key") + ".pub"
+	for _, p := range []string{path, pubPath} {
+		if _, err := os.Stat(p); err == nil {
+			fatalf("%s already exists; refusing to overwrite a signing key.", p)
+		}
+	}
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		fatalf("Failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		fatalf("Failed to encode key: %v", err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		fatalf("Failed to write %s: %v", path, err)
+	}
+	if der, err = x509.MarshalPKIXPublicKey(pub); err != nil {
+		fatalf("Failed to encode public key: %v", err)
+	}
+	if err := os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o644); err != nil {
+		fatalf("Failed to write %s: %v", pubPath, err)
+	}
+	log.Printf("Wrote signing key to %s; keep it private and give %s to whoever verifies the reports.", path, pubPath)
+}
+
+func runAttestVerify(path string) {
+	pub, err := loadAttestationPublicKey(attestVerifyKeyPath)
+	if err != nil {
+		fatal(err)
+	}
+	statement, err := verifyAttestation(path, pub)
+	if err != nil {
+		fatalf("%s: %v", path, err)
+	}
+	meta := statement.Predicate.RunDetails.Metadata
+	log.Printf("Signature OK: run %s of %v, finished %s.", meta.InvocationID,
+		statement.Predicate.BuildDefinition.ExternalParameters["site"], meta.FinishedOn.Format(time.RFC3339))
+
+	failed := 0
+	for _, f := range statement.Subject {
+		digest, err := hashFile(f.Name)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			log.Printf("MISSING  %s", f.Name)
+			failed++
+		case err != nil:
+			log.Printf("ERROR    %s: %v", f.Name, err)
+			failed++
+		case digest != f.Digest["sha256"]:
+			log.Printf("CHANGED  %s", f.Name)
+			failed++
+		default:
+			log.Printf("OK       %s", f.Name)
+		}
+	}
+	if failed > 0 {
+		fatalf("%d of %d attested file(s) do not match.", failed, len(statement.Subject))
+	}
+}
+
+// verifyAttestation checks the envelope's signature with pub and returns the
+// statement it carries.
+func verifyAttestation(path string, pub ed25519.PublicKey) (*InTotoStatement, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var envelope DSSEEnvelope
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return nil, fmt.Errorf("parsing envelope: %w", err)
+	}
+	if envelope.PayloadType != inTotoPayloadType {
+		return nil, fmt.Errorf("payload type %q is not an in-toto statement", envelope.PayloadType)
+	}
+	payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("decoding payload: %w", err)
+	}
+	verified := false
+	for _, s := range envelope.Signatures {
+		sig, err := base64.StdEncoding.DecodeString(s.Sig)
+		if err == nil && ed25519.Verify(pub, dssePAE(envelope.PayloadType, payload), sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.New("no valid signature from this public key; the attestation was altered or signed with another key")
+	}
+	var statement InTotoStatement
+	if err := json.Unmarshal(payload, &statement); err != nil {
+		return nil, fmt.Errorf("parsing statement: %w", err)
+	}
+	if statement.Type != inTotoStatementType {
+		return nil, fmt.Errorf("statement type %q is not in-toto v1", statement.Type)
+	}
+	return &statement, nil
+}
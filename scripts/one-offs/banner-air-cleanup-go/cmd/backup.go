@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+)
+
+var (
+	backupCommand string
+	backupAfter   bool
+)
+
+// BackupContext is what a --backup-command template can refer to.
+type BackupContext struct {
+	Container string
+	Phase     string // "pre-cleanup" or "post-cleanup"
+}
+
+// expandBackupCommand fills in the --backup-command template for a phase.
+func expandBackupCommand(phase string) (string, error) {
+	tmpl, err := template.New("backup").Parse(backupCommand)
+	if err != nil {
+		return "", fmt.Errorf("parsing --backup-command: %w", err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, BackupContext{Container: dockerContainer, Phase: phase}); err != nil {
+		return "", fmt.Errorf("expanding --backup-command: %w", err)
+	}
+	return b.String(), nil
+}
+
+// runBackup runs --backup-command through the shell for the current site,
+// with the same environment as hooks, and fails unless it exits 0. As
+// backup commands always have, it also gets HUBSTACK_CONTAINER, and
+// HUBSTACK_PHASE is pre-cleanup or post-cleanup rather than the hook phase.
+func runBackup(ctx context.Context, phase string) error {
+	command, err := expandBackupCommand(phase)
+	if err != nil {
+		return err
+	}
+	log.Printf("Backing up %s (%s): %s", dockerContainer, phase, command)
+	when, _, _ := strings.Cut(phase, "-")
+	env := append(hookEnv(when, "ok"), "HUBSTACK_CONTAINER="+dockerContainer, "HUBSTACK_PHASE="+phase)
+	if err := runShell(ctx, command, env); err != nil {
+		return fmt.Errorf("backup command failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	tagPattern    = regexp.MustCompile(`<[^>]*>`)
+	numberPattern = regexp.MustCompile(`[0-9]+`)
+)
+
+// newAccountDays is how recently before a campaign an account must have been
+// registered to be guessed as created for it.
+const newAccountDays = 14
+
+// Campaign is a group of spam posts that share link domains or a content
+// template, most likely placed by the same actor in one operation.
+type Campaign struct {
+	Key         string
+	Domains     []string
+	Templates   []string
+	PostIDs     []int
+	Start, End  string
+	Authors     []*CampaignAuthor
+	EntryVector string
+}
+
+// CampaignAuthor is an account that published posts of a campaign.
+type CampaignAuthor struct {
+	ID         string
+	Login      string
+	Roles      []string
+	Registered string
+	IPs        []string
+	Posts      int
+}
+
+// contentTemplate fingerprints the text of a post with links, markup and
+// numbers removed, so posts generated from one template match even when
+// their links differ. Short content has no fingerprint.
+func contentTemplate(content string) string {
+	s := linkPattern.ReplaceAllString(content, " ")
+	s = tagPattern.ReplaceAllString(s, " ")
+	s = numberPattern.ReplaceAllString(strings.ToLower(s), "0")
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) < 40 {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:6])
+}
+
+// buildCampaigns groups spam posts that share an external link domain or a
+// content template. Posts that share neither with another post form
+// single-post campaigns only if they link off-site.
+func buildCampaigns(posts []Post) []*Campaign {
+	own := siteHosts(posts)
+	var flagged []Post
+	for _, p := range posts {
+		if p.AIClassification == "Spam" {
+			flagged = append(flagged, p)
+		}
+	}
+
+	parent := make([]int, len(flagged))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	domains := make([][]string, len(flagged))
+	templates := make([]string, len(flagged))
+	firstWith := make(map[string]int) // domain or template -> first post index
+	link := func(attr string, i int) {
+		if j, ok := firstWith[attr]; ok {
+			parent[find(i)] = find(j)
+		} else {
+			firstWith[attr] = i
+		}
+	}
+	for i, p := range flagged {
+		for _, d := range extractLinkDomains(p.Content) {
+			if !own[d] {
+				domains[i] = append(domains[i], d)
+				link("domain "+d, i)
+			}
+		}
+		if templates[i] = contentTemplate(p.Content); templates[i] != "" {
+			link("template "+templates[i], i)
+		}
+	}
+
+	groups := make(map[int][]int)
+	for i := range flagged {
+		groups[find(i)] = append(groups[find(i)], i)
+	}
+	var campaigns []*Campaign
+	for _, members := range groups {
+		c := &Campaign{}
+		seenDomain, templateCount := make(map[string]bool), make(map[string]int)
+		for _, i := range members {
+			p := flagged[i]
+			c.PostIDs = append(c.PostIDs, p.ID)
+			if c.Start == "" || p.Date < c.Start {
+				c.Start = p.Date
+			}
+			if p.Date > c.End {
+				c.End = p.Date
+			}
+			for _, d := range domains[i] {
+				if !seenDomain[d] {
+					seenDomain[d] = true
+					c.Domains = append(c.Domains, d)
+				}
+			}
+			if templates[i] != "" {
+				templateCount[templates[i]]++
+			}
+			c.addAuthor(p)
+		}
+		for t, n := range templateCount {
+			if n > 1 {
+				c.Templates = append(c.Templates, t)
+			}
+		}
+		if len(c.Domains) == 0 && len(c.Templates) == 0 {
+			continue
+		}
+		sort.Ints(c.PostIDs)
+		sort.Strings(c.Domains)
+		sort.Strings(c.Templates)
+		if len(c.Domains) > 0 {
+			c.Key = c.Domains[0]
+		} else {
+			c.Key = "template-" + c.Templates[0]
+		}
+		campaigns = append(campaigns, c)
+	}
+	sort.Slice(campaigns, func(i, j int) bool {
+		if campaigns[i].Start != campaigns[j].Start {
+			return campaigns[i].Start < campaigns[j].Start
+		}
+		return campaigns[i].Key < campaigns[j].Key
+	})
+	return campaigns
+}
+
+func (c *Campaign) addAuthor(p Post) {
+	for _, a := range c.Authors {
+		if a.ID == p.AuthorID {
+			a.Posts++
+			return
+		}
+	}
+	c.Authors = append(c.Authors, &CampaignAuthor{ID: p.AuthorID, Login: p.Author.Login, Roles: p.Author.Roles, Posts: 1})
+}
+
+// attributeCampaigns guesses how each campaign got in: through an account
+// registered shortly before it started, or an existing account whose
+// credentials were likely stolen. WordPress keeps no IP for posts, so IPs
+// come from the authors' current login sessions.
+func attributeCampaigns(ctx context.Context, campaigns []*Campaign) {
+	details := make(map[string]*CampaignAuthor)
+	for _, c := range campaigns {
+		for _, a := range c.Authors {
+			d, ok := details[a.ID]
+			if !ok {
+				d = &CampaignAuthor{}
+				if out, err := runWPCommand(ctx, []string{"user", "get", a.ID, "--field=user_registered"}); err == nil {
+					d.Registered = strings.TrimSpace(out)
+				}
+				d.IPs = sessionIPs(ctx, a.ID)
+				details[a.ID] = d
+			}
+			a.Registered, a.IPs = d.Registered, d.IPs
+		}
+		c.EntryVector = entryVector(c)
+	}
+}
+
+// sessionIPs returns the IPs of a user's active login sessions.
+func sessionIPs(ctx context.Context, userID string) []string {
+	out, err := runWPCommand(ctx, []string{"user", "meta", "get", userID, "session_tokens", "--format=json"})
+	if err != nil {
+		return nil
+	}
+	return parseSessionIPs(out)
+}
+
+// parseSessionIPs returns the IPs in a user's session_tokens meta as output
+// by wp user meta get --format=json.
+func parseSessionIPs(out string) []string {
+	if strings.TrimSpace(out) == "" {
+		return nil
+	}
+	var sessions map[string]struct {
+		IP string `json:"ip"`
+	}
+	if err := json.Unmarshal([]byte(out), &sessions); err != nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var ips []string
+	for _, s := range sessions {
+		if s.IP != "" && !seen[s.IP] {
+			seen[s.IP] = true
+			ips = append(ips, s.IP)
+		}
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+func entryVector(c *Campaign) string {
+	start, _ := time.Parse("2006-01-02 15:04:05", c.Start)
+	var guesses []string
+	for _, a := range c.Authors {
+		who := firstNonEmpty(a.Login, "user "+a.ID)
+		role := strings.Join(a.Roles, "/")
+		registered, err := time.Parse("2006-01-02 15:04:05", a.Registered)
+		var guess string
+		switch {
+		case err == nil && !start.IsZero() && start.Sub(registered) < newAccountDays*24*time.Hour:
+			guess = fmt.Sprintf("account %s (%s) registered %s, just before the campaign", who, role, a.Registered[:10])
+		case strings.Contains(role, "administrator"):
+			guess = fmt.Sprintf("existing administrator %s; credentials likely compromised", who)
+		default:
+			guess = fmt.Sprintf("existing %s account %s", firstNonEmpty(role, "user"), who)
+		}
+		if len(a.IPs) > 0 {
+			guess += " (sessions from " + strings.Join(a.IPs, ", ") + ")"
+		}
+		guesses = append(guesses, guess)
+	}
+	return strings.Join(guesses, "; ")
+}
+
+// campaignFindings turns campaigns into typed findings for the findings CSV
+// and the store.
+func campaignFindings(campaigns []*Campaign) []Finding {
+	var findings []Finding
+	for _, c := range campaigns {
+		indicators := append([]string(nil), c.Domains...)
+		if len(c.Templates) > 0 {
+			indicators = append(indicators, fmt.Sprintf("%d shared template(s)", len(c.Templates)))
+		}
+		findings = append(findings, Finding{
+			Site:           dockerContainer,
+			Type:           "spam-campaign",
+			Subject:        "campaign:" + c.Key,
+			PostID:         c.PostIDs[0],
+			Title:          fmt.Sprintf("%d post(s) from %s", len(c.PostIDs), c.Start),
+			Classification: "Spam",
+			Detail: fmt.Sprintf("%s to %s; indicators: %s; entry: %s", c.Start, c.End, strings.Join(indicators, ", "),
+				firstNonEmpty(c.EntryVector, "unknown")),
+		})
+	}
+	return findings
+}
+
+// runCampaignAnalysis groups the site's spam into campaigns and attributes
+// each to its likely entry point.
+func runCampaignAnalysis(ctx context.Context, posts []Post) []*Campaign {
+	campaigns := buildCampaigns(posts)
+	if len(campaigns) == 0 {
+		return nil
+	}
+	attributeCampaigns(ctx, campaigns)
+	for _, c := range campaigns {
+		log.Printf("Campaign %s: %d post(s) since %s; entry: %s", c.Key, len(c.PostIDs), c.Start, c.EntryVector)
+	}
+	return campaigns
+}
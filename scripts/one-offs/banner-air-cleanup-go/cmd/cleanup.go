@@ -0,0 +1,293 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cleanupWhere        string
+	cleanupDryRun       bool
+	cleanupForce        bool
+	cleanupBatchSize    int
+	cleanupBatchPause   time.Duration
+	cleanupPurgeCommand string
+)
+
+// cleanupSeverities orders cleanup batches: the worst findings go first, so
+// a window that closes early leaves only the less urgent ones.
+var cleanupSeverities = []string{"critical", "low", ""}
+
+var cleanupCmd = &cobra.Command{
+	Use:   "cleanup",
+	Short: "Remove posts whose findings were approved in review.",
+	Long: `Removes the posts of every finding in review state "approved" and marks the
+findings "cleaned". Posts whose content changed since the run that found them
+are skipped for re-review.
+
+How a post is removed depends on its classification and post type: by default
+posts and pages go to the trash (deleted permanently with --force) and
+products, when scans cover them with --post-types, are set back to draft. The
+"cleanup" rules of a --profile can pick trash, delete, draft, or a plugin's
+own wp-cli command per classification and post type, e.g. "wc product delete
+{{.ID}} --force=true --user=1" for products. Only the post types scans
+extract can have findings; comments are not scanned, so spam comments are
+left to WordPress's own moderation.
+
+Posts are deleted in batches of --batch-size, most severe first (Spam, then
+Uncertain, then anything else approved), with a --batch-pause between batches
+and --purge-command run after each, so the database, caches and any sync or
+webhook plugins see a steady trickle instead of one huge delete wave.
+
+Cleanup is destructive, so with --window it only runs inside the maintenance
+window and stops as soon as the window closes. With --backup-command, each
+site is backed up first, e.g. with the hubstack backup script, which exits
+non-zero when the container is not found or any step fails:
+
+  cleanup --backup-command 'scripts/server/backup.sh --container-name {{.Container}} --wp-db-export --backup-dir /var/opt/backup-tarballs'
+
+and a site whose backup fails is not touched. Use --sites to clean a fleet.
+
+Categories and tags found dominated by spam are left in place unless
+--delete-spam-terms is given; then each is deleted once cleanup has left it
+without published posts, so empty spam archives drop out of sitemaps.
+
+Redirection and Pretty Links rules found redirecting to spam are disabled,
+not deleted, with --disable-spam-redirects, or one at a time with
+--disable-redirect; review the spam-redirect findings first, since a rule
+can be a legitimate redirect to a domain the spam also links to.
+
+For teams that run mutations themselves, --emit-script cleanup.sh writes the
+wp-cli commands cleanup would run, each annotated with the post's title and
+classification, instead of running them.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if storePath == "" {
+			fatal("--store-path is required for cleanup.")
+		}
+		if err := validateRedirectNames(disableRedirects); err != nil {
+			fatal(err)
+		}
+		if backupCommand != "" {
+			if _, err := expandBackupCommand("pre-cleanup"); err != nil {
+				fatal(err)
+			}
+		} else if !cleanupDryRun && cleanupEmitScript == "" {
+			log.Printf("Warning: no --backup-command; cleanup runs without a backup.")
+		}
+		forEachSite(runCleanup)
+		if cleanupEmitScript != "" {
+			if err := writeCleanupScript(); err != nil {
+				fatalf("Failed to write %s: %v", cleanupEmitScript, err)
+			}
+			log.Printf("Wrote the cleanup commands to %s; nothing was changed.", cleanupEmitScript)
+		}
+	},
+}
+
+func init() {
+	cleanupCmd.Flags().StringVar(&cleanupWhere, "where", "", "Extra SQL filter over the approved findings, e.g. \"classification = 'Spam'\".")
+	cleanupCmd.Flags().BoolVar(&cleanupDryRun, "dry-run", false, "List the posts that would be deleted without changing anything.")
+	cleanupCmd.Flags().BoolVar(&cleanupForce, "force", false, "Delete posts permanently where they would otherwise be moved to the trash.")
+	cleanupCmd.Flags().IntVar(&cleanupBatchSize, "batch-size", 100, "Posts deleted per batch (0 for a single batch per severity).")
+	cleanupCmd.Flags().DurationVar(&cleanupBatchPause, "batch-pause", 30*time.Second, "Pause between batches.")
+	cleanupCmd.Flags().BoolVar(&cleanupSpamTerms, "delete-spam-terms", false, "After removing posts, delete categories and tags flagged as spam archives once no published posts remain in them.")
+	cleanupCmd.Flags().StringArrayVar(&disableRedirects, "disable-redirect", nil, "Disable a Redirection or Pretty Links rule, e.g. redirection:12 or pretty-links:5 as listed in spam-redirect findings. Repeatable.")
+	cleanupCmd.Flags().BoolVar(&disableSpamRedirects, "disable-spam-redirects", false, "Disable every redirect rule found redirecting to spam.")
+	cleanupCmd.Flags().StringVar(&backupCommand, "backup-command", "", "Shell command that backs up the site before cleanup, a template over {{.Container}} and {{.Phase}}; cleanup of a site is skipped unless it exits 0.")
+	cleanupCmd.Flags().BoolVar(&backupAfter, "backup-after", false, "Also run --backup-command after a site is cleaned.")
+	cleanupCmd.Flags().StringVar(&cleanupEmitScript, "emit-script", "", "Write the wp-cli commands cleanup would run to this shell script instead of running them.")
+	cleanupCmd.Flags().StringVar(&cleanupPurgeCommand, "purge-command", "cache flush", `wp-cli command run after each batch to purge caches, e.g. "rocket clean --confirm" (empty to skip).`)
+	rootCmd.AddCommand(cleanupCmd)
+}
+
+func runCleanup() {
+	ctx := context.Background()
+	if !cleanupDryRun && cleanupEmitScript == "" {
+		if err := checkWindow(time.Now()); err != nil {
+			log.Printf("Skipping cleanup of %s: %v", dockerContainer, err)
+			return
+		}
+	}
+
+	db, err := openStore(storePath)
+	if err != nil {
+		fatalf("Failed to open store: %v", err)
+	}
+	defer db.Close()
+
+	where := siteFilter(dockerContainer) + " AND review_state = 'approved'"
+	if strings.TrimSpace(cleanupWhere) != "" {
+		where += " AND (" + cleanupWhere + ")"
+	}
+	approved, err := queryFindings(db, where)
+	if err != nil {
+		fatalf("Failed to select approved findings: %v", err)
+	}
+	if cleanupEmitScript != "" {
+		emitCleanupCommands(ctx, approved)
+		return
+	}
+
+	// Deleting terms and disabling redirects are as destructive as removing
+	// posts, so the backup comes before any of them.
+	destructive := len(approved) > 0 || cleanupSpamTerms || disableSpamRedirects || len(disableRedirects) > 0
+	if backupCommand != "" && !cleanupDryRun && destructive {
+		if err := runBackup(ctx, "pre-cleanup"); err != nil {
+			log.Printf("Skipping cleanup of %s: %v", dockerContainer, err)
+			return
+		}
+	}
+
+	if len(approved) == 0 {
+		log.Printf("No approved findings to clean up on %s.", dockerContainer)
+		if cleanupSpamTerms {
+			cleanSpamArchives(ctx, db) // posts removed by an earlier cleanup may have emptied them
+		}
+		cleanRedirects(ctx, db)
+		return
+	}
+
+	// With the companion plugin, every post's hash is checked up front in
+	// one request instead of fetching each post's content.
+	var hashes map[int]string
+	if c, err := activeCompanion(ctx); err != nil && !cleanupDryRun {
+		fatal(err)
+	} else if !cleanupDryRun && c != nil {
+		if hashes, err = companionHashes(ctx, approved); err != nil {
+			log.Printf("Warning: could not hash posts through HubStack Companion; fetching them with wp-cli: %v", err)
+		}
+	}
+
+	var cleaned, skipped int
+	batches := cleanupBatches(approved, cleanupBatchSize)
+batches:
+	for i, batch := range batches {
+		severity := firstNonEmpty(findingSeverity(batch[0].AIClassification), "unflagged")
+		if cleanupDryRun {
+			log.Printf("Batch %d/%d (%s):", i+1, len(batches), severity)
+			for _, p := range batch {
+				log.Printf("Would %s %s %d (%s): %s", cleanupRule(p).describe(p), p.Type, p.ID, p.AIClassification, p.Title)
+			}
+			continue
+		}
+		if i > 0 && cleanupBatchPause > 0 {
+			log.Printf("Pausing %s before the next batch.", cleanupBatchPause)
+			time.Sleep(cleanupBatchPause)
+		}
+		log.Printf("Batch %d/%d: %d %s post(s) on %s.", i+1, len(batches), len(batch), severity, dockerContainer)
+
+		deleted := 0
+		for _, p := range batch {
+			if err := checkWindow(time.Now()); err != nil {
+				log.Printf("Stopping cleanup of %s: %v", dockerContainer, err)
+				purgeCaches(ctx, deleted)
+				break batches
+			}
+			hash, err := currentContentHash(ctx, p.ID, hashes)
+			if err != nil {
+				log.Printf("Warning: skipping post %d: %v", p.ID, err)
+				skipped++
+				continue
+			}
+			if p.ContentHash != "" && hash != p.ContentHash {
+				log.Printf("Warning: skipping post %d: %v.", p.ID, errContentChanged)
+				skipped++
+				continue
+			}
+
+			rule := cleanupRule(p)
+			if err := removePost(ctx, p, rule); errors.Is(err, errContentChanged) {
+				log.Printf("Warning: skipping post %d: %v.", p.ID, err)
+				skipped++
+				continue
+			} else if err != nil {
+				log.Printf("Warning: could not %s post %d: %v", rule.Method, p.ID, err)
+				skipped++
+				continue
+			}
+			if _, err := updateReview(db, dockerContainer, []int{p.ID}, "cleaned", ""); err != nil {
+				fatalf("Removed post %d (%s) but failed to mark it cleaned: %v", p.ID, rule.Method, err)
+			}
+			deleted++
+			cleaned++
+		}
+		purgeCaches(ctx, deleted)
+	}
+	if cleanupDryRun {
+		log.Printf("Dry run: %d post(s) on %s would be removed.", len(approved), dockerContainer)
+		if cleanupSpamTerms {
+			cleanSpamArchives(ctx, db)
+		}
+		cleanRedirects(ctx, db)
+		return
+	}
+	log.Printf("Cleaned %d of %d approved finding(s) on %s; %d skipped.", cleaned, len(approved), dockerContainer, skipped)
+	if checkWindow(time.Now()) == nil {
+		if cleanupSpamTerms {
+			cleanSpamArchives(ctx, db)
+		}
+		cleanRedirects(ctx, db)
+	}
+	if backupCommand != "" && backupAfter && cleaned > 0 {
+		if err := runBackup(ctx, "post-cleanup"); err != nil {
+			log.Printf("Warning: post-cleanup backup of %s failed: %v", dockerContainer, err)
+		}
+	}
+}
+
+// cleanupBatches groups posts by severity, most severe first, and splits
+// each group into batches of at most size posts.
+func cleanupBatches(posts []Post, size int) [][]Post {
+	var batches [][]Post
+	for _, severity := range cleanupSeverities {
+		var group []Post
+		for _, p := range posts {
+			if findingSeverity(p.AIClassification) == severity {
+				group = append(group, p)
+			}
+		}
+		for len(group) > 0 {
+			n := len(group)
+			if size > 0 {
+				n = min(n, size)
+			}
+			batches = append(batches, group[:n])
+			group = group[n:]
+		}
+	}
+	return batches
+}
+
+// purgeCaches runs --purge-command after a batch that deleted anything, so
+// cached pages stop serving the deleted posts.
+func purgeCaches(ctx context.Context, deleted int) {
+	if deleted == 0 || strings.TrimSpace(cleanupPurgeCommand) == "" {
+		return
+	}
+	if _, err := runWPCommand(ctx, strings.Fields(cleanupPurgeCommand)); err != nil {
+		log.Printf("Warning: cache purge %q failed: %v", cleanupPurgeCommand, err)
+	}
+}
+
+// currentContentHash hashes a post's content as it is now, from hashes when
+// the companion plugin supplied them and with wp-cli otherwise.
+func currentContentHash(ctx context.Context, id int, hashes map[int]string) (string, error) {
+	if hashes != nil {
+		hash, ok := hashes[id]
+		if !ok {
+			return "", errors.New("post no longer exists")
+		}
+		return hash, nil
+	}
+	content, err := runWPCommand(ctx, []string{"post", "get", strconv.Itoa(id), "--field=content"})
+	if err != nil {
+		return "", err
+	}
+	return contentHash(strings.TrimSpace(content)), nil
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cleanupEmitScript is the --emit-script path; the script collects every
+// site's commands and is written once all sites are done.
+var (
+	cleanupEmitScript string
+	cleanupScript     strings.Builder
+)
+
+// emitCleanupCommands appends the commands that would remove the site's
+// approved posts, batch by batch, in place of running them.
+func emitCleanupCommands(ctx context.Context, approved []Post) {
+	b := &cleanupScript
+	fmt.Fprintf(b, "\n# == %s: %d approved finding(s) ==\n", dockerContainer, len(approved))
+	var ids []string
+	batches := cleanupBatches(approved, cleanupBatchSize)
+	for i, batch := range batches {
+		if i > 0 && cleanupBatchPause > 0 {
+			fmt.Fprintf(b, "sleep %d\n", int(cleanupBatchPause.Seconds()))
+		}
+		severity := firstNonEmpty(findingSeverity(batch[0].AIClassification), "unflagged")
+		fmt.Fprintf(b, "\n# Batch %d/%d (%s)\n", i+1, len(batches), severity)
+		emitted := 0
+		for _, p := range batch {
+			args, err := cleanupRule(p).wpArgs(p)
+			if err != nil {
+				log.Printf("Warning: leaving post %d out of the script: %v", p.ID, err)
+				fmt.Fprintf(b, "# Skipped %s %d: %s\n", p.Type, p.ID, scriptComment(err.Error()))
+				continue
+			}
+			fmt.Fprintf(b, "# %s %s %d: %s\n", firstNonEmpty(p.AIClassification, "Unclassified"), p.Type, p.ID, scriptComment(p.Title))
+			fmt.Fprintln(b, shellCommand(wpCommandLine(ctx, args)))
+			ids = append(ids, strconv.Itoa(p.ID))
+			emitted++
+		}
+		if emitted > 0 && strings.TrimSpace(cleanupPurgeCommand) != "" {
+			fmt.Fprintln(b, shellCommand(wpCommandLine(ctx, strings.Fields(cleanupPurgeCommand))))
+		}
+	}
+	if len(ids) > 0 {
+		fmt.Fprintf(b, "\n# Once the commands above succeeded, record the cleanup:\n#   %s review set --container-name %s --store-path %s --post-id %s --state cleaned\n",
+			os.Args[0], shellQuote(dockerContainer), shellQuote(storePath), strings.Join(ids, ","))
+	}
+	log.Printf("Added %d post(s) on %s to %s.", len(ids), dockerContainer, cleanupEmitScript)
+}
+
+// writeCleanupScript writes the collected commands to --emit-script.
+func writeCleanupScript() error {
+	header := fmt.Sprintf(`#!/bin/sh
+# Cleanup commands generated by banner-air-cleanup at %s.
+#
+# Nothing has been changed yet: these are the wp-cli commands cleanup would
+# run, in order, for the findings approved in %s. Review them, then
+# run the script. It stops at the first command that fails.
+#
+# Unlike cleanup, the script does not check whether a post was edited since
+# it was reviewed, and ignores the maintenance window, so run it soon.
+# Spam archives and redirects are not included; run cleanup for those.
+set -eu
+`, time.Now().Format(time.RFC3339), storePath)
+	return os.WriteFile(cleanupEmitScript, []byte(header+cleanupScript.String()), 0o755)
+}
+
+var shellSafePattern = regexp.MustCompile(`^[\w@%+=:,./-]+$`)
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	if shellSafePattern.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellCommand renders docker arguments as a shell command line.
+func shellCommand(args []string) string {
+	quoted := make([]string, len(args)+1)
+	quoted[0] = "docker"
+	for i, a := range args {
+		quoted[i+1] = shellQuote(a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// scriptComment keeps a title on one comment line.
+func scriptComment(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
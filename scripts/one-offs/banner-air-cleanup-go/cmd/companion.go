@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Modes for --companion.
+const (
+	companionAuto    = "auto"    // use the plugin when a site has it
+	companionOff     = "off"     // always use wp-cli
+	companionRequire = "require" // fail when a site does not have it
+)
+
+// companionAPIVersion is the hubstack/v1 API this tool speaks; see
+// websites/mu-plugins/hubstack-companion.php.
+const companionAPIVersion = 1
+
+// companionBatch is how many posts are exported or hashed per request. The
+// plugin accepts up to 500.
+const companionBatch = 200
+
+var companionMode string
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&companionMode, "companion", companionAuto, "Use the HubStack Companion mu-plugin's REST endpoints for content export, hashing and deletes: auto (fall back to wp-cli where it is not installed), off or require.")
+}
+
+func validateCompanionMode(mode string) error {
+	switch mode {
+	case companionAuto, companionOff, companionRequire:
+		return nil
+	}
+	return fmt.Errorf("unknown --companion %q; expected auto, off or require", mode)
+}
+
+// CompanionStatus identifies the companion plugin installed on a site.
+type CompanionStatus struct {
+	Plugin     string `json:"plugin"`
+	Version    string `json:"version"`
+	APIVersion int    `json:"api_version"`
+}
+
+// errContentChanged is returned when the plugin refuses to remove a post
+// whose content no longer has the reviewed hash.
+var errContentChanged = errors.New("content changed since it was reviewed")
+
+// companionError is a REST error response from the plugin.
+type companionError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *companionError) Error() string {
+	return fmt.Sprintf("%s (HTTP %d): %s", e.Code, e.Status, e.Message)
+}
+
+var companions struct {
+	sync.Mutex
+	// byContainer holds nil for sites that were checked and have no usable
+	// plugin.
+	byContainer map[string]*CompanionStatus
+	// errs holds why a required plugin is not usable, by container.
+	errs map[string]error
+}
+
+// activeCompanion returns the current site's companion plugin, checking for
+// it on first use, or nil if the site does not have it or --companion is
+// off. With --companion=require a missing plugin is an error.
+func activeCompanion(ctx context.Context) (*CompanionStatus, error) {
+	if companionMode == companionOff {
+		return nil, nil
+	}
+	companions.Lock()
+	defer companions.Unlock()
+	if c, ok := companions.byContainer[dockerContainer]; ok {
+		return c, companions.errs[dockerContainer]
+	}
+	if companions.byContainer == nil {
+		companions.byContainer = make(map[string]*CompanionStatus)
+		companions.errs = make(map[string]error)
+	}
+	c, err := detectCompanion(ctx)
+	companions.byContainer[dockerContainer] = c
+	if err != nil {
+		if companionMode == companionRequire {
+			err = fmt.Errorf("HubStack Companion is required but not usable on %s: %w", dockerContainer, err)
+			companions.errs[dockerContainer] = err
+			return nil, err
+		}
+		log.Printf("HubStack Companion not usable on %s (%v); using wp-cli.", dockerContainer, err)
+	} else {
+		log.Printf("Using HubStack Companion %s on %s for content export, hashing and deletes.", c.Version, dockerContainer)
+	}
+	return c, nil
+}
+
+func detectCompanion(ctx context.Context) (*CompanionStatus, error) {
+	var status CompanionStatus
+	err := companionRequest(ctx, http.MethodGet, "/status", nil, &status)
+	var ce *companionError
+	if errors.As(err, &ce) && ce.Status == http.StatusNotFound {
+		return nil, errors.New("plugin not installed")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if status.APIVersion != companionAPIVersion {
+		return nil, fmt.Errorf("plugin %s speaks API version %d, expected %d", status.Version, status.APIVersion, companionAPIVersion)
+	}
+	return &status, nil
+}
+
+// companionRequestPHP dispatches one REST request inside WordPress with
+// rest_do_request, so it runs as wp-cli without any HTTP authentication.
+// The parameters are passed base64-encoded to keep them out of PHP quoting.
+const companionRequestPHP = `$request = new WP_REST_Request('%s', '/hubstack/v1%s');
+$params = json_decode(base64_decode('%s'), true);
+if ($request->get_method() === 'GET') {
+	$request->set_query_params($params);
+} else {
+	$request->set_body_params($params);
+}
+$response = rest_do_request($request);
+echo wp_json_encode(array(
+	'status' => $response->get_status(),
+	'data'   => rest_get_server()->response_to_data($response, false),
+));`
+
+// companionRequest calls a hubstack/v1 route and decodes its response into
+// out. Error responses are returned as a *companionError.
+func companionRequest(ctx context.Context, method, route string, params map[string]any, out any) error {
+	if params == nil {
+		params = map[string]any{}
+	}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	var output string
+	if simulate {
+		output, err = simulatedCompanion(method, route, params)
+	} else {
+		php := fmt.Sprintf(companionRequestPHP, method, route, base64.StdEncoding.EncodeToString(body))
+		output, err = runWPScript(ctx, "companion.php", php)
+	}
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Status int             `json:"status"`
+		Data   json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(output), &resp); err != nil {
+		return fmt.Errorf("parsing %s response: %w", route, err)
+	}
+	if resp.Status >= 300 {
+		ce := &companionError{Status: resp.Status}
+		var data struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(resp.Data, &data) == nil {
+			ce.Code, ce.Message = data.Code, data.Message
+		}
+		return ce
+	}
+	if err := json.Unmarshal(resp.Data, out); err != nil {
+		return fmt.Errorf("parsing %s response: %w", route, err)
+	}
+	return nil
+}
+
+// exportContent fetches the content of posts in bulk through the companion
+// plugin, in place of one wp post get per post. It returns nil if the site
+// has no plugin; posts missing from the result, e.g. after a failed batch,
+// are left to wp-cli. The error is activeCompanion's.
+func exportContent(ctx context.Context, posts []Post) (map[int]string, error) {
+	if c, err := activeCompanion(ctx); c == nil {
+		return nil, err
+	}
+	contents := make(map[int]string, len(posts))
+	for start := 0; start < len(posts); start += companionBatch {
+		batch := posts[start:min(start+companionBatch, len(posts))]
+		var exported []struct {
+			ID      int    `json:"id"`
+			Content string `json:"content"`
+		}
+		if err := companionRequest(ctx, http.MethodGet, "/export", map[string]any{"ids": joinIDs(batch)}, &exported); err != nil {
+			log.Printf("Warning: companion export of %d post(s) failed; fetching them with wp-cli: %v", len(batch), err)
+			continue
+		}
+		for _, p := range exported {
+			contents[p.ID] = p.Content
+		}
+	}
+	log.Printf("Exported content of %d post(s) through HubStack Companion.", len(contents))
+	return contents, nil
+}
+
+// companionHashes returns the current content hash of each of posts that
+// still exists, keyed by post ID.
+func companionHashes(ctx context.Context, posts []Post) (map[int]string, error) {
+	hashes := make(map[int]string, len(posts))
+	for start := 0; start < len(posts); start += companionBatch {
+		batch := posts[start:min(start+companionBatch, len(posts))]
+		var got map[string]string
+		if err := companionRequest(ctx, http.MethodGet, "/hashes", map[string]any{"ids": joinIDs(batch)}, &got); err != nil {
+			return nil, err
+		}
+		for id, hash := range got {
+			if n, err := strconv.Atoi(id); err == nil {
+				hashes[n] = hash
+			}
+		}
+	}
+	return hashes, nil
+}
+
+// companionRemove trashes, deletes or unpublishes a post through the plugin.
+// The plugin checks the content hash and removes the post in one request, so
+// an edit made after the check below cannot slip through.
+func companionRemove(ctx context.Context, p Post, method string) error {
+	params := map[string]any{"id": p.ID, "method": method, "expected_hash": p.ContentHash}
+	var done struct {
+		ID int `json:"id"`
+	}
+	err := companionRequest(ctx, http.MethodPost, "/delete", params, &done)
+	var ce *companionError
+	if errors.As(err, &ce) && ce.Code == "hubstack_content_changed" {
+		return errContentChanged
+	}
+	return err
+}
+
+func joinIDs(posts []Post) string {
+	ids := make([]string, len(posts))
+	for i, p := range posts {
+		ids[i] = strconv.Itoa(p.ID)
+	}
+	return strings.Join(ids, ",")
+}
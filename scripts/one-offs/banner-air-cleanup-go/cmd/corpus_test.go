@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite testdata/corpus.golden.json from the current heuristics")
+
+// corpusSiteGUID is the GUID given to every sample, so links to the sample
+// site's own host count as internal.
+const corpusSiteGUID = "https://www.hvac-site.test/?p=1"
+
+// corpusResult is what the heuristics make of one sample. The golden file
+// holds one per sample, keyed by its path under testdata/corpus.
+type corpusResult struct {
+	Classification string   `json:"classification"`
+	Justification  string   `json:"justification"`
+	LinkDomains    []string `json:"link_domains"`
+	Template       string   `json:"template"`
+	SmartExcerpt   string   `json:"smart_excerpt"`
+}
+
+// corpusExcerptLimit is small enough that most samples are cut, so the smart
+// AI input strategy is exercised too.
+const corpusExcerptLimit = 160
+
+func analyzeSample(content string) corpusResult {
+	post := Post{GUID: corpusSiteGUID, Content: content}
+	classifyHeuristically(&post)
+	domains := extractLinkDomains(content)
+	if domains == nil {
+		domains = []string{}
+	}
+	return corpusResult{
+		Classification: post.AIClassification,
+		Justification:  post.AIJustification,
+		LinkDomains:    domains,
+		Template:       contentTemplate(content),
+		SmartExcerpt:   prepareAIInput(content, corpusExcerptLimit, inputStrategySmart),
+	}
+}
+
+// TestCorpus runs the heuristics over the sample corpus. Each sample must get
+// the classification named by its directory, and every detail of the outcome
+// must match the golden file. After an intended change, review the diff of
+// `go test ./cmd -run TestCorpus -update`.
+func TestCorpus(t *testing.T) {
+	const dir = "testdata/corpus"
+	paths, err := filepath.Glob(filepath.Join(dir, "*", "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no samples in " + dir)
+	}
+
+	got := make(map[string]corpusResult)
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := filepath.ToSlash(strings.TrimPrefix(path, dir+string(filepath.Separator)))
+		got[name] = analyzeSample(strings.TrimSpace(string(content)))
+	}
+
+	const goldenPath = "testdata/corpus.golden.json"
+	if *updateGolden {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false) // samples are markup; keep the file reviewable
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(got); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(goldenPath, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	var want map[string]corpusResult
+	if err := json.Unmarshal(data, &want); err != nil {
+		t.Fatalf("parsing %s: %v", goldenPath, err)
+	}
+
+	for name, res := range got {
+		t.Run(name, func(t *testing.T) {
+			class := filepath.Dir(name)
+			if !strings.EqualFold(res.Classification, class) {
+				t.Errorf("classified %s, want %s: %s", res.Classification, class, res.Justification)
+			}
+			w, ok := want[name]
+			if !ok {
+				t.Fatalf("not in %s (run with -update to add it)", goldenPath)
+			}
+			gotJSON, _ := json.MarshalIndent(res, "", "  ")
+			wantJSON, _ := json.MarshalIndent(w, "", "  ")
+			if string(gotJSON) != string(wantJSON) {
+				t.Errorf("outcome changed\ngot:  %s\nwant: %s", gotJSON, wantJSON)
+			}
+		})
+	}
+	for name := range want {
+		if _, ok := got[name]; !ok {
+			t.Errorf("%s is in %s but its sample is gone (run with -update)", name, goldenPath)
+		}
+	}
+}
+
+// TestCorpusTemplates checks that samples generated from one template share a
+// fingerprint and that no others collide with them, since campaigns are built
+// on that fingerprint.
+func TestCorpusTemplates(t *testing.T) {
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join("testdata/corpus", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(string(data))
+	}
+	a := contentTemplate(read("spam/payday-loan-template-a.html"))
+	b := contentTemplate(read("spam/payday-loan-template-b.html"))
+	if a == "" || a != b {
+		t.Errorf("payday loan variants have templates %q and %q, want one shared fingerprint", a, b)
+	}
+	if other := contentTemplate(read("legitimate/financing-page.html")); other == a {
+		t.Errorf("financing page shares the payday loan template %q", a)
+	}
+}
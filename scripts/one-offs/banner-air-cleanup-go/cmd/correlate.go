@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// webmailDomains are shared by unrelated people, so a common address at one of
+// them says nothing about two accounts being coordinated.
+var webmailDomains = map[string]bool{
+	"gmail.com":      true,
+	"googlemail.com": true,
+	"yahoo.com":      true,
+	"hotmail.com":    true,
+	"outlook.com":    true,
+	"live.com":       true,
+	"msn.com":        true,
+	"aol.com":        true,
+	"icloud.com":     true,
+	"me.com":         true,
+	"protonmail.com": true,
+	"proton.me":      true,
+}
+
+var linkPattern = regexp.MustCompile(`(?i)https?://[^\s"'<>()\[\]]+`)
+
+// AuthorNode is one author in the correlation graph.
+type AuthorNode struct {
+	ID          string
+	Login       string
+	DisplayName string
+	Email       string
+	Posts       int
+	Flagged     int
+	X, Y        float64
+}
+
+// AuthorEdge links two authors that share an attribute.
+type AuthorEdge struct {
+	From, To string
+	Reasons  []string
+	X1, Y1   float64
+	X2, Y2   float64
+}
+
+// AuthorCluster is a connected group of linked authors.
+type AuthorCluster struct {
+	Authors []*AuthorNode
+	Posts   int
+	Flagged int
+}
+
+// AuthorGraph is the correlation data rendered in the report.
+type AuthorGraph struct {
+	Nodes    []*AuthorNode
+	Edges    []*AuthorEdge
+	Clusters []*AuthorCluster
+	Width    float64
+	Height   float64
+}
+
+// extractLinkDomains returns the unique, lower-cased hosts linked from content.
+func extractLinkDomains(content string) []string {
+	seen := make(map[string]struct{})
+	var domains []string
+	for _, raw := range linkPattern.FindAllString(content, -1) {
+		u, err := url.Parse(raw)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+		if _, ok := seen[host]; ok {
+			continue
+		}
+		seen[host] = struct{}{}
+		domains = append(domains, host)
+	}
+	return domains
+}
+
+// siteHosts returns the hosts the site itself is served from, derived from
+// post GUIDs, so internal links are not treated as shared external domains.
+func siteHosts(posts []Post) map[string]bool {
+	hosts := make(map[string]bool)
+	for _, p := range posts {
+		if u, err := url.Parse(p.GUID); err == nil && u.Hostname() != "" {
+			hosts[strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")] = true
+		}
+	}
+	return hosts
+}
+
+func emailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(email[at+1:]))
+}
+
+// buildAuthorGraph links authors that share a non-webmail email domain or link
+// to the same external domains. WordPress does not record an IP address for
+// post authors, so IPs are not part of the correlation.
+func buildAuthorGraph(posts []Post) *AuthorGraph {
+	own := siteHosts(posts)
+	nodes := make(map[string]*AuthorNode)
+	attrs := make(map[string]map[string]struct{}) // attribute -> author IDs
+
+	addAttr := func(attr, authorID string) {
+		if attrs[attr] == nil {
+			attrs[attr] = make(map[string]struct{})
+		}
+		attrs[attr][authorID] = struct{}{}
+	}
+
+	for _, p := range posts {
+		node, ok := nodes[p.AuthorID]
+		if !ok {
+			node = &AuthorNode{
+				ID:          p.AuthorID,
+				Login:       p.Author.Login,
+				DisplayName: p.Author.DisplayName,
+				Email:       p.Author.Email,
+			}
+			nodes[p.AuthorID] = node
+			if d := emailDomain(p.Author.Email); d != "" && !webmailDomains[d] {
+				addAttr("email domain "+d, p.AuthorID)
+			}
+		}
+		node.Posts++
+		if p.AIClassification == "Spam" {
+			node.Flagged++
+		}
+		for _, d := range extractLinkDomains(p.Content) {
+			if !own[d] {
+				addAttr("links to "+d, p.AuthorID)
+			}
+		}
+	}
+
+	edges := make(map[[2]string]*AuthorEdge)
+	for attr, members := range attrs {
+		if len(members) < 2 {
+			continue
+		}
+		ids := make([]string, 0, len(members))
+		for id := range members {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for i := 0; i < len(ids); i++ {
+			for j := i + 1; j < len(ids); j++ {
+				key := [2]string{ids[i], ids[j]}
+				if edges[key] == nil {
+					edges[key] = &AuthorEdge{From: ids[i], To: ids[j]}
+				}
+				edges[key].Reasons = append(edges[key].Reasons, attr)
+			}
+		}
+	}
+
+	graph := &AuthorGraph{}
+	for _, e := range edges {
+		sort.Strings(e.Reasons)
+		graph.Edges = append(graph.Edges, e)
+	}
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].From != graph.Edges[j].From {
+			return graph.Edges[i].From < graph.Edges[j].From
+		}
+		return graph.Edges[i].To < graph.Edges[j].To
+	})
+
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		graph.Nodes = append(graph.Nodes, nodes[id])
+	}
+
+	graph.Clusters = connectedClusters(graph.Nodes, graph.Edges)
+	layoutGraph(graph, nodes)
+	return graph
+}
+
+// connectedClusters groups linked authors; unlinked authors are left out.
+func connectedClusters(nodes []*AuthorNode, edges []*AuthorEdge) []*AuthorCluster {
+	parent := make(map[string]string)
+	var find func(string) string
+	find = func(id string) string {
+		if parent[id] == "" || parent[id] == id {
+			parent[id] = id
+			return id
+		}
+		parent[id] = find(parent[id])
+		return parent[id]
+	}
+	for _, e := range edges {
+		parent[find(e.From)] = find(e.To)
+	}
+
+	groups := make(map[string]*AuthorCluster)
+	for _, n := range nodes {
+		if _, linked := parent[n.ID]; !linked {
+			continue
+		}
+		root := find(n.ID)
+		if groups[root] == nil {
+			groups[root] = &AuthorCluster{}
+		}
+		groups[root].Authors = append(groups[root].Authors, n)
+		groups[root].Posts += n.Posts
+		groups[root].Flagged += n.Flagged
+	}
+
+	clusters := make([]*AuthorCluster, 0, len(groups))
+	for _, g := range groups {
+		clusters = append(clusters, g)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i].Authors) != len(clusters[j].Authors) {
+			return len(clusters[i].Authors) > len(clusters[j].Authors)
+		}
+		return clusters[i].Authors[0].ID < clusters[j].Authors[0].ID
+	})
+	return clusters
+}
+
+// layoutGraph places each cluster on its own circle, shelf-packing the circles
+// left to right so the SVG needs no client-side layout code.
+func layoutGraph(graph *AuthorGraph, nodes map[string]*AuthorNode) {
+	const maxWidth, pad = 960.0, 30.0
+	x, y, rowHeight := pad, pad, 0.0
+	graph.Width = maxWidth
+
+	for _, cluster := range graph.Clusters {
+		radius := 30 + 10*float64(len(cluster.Authors))
+		size := 2*radius + 2*pad
+		if x+size > maxWidth && x > pad {
+			x = pad
+			y += rowHeight
+			rowHeight = 0
+		}
+		cx, cy := x+size/2, y+size/2
+		for i, n := range cluster.Authors {
+			angle := 2 * math.Pi * float64(i) / float64(len(cluster.Authors))
+			n.X = cx + radius*math.Cos(angle)
+			n.Y = cy + radius*math.Sin(angle)
+		}
+		x += size
+		rowHeight = math.Max(rowHeight, size)
+	}
+	graph.Height = y + rowHeight + pad
+
+	for _, e := range graph.Edges {
+		from, to := nodes[e.From], nodes[e.To]
+		e.X1, e.Y1, e.X2, e.Y2 = from.X, from.Y, to.X, to.Y
+	}
+}
+
+// Label is the short name shown next to a node.
+func (n *AuthorNode) Label() string {
+	if n.Login != "" {
+		return n.Login
+	}
+	return fmt.Sprintf("user %s", n.ID)
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// newRunTag returns a short random ID for one run of one site. Together with
+// a post ID it forms the post's correlation ID.
+func newRunTag() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// correlationID identifies one post in one run, e.g. 9f3a0c1e-1234. It is
+// logged with every message about the post and written to its output row,
+// so a surprising row can be traced back with a single grep.
+func correlationID(runTag string, postID int) string {
+	return fmt.Sprintf("%s-%d", runTag, postID)
+}
+
+// ref names a post in log and error messages.
+func (p *Post) ref() string {
+	if p.CorrelationID == "" {
+		return fmt.Sprintf("post %d", p.ID)
+	}
+	return fmt.Sprintf("post %d [cid=%s]", p.ID, p.CorrelationID)
+}
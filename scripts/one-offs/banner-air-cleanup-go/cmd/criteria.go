@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ReportCriteria is the report's criteria appendix: the prompt, rules and
+// thresholds a run's classifications and findings were produced with, so
+// clients and auditors can see what standard was applied.
+type ReportCriteria struct {
+	Provider      string
+	Model         string
+	PromptHash    string
+	PromptSummary []string
+	Prompt        string
+	MaxInputChars int
+	InputStrategy string
+	Normalizers   []string
+	// Results counts the classified posts by the prompt and model that
+	// produced them; results loaded from the store may predate the prompt
+	// above.
+	Results    []CriteriaResult
+	Rules      []CriteriaRule
+	Compliance []CriteriaRule
+}
+
+// CriteriaResult is a prompt and model version and how many posts it
+// classified.
+type CriteriaResult struct {
+	PromptHash   string
+	ModelVersion string
+	Posts        int
+	// Current is whether PromptHash is the prompt shown in the appendix.
+	Current bool
+}
+
+// CriteriaRule is a named detection rule in plain words.
+type CriteriaRule struct {
+	Name string
+	Rule string
+}
+
+func newReportCriteria(posts []Post) *ReportCriteria {
+	c := &ReportCriteria{
+		Provider:      aiProvider,
+		Model:         activeVariant.Model,
+		PromptHash:    promptHash(),
+		PromptSummary: promptSummary(activeVariant.Prompt),
+		Prompt:        strings.TrimSpace(activeVariant.Prompt),
+		MaxInputChars: activeVariant.MaxInputChars,
+		InputStrategy: firstNonEmpty(activeVariant.InputStrategy, inputStrategyHead),
+		Normalizers:   activeVariant.Normalizers,
+	}
+
+	counts := make(map[CriteriaResult]int)
+	for _, p := range posts {
+		switch p.AIClassification {
+		case "", "N/A", "Error":
+			continue
+		}
+		counts[CriteriaResult{PromptHash: p.AIPromptHash, ModelVersion: p.AIModelVersion}]++
+	}
+	for r, n := range counts {
+		r.Posts = n
+		r.Current = r.PromptHash == c.PromptHash
+		c.Results = append(c.Results, r)
+	}
+	sort.Slice(c.Results, func(i, j int) bool {
+		if c.Results[i].Posts != c.Results[j].Posts {
+			return c.Results[i].Posts > c.Results[j].Posts
+		}
+		return c.Results[i].ModelVersion+c.Results[i].PromptHash < c.Results[j].ModelVersion+c.Results[j].PromptHash
+	})
+
+	c.Rules = []CriteriaRule{
+		{"Spam keywords", "Case-insensitive whole words matching " + spamKeywordPattern.String()},
+		{"Hidden markup", "Markup matching " + hiddenMarkupPattern.String()},
+		{"Local heuristics (" + heuristicsVersion + ")", "Used instead of AI with --offline. Scores 2 per distinct spam keyword and per hidden-markup marker, 1 for more than 3 external link domains, and 1 for links in the excerpt or SEO meta; Spam from 3, Uncertain from 1, Legitimate at 0."},
+		{"Excerpt and SEO meta", "The excerpt and Yoast or Rank Math title and description are flagged Spam when they mention a spam keyword, and Uncertain when they only contain hidden markup or links."},
+		{"Spam archives", fmt.Sprintf("A category or tag is flagged when at least %d of its analyzed posts are Spam and they make up %.0f%% of them; from %.0f%% it is classified Spam.",
+			spamArchiveMinPosts, spamArchiveUncertain*100, spamArchiveSpam*100)},
+		{"Campaigns", fmt.Sprintf("Spam posts are grouped when they link to the same external domain or share a content template. An account registered within %d days before a campaign started is guessed as its entry point.", newAccountDays)},
+	}
+
+	if p := activeIndustry; p != nil {
+		rule := "Adds the spam keywords " + strings.Join(p.Extra, ", ")
+		if len(p.Allowed) > 0 {
+			rule += " and no longer flags " + strings.Join(p.Allowed, ", ")
+		}
+		rule += ". Local heuristics score 1 more for content that links off-site without any of " + strings.Join(p.Expected, ", ") + "."
+		c.Rules = append(c.Rules, CriteriaRule{"Industry pack: " + p.Label, rule})
+	}
+
+	for _, name := range activeProfile.Compliance {
+		rule := complianceRules[name]
+		if file, ok := activeProfile.CompliancePrompts[name]; ok {
+			rule = "Custom prompt " + file
+		}
+		c.Compliance = append(c.Compliance, CriteriaRule{name, rule})
+	}
+	return c
+}
+
+// promptSummary picks the lines of a classification prompt that state what is
+// being judged: the opening instruction and the website context. Output
+// format rules and examples are left to the full prompt.
+func promptSummary(prompt string) []string {
+	var summary []string
+	inContext := false
+	for _, line := range strings.Split(prompt, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || line == "---":
+			continue
+		case strings.HasPrefix(line, "**"):
+			inContext = strings.Contains(strings.ToLower(line), "context")
+		case len(summary) == 0 || inContext:
+			summary = append(summary, line)
+		}
+	}
+	return summary
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	datasetOutput string
+	datasetFormat string
+	datasetWhere  string
+)
+
+var exportDatasetCmd = &cobra.Command{
+	Use:   "export-dataset",
+	Short: "Export human-verified findings as a JSONL fine-tuning dataset.",
+	Long: `Writes one JSONL line per human-verified finding in --store-path. A finding
+counts as verified, and gets its final label, from the first rule that applies:
+
+  a "label:<Classification>" tag     that classification
+  a "false-positive" tag             Legitimate
+  review state approved or cleaned   the stored AI classification
+
+Formats: plain ({content, label, justification, ...}), gemini (contents with
+user/model turns) and openai (chat messages). Chat formats use the active
+prompt template for the user turn, so the dataset matches what the pipeline
+sends today.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runExportDataset()
+	},
+}
+
+func init() {
+	exportDatasetCmd.Flags().StringVar(&datasetOutput, "output", "dataset.jsonl", "Output JSONL file.")
+	exportDatasetCmd.Flags().StringVar(&datasetFormat, "format", "plain", "Output format: plain, gemini or openai.")
+	exportDatasetCmd.Flags().StringVar(&datasetWhere, "where", "", "Optional SQL filter over the findings table.")
+	rootCmd.AddCommand(exportDatasetCmd)
+}
+
+// DatasetExample is a plain-format dataset line.
+type DatasetExample struct {
+	Content       string `json:"content"`
+	Label         string `json:"label"`
+	Justification string `json:"justification"`
+	Site          string `json:"site"`
+	PostID        int    `json:"post_id"`
+}
+
+// verifiedLabel returns the human-verified label of a finding, if it has one.
+func verifiedLabel(p Post) (string, bool) {
+	for _, tag := range p.Tags {
+		if label, ok := strings.CutPrefix(tag, "label:"); ok && label != "" {
+			return label, true
+		}
+	}
+	if slices.Contains(p.Tags, "false-positive") {
+		return "Legitimate", true
+	}
+	if p.ReviewState == "approved" || p.ReviewState == "cleaned" {
+		switch p.AIClassification {
+		case "", "N/A", "Error":
+			return "", false
+		}
+		return p.AIClassification, true
+	}
+	return "", false
+}
+
+func runExportDataset() {
+	if storePath == "" {
+		fatal("--store-path is required for export-dataset.")
+	}
+	if datasetFormat != "plain" && datasetFormat != "gemini" && datasetFormat != "openai" {
+		fatalf("Unknown --format %q; expected plain, gemini or openai.", datasetFormat)
+	}
+	db, err := openStoreReadOnly(storePath)
+	if err != nil {
+		fatalf("Failed to open store: %v", err)
+	}
+	defer db.Close()
+
+	posts, err := queryFindings(db, datasetWhere)
+	if err != nil {
+		fatalf("Failed to read findings: %v", err)
+	}
+
+	file, err := os.Create(datasetOutput)
+	if err != nil {
+		fatalf("Error creating %s: %v", datasetOutput, err)
+	}
+	defer file.Close()
+	enc := json.NewEncoder(file)
+
+	written := 0
+	labels := make(map[string]int)
+	for _, p := range posts {
+		label, ok := verifiedLabel(p)
+		if !ok {
+			continue
+		}
+		content := p.Content
+		if content == "" {
+			content = p.ContentExcerpt
+		}
+		justification := p.AIJustification
+		if !strings.EqualFold(label, p.AIClassification) {
+			justification = fmt.Sprintf("Reviewed by a human and labeled %s.", label)
+		}
+
+		if err := enc.Encode(datasetLine(datasetFormat, content, label, justification, p)); err != nil {
+			fatalf("Error writing %s: %v", datasetOutput, err)
+		}
+		written++
+		labels[label]++
+	}
+	log.Printf("Wrote %d labeled example(s) to %s: %v", written, datasetOutput, labels)
+}
+
+func datasetLine(format, content, label, justification string, p Post) any {
+	answer, _ := json.Marshal(AIResult{Classification: label, Justification: justification})
+	prompt := fmt.Sprintf("%s\n%s", activeVariant.Prompt, activeVariant.Input(content))
+	switch format {
+	case "gemini":
+		return map[string]any{"contents": []map[string]any{
+			{"role": "user", "parts": []map[string]string{{"text": prompt}}},
+			{"role": "model", "parts": []map[string]string{{"text": string(answer)}}},
+		}}
+	case "openai":
+		return map[string]any{"messages": []map[string]string{
+			{"role": "user", "content": prompt},
+			{"role": "assistant", "content": string(answer)},
+		}}
+	}
+	return DatasetExample{Content: content, Label: label, Justification: justification, Site: p.Site, PostID: p.ID}
+}
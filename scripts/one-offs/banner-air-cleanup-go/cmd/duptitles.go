@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Titles shorter than titleMinWords words are too generic to group, e.g.
+// "Services" or "Hello world!". Near-identical matching, where one word may
+// differ, needs titleFuzzyMinWords so "Contact us today" and "Call us
+// today" stay apart.
+const (
+	titleMinWords      = 3
+	titleFuzzyMinWords = 4
+)
+
+var titleNonWordPattern = regexp.MustCompile(`[^\pL\pN]+`)
+
+// TitleGroup is a set of posts whose titles are identical or differ in a
+// single word or in numbers, as auto-posted and scraped content usually is:
+// "Fast payday loans in Springfield", "Fast payday loans in Riverside".
+type TitleGroup struct {
+	Key             string
+	Titles          []string
+	PostIDs         []int
+	Start, End      string
+	Classifications map[string]int
+}
+
+// titleWords normalizes a title to lower-case words with numbers replaced by
+// 0, so titles differing only in case, punctuation or numbers match.
+func titleWords(title string) []string {
+	s := numberPattern.ReplaceAllString(strings.ToLower(title), "0")
+	return strings.Fields(titleNonWordPattern.ReplaceAllString(s, " "))
+}
+
+// buildTitleGroups groups posts by title alone, independent of their content:
+// scraped posts often share a title pattern while their text is rewritten.
+// A title matches another when they normalize to the same words, or have the
+// same number of words and differ in exactly one.
+func buildTitleGroups(posts []Post) []*TitleGroup {
+	parent := make([]int, len(posts))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	firstWith := make(map[string]int) // title or title pattern -> first post index
+	link := func(key string, i int) {
+		if j, ok := firstWith[key]; ok {
+			parent[find(i)] = find(j)
+		} else {
+			firstWith[key] = i
+		}
+	}
+	for i, p := range posts {
+		words := titleWords(p.Title)
+		if len(words) < titleMinWords {
+			continue
+		}
+		link(strings.Join(words, " "), i)
+		if len(words) < titleFuzzyMinWords {
+			continue
+		}
+		// One key per word position, with that word wildcarded, so titles
+		// that differ in one word share a key without comparing every pair.
+		for w := range words {
+			pattern := append(append(append([]string(nil), words[:w]...), "*"), words[w+1:]...)
+			link(strings.Join(pattern, " "), i)
+		}
+	}
+
+	members := make(map[int][]int)
+	for i, p := range posts {
+		if len(titleWords(p.Title)) >= titleMinWords {
+			members[find(i)] = append(members[find(i)], i)
+		}
+	}
+	var groups []*TitleGroup
+	for _, m := range members {
+		if len(m) < 2 {
+			continue
+		}
+		g := &TitleGroup{Classifications: make(map[string]int)}
+		seen := make(map[string]bool)
+		for _, i := range m {
+			p := posts[i]
+			g.PostIDs = append(g.PostIDs, p.ID)
+			if g.Start == "" || p.Date < g.Start {
+				g.Start = p.Date
+			}
+			if p.Date > g.End {
+				g.End = p.Date
+			}
+			if !seen[p.Title] {
+				seen[p.Title] = true
+				g.Titles = append(g.Titles, p.Title)
+			}
+			g.Classifications[firstNonEmpty(p.AIClassification, "Unclassified")]++
+		}
+		sort.Ints(g.PostIDs)
+		sort.Strings(g.Titles)
+		g.Key = strings.Join(titleWords(g.Titles[0]), "-")
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if len(groups[i].PostIDs) != len(groups[j].PostIDs) {
+			return len(groups[i].PostIDs) > len(groups[j].PostIDs)
+		}
+		return groups[i].Key < groups[j].Key
+	})
+	return groups
+}
+
+// classification is Spam when most of the group's posts are, and Uncertain
+// otherwise: a legitimate series such as "Weekly update 12" also matches.
+func (g *TitleGroup) classification() string {
+	if g.Classifications["Spam"]*2 > len(g.PostIDs) {
+		return "Spam"
+	}
+	return "Uncertain"
+}
+
+// titleGroupFindings turns title groups into typed findings for the findings
+// CSV and the store.
+func titleGroupFindings(groups []*TitleGroup) []Finding {
+	var findings []Finding
+	for _, g := range groups {
+		ids := make([]string, len(g.PostIDs))
+		for i, id := range g.PostIDs {
+			ids[i] = strconv.Itoa(id)
+		}
+		findings = append(findings, Finding{
+			Site:           dockerContainer,
+			Type:           "duplicate-titles",
+			Subject:        "titles:" + g.Key,
+			PostID:         g.PostIDs[0],
+			Title:          fmt.Sprintf("%d post(s) titled like %q", len(g.PostIDs), g.Titles[0]),
+			Classification: g.classification(),
+			Detail: fmt.Sprintf("%s to %s; %d distinct title(s); posts %s", g.Start, g.End, len(g.Titles),
+				strings.Join(ids, ", ")),
+		})
+	}
+	return findings
+}
+
+// runTitleAnalysis groups the site's posts by duplicate titles and logs the
+// groups found.
+func runTitleAnalysis(posts []Post) []*TitleGroup {
+	groups := buildTitleGroups(posts)
+	for _, g := range groups {
+		log.Printf("Duplicate titles %q: %d post(s) from %s to %s", g.Titles[0], len(g.PostIDs), g.Start, g.End)
+	}
+	return groups
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// envPrefix starts the environment variable for every flag, so the tool can
+// be configured entirely from a container or CronJob spec.
+const envPrefix = "HUBSTACK_"
+
+// envAliases are shorter names for commonly set flags.
+var envAliases = map[string]string{
+	"HUBSTACK_OUTPUT": "output-csv-path",
+	"HUBSTACK_REPORT": "report-html-path",
+	"HUBSTACK_STORE":  "store-path",
+}
+
+// flagEnvName returns the environment variable for a flag, e.g.
+// HUBSTACK_CONTAINER_NAME for --container-name.
+func flagEnvName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyEnv sets every flag not given on the command line from its
+// environment variable, or an alias of it. Flags on the command line win over
+// the environment, which wins over the defaults. Variables may also come from
+// .env.
+func applyEnv(cmd *cobra.Command) error {
+	_ = godotenv.Load()
+
+	aliases := make(map[string]string)
+	for env, flag := range envAliases {
+		aliases[flag] = env
+	}
+
+	var err error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || f.Name == "help" {
+			return
+		}
+		env := flagEnvName(f.Name)
+		value, ok := os.LookupEnv(env)
+		if !ok && aliases[f.Name] != "" {
+			env = aliases[f.Name]
+			value, ok = os.LookupEnv(env)
+		}
+		if !ok {
+			return
+		}
+		if setErr := cmd.Flags().Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid %s for --%s: %w", env, f.Name, setErr)
+		}
+	})
+	return err
+}
@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	evalSamplesPath string
+	evalPromptA     string
+	evalPromptB     string
+	evalModelA      string
+	evalModelB      string
+	evalOutputPath  string
+)
+
+var evalCmd = &cobra.Command{
+	Use:   "eval",
+	Short: "Compare two prompt templates or models on a labeled sample set.",
+	Long: `Classifies every sample in --samples with variant A and variant B and
+reports precision, recall and F1 for the Spam class, accuracy, and how often
+the two variants agree, so a prompt or model change can be measured before it
+is rolled out.
+
+The samples file is a CSV with a "label" column (Spam, Legitimate or
+Uncertain) and a "content" or "content_excerpt" column; an output CSV from a
+previous run with a label column added works as is. Prompt files replace the
+built-in template; the content is appended after the template.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runEval()
+	},
+}
+
+func init() {
+	evalCmd.Flags().StringVar(&evalSamplesPath, "samples", "", "Labeled samples CSV.")
+	evalCmd.Flags().StringVar(&evalPromptA, "prompt-a", "", "Prompt template file for variant A (default: built-in prompt).")
+	evalCmd.Flags().StringVar(&evalPromptB, "prompt-b", "", "Prompt template file for variant B (default: built-in prompt).")
+	evalCmd.Flags().StringVar(&evalModelA, "model-a", aiModel, "Model for variant A.")
+	evalCmd.Flags().StringVar(&evalModelB, "model-b", aiModel, "Model for variant B.")
+	evalCmd.Flags().StringVar(&evalOutputPath, "output", "", "Optional CSV of per-sample results.")
+	evalCmd.MarkFlagRequired("samples")
+	rootCmd.AddCommand(evalCmd)
+}
+
+// EvalSample is one labeled piece of content.
+type EvalSample struct {
+	Content string
+	Label   string
+}
+
+// EvalScore summarizes one variant's predictions against the labels.
+type EvalScore struct {
+	TruePositives  int
+	FalsePositives int
+	FalseNegatives int
+	Correct        int
+	Errors         int
+	Total          int
+}
+
+func (s EvalScore) Precision() float64 {
+	return ratio(s.TruePositives, s.TruePositives+s.FalsePositives)
+}
+func (s EvalScore) Recall() float64   { return ratio(s.TruePositives, s.TruePositives+s.FalseNegatives) }
+func (s EvalScore) Accuracy() float64 { return ratio(s.Correct, s.Total) }
+
+func (s EvalScore) F1() float64 {
+	p, r := s.Precision(), s.Recall()
+	if p+r == 0 {
+		return 0
+	}
+	return 2 * p * r / (p + r)
+}
+
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
+// score adds one prediction, treating Spam as the positive class.
+func (s *EvalScore) score(label, predicted string) {
+	s.Total++
+	if predicted == "Error" {
+		s.Errors++
+	}
+	if strings.EqualFold(label, predicted) {
+		s.Correct++
+	}
+	isSpam, predictedSpam := strings.EqualFold(label, "Spam"), strings.EqualFold(predicted, "Spam")
+	switch {
+	case isSpam && predictedSpam:
+		s.TruePositives++
+	case !isSpam && predictedSpam:
+		s.FalsePositives++
+	case isSpam && !predictedSpam:
+		s.FalseNegatives++
+	}
+}
+
+func runEval() {
+	ctx := context.Background()
+	samples, err := readEvalSamples(evalSamplesPath)
+	if err != nil {
+		fatalf("Failed to read samples: %v", err)
+	}
+	variantA, variantB := activeVariant, activeVariant
+	variantA.Model, variantA.Prompt = evalModelA, loadPromptTemplate(evalPromptA)
+	variantB.Model, variantB.Prompt = evalModelB, loadPromptTemplate(evalPromptB)
+	if variantA.Hash() == variantB.Hash() {
+		fatal("Variants A and B are identical; pass a different --prompt-b or --model-b.")
+	}
+
+	genaiClient, err := newAIClient(ctx)
+	if err != nil {
+		fatal(err)
+	}
+	var scoreA, scoreB EvalScore
+	agree := 0
+	var rows [][]string
+	for i, sample := range samples {
+		log.Printf("Evaluating sample %d/%d...", i+1, len(samples))
+		a := evalClassify(ctx, genaiClient, variantA, sample.Content)
+		b := evalClassify(ctx, genaiClient, variantB, sample.Content)
+		scoreA.score(sample.Label, a)
+		scoreB.score(sample.Label, b)
+		if a == b {
+			agree++
+		}
+		rows = append(rows, []string{fmt.Sprint(i + 1), sample.Label, a, b})
+	}
+
+	fmt.Printf("Samples: %d\n\n", len(samples))
+	fmt.Printf("%-8s %-18s %-22s %9s %9s %9s %9s %7s\n", "VARIANT", "PROMPT", "MODEL", "PRECISION", "RECALL", "F1", "ACCURACY", "ERRORS")
+	for _, v := range []struct {
+		name    string
+		variant AIVariant
+		score   EvalScore
+	}{{"A", variantA, scoreA}, {"B", variantB, scoreB}} {
+		fmt.Printf("%-8s %-18s %-22s %9.3f %9.3f %9.3f %9.3f %7d\n", v.name, v.variant.Hash(), v.variant.Model,
+			v.score.Precision(), v.score.Recall(), v.score.F1(), v.score.Accuracy(), v.score.Errors)
+	}
+	fmt.Printf("\nAgreement between A and B: %.3f (%d/%d)\n", ratio(agree, len(samples)), agree, len(samples))
+
+	if evalOutputPath != "" {
+		file, err := os.Create(evalOutputPath)
+		if err != nil {
+			fatalf("Error creating %s: %v", evalOutputPath, err)
+		}
+		defer file.Close()
+		writer := csv.NewWriter(file)
+		writer.Write([]string{"sample", "label", "variant_a", "variant_b"})
+		if err := writer.WriteAll(rows); err != nil {
+			fatalf("Error writing %s: %v", evalOutputPath, err)
+		}
+	}
+}
+
+func evalClassify(ctx context.Context, client AIClient, variant AIVariant, content string) string {
+	result, err := analyzeContentViaAI(ctx, client, variant, content)
+	time.Sleep(1 * time.Second) // Avoid hitting API rate limits
+	if err != nil {
+		log.Printf("Error classifying sample with %s: %v", variant.Model, err)
+		return "Error"
+	}
+	return result.Classification
+}
+
+// loadPromptTemplate reads a prompt template file, or returns the built-in
+// prompt when path is empty.
+func loadPromptTemplate(path string) string {
+	if path == "" {
+		return classificationPrompt
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fatalf("Failed to read prompt template %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func readEvalSamples(path string) ([]EvalSample, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("%s has no samples", path)
+	}
+	col := make(map[string]int)
+	for i, h := range records[0] {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	labelCol, ok := col["label"]
+	if !ok {
+		return nil, fmt.Errorf("%s has no label column", path)
+	}
+	contentCol, ok := col["content"]
+	if !ok {
+		if contentCol, ok = col["content_excerpt"]; !ok {
+			return nil, fmt.Errorf("%s has no content or content_excerpt column", path)
+		}
+	}
+
+	var samples []EvalSample
+	for _, rec := range records[1:] {
+		if strings.TrimSpace(rec[labelCol]) == "" {
+			continue
+		}
+		samples = append(samples, EvalSample{Content: rec[contentCol], Label: strings.TrimSpace(rec[labelCol])})
+	}
+	return samples, nil
+}
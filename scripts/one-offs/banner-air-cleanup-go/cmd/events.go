@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventType identifies a progress event.
+type EventType string
+
+const (
+	// PostFetched: a post's content was read from the site.
+	PostFetched EventType = "post_fetched"
+	// PostAnalyzed: a post was classified, by the AI, the offline heuristics
+	// or a reused stored result.
+	PostAnalyzed EventType = "post_analyzed"
+	// FindingCreated: the run produced a typed finding.
+	FindingCreated EventType = "finding_created"
+	// RunCompleted: a site's run finished and its manifest is final.
+	RunCompleted EventType = "run_completed"
+)
+
+// Event reports progress to a wrapper program's own main (see ExecuteArgs). Post,
+// Finding and Manifest are copies owned by the receiver.
+type Event struct {
+	Type     EventType
+	Time     time.Time
+	Site     string
+	RunTag   string
+	Post     *Post        // PostFetched, PostAnalyzed
+	Finding  *Finding     // FindingCreated
+	Manifest *RunManifest // RunCompleted
+}
+
+var subscribers struct {
+	sync.RWMutex
+	next int
+	fns  map[int]func(Event)
+}
+
+// Subscribe registers fn to receive every event until the returned function
+// is called. Workers emit concurrently and wait for fn to return, so fn must
+// be safe for concurrent use and quick.
+func Subscribe(fn func(Event)) (unsubscribe func()) {
+	subscribers.Lock()
+	defer subscribers.Unlock()
+	if subscribers.fns == nil {
+		subscribers.fns = make(map[int]func(Event))
+	}
+	id := subscribers.next
+	subscribers.next++
+	subscribers.fns[id] = fn
+	return func() {
+		subscribers.Lock()
+		delete(subscribers.fns, id)
+		subscribers.Unlock()
+	}
+}
+
+// Events returns a channel receiving every event, for applications that
+// prefer a channel to a callback. The channel must be drained: a full buffer
+// blocks the run until stop is called. stop unsubscribes and closes the
+// channel.
+func Events(buffer int) (events <-chan Event, stop func()) {
+	ch := make(chan Event, buffer)
+	done := make(chan struct{})
+	var mu sync.RWMutex // held for reading while sending, so close waits for senders
+	unsubscribe := Subscribe(func(e Event) {
+		mu.RLock()
+		defer mu.RUnlock()
+		select {
+		case <-done:
+		default:
+			select {
+			case ch <- e:
+			case <-done:
+			}
+		}
+	})
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			unsubscribe()
+			close(done)
+			mu.Lock()
+			close(ch)
+			mu.Unlock()
+		})
+	}
+}
+
+// emit sends an event about the current site to every subscriber.
+func emit(e Event) {
+	subscribers.RLock()
+	fns := make([]func(Event), 0, len(subscribers.fns))
+	for _, fn := range subscribers.fns {
+		fns = append(fns, fn)
+	}
+	subscribers.RUnlock()
+	if len(fns) == 0 {
+		return
+	}
+	e.Time = time.Now()
+	e.Site = dockerContainer
+	e.RunTag = runManifest.RunTag
+	for _, fn := range fns {
+		fn(e)
+	}
+}
+
+func emitPost(t EventType, post Post) {
+	emit(Event{Type: t, Post: &post})
+}
+
+// executed guards ExecuteArgs against a second call.
+var executed atomic.Bool
+
+// ExecuteArgs runs the tool with the given command-line arguments, as
+// Execute does with the process's own. It is a hook for a wrapper's main
+// that subscribes to events and then hands the process over to the tool, not
+// a library call: fatal errors exit the process, and flag values live in
+// package globals that are never reset, so it runs only once per process
+// and returns an error on any later call. Run the tool as a subprocess to
+// scan more than once.
+func ExecuteArgs(args []string) error {
+	if !executed.CompareAndSwap(false, true) {
+		return errors.New("ExecuteArgs can only run once per process")
+	}
+	rootCmd.SetArgs(args)
+	err := rootCmd.Execute()
+	runExitHooks()
+	return err
+}
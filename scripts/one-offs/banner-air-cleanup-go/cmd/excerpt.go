@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Excerpt strategies for --excerpt-strategy.
+const (
+	excerptChars     = "chars"
+	excerptSentences = "sentences"
+)
+
+// excerptLimit is how many characters of content the content_excerpt
+// column keeps.
+const excerptLimit = 300
+
+var excerptStrategy string
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&excerptStrategy, "excerpt-strategy", excerptChars, fmt.Sprintf("How content is cut to the %d-character content_excerpt: chars, or sentences to end at the last sentence that fits.", excerptLimit))
+}
+
+func validateExcerptStrategy(strategy string) error {
+	switch strategy {
+	case excerptChars, excerptSentences:
+		return nil
+	}
+	return fmt.Errorf("unknown --excerpt-strategy %q; expected chars or sentences", strategy)
+}
+
+// contentExcerpt cuts content to excerptLimit characters, never inside a
+// multi-byte character. With the sentences strategy it ends after the last
+// sentence that fits, falling back to a plain cut when even the first
+// sentence is too long.
+func contentExcerpt(content string) string {
+	runes := []rune(content)
+	if len(runes) <= excerptLimit {
+		return content
+	}
+	if excerptStrategy == excerptSentences {
+		if end := lastSentenceEnd(runes, excerptLimit); end > 0 {
+			return strings.TrimSpace(string(runes[:end])) + " ..."
+		}
+	}
+	return string(runes[:excerptLimit]) + "..."
+}
+
+// lastSentenceEnd returns the position just after the last sentence that
+// ends within the first limit runes, or 0 if none does. Latin terminators
+// only count before whitespace, markup or the end of the text; CJK ones need
+// nothing after them.
+func lastSentenceEnd(runes []rune, limit int) int {
+	for i := min(limit, len(runes)); i > 0; i-- {
+		switch runes[i-1] {
+		case '。', '！', '？':
+			return i
+		case '.', '!', '?', '…':
+			if i == len(runes) || unicode.IsSpace(runes[i]) || runes[i] == '<' {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+// validUTF8 replaces invalid UTF-8 with U+FFFD, so content cut or stored by
+// a misbehaving plugin cannot produce a file other tools refuse to open.
+func validUTF8(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+	return strings.ToValidUTF8(s, "\uFFFD")
+}
+
+// validRecord applies validUTF8 to every field of an output row.
+func validRecord(record []string) []string {
+	for i, v := range record {
+		record[i] = validUTF8(v)
+	}
+	return record
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+)
+
+// exitHooks undo side effects outside this process, such as files placed in
+// a container, and must run however the tool exits. log.Fatal skips deferred
+// calls, so fatal errors go through fatal/fatalf instead.
+var exitHooks struct {
+	sync.Mutex
+	hooks []*exitHook
+}
+
+type exitHook struct {
+	once sync.Once
+	fn   func()
+}
+
+func (h *exitHook) run() { h.once.Do(h.fn) }
+
+// onExit registers fn to run once when the process exits, normally or not.
+// It returns a function that runs fn early and unregisters it, so hooks
+// registered per site or per scan don't pile up in a long-running monitor.
+func onExit(fn func()) func() {
+	h := &exitHook{fn: fn}
+	exitHooks.Lock()
+	exitHooks.hooks = append(exitHooks.hooks, h)
+	exitHooks.Unlock()
+	return func() {
+		exitHooks.Lock()
+		exitHooks.hooks = slices.DeleteFunc(exitHooks.hooks, func(other *exitHook) bool { return other == h })
+		exitHooks.Unlock()
+		h.run()
+	}
+}
+
+// runExitHooks runs the registered hooks, most recent first.
+func runExitHooks() {
+	exitHooks.Lock()
+	hooks := exitHooks.hooks
+	exitHooks.hooks = nil
+	exitHooks.Unlock()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i].run()
+	}
+}
+
+func fatal(v ...any) {
+	log.Output(2, fmt.Sprint(v...))
+	runExitHooks()
+	os.Exit(1)
+}
+
+func fatalf(format string, v ...any) {
+	log.Output(2, fmt.Sprintf(format, v...))
+	runExitHooks()
+	os.Exit(1)
+}
+
+// handleSignals runs the exit hooks when the tool is interrupted or
+// terminated, e.g. by Ctrl-C or a Kubernetes pod shutdown.
+func handleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Printf("Received %s; cleaning up.", sig)
+		runExitHooks()
+		os.Exit(130)
+	}()
+}
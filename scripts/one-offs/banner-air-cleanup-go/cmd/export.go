@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportStorePath string
+	exportFormats   string
+	exportOutput    string
+	exportWhere     string
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Re-write reports from stored results without touching the site.",
+	Long: `Re-runs only the export phase: reads the results accumulated in a store and
+writes them in the requested formats, so changing report formats or templates
+needs no new extraction or AI analysis. For example:
+
+  export --from-store results.db --format html,xlsx --output reports/results
+
+writes reports/results.html and reports/results.xlsx. A store holding several
+sites gets one set of files per site, prefixed with the container name,
+unless --container-name picks one. Templates from --report-template apply as
+in a normal run. Campaigns are regrouped from the stored content; the
+creation-rate table needs the live site and is left out.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runExport(cmd.Flags().Changed("container-name"))
+	},
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&exportStorePath, "from-store", "", "SQLite results store to export from.")
+	exportCmd.Flags().StringVar(&exportFormats, "format", "html", "Comma-separated output formats: csv, json, html, xlsx.")
+	exportCmd.Flags().StringVar(&exportOutput, "output", "results", "Output path without extension; each format adds its own.")
+	exportCmd.Flags().StringVar(&exportWhere, "where", "", "SQL filter over the findings table.")
+	exportCmd.MarkFlagRequired("from-store")
+	rootCmd.AddCommand(exportCmd)
+}
+
+func runExport(oneSite bool) {
+	formats := strings.Split(exportFormats, ",")
+	for i, format := range formats {
+		formats[i] = strings.TrimSpace(format)
+		switch formats[i] {
+		case "csv", "json", "html", "xlsx":
+		default:
+			fatalf("Unsupported export format %q.", formats[i])
+		}
+	}
+
+	db, err := openStoreReadOnly(exportStorePath)
+	if err != nil {
+		fatalf("Failed to open store: %v", err)
+	}
+	defer db.Close()
+
+	sites := []string{dockerContainer}
+	if !oneSite {
+		if sites, err = queryStrings(db, `SELECT DISTINCT site FROM findings ORDER BY site`); err != nil {
+			fatalf("Failed to list sites: %v", err)
+		}
+	}
+	if len(sites) == 0 {
+		fatalf("Store %s has no results to export.", exportStorePath)
+	}
+
+	for _, site := range sites {
+		base := exportOutput
+		if len(sites) > 1 {
+			base = sitePath(exportOutput, site)
+		}
+		data, err := storedReportData(db, site, exportWhere)
+		if err != nil {
+			fatalf("Failed to load %s from the store: %v", site, err)
+		}
+		for _, format := range formats {
+			path := base + "." + format
+			if err := writeExport(path, format, data); err != nil {
+				fatalf("Failed to write %s: %v", path, err)
+			}
+			log.Printf("Wrote %d %s result(s) to %s", len(data.Posts), site, path)
+			if format != "html" {
+				continue
+			}
+			extra, err := writeExtraReports(path, data)
+			for _, p := range extra {
+				log.Printf("Wrote report to %s", p)
+			}
+			if err != nil {
+				fatalf("Failed to write report: %v", err)
+			}
+		}
+	}
+}
+
+// storedReportData rebuilds a site's report model from the store.
+func storedReportData(db *sql.DB, site, where string) (*ReportData, error) {
+	filter := siteFilter(site)
+	postFilter := filter
+	if strings.TrimSpace(where) != "" {
+		postFilter = "(" + where + ") AND " + filter
+	}
+	posts, err := queryFindings(db, postFilter)
+	if err != nil {
+		return nil, err
+	}
+	findings, err := queryTypedFindings(db, filter)
+	if err != nil {
+		return nil, err
+	}
+	data := newReportData(posts)
+	data.Container = site
+	data.Findings = findings
+	data.Campaigns = buildCampaigns(posts)
+	return data, nil
+}
+
+func writeExport(path, format string, data *ReportData) error {
+	if format == "csv" || format == "xlsx" {
+		_, err := writeTable(path, format, csvHeaders, postRecords(data.Posts))
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if format == "html" {
+		err = renderHTMLReport(file, data)
+	} else {
+		err = writePosts(file, format, data.Posts)
+	}
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var findingsCSVPath string
+
+// Finding is a problem other than the per-post spam classification, e.g. a
+// compliance violation or a hidden admin page. Type names the analyzer that
+// produced it; Subject identifies what it is about, unique per site and type.
+type Finding struct {
+	Site           string
+	Type           string
+	Subject        string
+	PostID         int
+	Title          string
+	Classification string
+	Detail         string
+	PromptHash     string
+	ModelVersion   string
+}
+
+var findingCSVHeaders = []string{"site", "type", "subject", "post_id", "title", "classification", "detail", "prompt_hash", "model_version"}
+
+func postSubject(postID int) string {
+	return "post:" + strconv.Itoa(postID)
+}
+
+// collectFindings gathers the typed findings attached to posts, sorted by
+// type and subject.
+func collectFindings(posts []Post) []Finding {
+	var findings []Finding
+	for _, p := range posts {
+		findings = append(findings, p.Findings...)
+	}
+	sortFindings(findings)
+	return findings
+}
+
+func sortFindings(findings []Finding) {
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].Type != findings[j].Type {
+			return findings[i].Type < findings[j].Type
+		}
+		return findings[i].Subject < findings[j].Subject
+	})
+}
+
+func writeFindingsCSV(path string, findings []Finding) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating findings file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write(findingCSVHeaders); err != nil {
+		return err
+	}
+	for _, f := range findings {
+		if err := writer.Write(validRecord([]string{f.Site, f.Type, f.Subject, strconv.Itoa(f.PostID), f.Title,
+			f.Classification, f.Detail, f.PromptHash, f.ModelVersion})); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// saveTypedFindings upserts a run's typed findings, keeping when each was
+// first seen.
+func saveTypedFindings(db *sql.DB, runID int64, findings []Finding) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO typed_findings (site, type, subject, post_id, title, classification,
+		detail, prompt_hash, model_version, run_id, first_seen, last_seen)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (site, type, subject) DO UPDATE SET
+			post_id = excluded.post_id,
+			title = excluded.title,
+			classification = excluded.classification,
+			detail = excluded.detail,
+			prompt_hash = excluded.prompt_hash,
+			model_version = excluded.model_version,
+			run_id = excluded.run_id,
+			last_seen = excluded.last_seen`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, f := range findings {
+		if _, err := stmt.Exec(f.Site, f.Type, f.Subject, f.PostID, f.Title, f.Classification,
+			f.Detail, f.PromptHash, f.ModelVersion, runID, now, now); err != nil {
+			return fmt.Errorf("saving %s finding %s: %w", f.Type, f.Subject, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// queryTypedFindings returns stored typed findings matching an optional SQL
+// filter.
+func queryTypedFindings(db *sql.DB, where string) ([]Finding, error) {
+	query := `SELECT site, type, subject, post_id, title, classification, detail, prompt_hash, model_version
+		FROM typed_findings`
+	if strings.TrimSpace(where) != "" {
+		query += " WHERE " + where
+	}
+	query += " ORDER BY site, type, subject"
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("querying typed findings: %w", err)
+	}
+	defer rows.Close()
+
+	var findings []Finding
+	for rows.Next() {
+		var f Finding
+		if err := rows.Scan(&f.Site, &f.Type, &f.Subject, &f.PostID, &f.Title, &f.Classification,
+			&f.Detail, &f.PromptHash, &f.ModelVersion); err != nil {
+			return nil, err
+		}
+		findings = append(findings, f)
+	}
+	return findings, rows.Err()
+}
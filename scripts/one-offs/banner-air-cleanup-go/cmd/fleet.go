@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	fleetSince    time.Duration
+	fleetMinSites int
+)
+
+var fleetCampaignsCmd = &cobra.Command{
+	Use:   "fleet-campaigns",
+	Short: "Find spam campaigns that hit several sites in the store.",
+	Long: `Correlates the campaigns recorded by every site that writes to the same
+--store-path. Campaigns on different sites that link to the same domain or
+share a content template are reported together, most widespread first, so a
+campaign hitting many clients can be handled once across the fleet.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runFleetCampaigns()
+	},
+}
+
+func init() {
+	fleetCampaignsCmd.Flags().DurationVar(&fleetSince, "since", 90*24*time.Hour, "Only consider campaigns seen within this long ago.")
+	fleetCampaignsCmd.Flags().IntVar(&fleetMinSites, "min-sites", 2, "Only report campaigns seen on at least this many sites.")
+	rootCmd.AddCommand(fleetCampaignsCmd)
+}
+
+// indicators returns what identifies a campaign across sites.
+func (c *Campaign) indicators() []string {
+	var indicators []string
+	for _, d := range c.Domains {
+		indicators = append(indicators, "domain:"+d)
+	}
+	for _, t := range c.Templates {
+		indicators = append(indicators, "template:"+t)
+	}
+	return indicators
+}
+
+// saveCampaigns records a run's campaigns and their indicators.
+func saveCampaigns(db *sql.DB, runID int64, campaigns []*Campaign) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO campaign_indicators (site, campaign, indicator, posts, started,
+		run_id, first_seen, last_seen)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (site, campaign, indicator) DO UPDATE SET
+			posts = excluded.posts,
+			started = excluded.started,
+			run_id = excluded.run_id,
+			last_seen = excluded.last_seen`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, c := range campaigns {
+		for _, indicator := range c.indicators() {
+			if _, err := stmt.Exec(dockerContainer, c.Key, indicator, len(c.PostIDs), c.Start, runID, now, now); err != nil {
+				return fmt.Errorf("saving campaign %s: %w", c.Key, err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// SiteCampaign is one site's view of a fleet campaign.
+type SiteCampaign struct {
+	Site, Campaign string
+	Posts          int
+	Started        string
+	Indicators     []string
+}
+
+// FleetCampaign is a campaign seen on several sites.
+type FleetCampaign struct {
+	Sites      []*SiteCampaign
+	Shared     []string // indicators seen on more than one site
+	Posts      int
+	FirstSite  string
+	FirstStart string
+}
+
+// correlateCampaigns joins site campaigns that share an indicator.
+func correlateCampaigns(siteCampaigns []*SiteCampaign, minSites int) []*FleetCampaign {
+	parent := make([]int, len(siteCampaigns))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	first := make(map[string]int)
+	sitesWith := make(map[string]map[string]bool)
+	for i, sc := range siteCampaigns {
+		for _, ind := range sc.Indicators {
+			if j, ok := first[ind]; ok {
+				parent[find(i)] = find(j)
+			} else {
+				first[ind] = i
+			}
+			if sitesWith[ind] == nil {
+				sitesWith[ind] = make(map[string]bool)
+			}
+			sitesWith[ind][sc.Site] = true
+		}
+	}
+
+	groups := make(map[int][]*SiteCampaign)
+	for i, sc := range siteCampaigns {
+		groups[find(i)] = append(groups[find(i)], sc)
+	}
+	var fleet []*FleetCampaign
+	for _, members := range groups {
+		sites := make(map[string]bool)
+		fc := &FleetCampaign{Sites: members}
+		shared := make(map[string]bool)
+		for _, sc := range members {
+			sites[sc.Site] = true
+			fc.Posts += sc.Posts
+			if fc.FirstStart == "" || sc.Started < fc.FirstStart {
+				fc.FirstStart, fc.FirstSite = sc.Started, sc.Site
+			}
+			for _, ind := range sc.Indicators {
+				if len(sitesWith[ind]) > 1 {
+					shared[ind] = true
+				}
+			}
+		}
+		if len(sites) < minSites {
+			continue
+		}
+		for ind := range shared {
+			fc.Shared = append(fc.Shared, ind)
+		}
+		sort.Strings(fc.Shared)
+		sort.Slice(fc.Sites, func(i, j int) bool { return fc.Sites[i].Started < fc.Sites[j].Started })
+		fleet = append(fleet, fc)
+	}
+	sort.Slice(fleet, func(i, j int) bool {
+		if a, b := fleet[i].siteCount(), fleet[j].siteCount(); a != b {
+			return a > b
+		}
+		if fleet[i].Posts != fleet[j].Posts {
+			return fleet[i].Posts > fleet[j].Posts
+		}
+		return fleet[i].FirstStart < fleet[j].FirstStart
+	})
+	return fleet
+}
+
+func (fc *FleetCampaign) siteCount() int {
+	sites := make(map[string]bool)
+	for _, sc := range fc.Sites {
+		sites[sc.Site] = true
+	}
+	return len(sites)
+}
+
+func loadSiteCampaigns(db *sql.DB, since time.Time) ([]*SiteCampaign, error) {
+	rows, err := db.Query(`SELECT site, campaign, indicator, posts, started FROM campaign_indicators
+		WHERE last_seen >= ? ORDER BY site, campaign, indicator`, since.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("loading campaigns: %w", err)
+	}
+	defer rows.Close()
+
+	var campaigns []*SiteCampaign
+	var current *SiteCampaign
+	for rows.Next() {
+		var site, campaign, indicator, started string
+		var posts int
+		if err := rows.Scan(&site, &campaign, &indicator, &posts, &started); err != nil {
+			return nil, err
+		}
+		if current == nil || current.Site != site || current.Campaign != campaign {
+			current = &SiteCampaign{Site: site, Campaign: campaign, Posts: posts, Started: started}
+			campaigns = append(campaigns, current)
+		}
+		current.Indicators = append(current.Indicators, indicator)
+	}
+	return campaigns, rows.Err()
+}
+
+func runFleetCampaigns() {
+	if storePath == "" {
+		fatal("--store-path is required for fleet-campaigns.")
+	}
+	db, err := openStoreReadOnly(storePath)
+	if err != nil {
+		fatalf("Failed to open store: %v", err)
+	}
+	defer db.Close()
+
+	siteCampaigns, err := loadSiteCampaigns(db, time.Now().Add(-fleetSince))
+	if err != nil {
+		fatalf("Failed to load campaigns: %v", err)
+	}
+	fleet := correlateCampaigns(siteCampaigns, fleetMinSites)
+	if len(fleet) == 0 {
+		fmt.Printf("No campaign was seen on %d or more sites.\n", fleetMinSites)
+		return
+	}
+	for i, fc := range fleet {
+		fmt.Printf("Campaign %d: %d site(s), %d post(s), first seen %s on %s\n",
+			i+1, fc.siteCount(), fc.Posts, fc.FirstStart, fc.FirstSite)
+		fmt.Printf("  shared: %s\n", strings.Join(fc.Shared, ", "))
+		for _, sc := range fc.Sites {
+			fmt.Printf("  %-24s %-28s %5d post(s) since %s\n", sc.Site, sc.Campaign, sc.Posts, sc.Started)
+		}
+		fmt.Println()
+	}
+}
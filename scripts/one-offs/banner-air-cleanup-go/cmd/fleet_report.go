@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+//go:embed templates/fleet.html.tmpl
+var fleetHTMLTemplate string
+
+var (
+	fleetMonth  string
+	fleetFormat string
+	fleetOutput string
+)
+
+var fleetCmd = &cobra.Command{
+	Use:   "fleet",
+	Short: "Summarize every site in the store.",
+}
+
+var fleetReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Roll the store up into a fleet-wide executive summary.",
+	Long: `Aggregates every site that writes to --store-path into one summary for
+--month: how many sites were scanned, how many have active infections, and how
+much spam was removed. A site counts as infected when its latest scan still
+found Spam that has not been cleaned. Removed spam is counted by the month its
+finding was marked cleaned; reinfections by the month they were last seen.
+
+The summary is printed as text, or written as JSON or a standalone HTML page
+with --format and --output.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runFleetReport()
+	},
+}
+
+func init() {
+	fleetReportCmd.Flags().StringVar(&fleetMonth, "month", "", "Month to summarize as YYYY-MM, in UTC (default the current month).")
+	fleetReportCmd.Flags().StringVar(&fleetFormat, "format", "text", "Output format: text, json or html.")
+	fleetReportCmd.Flags().StringVar(&fleetOutput, "output", "", "File to write the summary to (default standard output).")
+	fleetCmd.AddCommand(fleetReportCmd)
+	rootCmd.AddCommand(fleetCmd)
+}
+
+// FleetSummary is the fleet-wide roll-up for one month.
+type FleetSummary struct {
+	Month         string       `json:"month"`
+	GeneratedAt   time.Time    `json:"generated_at"`
+	Sites         int          `json:"sites"`
+	SitesScanned  int          `json:"sites_scanned"`
+	SitesInfected int          `json:"sites_infected"`
+	SpamOpen      int          `json:"spam_open"`
+	SpamRemoved   int          `json:"spam_removed"`
+	Reinfections  int          `json:"reinfections"`
+	PerSite       []*FleetSite `json:"per_site"`
+}
+
+// FleetSite is one site's line in the fleet summary.
+type FleetSite struct {
+	Site          string `json:"site"`
+	LastScan      string `json:"last_scan"`
+	Scans         int    `json:"scans"` // in the month
+	Posts         int    `json:"posts"` // in the latest scan
+	OpenSpam      int    `json:"open_spam"`
+	OpenUncertain int    `json:"open_uncertain"`
+	Removed       int    `json:"removed"`
+	Reinfections  int    `json:"reinfections"`
+	IncidentID    string `json:"incident_id,omitempty"` // of the latest scan
+}
+
+// Infected is whether the site's latest scan still found uncleaned Spam.
+func (s *FleetSite) Infected() bool { return s.OpenSpam > 0 }
+
+func runFleetReport() {
+	if storePath == "" {
+		fatal("--store-path is required for fleet report.")
+	}
+	switch fleetFormat {
+	case "text", "json", "html":
+	default:
+		fatalf("Unsupported fleet report format %q; expected text, json or html.", fleetFormat)
+	}
+	month := time.Now().UTC()
+	if fleetMonth != "" {
+		var err error
+		if month, err = time.Parse("2006-01", fleetMonth); err != nil {
+			fatalf("Invalid --month %q; expected YYYY-MM.", fleetMonth)
+		}
+	}
+
+	db, err := openStoreReadOnly(storePath)
+	if err != nil {
+		fatalf("Failed to open store: %v", err)
+	}
+	defer db.Close()
+	summary, err := summarizeFleet(db, month)
+	if err != nil {
+		fatalf("Failed to summarize the fleet: %v", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if fleetOutput != "" {
+		file, err := os.Create(fleetOutput)
+		if err != nil {
+			fatalf("Failed to create %s: %v", fleetOutput, err)
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := writeFleetSummary(w, fleetFormat, summary); err != nil {
+		fatalf("Failed to write fleet report: %v", err)
+	}
+	if fleetOutput != "" {
+		log.Printf("Wrote fleet report for %s to %s", summary.Month, fleetOutput)
+	}
+}
+
+// summarizeFleet rolls up the store for the calendar month containing month.
+func summarizeFleet(db *sql.DB, month time.Time) (*FleetSummary, error) {
+	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	from, to := start.Format(time.RFC3339), start.AddDate(0, 1, 0).Format(time.RFC3339)
+	summary := &FleetSummary{Month: start.Format("2006-01"), GeneratedAt: time.Now()}
+
+	rows, err := db.Query(`SELECT r.site, r.started_at, r.posts, r.incident_id,
+			(SELECT COUNT(*) FROM runs m WHERE m.site = r.site AND m.started_at >= ? AND m.started_at < ?)
+		FROM runs r WHERE r.id = (SELECT MAX(id) FROM runs l WHERE l.site = r.site)
+		ORDER BY r.site`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("loading runs: %w", err)
+	}
+	bySite := make(map[string]*FleetSite)
+	for rows.Next() {
+		s := &FleetSite{}
+		if err := rows.Scan(&s.Site, &s.LastScan, &s.Posts, &s.IncidentID, &s.Scans); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		bySite[s.Site] = s
+		summary.PerSite = append(summary.PerSite, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Open findings only count if the latest scan still saw them.
+	rows, err = db.Query(`SELECT site,
+			SUM(classification = 'Spam' AND review_state <> 'cleaned' AND run_id = latest),
+			SUM(classification = 'Uncertain' AND review_state <> 'cleaned' AND run_id = latest),
+			SUM(review_state = 'cleaned' AND review_updated_at >= ? AND review_updated_at < ?)
+		FROM (SELECT *, (SELECT MAX(id) FROM runs WHERE runs.site = findings.site) AS latest FROM findings)
+		GROUP BY site`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("loading findings: %w", err)
+	}
+	for rows.Next() {
+		var site string
+		var spam, uncertain, removed int
+		if err := rows.Scan(&site, &spam, &uncertain, &removed); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if s := bySite[site]; s != nil {
+			s.OpenSpam, s.OpenUncertain, s.Removed = spam, uncertain, removed
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`SELECT site, COUNT(*) FROM typed_findings
+		WHERE type = 'reinfection' AND last_seen >= ? AND last_seen < ? GROUP BY site`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("loading reinfections: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var site string
+		var n int
+		if err := rows.Scan(&site, &n); err != nil {
+			return nil, err
+		}
+		if s := bySite[site]; s != nil {
+			s.Reinfections = n
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	summary.Sites = len(summary.PerSite)
+	for _, s := range summary.PerSite {
+		if s.Scans > 0 {
+			summary.SitesScanned++
+		}
+		if s.Infected() {
+			summary.SitesInfected++
+		}
+		summary.SpamOpen += s.OpenSpam
+		summary.SpamRemoved += s.Removed
+		summary.Reinfections += s.Reinfections
+	}
+	return summary, nil
+}
+
+var fleetTemplate = template.Must(template.New("fleet").Parse(fleetHTMLTemplate))
+
+func writeFleetSummary(w io.Writer, format string, s *FleetSummary) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	case "html":
+		return fleetTemplate.Execute(w, s)
+	}
+	fmt.Fprintf(w, "Fleet summary for %s\n\n", s.Month)
+	fmt.Fprintf(w, "  Sites scanned:           %d of %d\n", s.SitesScanned, s.Sites)
+	fmt.Fprintf(w, "  Sites with active spam:  %d\n", s.SitesInfected)
+	fmt.Fprintf(w, "  Spam removed:            %d\n", s.SpamRemoved)
+	fmt.Fprintf(w, "  Spam awaiting cleanup:   %d\n", s.SpamOpen)
+	fmt.Fprintf(w, "  Reinfections:            %d\n\n", s.Reinfections)
+	fmt.Fprintf(w, "%-24s %-20s %5s %6s %9s %9s %7s %8s %s\n",
+		"SITE", "LAST_SCAN", "SCANS", "POSTS", "OPEN_SPAM", "UNCERTAIN", "REMOVED", "REINFECT", "INCIDENT")
+	for _, site := range s.PerSite {
+		fmt.Fprintf(w, "%-24s %-20s %5d %6d %9d %9d %7d %8d %s\n",
+			site.Site, site.LastScan, site.Scans, site.Posts, site.OpenSpam, site.OpenUncertain, site.Removed, site.Reinfections, site.IncidentID)
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+package cmd
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var graphPath string
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&graphPath, "graph-path", "", "Optional path for the spam network (authors, posts, linked domains and session IPs) to load into Gephi (.gexf) or Graphviz (.dot).")
+}
+
+func validateGraphPath(path string) error {
+	if path == "" {
+		return nil
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gexf", ".dot", ".gv":
+		return nil
+	}
+	return fmt.Errorf("unsupported --graph-path %q; use a .gexf or .dot file", path)
+}
+
+// Node kinds and edge relations of the network graph.
+const (
+	graphAuthor = "author"
+	graphPost   = "post"
+	graphDomain = "domain"
+	graphIP     = "ip"
+
+	relAuthored    = "authored"
+	relLinksTo     = "links-to"
+	relSessionFrom = "session-from"
+)
+
+// NetworkGraph is the site's content as a graph for external tools: authors
+// connect to their posts and the IPs of their login sessions, posts to the
+// external domains they link to. Shared domains and IPs are what tie
+// otherwise unrelated accounts together.
+type NetworkGraph struct {
+	Nodes []*NetworkNode
+	Edges []*NetworkEdge
+}
+
+// NetworkNode is an author, post, domain or IP. Fields that do not apply to
+// its kind are empty.
+type NetworkNode struct {
+	ID             string
+	Kind           string
+	Label          string
+	Classification string
+	PostType       string
+	Date           string
+	Roles          string
+}
+
+// NetworkEdge is a directed relation; Weight counts repeats, e.g. how many
+// links a post has to one domain.
+type NetworkEdge struct {
+	Source, Target string
+	Relation       string
+	Weight         int
+}
+
+// buildNetworkGraph builds the graph from analyzed posts. ips holds the
+// session IPs of author IDs; WordPress records none for posts themselves.
+func buildNetworkGraph(posts []Post, ips map[string][]string) *NetworkGraph {
+	g := &NetworkGraph{}
+	own := siteHosts(posts)
+	nodes := make(map[string]*NetworkNode)
+	edges := make(map[[3]string]*NetworkEdge)
+	node := func(n *NetworkNode) {
+		if nodes[n.ID] == nil {
+			nodes[n.ID] = n
+			g.Nodes = append(g.Nodes, n)
+		}
+	}
+	edge := func(source, target, relation string) {
+		key := [3]string{source, target, relation}
+		if e := edges[key]; e != nil {
+			e.Weight++
+			return
+		}
+		e := &NetworkEdge{Source: source, Target: target, Relation: relation, Weight: 1}
+		edges[key] = e
+		g.Edges = append(g.Edges, e)
+	}
+
+	for _, p := range posts {
+		author := graphAuthor + ":" + p.AuthorID
+		node(&NetworkNode{ID: author, Kind: graphAuthor, Label: firstNonEmpty(p.Author.Login, "user "+p.AuthorID),
+			Roles: strings.Join(p.Author.Roles, ",")})
+		post := graphPost + ":" + strconv.Itoa(p.ID)
+		node(&NetworkNode{ID: post, Kind: graphPost, Label: firstNonEmpty(p.Title, post),
+			Classification: p.AIClassification, PostType: p.Type, Date: p.Date})
+		edge(author, post, relAuthored)
+		for _, raw := range linkPattern.FindAllString(p.Content, -1) {
+			d := linkDomain(raw)
+			if d == "" || own[d] {
+				continue
+			}
+			node(&NetworkNode{ID: graphDomain + ":" + d, Kind: graphDomain, Label: d})
+			edge(post, graphDomain+":"+d, relLinksTo)
+		}
+	}
+	authors := make([]string, 0, len(ips))
+	for id := range ips {
+		authors = append(authors, id)
+	}
+	sort.Strings(authors)
+	for _, id := range authors {
+		for _, ip := range ips[id] {
+			node(&NetworkNode{ID: graphIP + ":" + ip, Kind: graphIP, Label: ip})
+			edge(graphAuthor+":"+id, graphIP+":"+ip, relSessionFrom)
+		}
+	}
+	return g
+}
+
+// linkDomain is the lower-cased host of a link without "www.", as
+// extractLinkDomains reports it.
+func linkDomain(raw string) string {
+	if d := extractLinkDomains(raw); len(d) > 0 {
+		return d[0]
+	}
+	return ""
+}
+
+// networkIPs returns the session IPs of every author of a flagged post.
+// Authors already looked up for campaign attribution are not asked again.
+func networkIPs(ctx context.Context, posts []Post, campaigns []*Campaign) map[string][]string {
+	ips := make(map[string][]string)
+	for _, c := range campaigns {
+		for _, a := range c.Authors {
+			ips[a.ID] = a.IPs
+		}
+	}
+	for _, p := range posts {
+		if findingSeverity(p.AIClassification) == "" {
+			continue
+		}
+		if _, ok := ips[p.AuthorID]; !ok {
+			ips[p.AuthorID] = sessionIPs(ctx, p.AuthorID)
+		}
+	}
+	return ips
+}
+
+func writeNetworkGraph(path string, g *NetworkGraph) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating graph file %s: %w", path, err)
+	}
+	defer file.Close()
+	if strings.EqualFold(filepath.Ext(path), ".gexf") {
+		err = writeGEXF(file, g)
+	} else {
+		err = writeDOT(file, g)
+	}
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return file.Close()
+}
+
+// gexfNodeAttributes are the node columns Gephi shows in its data
+// laboratory, in attribute ID order.
+var gexfNodeAttributes = []string{"kind", "classification", "post_type", "date", "roles"}
+
+type gexfAttribute struct {
+	ID    int    `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+// gexfAttributes declares the attributes of nodes or edges.
+type gexfAttributes struct {
+	Class string          `xml:"class,attr"`
+	List  []gexfAttribute `xml:"attribute"`
+}
+
+type gexfValue struct {
+	For   int    `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type gexfNode struct {
+	ID     string      `xml:"id,attr"`
+	Label  string      `xml:"label,attr"`
+	Values []gexfValue `xml:"attvalues>attvalue"`
+}
+
+type gexfEdge struct {
+	ID     int         `xml:"id,attr"`
+	Source string      `xml:"source,attr"`
+	Target string      `xml:"target,attr"`
+	Weight int         `xml:"weight,attr"`
+	Label  string      `xml:"label,attr"`
+	Values []gexfValue `xml:"attvalues>attvalue"`
+}
+
+type gexfDocument struct {
+	XMLName xml.Name `xml:"gexf"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Version string   `xml:"version,attr"`
+	Meta    struct {
+		LastModified string `xml:"lastmodifieddate,attr"`
+		Creator      string `xml:"creator"`
+		Description  string `xml:"description"`
+	} `xml:"meta"`
+	Graph struct {
+		EdgeType   string           `xml:"defaultedgetype,attr"`
+		Attributes []gexfAttributes `xml:"attributes"`
+		Nodes      []gexfNode       `xml:"nodes>node"`
+		Edges      []gexfEdge       `xml:"edges>edge"`
+	} `xml:"graph"`
+}
+
+// writeGEXF writes the graph as GEXF 1.3, Gephi's native format.
+func writeGEXF(w io.Writer, g *NetworkGraph) error {
+	doc := gexfDocument{Xmlns: "http://gexf.net/1.3", Version: "1.3"}
+	doc.Meta.LastModified = time.Now().Format("2006-01-02")
+	doc.Meta.Creator = "banner-air-cleanup"
+	doc.Meta.Description = "Spam network of " + dockerContainer
+	doc.Graph.EdgeType = "directed"
+	nodeAttrs := gexfAttributes{Class: "node"}
+	for i, title := range gexfNodeAttributes {
+		nodeAttrs.List = append(nodeAttrs.List, gexfAttribute{i, title, "string"})
+	}
+	doc.Graph.Attributes = []gexfAttributes{nodeAttrs, {Class: "edge", List: []gexfAttribute{{0, "relation", "string"}}}}
+	for _, n := range g.Nodes {
+		gn := gexfNode{ID: n.ID, Label: validUTF8(n.Label)}
+		for i, v := range []string{n.Kind, n.Classification, n.PostType, n.Date, n.Roles} {
+			if v != "" {
+				gn.Values = append(gn.Values, gexfValue{i, v})
+			}
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, gn)
+	}
+	for i, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, gexfEdge{ID: i, Source: e.Source, Target: e.Target, Weight: e.Weight,
+			Label: e.Relation, Values: []gexfValue{{0, e.Relation}}})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// dotStyles are the Graphviz attributes of each node kind, and of posts by
+// classification.
+var dotStyles = map[string]string{
+	graphAuthor:  `shape=ellipse, style=filled, fillcolor="#cfe2ff"`,
+	graphDomain:  `shape=diamond, style=filled, fillcolor="#e2e3e5"`,
+	graphIP:      `shape=hexagon, style=filled, fillcolor="#fff3cd"`,
+	graphPost:    `shape=box`,
+	"Spam":       `shape=box, style=filled, fillcolor="#f8d7da"`,
+	"Uncertain":  `shape=box, style=filled, fillcolor="#ffe5b4"`,
+	"Legitimate": `shape=box, style=filled, fillcolor="#d1e7dd"`,
+}
+
+// writeDOT writes the graph in Graphviz's DOT language.
+func writeDOT(w io.Writer, g *NetworkGraph) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n  rankdir=LR;\n  node [fontname=\"Helvetica\", fontsize=10];\n", dotQuote("spam network of "+dockerContainer))
+	for _, n := range g.Nodes {
+		style := dotStyles[n.Kind]
+		if s, ok := dotStyles[n.Classification]; ok && n.Kind == graphPost {
+			style = s
+		}
+		label := n.Label
+		if n.Classification != "" {
+			label += "\n" + n.Classification
+		}
+		fmt.Fprintf(&b, "  %s [label=%s, kind=%s, %s];\n", dotQuote(n.ID), dotQuote(label), dotQuote(n.Kind), style)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "  %s -> %s [label=%s, weight=%d];\n", dotQuote(e.Source), dotQuote(e.Target), dotQuote(e.Relation), e.Weight)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotQuote quotes s as a DOT string; newlines become line breaks in labels.
+func dotQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r", "", "\n", `\n`).Replace(validUTF8(s))
+	return `"` + s + `"`
+}
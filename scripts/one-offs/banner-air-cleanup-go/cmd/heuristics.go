@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var offline bool
+
+// heuristicsVersion is stamped as the model version of locally classified
+// posts so they are never mistaken for AI results.
+const heuristicsVersion = "local-heuristics-v1"
+
+// hiddenMarkupPattern matches markup commonly used to hide injected links from
+// visitors while keeping them visible to crawlers.
+var hiddenMarkupPattern = regexp.MustCompile(`(?i)display\s*:\s*none|visibility\s*:\s*hidden|font-size\s*:\s*0|<iframe|<script|eval\(|base64_decode`)
+
+// Analyzer is a named analysis stage; the report lists the ones skipped in a
+// run and why.
+type Analyzer struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// skippedAnalyzers lists the network-dependent analyzers disabled for this
+// run.
+func skippedAnalyzers() []Analyzer {
+	var skipped []Analyzer
+	if offline {
+		skipped = append(skipped, Analyzer{Name: "AI classification", Reason: "--offline; local heuristics used instead"})
+	}
+	if outage := aiOutageAnalyzer(); outage != nil {
+		skipped = append(skipped, *outage)
+	}
+	if offline && screenshots {
+		skipped = append(skipped, Analyzer{Name: "page screenshots", Reason: "--offline"})
+	}
+	for _, name := range activeProfile.Compliance {
+		switch {
+		case offline:
+			skipped = append(skipped, Analyzer{Name: "compliance: " + name, Reason: "--offline"})
+		case !analyzeContent:
+			skipped = append(skipped, Analyzer{Name: "compliance: " + name, Reason: "AI analysis not enabled"})
+		}
+	}
+	return skipped
+}
+
+// classifyHeuristically scores content, excerpt and SEO meta with keyword,
+// hidden-markup and external-link rules that need no network access. It is
+// deliberately conservative: anything short of a strong signal is Uncertain.
+// With --industry, off-site links in content that never mentions the
+// vertical's terms count as a signal too.
+func classifyHeuristically(post *Post) {
+	content := post.Content
+	keywords := make(map[string]bool)
+	for _, m := range spamKeywordPattern.FindAllString(content, -1) {
+		keywords[strings.ToLower(m)] = true
+	}
+	hidden := len(hiddenMarkupPattern.FindAllString(content, -1))
+	metaLinks := 0
+	for _, f := range post.metaFields() {
+		for _, m := range spamKeywordPattern.FindAllString(f.text, -1) {
+			keywords[strings.ToLower(m)] = true
+		}
+		hidden += len(hiddenMarkupPattern.FindAllString(f.text, -1))
+		metaLinks += len(extractLinkDomains(f.text))
+	}
+
+	own := ""
+	if u, err := url.Parse(post.GUID); err == nil {
+		own = strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	}
+	external := 0
+	for _, d := range extractLinkDomains(content) {
+		if d != own {
+			external++
+		}
+	}
+
+	score := 2*len(keywords) + 2*hidden
+	if external > 3 {
+		score++
+	}
+	unrelated := offTopic(post, external)
+	if unrelated {
+		score++
+	}
+	if metaLinks > 0 {
+		score++
+	}
+
+	var reasons []string
+	if len(keywords) > 0 {
+		words := make([]string, 0, len(keywords))
+		for w := range keywords {
+			words = append(words, w)
+		}
+		sort.Strings(words)
+		reasons = append(reasons, "spam keywords: "+strings.Join(words, ", "))
+	}
+	if hidden > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d hidden-markup marker(s)", hidden))
+	}
+	if external > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d external link domain(s)", external))
+	}
+	if unrelated {
+		reasons = append(reasons, "links off-site without mentioning "+strings.ToLower(activeIndustry.Label))
+	}
+	if signals, _ := metaSignals(*post); len(signals) > 0 {
+		reasons = append(reasons, strings.Join(signals, "; "))
+	}
+
+	switch {
+	case score >= 3:
+		post.AIClassification = "Spam"
+	case score >= 1:
+		post.AIClassification = "Uncertain"
+	default:
+		post.AIClassification = "Legitimate"
+		reasons = append(reasons, "no spam signals")
+	}
+	post.AIJustification = "Heuristic: " + strings.Join(reasons, "; ")
+	post.AIPromptHash = ""
+	post.AIModelVersion = heuristicsVersion
+}
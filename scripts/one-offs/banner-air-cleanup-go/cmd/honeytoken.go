@@ -0,0 +1,388 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	honeytokenTitle string
+	honeytokenForce bool
+)
+
+var honeytokenCmd = &cobra.Command{
+	Use:   "honeytoken",
+	Short: "Plant and check a marker page that reveals tampering between audits.",
+	Long: `Plants an inert marker on a clean site: a private page and an option that
+nothing links to or reads. Injections that rewrite posts in bulk, or an
+attacker browsing the admin, tend to touch them, and spam is often staged as
+private pages first.
+
+"honeytoken verify", and monitor on every scan, checks that the page and the
+option are unchanged and that no other private page appeared since the
+marker was planted. A failed check opens a honeytoken-tampered incident with
+the configured PagerDuty or Opsgenie keys, and verify exits 1.
+
+The marker is recorded in --store-path; "honeytoken remove" deletes it.`,
+}
+
+var honeytokenPlantCmd = &cobra.Command{
+	Use:   "plant",
+	Short: "Plant the marker page and option on the site.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		forEachSite(runHoneytokenPlant)
+	},
+}
+
+var honeytokenVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check the planted marker and report any tampering.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		tampered := 0
+		forEachSite(func() {
+			if runHoneytokenVerify() {
+				tampered++
+			}
+		})
+		if tampered > 0 {
+			fatalf("The honeytoken was tampered with on %d site(s).", tampered)
+		}
+	},
+}
+
+var honeytokenRemoveCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Delete the marker page and option and forget them.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		forEachSite(runHoneytokenRemove)
+	},
+}
+
+func init() {
+	honeytokenPlantCmd.Flags().StringVar(&honeytokenTitle, "title", "Internal notes", "Title of the marker page; pick one that looks ordinary on the site.")
+	honeytokenPlantCmd.Flags().BoolVar(&honeytokenForce, "force", false, "Plant even though the site still has open Spam findings, or replace an existing marker.")
+	honeytokenCmd.AddCommand(honeytokenPlantCmd, honeytokenVerifyCmd, honeytokenRemoveCmd)
+	rootCmd.AddCommand(honeytokenCmd)
+}
+
+// Honeytoken is a planted marker as recorded in the store.
+type Honeytoken struct {
+	Site        string
+	PostID      int
+	PostDate    string // the page's post_date, in the site's time zone
+	OptionName  string
+	Token       string
+	ContentHash string
+	PlantedAt   string
+}
+
+// markerPage is the part of the marker page that is checked.
+type markerPage struct {
+	Title   string `json:"post_title"`
+	Content string `json:"post_content"`
+	Status  string `json:"post_status"`
+	Date    string `json:"post_date"`
+}
+
+func (p markerPage) hash() string {
+	sum := sha256.Sum256([]byte(p.Title + "\x00" + p.Content + "\x00" + p.Status))
+	return hex.EncodeToString(sum[:])
+}
+
+func honeytokenStore() *sql.DB {
+	if storePath == "" {
+		fatal("--store-path is required for honeytoken.")
+	}
+	db, err := openStore(storePath)
+	if err != nil {
+		fatalf("Failed to open store: %v", err)
+	}
+	return db
+}
+
+func runHoneytokenPlant() {
+	ctx := context.Background()
+	db := honeytokenStore()
+	defer db.Close()
+
+	existing, err := loadHoneytoken(db, dockerContainer)
+	if err != nil {
+		fatalf("Failed to read honeytoken: %v", err)
+	} else if existing != nil && !honeytokenForce {
+		log.Printf("%s already has a honeytoken (page %d); use --force to replace it.", dockerContainer, existing.PostID)
+		return
+	}
+	var open int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM findings WHERE site = ? AND classification = 'Spam' AND review_state != 'cleaned'`,
+		dockerContainer).Scan(&open); err != nil {
+		fatalf("Failed to count open findings: %v", err)
+	}
+	if open > 0 && !honeytokenForce {
+		log.Printf("Skipping %s: %d Spam finding(s) are not cleaned yet; plant the honeytoken once the site is clean, or use --force.", dockerContainer, open)
+		return
+	}
+
+	// The token is made first so a failure leaves any existing marker alone.
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		fatalf("Failed to generate the honeytoken: %v", err)
+	}
+	token := hex.EncodeToString(b)
+
+	// The store only records one marker, so a replaced one would be left
+	// on the site with nothing pointing at it.
+	if existing != nil {
+		if err := deleteMarker(ctx, existing); err != nil {
+			fatalf("Failed to remove the existing honeytoken from %s; not replacing it: %v", dockerContainer, err)
+		}
+		log.Printf("Removed the existing honeytoken from %s (page %d, option %s).", dockerContainer, existing.PostID, existing.OptionName)
+	}
+
+	content := fmt.Sprintf("<!-- %s -->\n<p>Notes for site maintenance. Do not publish.</p>", token)
+	out, err := runWPCommand(ctx, []string{"post", "create", "--post_type=page", "--post_status=private",
+		"--post_title=" + honeytokenTitle, "--post_content=" + content, "--porcelain"})
+	if err != nil {
+		fatalf("Failed to create the marker page on %s: %v", dockerContainer, err)
+	}
+	postID, err := strconv.Atoi(strings.TrimSpace(out))
+	if err != nil {
+		fatalf("Unexpected output creating the marker page: %q", out)
+	}
+	page, err := getMarkerPage(ctx, postID)
+	if err != nil {
+		fatalf("Failed to read back the marker page: %v", err)
+	}
+	option := "site_notes_" + token[:8]
+	if _, err := runWPCommand(ctx, []string{"option", "add", option, token, "--autoload=no"}); err != nil {
+		fatalf("Failed to add the marker option on %s: %v", dockerContainer, err)
+	}
+
+	h := Honeytoken{Site: dockerContainer, PostID: postID, PostDate: page.Date, OptionName: option, Token: token,
+		ContentHash: page.hash(), PlantedAt: time.Now().UTC().Format(time.RFC3339)}
+	if err := saveHoneytoken(db, h); err != nil {
+		fatalf("Failed to record the honeytoken: %v", err)
+	}
+	log.Printf("Planted a honeytoken on %s: private page %d and option %s.", dockerContainer, postID, option)
+}
+
+// runHoneytokenVerify checks the site's marker and reports whether it was
+// tampered with.
+func runHoneytokenVerify() bool {
+	db := honeytokenStore()
+	defer db.Close()
+	h, err := loadHoneytoken(db, dockerContainer)
+	if err != nil {
+		fatalf("Failed to read honeytoken: %v", err)
+	}
+	if h == nil {
+		log.Printf("No honeytoken planted on %s.", dockerContainer)
+		return false
+	}
+	inc, err := checkHoneytoken(context.Background(), db, h)
+	if err != nil {
+		log.Printf("Warning: could not verify the honeytoken on %s: %v", dockerContainer, err)
+		return false
+	}
+	if inc == nil {
+		log.Printf("Honeytoken on %s is intact.", dockerContainer)
+		return false
+	}
+	log.Printf("Honeytoken tampered: %s", inc.Summary)
+	raiseIncident(*inc)
+	return true
+}
+
+// detectHoneytokenTampering is monitor's check; sites without a planted
+// marker are skipped.
+func detectHoneytokenTampering(ctx context.Context, db *sql.DB, site string) (*Incident, error) {
+	h, err := loadHoneytoken(db, site)
+	if err != nil || h == nil {
+		return nil, err
+	}
+	return checkHoneytoken(ctx, db, h)
+}
+
+// checkHoneytoken compares the marker with what was planted and looks for
+// private pages created after it. A page or option that cannot be read
+// because wp-cli failed is an error, not tampering.
+func checkHoneytoken(ctx context.Context, db *sql.DB, h *Honeytoken) (*Incident, error) {
+	var problems []string
+	page, err := getMarkerPage(ctx, h.PostID)
+	switch {
+	case errors.Is(err, errMarkerMissing):
+		problems = append(problems, fmt.Sprintf("marker page %d was deleted", h.PostID))
+	case err != nil:
+		return nil, err
+	case page.hash() != h.ContentHash:
+		problems = append(problems, fmt.Sprintf("marker page %d was modified (now %s, %q)", h.PostID, page.Status, page.Title))
+	}
+
+	value, found, err := getMarkerOption(ctx, h.OptionName)
+	switch {
+	case err != nil:
+		return nil, err
+	case !found:
+		problems = append(problems, fmt.Sprintf("marker option %s was deleted", h.OptionName))
+	case value != h.Token:
+		problems = append(problems, fmt.Sprintf("marker option %s was changed", h.OptionName))
+	}
+
+	out, err := runWPCommand(ctx, []string{"post", "list", "--post_type=any", "--post_status=private",
+		"--fields=ID,post_title,post_date", "--format=json"})
+	if err != nil {
+		return nil, err
+	}
+	var private []struct {
+		ID    int    `json:"ID"`
+		Title string `json:"post_title"`
+		Date  string `json:"post_date"`
+	}
+	if err := json.Unmarshal([]byte(out), &private); err != nil {
+		return nil, fmt.Errorf("parsing private posts: %w", err)
+	}
+	var siblings []string
+	for _, p := range private {
+		if p.Date > h.PostDate || p.Date == h.PostDate && p.ID > h.PostID {
+			siblings = append(siblings, fmt.Sprintf("%d: %s", p.ID, p.Title))
+		}
+	}
+	if len(siblings) > 0 {
+		problems = append(problems, fmt.Sprintf("%d private post(s) appeared since the marker was planted", len(siblings)))
+	}
+
+	if _, err := db.Exec(`UPDATE honeytokens SET verified_at = ?, tampered = ? WHERE site = ?`,
+		time.Now().UTC().Format(time.RFC3339), strings.Join(problems, "; "), h.Site); err != nil {
+		log.Printf("Warning: could not record honeytoken check: %v", err)
+	}
+	if len(problems) == 0 {
+		return nil, nil
+	}
+	inc := newIncident(h.Site, "honeytoken-tampered",
+		fmt.Sprintf("Honeytoken on %s: %s", h.Site, strings.Join(problems, "; ")),
+		map[string]any{"page_id": h.PostID, "option": h.OptionName, "planted_at": h.PlantedAt, "problems": problems, "new_private_posts": siblings})
+	return &inc, nil
+}
+
+func runHoneytokenRemove() {
+	ctx := context.Background()
+	db := honeytokenStore()
+	defer db.Close()
+	h, err := loadHoneytoken(db, dockerContainer)
+	if err != nil {
+		fatalf("Failed to read honeytoken: %v", err)
+	}
+	if h == nil {
+		log.Printf("No honeytoken planted on %s.", dockerContainer)
+		return
+	}
+	// A marker still on the site stays recorded, so removing it can be retried.
+	if err := deleteMarker(ctx, h); err != nil {
+		log.Printf("Warning: the honeytoken on %s stays recorded: %v", dockerContainer, err)
+		return
+	}
+	if _, err := db.Exec(`DELETE FROM honeytokens WHERE site = ?`, dockerContainer); err != nil {
+		fatalf("Failed to forget the honeytoken: %v", err)
+	}
+	log.Printf("Removed the honeytoken from %s.", dockerContainer)
+}
+
+// deleteMarker deletes the marker page and option, whichever still exist.
+func deleteMarker(ctx context.Context, h *Honeytoken) error {
+	_, err := getMarkerPage(ctx, h.PostID)
+	switch {
+	case err == nil:
+		if _, err := runWPCommand(ctx, []string{"post", "delete", strconv.Itoa(h.PostID), "--force"}); err != nil {
+			return fmt.Errorf("could not delete marker page %d: %w", h.PostID, err)
+		}
+	case !errors.Is(err, errMarkerMissing):
+		return fmt.Errorf("could not read marker page %d: %w", h.PostID, err)
+	}
+	if _, found, err := getMarkerOption(ctx, h.OptionName); err != nil {
+		return fmt.Errorf("could not read marker option %s: %w", h.OptionName, err)
+	} else if found {
+		if _, err := runWPCommand(ctx, []string{"option", "delete", h.OptionName}); err != nil {
+			return fmt.Errorf("could not delete marker option %s: %w", h.OptionName, err)
+		}
+	}
+	return nil
+}
+
+var errMarkerMissing = errors.New("marker page not found")
+
+func getMarkerPage(ctx context.Context, id int) (markerPage, error) {
+	out, err := runWPCommand(ctx, []string{"post", "get", strconv.Itoa(id),
+		"--fields=post_title,post_content,post_status,post_date", "--format=json"})
+	if err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "could not find the post") {
+			return markerPage{}, errMarkerMissing
+		}
+		return markerPage{}, err
+	}
+	var p markerPage
+	if err := json.Unmarshal([]byte(out), &p); err != nil {
+		return markerPage{}, fmt.Errorf("parsing marker page: %w", err)
+	}
+	if p.Status == "trash" {
+		return markerPage{}, errMarkerMissing
+	}
+	return p, nil
+}
+
+// getMarkerOption reads the marker option. wp option get exits 1 without a
+// message for a missing option, which cannot be told apart from a failure;
+// list finds it or nothing. --search is a LIKE match in which the _ of the
+// name matches any character, so the name is compared exactly.
+func getMarkerOption(ctx context.Context, name string) (string, bool, error) {
+	out, err := runWPCommand(ctx, []string{"option", "list", "--search=" + name, "--fields=option_name,option_value", "--format=json"})
+	if err != nil {
+		return "", false, err
+	}
+	var options []struct {
+		Name  string `json:"option_name"`
+		Value string `json:"option_value"`
+	}
+	if err := json.Unmarshal([]byte(out), &options); err != nil {
+		return "", false, fmt.Errorf("parsing options: %w", err)
+	}
+	for _, o := range options {
+		if o.Name == name {
+			return o.Value, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func loadHoneytoken(db *sql.DB, site string) (*Honeytoken, error) {
+	h := &Honeytoken{Site: site}
+	err := db.QueryRow(`SELECT post_id, post_date, option_name, token, content_hash, planted_at FROM honeytokens WHERE site = ?`, site).
+		Scan(&h.PostID, &h.PostDate, &h.OptionName, &h.Token, &h.ContentHash, &h.PlantedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return h, err
+}
+
+func saveHoneytoken(db *sql.DB, h Honeytoken) error {
+	_, err := db.Exec(`INSERT INTO honeytokens (site, post_id, post_date, option_name, token, content_hash, planted_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (site) DO UPDATE SET post_id = excluded.post_id, post_date = excluded.post_date,
+			option_name = excluded.option_name, token = excluded.token, content_hash = excluded.content_hash,
+			planted_at = excluded.planted_at, verified_at = '', tampered = ''`,
+		h.Site, h.PostID, h.PostDate, h.OptionName, h.Token, h.ContentHash, h.PlantedAt)
+	return err
+}
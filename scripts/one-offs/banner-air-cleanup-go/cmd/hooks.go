@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+var (
+	preHooks  []string
+	postHooks []string
+	// hookPhase is the phase hooks run around: the subcommand name, or "run"
+	// for the root command.
+	hookPhase string
+)
+
+// runShell runs a command through sh with extra environment variables. Its
+// output goes to stderr alongside the log.
+func runShell(ctx context.Context, command string, env []string) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), env...)
+	return cmd.Run()
+}
+
+// hookEnv is the run metadata hooks receive. Settings use their flags'
+// variable names, e.g. HUBSTACK_CONTAINER_NAME, so a hook that runs this tool
+// again acts on the same site. Post hooks of a run also get what it produced.
+func hookEnv(when, status string) []string {
+	env := []string{
+		"HUBSTACK_PHASE=" + hookPhase,
+		"HUBSTACK_HOOK=" + when,
+		flagEnvName("container-name") + "=" + dockerContainer,
+		flagEnvName("store-path") + "=" + storePath,
+		flagEnvName("output-csv-path") + "=" + outputCSVPath,
+		flagEnvName("report-html-path") + "=" + reportHTMLPath,
+		flagEnvName("run-manifest-path") + "=" + runManifestPath,
+		flagEnvName("wp-path") + "=" + wpPath,
+		flagEnvName("incident-id") + "=" + incidentID,
+		flagEnvName("note") + "=" + runNote,
+	}
+	if when != "post" {
+		return env
+	}
+	env = append(env, "HUBSTACK_STATUS="+status)
+	if runManifest.Site == dockerContainer && runManifest.RunTag != "" {
+		env = append(env,
+			"HUBSTACK_RUN_TAG="+runManifest.RunTag,
+			"HUBSTACK_POSTS="+strconv.Itoa(runManifest.Posts),
+			"HUBSTACK_FINDINGS="+strconv.Itoa(runManifest.Findings),
+			"HUBSTACK_OUTPUTS="+strings.Join(runManifest.Outputs, "\n"))
+	}
+	return env
+}
+
+// siteHooks returns the --pre-hook or --post-hook commands followed by the
+// site profile's hooks for the current phase.
+func siteHooks(when string) []string {
+	hooks := preHooks
+	if when == "post" {
+		hooks = postHooks
+	}
+	return append(append([]string(nil), hooks...), activeProfile.Hooks[when+"-"+hookPhase]...)
+}
+
+// withHooks runs fn for the current site between its pre and post hooks. A
+// failing pre hook skips the site. Post hooks run even when fn exits the
+// process, with HUBSTACK_STATUS=failed.
+func withHooks(fn func()) {
+	ctx := context.Background()
+	for _, hook := range siteHooks("pre") {
+		if err := runShell(ctx, hook, hookEnv("pre", "")); err != nil {
+			log.Printf("Skipping %s of %s: pre-hook %q failed: %v", hookPhase, dockerContainer, hook, err)
+			return
+		}
+	}
+	post := siteHooks("post")
+	if len(post) == 0 {
+		fn()
+		return
+	}
+
+	status := "failed"
+	finish := onExit(func() {
+		for _, hook := range post {
+			if err := runShell(ctx, hook, hookEnv("post", status)); err != nil {
+				log.Printf("Warning: post-hook %q failed: %v", hook, err)
+			}
+		}
+	})
+	fn()
+	status = "ok"
+	finish()
+}
+
+// validateHookPhases checks that profile hooks are keyed pre-<phase> or
+// post-<phase>.
+func validateHookPhases(hooks map[string][]string) error {
+	for key := range hooks {
+		when, phase, ok := strings.Cut(key, "-")
+		if !ok || (when != "pre" && when != "post") || phase == "" {
+			return fmt.Errorf("hook %q must be named pre-<phase> or post-<phase>, e.g. pre-cleanup", key)
+		}
+	}
+	return nil
+}
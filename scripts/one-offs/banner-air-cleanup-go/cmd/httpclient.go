@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+var caBundlePath string
+
+// httpClient is used for every outbound HTTP call the tool makes itself
+// (Slack, PagerDuty, Opsgenie, ...).
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// configureHTTP makes all outbound HTTP go through the proxy named by
+// HTTPS_PROXY/HTTP_PROXY/NO_PROXY and trust the extra CAs in --ca-bundle, for
+// management hosts behind a TLS-inspecting proxy. It replaces
+// http.DefaultTransport because the AI client and the Google credential
+// lookup build their own clients on top of it.
+func configureHTTP() error {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+
+	if caBundlePath != "" {
+		pem, err := os.ReadFile(caBundlePath)
+		if err != nil {
+			return fmt.Errorf("reading CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no PEM certificates found in CA bundle %s", caBundlePath)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	http.DefaultTransport = transport
+	httpClient.Transport = transport
+	return nil
+}
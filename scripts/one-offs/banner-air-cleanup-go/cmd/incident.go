@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	incidentSpamThreshold int
+	incidentWindow        time.Duration
+	checkCoreChecksums    bool
+	opsgenieAPIURL        string
+)
+
+// Incident is an active-injection signal worth paging someone for.
+type Incident struct {
+	Site     string
+	Kind     string
+	Summary  string
+	Details  map[string]any
+	DedupKey string
+}
+
+func newIncident(site, kind, summary string, details map[string]any) Incident {
+	return Incident{
+		Site:     site,
+		Kind:     kind,
+		Summary:  summary,
+		Details:  details,
+		DedupKey: fmt.Sprintf("banner-air-cleanup/%s/%s", site, kind),
+	}
+}
+
+// detectSpamBurst reports an incident when more than the threshold of spam
+// findings were flagged within the window, whether they are new posts or
+// existing ones reclassified. Findings flagged by the site's first stored
+// run are the pre-existing baseline and never count as a burst; saveRun
+// stamps them with that run's finished_at.
+func detectSpamBurst(db *sql.DB, site string, now time.Time) (*Incident, error) {
+	since := now.Add(-incidentWindow).UTC().Format(time.RFC3339)
+	rows, err := db.Query(`SELECT post_id, post_title FROM findings
+		WHERE site = ? AND classification = 'Spam' AND flagged_at >= ?
+		AND flagged_at > (SELECT finished_at FROM runs WHERE id = (SELECT MIN(id) FROM runs WHERE site = ?))
+		ORDER BY post_id`, site, since, site)
+	if err != nil {
+		return nil, fmt.Errorf("counting newly flagged spam: %w", err)
+	}
+	defer rows.Close()
+
+	var titles []string
+	for rows.Next() {
+		var id int
+		var title string
+		if err := rows.Scan(&id, &title); err != nil {
+			return nil, err
+		}
+		titles = append(titles, fmt.Sprintf("%d: %s", id, title))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(titles) <= incidentSpamThreshold {
+		return nil, nil
+	}
+
+	inc := newIncident(site, "spam-injection",
+		fmt.Sprintf("%d posts flagged as spam on %s within %s", len(titles), site, incidentWindow),
+		map[string]any{"new_spam_posts": len(titles), "window": incidentWindow.String(), "posts": titles})
+	return &inc, nil
+}
+
+// detectCoreModifications reports an incident when wp core verify-checksums
+// finds modified or unexpected core files.
+func detectCoreModifications(ctx context.Context, site string) (*Incident, error) {
+	_, err := runWPCommand(ctx, []string{"core", "verify-checksums"})
+	if err == nil {
+		return nil, nil
+	}
+
+	var files []string
+	for _, line := range strings.Split(err.Error(), "\n") {
+		for _, marker := range []string{"File doesn't verify against checksum", "File should not exist"} {
+			if i := strings.Index(line, marker); i >= 0 {
+				files = append(files, strings.TrimSpace(line[i:]))
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("verifying core checksums: %w", err)
+	}
+
+	inc := newIncident(site, "core-modified",
+		fmt.Sprintf("%d modified WordPress core file(s) on %s", len(files), site),
+		map[string]any{"files": files})
+	return &inc, nil
+}
+
+// raiseIncident opens (or re-triggers) the incident with every configured
+// provider. Providers deduplicate on the incident's per-site dedup key.
+func raiseIncident(inc Incident) {
+	if key := os.Getenv("PAGERDUTY_ROUTING_KEY"); key != "" {
+		if err := triggerPagerDuty(key, inc); err != nil {
+			log.Printf("Warning: could not trigger PagerDuty incident: %v", err)
+		} else {
+			log.Printf("Triggered PagerDuty incident %s", inc.DedupKey)
+		}
+	}
+	if key := os.Getenv("OPSGENIE_API_KEY"); key != "" {
+		if err := createOpsgenieAlert(key, inc); err != nil {
+			log.Printf("Warning: could not create Opsgenie alert: %v", err)
+		} else {
+			log.Printf("Created Opsgenie alert %s", inc.DedupKey)
+		}
+	}
+}
+
+func triggerPagerDuty(routingKey string, inc Incident) error {
+	return postJSON("https://events.pagerduty.com/v2/enqueue", nil, map[string]any{
+		"routing_key":  routingKey,
+		"event_action": "trigger",
+		"dedup_key":    inc.DedupKey,
+		"payload": map[string]any{
+			"summary":        inc.Summary,
+			"source":         inc.Site,
+			"severity":       "critical",
+			"component":      "wordpress",
+			"class":          inc.Kind,
+			"custom_details": inc.Details,
+		},
+	})
+}
+
+func createOpsgenieAlert(apiKey string, inc Incident) error {
+	details, err := json.MarshalIndent(inc.Details, "", "  ")
+	if err != nil {
+		return err
+	}
+	return postJSON(opsgenieAPIURL, map[string]string{"Authorization": "GenieKey " + apiKey}, map[string]any{
+		"message":     inc.Summary,
+		"alias":       inc.DedupKey,
+		"description": string(details),
+		"source":      "banner-air-cleanup",
+		"entity":      inc.Site,
+		"priority":    "P1",
+		"tags":        []string{inc.Kind},
+	})
+}
+
+func postJSON(url string, headers map[string]string, body any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
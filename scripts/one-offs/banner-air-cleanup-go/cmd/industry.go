@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// industry is the --industry flag; a profile's "industry" applies when it is
+// not given.
+var industry string
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&industry, "industry", "", fmt.Sprintf("Heuristics pack for the site's vertical: %s (default the profile's, else generic).", strings.Join(industryNames(), ", ")))
+}
+
+// IndustryPack tunes detection for one vertical: which spam keywords to add
+// or drop and which terms on-topic content is expected to use.
+type IndustryPack struct {
+	Label string
+	// Context replaces the website context of the classification prompt.
+	Context string
+	// Extra keywords are flagged on top of spamKeywords.
+	Extra []string
+	// Allowed keywords are dropped from spamKeywords because the vertical
+	// uses them legitimately.
+	Allowed []string
+	// Expected terms mark on-topic content. Posts that link off-site
+	// without using any of them score as a spam signal.
+	Expected []string
+
+	expected *regexp.Regexp
+}
+
+// industryPacks are the built-in packs, keyed by --industry name. Keywords
+// and terms are case-insensitive regular expressions matched as whole words.
+var industryPacks = map[string]*IndustryPack{
+	"hvac": {
+		Label:   "HVAC and home services",
+		Context: "The website belongs to a heating, cooling and home services company (HVAC, plumbing, electrical). Content should be about its services, service areas, maintenance advice, equipment, financing and promotions for that work, and company news.",
+		Extra:   []string{"cbd", "vape", "sportsbook", "jackpot", "keto", "weight loss"},
+		Allowed: []string{"loans?"}, // equipment financing
+		Expected: []string{"hvac", "furnaces?", "air condition(ing|ers?)", "a/c", "heat pumps?", "heating", "cooling",
+			"thermostats?", "ducts?", "ductwork", "boilers?", "water heaters?", "plumb(ing|ers?)", "ventilation",
+			"refrigerant", "filters?", "energy", "efficien(t|cy)", "equipment", "rebates?", "tune-?ups?",
+			"maintenance", "repairs?", "install(ation)?", "technicians?"},
+	},
+	"legal": {
+		Label:    "Legal services",
+		Context:  "The website belongs to a law firm. Content should be about its practice areas, attorneys, case results, legal guides and news, and how to arrange a consultation.",
+		Extra:    []string{"essay writing", "term papers?", "cbd", "sportsbook", "jackpot"},
+		Allowed:  []string{"crypto", "bitcoin", "dating", "loans?", "pharmacy", "pills"}, // fraud, violence, debt and injury cases
+		Expected: []string{"attorneys?", "lawyers?", "law firm", "legal", "courts?", "cases?", "claims?", "lawsuits?", "injur(y|ies)", "counsel", "settlements?", "litigation", "statutes?", "consultation", "rights", "liability"},
+	},
+	"ecommerce": {
+		Label:    "Ecommerce",
+		Context:  "The website is an online store. Content should be about its products, categories, buying guides, shipping, returns and store policies, and store news.",
+		Extra:    []string{"cheap jerseys", "ugg boots", "outlet store", "louis vuitton", "michael kors", "ray-?ban", "cbd"},
+		Allowed:  []string{"slots?", "pills"}, // card slots, supplements
+		Expected: []string{"products?", "price", "prices", "cart", "shipping", "orders?", "checkout", "returns?", "sizes?", "sku", "in stock", "sale", "buy", "warranty", "collection", "reviews?"},
+	},
+}
+
+func industryNames() []string {
+	names := make([]string, 0, len(industryPacks))
+	for name := range industryPacks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func validateIndustry(name string) error {
+	if name == "" || industryPacks[name] != nil {
+		return nil
+	}
+	return fmt.Errorf("unknown industry %q; expected %s", name, strings.Join(industryNames(), ", "))
+}
+
+// activeIndustry is the pack of the site being processed, or nil for the
+// generic heuristics.
+var activeIndustry *IndustryPack
+
+// applyIndustry switches the spam keywords, expected terms and classification
+// prompt to a pack, or back to the generic ones for "".
+func applyIndustry(name string) error {
+	if err := validateIndustry(name); err != nil {
+		return err
+	}
+	activeIndustry = industryPacks[name]
+	activeVariant.Prompt = classificationPrompt
+	if activeIndustry == nil {
+		activeSpamKeywords = spamKeywords
+		spamKeywordPattern = keywordPattern(spamKeywords)
+		return nil
+	}
+	allowed := make(map[string]bool)
+	for _, k := range activeIndustry.Allowed {
+		allowed[k] = true
+	}
+	var keywords []string
+	for _, k := range spamKeywords {
+		if !allowed[k] {
+			keywords = append(keywords, k)
+		}
+	}
+	activeSpamKeywords = append(keywords, activeIndustry.Extra...)
+	spamKeywordPattern = keywordPattern(activeSpamKeywords)
+	if activeIndustry.expected == nil {
+		activeIndustry.expected = keywordPattern(activeIndustry.Expected)
+	}
+	activeVariant.Prompt = withWebsiteContext(classificationPrompt, activeIndustry.Context)
+	return nil
+}
+
+// keywordPattern matches any of keywords as a case-insensitive whole word.
+func keywordPattern(keywords []string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)\b(` + strings.Join(keywords, "|") + `)\b`)
+}
+
+// withWebsiteContext replaces the website context section of a prompt.
+func withWebsiteContext(prompt, context string) string {
+	const start, end = "**Website Context:**\n", "\n\n**CONTENT TO ANALYZE:**"
+	i := strings.Index(prompt, start)
+	j := strings.Index(prompt, end)
+	if i < 0 || j < i {
+		return prompt
+	}
+	return prompt[:i+len(start)] + context + prompt[j:]
+}
+
+// offTopic reports whether a post links off-site without its title or
+// content using any of the active pack's expected terms. It is always false
+// without a pack.
+func offTopic(p *Post, externalLinks int) bool {
+	if activeIndustry == nil || externalLinks == 0 {
+		return false
+	}
+	return !activeIndustry.expected.MatchString(p.Title + "\n" + tagPattern.ReplaceAllString(p.Content, " "))
+}
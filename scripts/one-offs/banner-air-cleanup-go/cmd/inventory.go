@@ -0,0 +1,409 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	inventorySource   string
+	inventoryOutput   string
+	inventoryFormat   string
+	inventoryBaseURL  string
+	inventoryDryRun   bool
+	inventoryLabelKey string
+)
+
+// Base URLs of the hosted control panel APIs. Plesk and cPanel run on the
+// customer's own server, so their URLs come from the environment.
+const (
+	gridPaneAPI = "https://my.gridpane.com/oauth/api/v1"
+	runCloudAPI = "https://manage.runcloud.io/api/v3"
+)
+
+var inventoryCmd = &cobra.Command{
+	Use:   "inventory",
+	Short: "Build the --sites manifest from a control panel or Docker labels.",
+	Long: `Lists the WordPress sites known to a hosting control panel, or the running
+containers carrying a Docker label, and writes them as a sites manifest.
+Settings already in the manifest for a site (AI provider, profile, ...) are
+kept; sites that disappeared are dropped and new ones added, so the fleet
+list never drifts from what is actually hosted.
+
+Sources and their credentials (always read from the environment):
+
+  docker    containers labelled hubstack.enable=true; hubstack.profile,
+            hubstack.window, hubstack.wp-flags, hubstack.ai-provider and
+            hubstack.ai-api-key-env labels set the matching manifest fields
+  gridpane  GRIDPANE_API_TOKEN
+  runcloud  RUNCLOUD_API_TOKEN
+  plesk     PLESK_URL, PLESK_API_KEY
+  cpanel    CPANEL_URL, CPANEL_USER, CPANEL_API_TOKEN
+
+Control panels know domains, not containers; --container-format maps a domain
+to its container name.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runInventory(context.Background())
+	},
+}
+
+func init() {
+	inventoryCmd.Flags().StringVar(&inventorySource, "source", "docker", "Where to list sites from: docker, gridpane, runcloud, plesk or cpanel.")
+	inventoryCmd.Flags().StringVar(&inventoryOutput, "output", "", "Sites manifest to update (default --sites, or sites.json).")
+	inventoryCmd.Flags().StringVar(&inventoryFormat, "container-format", "wp_{{.Name}}", "Go template mapping a control panel domain to its container; fields .Domain and .Name (its first label, e.g. bannerair for bannerair.com).")
+	inventoryCmd.Flags().StringVar(&inventoryBaseURL, "api-base-url", "", "Override the control panel API base URL, e.g. for a proxy.")
+	inventoryCmd.Flags().StringVar(&inventoryLabelKey, "label-prefix", "hubstack", "Prefix of the Docker labels read by --source=docker.")
+	inventoryCmd.Flags().BoolVar(&inventoryDryRun, "dry-run", false, "Show which sites would be added or removed without writing the manifest.")
+	rootCmd.AddCommand(inventoryCmd)
+}
+
+// inventorySite is a site found by an importer.
+type inventorySite struct {
+	Domain string
+	Config SiteConfig // Container plus any settings the source knows
+}
+
+func runInventory(ctx context.Context) {
+	path := firstNonEmpty(inventoryOutput, sitesManifestPath, "sites.json")
+
+	var found []inventorySite
+	var err error
+	switch inventorySource {
+	case "docker":
+		found, err = dockerInventory(ctx)
+	case "gridpane", "runcloud", "plesk", "cpanel":
+		var domains []string
+		if domains, err = panelDomains(ctx, inventorySource); err == nil {
+			found, err = domainSites(domains, inventoryFormat)
+		}
+	default:
+		fatalf("Unknown inventory source %q; expected docker, gridpane, runcloud, plesk or cpanel.", inventorySource)
+	}
+	if err != nil {
+		fatalf("Failed to list sites from %s: %v", inventorySource, err)
+	}
+
+	current := &SitesManifest{}
+	if _, statErr := os.Stat(path); statErr == nil {
+		if current, err = loadSitesManifest(path); err != nil {
+			fatal(err)
+		}
+	}
+	if len(found) == 0 && len(current.Sites) > 0 {
+		fatalf("%s listed no sites; refusing to empty %s.", inventorySource, path)
+	}
+	merged, added, removed := mergeInventory(current, found, inventorySource == "docker")
+	for _, c := range added {
+		log.Printf("+ %s", c)
+	}
+	for _, c := range removed {
+		log.Printf("- %s", c)
+	}
+	log.Printf("%d site(s) from %s: %d added, %d removed.", len(merged.Sites), inventorySource, len(added), len(removed))
+	if inventoryDryRun {
+		return
+	}
+
+	data, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		fatal(err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		fatalf("Failed to write sites manifest: %v", err)
+	}
+	log.Printf("Wrote %s", path)
+}
+
+// mergeInventory keeps the manifest entries of sites still found, adds new
+// ones and drops the rest. With override, settings from the source replace
+// those in the manifest; otherwise the manifest's hand-made settings win.
+func mergeInventory(current *SitesManifest, found []inventorySite, override bool) (*SitesManifest, []string, []string) {
+	existing := make(map[string]SiteConfig)
+	for _, s := range current.Sites {
+		existing[s.Container] = s
+	}
+	merged := &SitesManifest{}
+	seen := make(map[string]bool)
+	var added, removed []string
+	for _, f := range found {
+		name := f.Config.Container
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		site, ok := existing[name]
+		switch {
+		case !ok:
+			site = f.Config
+			added = append(added, strings.TrimSuffix(name+" ("+f.Domain+")", " ()"))
+		case override:
+			site = overlaySite(site, f.Config)
+		}
+		merged.Sites = append(merged.Sites, site)
+	}
+	for _, s := range current.Sites {
+		if !seen[s.Container] {
+			removed = append(removed, s.Container)
+		}
+	}
+	sort.Slice(merged.Sites, func(i, j int) bool { return merged.Sites[i].Container < merged.Sites[j].Container })
+	return merged, added, removed
+}
+
+// overlaySite replaces the fields of base that the source sets.
+func overlaySite(base, from SiteConfig) SiteConfig {
+	base.Profile = firstNonEmpty(from.Profile, base.Profile)
+	base.Window = firstNonEmpty(from.Window, base.Window)
+	base.WPFlags = firstNonEmpty(from.WPFlags, base.WPFlags)
+	base.AIProvider = firstNonEmpty(from.AIProvider, base.AIProvider)
+	base.AIAPIKeyEnv = firstNonEmpty(from.AIAPIKeyEnv, base.AIAPIKeyEnv)
+	return base
+}
+
+// dockerInventory lists running containers labelled <prefix>.enable=true.
+func dockerInventory(ctx context.Context) ([]inventorySite, error) {
+	out, err := exec.CommandContext(ctx, "docker", "ps", "-q", "--filter", "label="+inventoryLabelKey+".enable=true").Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing containers: %w", err)
+	}
+	ids := strings.Fields(string(out))
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	out, err = exec.CommandContext(ctx, "docker", append([]string{"inspect"}, ids...)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("inspecting containers: %w", err)
+	}
+	var containers []struct {
+		Name   string `json:"Name"`
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"Config"`
+	}
+	if err := json.Unmarshal(out, &containers); err != nil {
+		return nil, fmt.Errorf("parsing docker inspect: %w", err)
+	}
+	var sites []inventorySite
+	for _, c := range containers {
+		label := func(name string) string { return c.Config.Labels[inventoryLabelKey+"."+name] }
+		sites = append(sites, inventorySite{Config: SiteConfig{
+			Container:   strings.TrimPrefix(c.Name, "/"),
+			Profile:     label("profile"),
+			Window:      label("window"),
+			WPFlags:     label("wp-flags"),
+			AIProvider:  label("ai-provider"),
+			AIAPIKeyEnv: label("ai-api-key-env"),
+		}})
+	}
+	return sites, nil
+}
+
+// domainSites maps control panel domains to containers.
+func domainSites(domains []string, format string) ([]inventorySite, error) {
+	tmpl, err := template.New("container").Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("parsing --container-format: %w", err)
+	}
+	var sites []inventorySite
+	for _, domain := range domains {
+		domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "www.")
+		if domain == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(domain, ".")
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, struct{ Domain, Name string }{domain, name}); err != nil {
+			return nil, fmt.Errorf("mapping %s to a container: %w", domain, err)
+		}
+		sites = append(sites, inventorySite{Domain: domain, Config: SiteConfig{Container: buf.String()}})
+	}
+	return sites, nil
+}
+
+// panelDomains lists the WordPress domains hosted on a control panel.
+func panelDomains(ctx context.Context, source string) ([]string, error) {
+	env := func(name string) (string, error) {
+		if v := os.Getenv(name); v != "" {
+			return v, nil
+		}
+		return "", fmt.Errorf("%s is not set", name)
+	}
+
+	switch source {
+	case "gridpane":
+		token, err := env("GRIDPANE_API_TOKEN")
+		if err != nil {
+			return nil, err
+		}
+		base := firstNonEmpty(inventoryBaseURL, gridPaneAPI)
+		var domains []string
+		for page := 1; ; page++ {
+			var resp struct {
+				Data []struct {
+					URL string `json:"url"`
+				} `json:"data"`
+				Meta struct {
+					LastPage int `json:"last_page"`
+				} `json:"meta"`
+			}
+			if err := getJSON(ctx, fmt.Sprintf("%s/site?per_page=100&page=%d", base, page),
+				map[string]string{"Authorization": "Bearer " + token}, &resp); err != nil {
+				return nil, err
+			}
+			for _, s := range resp.Data {
+				domains = append(domains, s.URL)
+			}
+			if page >= resp.Meta.LastPage {
+				return domains, nil
+			}
+		}
+
+	case "runcloud":
+		token, err := env("RUNCLOUD_API_TOKEN")
+		if err != nil {
+			return nil, err
+		}
+		base := firstNonEmpty(inventoryBaseURL, runCloudAPI)
+		headers := map[string]string{"Authorization": "Bearer " + token}
+		type page struct {
+			Data []struct {
+				ID   int    `json:"id"`
+				Name string `json:"name"`
+			} `json:"data"`
+			Meta struct {
+				Pagination struct {
+					TotalPages int `json:"total_pages"`
+				} `json:"pagination"`
+			} `json:"meta"`
+		}
+		list := func(path string) ([]int, []string, error) {
+			var ids []int
+			var names []string
+			for n := 1; ; n++ {
+				var resp page
+				if err := getJSON(ctx, fmt.Sprintf("%s%s?page=%d", base, path, n), headers, &resp); err != nil {
+					return nil, nil, err
+				}
+				for _, d := range resp.Data {
+					ids = append(ids, d.ID)
+					names = append(names, d.Name)
+				}
+				if n >= resp.Meta.Pagination.TotalPages {
+					return ids, names, nil
+				}
+			}
+		}
+		servers, _, err := list("/servers")
+		if err != nil {
+			return nil, err
+		}
+		var domains []string
+		for _, server := range servers {
+			apps, _, err := list(fmt.Sprintf("/servers/%d/webapps", server))
+			if err != nil {
+				return nil, err
+			}
+			for _, app := range apps {
+				_, names, err := list(fmt.Sprintf("/servers/%d/webapps/%d/domains", server, app))
+				if err != nil {
+					return nil, err
+				}
+				if len(names) > 0 {
+					domains = append(domains, names[0])
+				}
+			}
+		}
+		return domains, nil
+
+	case "plesk":
+		base, err := env("PLESK_URL")
+		if err != nil {
+			return nil, err
+		}
+		key, err := env("PLESK_API_KEY")
+		if err != nil {
+			return nil, err
+		}
+		var resp []struct {
+			Name string `json:"name"`
+		}
+		if err := getJSON(ctx, strings.TrimSuffix(firstNonEmpty(inventoryBaseURL, base), "/")+"/api/v2/domains",
+			map[string]string{"X-API-Key": key}, &resp); err != nil {
+			return nil, err
+		}
+		var domains []string
+		for _, d := range resp {
+			domains = append(domains, d.Name)
+		}
+		return domains, nil
+
+	case "cpanel":
+		base, err := env("CPANEL_URL")
+		if err != nil {
+			return nil, err
+		}
+		user, err := env("CPANEL_USER")
+		if err != nil {
+			return nil, err
+		}
+		token, err := env("CPANEL_API_TOKEN")
+		if err != nil {
+			return nil, err
+		}
+		var resp struct {
+			Data struct {
+				MainDomain   string   `json:"main_domain"`
+				AddonDomains []string `json:"addon_domains"`
+			} `json:"data"`
+			Errors []string `json:"errors"`
+		}
+		if err := getJSON(ctx, strings.TrimSuffix(firstNonEmpty(inventoryBaseURL, base), "/")+"/execute/DomainInfo/list_domains",
+			map[string]string{"Authorization": "cpanel " + user + ":" + token}, &resp); err != nil {
+			return nil, err
+		}
+		if len(resp.Errors) > 0 {
+			return nil, fmt.Errorf("cPanel: %s", strings.Join(resp.Errors, "; "))
+		}
+		return append([]string{resp.Data.MainDomain}, resp.Data.AddonDomains...), nil
+	}
+	return nil, fmt.Errorf("unknown source %q", source)
+}
+
+func getJSON(ctx context.Context, url string, headers map[string]string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s: %s", url, resp.Status, bytes.TrimSpace(raw))
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("parsing %s: %w", url, err)
+	}
+	return nil
+}
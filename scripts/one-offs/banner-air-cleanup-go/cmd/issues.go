@@ -0,0 +1,324 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+var (
+	issueTracker string
+	issueRepo    string
+	issueAPIURL  string
+	issueLabels  []string
+)
+
+// issueTrackers maps --issue-tracker to the default API URL and the
+// environment variable holding the token.
+var issueTrackers = map[string]struct{ api, tokenEnv string }{
+	"github": {"https://api.github.com", "GITHUB_TOKEN"},
+	"gitlab": {"https://gitlab.com/api/v4", "GITLAB_TOKEN"},
+}
+
+// Longest issue description each tracker accepts, less some room to spare.
+var issueBodyLimits = map[string]int{"github": 65000, "gitlab": 1000000}
+
+// issueMaxFlagged caps the flagged posts listed in the issue itself.
+const issueMaxFlagged = 50
+
+//go:embed templates/issue.md.tmpl
+var issueTemplateText string
+
+var issueTemplate = texttemplate.Must(texttemplate.New("issue").Funcs(reportFuncs).Funcs(texttemplate.FuncMap{
+	// cell keeps a value on one line of a markdown table.
+	"cell": func(s string) string {
+		return strings.ReplaceAll(strings.Join(strings.Fields(s), " "), "|", `\|`)
+	},
+}).Parse(issueTemplateText))
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&issueTracker, "issue-tracker", "", "Open or update an issue per site with each run's findings: github or gitlab (token in $GITHUB_TOKEN or $GITLAB_TOKEN).")
+	rootCmd.PersistentFlags().StringVar(&issueRepo, "issue-repo", "", "Repository the issues are filed in: owner/repo on GitHub, group/project on GitLab.")
+	rootCmd.PersistentFlags().StringVar(&issueAPIURL, "issue-api-url", "", "API base URL, for GitHub Enterprise or self-hosted GitLab (default the public service).")
+	rootCmd.PersistentFlags().StringSliceVar(&issueLabels, "issue-labels", []string{"banner-air-cleanup"}, "Labels put on the issues; a site's open issue is found by these labels and its title.")
+}
+
+func validateIssueTracker() error {
+	if issueTracker == "" {
+		return nil
+	}
+	if _, ok := issueTrackers[issueTracker]; !ok {
+		return fmt.Errorf("unknown --issue-tracker %q; expected github or gitlab", issueTracker)
+	}
+	if strings.Count(issueRepo, "/") < 1 || (issueTracker == "github" && strings.Count(issueRepo, "/") != 1) {
+		return fmt.Errorf("--issue-repo must be owner/repo on GitHub or group/project on GitLab")
+	}
+	if len(issueLabels) == 0 {
+		return fmt.Errorf("--issue-labels must name at least one label, to find a site's issue by")
+	}
+	return nil
+}
+
+// IssueData is what the issue template renders.
+type IssueData struct {
+	Site          string
+	RunTag        string
+	GeneratedAt   time.Time
+	IncidentID    string
+	Note          string
+	Total         int
+	Spam          int
+	Uncertain     int
+	Flagged       []Post
+	MoreFlagged   int
+	OtherFindings []struct {
+		Type  string
+		Count int
+	}
+	Attachments []IssueAttachment
+}
+
+// IssueAttachment is a markdown report of the run, included in the issue.
+type IssueAttachment struct {
+	Name      string
+	Content   string
+	Truncated bool
+}
+
+func newIssueData(data *ReportData) *IssueData {
+	d := &IssueData{
+		Site: data.Container, RunTag: runManifest.RunTag, GeneratedAt: data.GeneratedAt,
+		IncidentID: data.IncidentID, Note: data.Note,
+		Spam: data.Classifications["Spam"], Uncertain: data.Classifications["Uncertain"],
+	}
+	for _, n := range data.Classifications {
+		d.Total += n
+	}
+	for _, p := range data.Posts {
+		if findingSeverity(p.AIClassification) == "" {
+			continue
+		}
+		if len(d.Flagged) == issueMaxFlagged {
+			d.MoreFlagged++
+			continue
+		}
+		d.Flagged = append(d.Flagged, p)
+	}
+	counts := map[string]int{}
+	for _, f := range data.Findings {
+		counts[f.Type]++
+	}
+	for t, n := range counts {
+		d.OtherFindings = append(d.OtherFindings, struct {
+			Type  string
+			Count int
+		}{t, n})
+	}
+	sort.Slice(d.OtherFindings, func(i, j int) bool { return d.OtherFindings[i].Type < d.OtherFindings[j].Type })
+
+	// Markdown reports from --report-template are attached in full.
+	for _, path := range runManifest.Outputs {
+		if filepath.Ext(path) != ".md" {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Warning: could not attach %s to the issue: %v", path, err)
+			continue
+		}
+		d.Attachments = append(d.Attachments, IssueAttachment{Name: filepath.Base(path), Content: string(content)})
+	}
+	return d
+}
+
+// render renders the issue body, cutting attached reports short if the body
+// would exceed limit.
+func (d *IssueData) render(limit int) (string, error) {
+	for {
+		var b strings.Builder
+		if err := issueTemplate.Execute(&b, d); err != nil {
+			return "", err
+		}
+		over := b.Len() - limit
+		if over <= 0 {
+			return b.String(), nil
+		}
+		// Cut the last attachment that still has content.
+		j := len(d.Attachments) - 1
+		for j >= 0 && d.Attachments[j].Content == "" {
+			j--
+		}
+		if j < 0 {
+			return strings.ToValidUTF8(b.String()[:limit], ""), nil
+		}
+		a := &d.Attachments[j]
+		a.Content = strings.ToValidUTF8(a.Content[:max(len(a.Content)-over-100, 0)], "")
+		a.Truncated = true
+	}
+}
+
+// fileSiteIssue opens the site's issue, or updates its description and
+// comments on it when it is already open. A site without flagged posts and
+// without an open issue gets none.
+func fileSiteIssue(ctx context.Context, data *ReportData) error {
+	tracker := issueTrackers[issueTracker]
+	token := os.Getenv(tracker.tokenEnv)
+	if token == "" {
+		return fmt.Errorf("%s is not set", tracker.tokenEnv)
+	}
+	c := &issueClient{kind: issueTracker, api: strings.TrimSuffix(firstNonEmpty(issueAPIURL, tracker.api), "/"), token: token}
+
+	d := newIssueData(data)
+	title := fmt.Sprintf("Spam findings on %s", d.Site)
+	existing, err := c.find(ctx, title)
+	if err != nil {
+		return fmt.Errorf("looking for the open issue: %w", err)
+	}
+	if existing == nil && len(d.Flagged) == 0 {
+		log.Printf("No flagged posts on %s; no issue opened.", d.Site)
+		return nil
+	}
+	body, err := d.render(issueBodyLimits[issueTracker])
+	if err != nil {
+		return fmt.Errorf("rendering issue: %w", err)
+	}
+	if existing == nil {
+		created, err := c.create(ctx, title, body)
+		if err != nil {
+			return fmt.Errorf("opening issue: %w", err)
+		}
+		log.Printf("Opened issue %s for %s.", created.url, d.Site)
+		return nil
+	}
+	if err := c.update(ctx, existing, body); err != nil {
+		return fmt.Errorf("updating issue %s: %w", existing.url, err)
+	}
+	comment := fmt.Sprintf("Run `%s`: %d Spam, %d Uncertain of %d post(s). The description now shows this run's findings.", d.RunTag, d.Spam, d.Uncertain, d.Total)
+	if err := c.comment(ctx, existing, comment); err != nil {
+		return fmt.Errorf("commenting on issue %s: %w", existing.url, err)
+	}
+	log.Printf("Updated issue %s for %s.", existing.url, d.Site)
+	return nil
+}
+
+// issueClient speaks the issues API of GitHub or GitLab.
+type issueClient struct {
+	kind, api, token string
+}
+
+type trackedIssue struct {
+	number int // GitHub's number, GitLab's iid
+	url    string
+}
+
+func (c *issueClient) repoPath() string {
+	if c.kind == "gitlab" {
+		return "/projects/" + url.PathEscape(issueRepo) + "/issues"
+	}
+	return "/repos/" + issueRepo + "/issues"
+}
+
+func (c *issueClient) find(ctx context.Context, title string) (*trackedIssue, error) {
+	q := url.Values{"labels": {strings.Join(issueLabels, ",")}, "per_page": {"100"}, "state": {"open"}}
+	if c.kind == "gitlab" {
+		q.Set("state", "opened")
+	}
+	var issues []struct {
+		Number      int             `json:"number"`
+		IID         int             `json:"iid"`
+		Title       string          `json:"title"`
+		HTMLURL     string          `json:"html_url"`
+		WebURL      string          `json:"web_url"`
+		PullRequest json.RawMessage `json:"pull_request"`
+	}
+	if err := c.do(ctx, http.MethodGet, c.repoPath()+"?"+q.Encode(), nil, &issues); err != nil {
+		return nil, err
+	}
+	for _, i := range issues {
+		if i.Title == title && i.PullRequest == nil {
+			return &trackedIssue{number: max(i.Number, i.IID), url: firstNonEmpty(i.HTMLURL, i.WebURL)}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *issueClient) create(ctx context.Context, title, body string) (*trackedIssue, error) {
+	req := map[string]any{"title": title, "body": body, "labels": issueLabels}
+	if c.kind == "gitlab" {
+		req = map[string]any{"title": title, "description": body, "labels": strings.Join(issueLabels, ",")}
+	}
+	var created struct {
+		Number  int    `json:"number"`
+		IID     int    `json:"iid"`
+		HTMLURL string `json:"html_url"`
+		WebURL  string `json:"web_url"`
+	}
+	if err := c.do(ctx, http.MethodPost, c.repoPath(), req, &created); err != nil {
+		return nil, err
+	}
+	return &trackedIssue{number: max(created.Number, created.IID), url: firstNonEmpty(created.HTMLURL, created.WebURL)}, nil
+}
+
+func (c *issueClient) update(ctx context.Context, issue *trackedIssue, body string) error {
+	path := fmt.Sprintf("%s/%d", c.repoPath(), issue.number)
+	if c.kind == "gitlab" {
+		return c.do(ctx, http.MethodPut, path, map[string]any{"description": body}, nil)
+	}
+	return c.do(ctx, http.MethodPatch, path, map[string]any{"body": body}, nil)
+}
+
+func (c *issueClient) comment(ctx context.Context, issue *trackedIssue, body string) error {
+	path := fmt.Sprintf("%s/%d/comments", c.repoPath(), issue.number)
+	if c.kind == "gitlab" {
+		path = fmt.Sprintf("%s/%d/notes", c.repoPath(), issue.number)
+	}
+	return c.do(ctx, http.MethodPost, path, map[string]any{"body": body}, nil)
+}
+
+func (c *issueClient) do(ctx context.Context, method, path string, body, out any) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.api+path, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.kind == "gitlab" {
+		req.Header.Set("PRIVATE-TOKEN", c.token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		reply, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s returned %s: %s", method, path, resp.Status, strings.TrimSpace(string(reply)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"path"
+	"strings"
+	"sync"
+)
+
+// wpPath is the --wp-path flag: where WordPress core lives in the container,
+// passed to wp-cli as --path. Empty means detect it.
+var wpPath string
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&wpPath, "wp-path", "", "WordPress core directory in the container, passed to wp-cli as --path, e.g. /srv/www/site/web/wp (default: detected for standard, Bedrock and common subdirectory installs).")
+}
+
+// wpCoreCandidates are the directories, relative to the container's working
+// directory, where WordPress core is looked for: standard installs, Bedrock's
+// web/wp, and common subdirectory installs.
+var wpCoreCandidates = []string{".", "web/wp", "wp", "wordpress", "public/wp", "public", "htdocs"}
+
+// wpLayoutProbe reports, in one docker exec, whether a wp-cli config file
+// already tells wp-cli where WordPress is, the first candidate directory
+// holding WordPress core, and whether the directory is a Bedrock project.
+var wpLayoutProbe = `pwd
+if [ -f wp-cli.yml ] || [ -f wp-cli.local.yml ]; then echo config; fi
+for d in ` + strings.Join(wpCoreCandidates, " ") + `; do
+	if [ -f "$d/wp-includes/version.php" ]; then echo "core $d"; break; fi
+done
+if [ -f config/application.php ] && [ -d web/app ]; then echo bedrock; fi`
+
+// WPLayout is where a site's WordPress lives in its container, for sites
+// that do not use the standard layout.
+type WPLayout struct {
+	// Path is given to wp-cli as --path; empty when wp-cli finds WordPress
+	// by itself.
+	Path string `json:"path,omitempty"`
+	// ContentDir is the wp-content directory when it is not in core's
+	// directory, relative to the working directory.
+	ContentDir string `json:"content_dir,omitempty"`
+	Bedrock    bool   `json:"bedrock,omitempty"`
+	// Detected is false when the path came from --wp-path or wp_path.
+	Detected bool `json:"detected,omitempty"`
+}
+
+var wpLayouts struct {
+	sync.Mutex
+	byContainer map[string]*WPLayout
+}
+
+// activeWPLayout returns the current site's layout, detecting it on first
+// use. It is nil for the standard layout, in simulation, and when --wp-flags
+// already sets --path.
+func activeWPLayout(ctx context.Context) *WPLayout {
+	if simulate || strings.Contains(" "+wpFlags, " --path=") {
+		return nil
+	}
+	if wpPath != "" {
+		return &WPLayout{Path: wpPath}
+	}
+	wpLayouts.Lock()
+	defer wpLayouts.Unlock()
+	if l, ok := wpLayouts.byContainer[dockerContainer]; ok {
+		return l
+	}
+	l := detectWPLayout(ctx)
+	if wpLayouts.byContainer == nil {
+		wpLayouts.byContainer = make(map[string]*WPLayout)
+	}
+	wpLayouts.byContainer[dockerContainer] = l
+	return l
+}
+
+// detectWPLayout probes the container's working directory. A failed probe
+// leaves wp-cli to its defaults, which is what every site got before.
+func detectWPLayout(ctx context.Context) *WPLayout {
+	out, err := dockerExec(ctx, dockerContainer, "sh", "-c", wpLayoutProbe)
+	if err != nil {
+		log.Printf("Warning: could not detect the WordPress layout of %s: %v", dockerContainer, err)
+		return nil
+	}
+	var cwd, core string
+	var config, bedrock bool
+	for i, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		switch {
+		case i == 0:
+			cwd = line
+		case line == "config":
+			config = true
+		case line == "bedrock":
+			bedrock = true
+		case strings.HasPrefix(line, "core "):
+			core = strings.TrimPrefix(line, "core ")
+		}
+	}
+	l := &WPLayout{Bedrock: bedrock, Detected: true}
+	if bedrock {
+		l.ContentDir = "web/app"
+	}
+	switch {
+	case config:
+		// wp-cli.yml, as Bedrock ships it, already points wp-cli at core.
+	case core == "":
+		log.Printf("Warning: no WordPress core found under %s in %s; set --wp-path if wp-cli cannot find it.", cwd, dockerContainer)
+	case core != ".":
+		l.Path = path.Join(cwd, core)
+	}
+	if l.Path == "" && !l.Bedrock {
+		return nil
+	}
+	if l.Bedrock {
+		log.Printf("Detected a Bedrock install on %s.", dockerContainer)
+	}
+	if l.Path != "" {
+		log.Printf("Found WordPress core in %s on %s; running wp-cli with --path=%s.", core, dockerContainer, l.Path)
+	}
+	return l
+}
+
+// wpPathFlags returns the --path flag for the current site's wp calls.
+func wpPathFlags(ctx context.Context) []string {
+	if l := activeWPLayout(ctx); l != nil && l.Path != "" {
+		return []string{"--path=" + l.Path}
+	}
+	return nil
+}
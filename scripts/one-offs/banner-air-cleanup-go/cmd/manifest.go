@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+var runManifestPath string
+
+// RunManifest describes one run of one site: what was processed, what was
+// skipped or degraded, and which files were written. It is the record to
+// check when a run's results look different from the last one.
+type RunManifest struct {
+	Site             string           `json:"site"`
+	RunTag           string           `json:"run_tag"`
+	StartedAt        time.Time        `json:"started_at"`
+	FinishedAt       time.Time        `json:"finished_at"`
+	Posts            int              `json:"posts"`
+	Findings         int              `json:"findings"`
+	Sample           int              `json:"sample,omitempty"`
+	Seed             uint64           `json:"seed,omitempty"`
+	IncidentID       string           `json:"incident_id,omitempty"`
+	Note             string           `json:"note,omitempty"`
+	SkippedAnalyzers []Analyzer       `json:"skipped_analyzers,omitempty"`
+	WPFallback       *WPFallback      `json:"wp_fallback,omitempty"`
+	WPLayout         *WPLayout        `json:"wp_layout,omitempty"`
+	Companion        *CompanionStatus `json:"companion,omitempty"`
+	ContainerImpact  *ContainerImpact `json:"container_impact,omitempty"`
+	Phases           []PhaseTiming    `json:"phases,omitempty"`
+	Outputs          []string         `json:"outputs"`
+}
+
+// runManifest is the manifest of the site being processed.
+var runManifest = &RunManifest{}
+
+// recordOutput adds a written file to the current run manifest.
+func recordOutput(path string) {
+	runManifest.Outputs = append(runManifest.Outputs, path)
+}
+
+func writeRunManifest(path string, manifest *RunManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing run manifest %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	auditMedia     bool
+	mediaCSVPath   string
+	editorialHours string
+)
+
+// attachmentsPHP lists every attachment with the image metadata WordPress
+// extracted from its EXIF/IPTC data at upload, in a single wp-cli script.
+const attachmentsPHP = `$out = array();
+foreach (get_posts(array('post_type' => 'attachment', 'post_status' => 'any', 'numberposts' => -1)) as $p) {
+	$m = wp_get_attachment_metadata($p->ID);
+	$out[] = array(
+		'ID' => $p->ID,
+		'post_title' => $p->post_title,
+		'post_author' => $p->post_author,
+		'post_date' => $p->post_date,
+		'post_mime_type' => $p->post_mime_type,
+		'file' => get_post_meta($p->ID, '_wp_attached_file', true),
+		'image_meta' => (is_array($m) && isset($m['image_meta'])) ? $m['image_meta'] : null,
+	);
+}
+echo wp_json_encode($out);`
+
+// Attachment is an uploaded media item.
+type Attachment struct {
+	ID        int        `json:"ID"`
+	Title     string     `json:"post_title"`
+	AuthorID  string     `json:"post_author"`
+	Date      string     `json:"post_date"`
+	MimeType  string     `json:"post_mime_type"`
+	File      string     `json:"file"`
+	ImageMeta *ImageMeta `json:"image_meta"`
+	Flags     []string   `json:"-"`
+}
+
+// ImageMeta is the subset of WordPress's image_meta worth auditing.
+type ImageMeta struct {
+	Camera           looseString `json:"camera"`
+	CreatedTimestamp looseString `json:"created_timestamp"`
+	Credit           looseString `json:"credit"`
+	Copyright        looseString `json:"copyright"`
+}
+
+// looseString accepts JSON strings and numbers; image_meta values are
+// whatever PHP's EXIF reader produced.
+type looseString string
+
+func (s *looseString) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*s = looseString(str)
+		return nil
+	}
+	var num json.Number
+	if err := json.Unmarshal(data, &num); err == nil {
+		*s = looseString(num.String())
+		return nil
+	}
+	*s = ""
+	return nil
+}
+
+// Created returns the EXIF creation time, if the image recorded one.
+func (m *ImageMeta) Created() string {
+	if m == nil {
+		return ""
+	}
+	ts, err := strconv.ParseInt(string(m.CreatedTimestamp), 10, 64)
+	if err != nil || ts <= 0 {
+		return ""
+	}
+	return time.Unix(ts, 0).UTC().Format("2006-01-02 15:04:05")
+}
+
+var mediaCSVHeaders = []string{"attachment_id", "title", "mime_type", "uploaded_at", "uploader_id", "uploader_login",
+	"file", "exif_created", "exif_camera", "exif_credit", "exif_copyright", "flags"}
+
+func getAttachments(ctx context.Context) ([]Attachment, error) {
+	output, err := runWPScript(ctx, "attachments.php", attachmentsPHP)
+	if err != nil {
+		return nil, err
+	}
+	var attachments []Attachment
+	if err := json.Unmarshal([]byte(output), &attachments); err != nil {
+		return nil, fmt.Errorf("parsing attachment list: %w", err)
+	}
+	sort.Slice(attachments, func(i, j int) bool { return attachments[i].ID < attachments[j].ID })
+	return attachments, nil
+}
+
+// parseHourRange parses "8-18" into the set of hours from 8 up to and
+// including 18. A range may wrap past midnight, e.g. "22-6".
+func parseHourRange(spec string) (map[int]bool, error) {
+	from, to, ok := strings.Cut(spec, "-")
+	start, err1 := strconv.Atoi(strings.TrimSpace(from))
+	end, err2 := strconv.Atoi(strings.TrimSpace(to))
+	if !ok || err1 != nil || err2 != nil || start < 0 || start > 23 || end < 0 || end > 23 {
+		return nil, fmt.Errorf("invalid hour range %q; expected e.g. 8-18", spec)
+	}
+	hours := make(map[int]bool)
+	for h := start; ; h = (h + 1) % 24 {
+		hours[h] = true
+		if h == end {
+			break
+		}
+	}
+	return hours, nil
+}
+
+// editorialWindow returns the hours of day (site time) in which the site's
+// legitimate content is normally published: hours with at least one
+// legitimate post, widened by an hour either side. Sites with too little
+// history fall back to 07-19.
+func editorialWindow(posts []Post) map[int]bool {
+	if editorialHours != "" {
+		// Validated in PersistentPreRunE, before anything is scanned.
+		hours, _ := parseHourRange(editorialHours)
+		return hours
+	}
+
+	const minHistory = 20
+	seen := make(map[int]bool)
+	count := 0
+	for _, p := range posts {
+		if p.AIClassification == "Spam" {
+			continue
+		}
+		t, err := time.Parse("2006-01-02 15:04:05", p.Date)
+		if err != nil {
+			continue
+		}
+		seen[t.Hour()] = true
+		count++
+	}
+	if count < minHistory {
+		hours, _ := parseHourRange("7-19")
+		return hours
+	}
+	hours := make(map[int]bool)
+	for h := range seen {
+		hours[(h+23)%24] = true
+		hours[h] = true
+		hours[(h+1)%24] = true
+	}
+	return hours
+}
+
+// auditAttachments flags uploads made outside the editorial window or by
+// authors with spam-classified posts, returning them as typed findings.
+func auditAttachments(attachments []Attachment, posts []Post, authors map[string]Author) []Finding {
+	window := editorialWindow(posts)
+	flaggedUsers := make(map[string]bool)
+	for _, p := range posts {
+		if p.AIClassification == "Spam" {
+			flaggedUsers[p.AuthorID] = true
+		}
+	}
+
+	var findings []Finding
+	for i := range attachments {
+		a := &attachments[i]
+		detail := fmt.Sprintf("uploaded %s by %s (%s)", a.Date, uploaderLabel(a.AuthorID, authors), a.File)
+		if created := a.ImageMeta.Created(); created != "" {
+			detail += "; EXIF created " + created
+		}
+		if a.ImageMeta != nil && a.ImageMeta.Camera != "" {
+			detail += "; camera " + string(a.ImageMeta.Camera)
+		}
+
+		flag := func(kind, classification string) {
+			a.Flags = append(a.Flags, kind)
+			findings = append(findings, Finding{
+				Site:           dockerContainer,
+				Type:           "media:" + kind,
+				Subject:        "attachment:" + strconv.Itoa(a.ID),
+				PostID:         a.ID,
+				Title:          a.Title,
+				Classification: classification,
+				Detail:         detail,
+			})
+		}
+		if t, err := time.Parse("2006-01-02 15:04:05", a.Date); err == nil && !window[t.Hour()] {
+			flag("off-hours-upload", "Uncertain")
+		}
+		if flaggedUsers[a.AuthorID] {
+			flag("flagged-user-upload", "Spam")
+		}
+	}
+	return findings
+}
+
+func uploaderLabel(id string, authors map[string]Author) string {
+	if a, ok := authors[id]; ok && a.Login != "" {
+		return a.Login
+	}
+	return "user " + id
+}
+
+func writeMediaCSV(path string, attachments []Attachment, authors map[string]Author) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating media file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write(mediaCSVHeaders); err != nil {
+		return err
+	}
+	for _, a := range attachments {
+		var camera, credit, copyright string
+		if a.ImageMeta != nil {
+			camera, credit, copyright = string(a.ImageMeta.Camera), string(a.ImageMeta.Credit), string(a.ImageMeta.Copyright)
+		}
+		if err := writer.Write(validRecord([]string{strconv.Itoa(a.ID), a.Title, a.MimeType, a.Date, a.AuthorID,
+			authors[a.AuthorID].Login, a.File, a.ImageMeta.Created(), camera, credit, copyright,
+			strings.Join(a.Flags, ";")})); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// runMediaAudit lists the site's uploads, writes the media inventory and
+// returns findings for suspicious uploads.
+func runMediaAudit(ctx context.Context, posts []Post, authors map[string]Author) []Finding {
+	log.Println("Auditing media uploads...")
+	attachments, err := getAttachments(ctx)
+	if err != nil {
+		log.Printf("Warning: media audit failed: %v", err)
+		return nil
+	}
+	findings := auditAttachments(attachments, posts, authors)
+	if err := writeMediaCSV(mediaCSVPath, attachments, authors); err != nil {
+		log.Printf("Warning: could not write media inventory: %v", err)
+	} else {
+		recordOutput(mediaCSVPath)
+		log.Printf("Wrote %d attachment(s) to %s; %d flagged.", len(attachments), mediaCSVPath, len(findings))
+	}
+	return findings
+}
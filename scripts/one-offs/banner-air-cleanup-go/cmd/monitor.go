@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/spf13/cobra"
+)
+
+var monitorInterval time.Duration
+
+var monitorCmd = &cobra.Command{
+	Use:   "monitor",
+	Short: "Re-scan the site on an interval and send notification digests.",
+	Long: `Runs the extraction (and AI analysis, if enabled) every --interval, storing
+results in --store-path. Newly flagged content is queued and delivered per
+--notify-route, so critical findings can go to Slack right away while
+low-severity ones are batched into an hourly or daily email digest.
+
+Routes are written severity=channel:schedule. Severities are critical (Spam),
+low (Uncertain) and overdue (still open past --sla, sent once per finding);
+channels are slack, email and webhook; schedules are immediate, hourly and daily.
+Check that every channel delivers with notify test before relying on them.
+
+Webhook routes POST the findings as JSON to --webhook-url in batches of
+--webhook-batch-size. Each request carries an X-Hubstack-Signature header,
+"sha256=" and the hex HMAC-SHA256 of "<X-Hubstack-Timestamp>.<body>" keyed
+with HUBSTACK_WEBHOOK_SECRET, and an X-Hubstack-Delivery ID that is the same
+on every retry of a batch. Network errors, 429 and 5xx responses are retried
+with exponential backoff; batches that still fail stay queued.
+
+When PAGERDUTY_ROUTING_KEY and/or OPSGENIE_API_KEY are set, an incident is
+opened whenever a scan sees active injection: more than
+--incident-spam-threshold posts flagged as spam within --incident-window (new
+posts or existing ones reclassified), or WordPress
+core files failing checksum verification. Incidents use one dedup key per site
+and kind, so repeated scans update rather than duplicate them.
+
+When the AI quota runs out mid-scan, the remaining posts go to the retry queue
+without being sent. If the quota resets before the next scan, monitor wakes
+just after the reset to re-analyze them.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runMonitor()
+	},
+}
+
+func init() {
+	monitorCmd.Flags().DurationVar(&monitorInterval, "interval", time.Hour, "Time between scans.")
+	monitorCmd.Flags().StringSliceVar(&notifyRoutes, "notify-route", []string{"critical=slack:immediate", "low=email:daily", "overdue=email:daily"}, "Notification routes as severity=channel:schedule.")
+	monitorCmd.Flags().IntVar(&incidentSpamThreshold, "incident-spam-threshold", 10, "Open an incident when more than this many posts are flagged as spam within --incident-window.")
+	monitorCmd.Flags().DurationVar(&incidentWindow, "incident-window", time.Hour, "Window for counting posts flagged as spam.")
+	monitorCmd.Flags().BoolVar(&checkCoreChecksums, "check-core-checksums", true, "Verify WordPress core checksums on every scan.")
+	monitorCmd.Flags().StringVar(&opsgenieAPIURL, "opsgenie-api-url", "https://api.opsgenie.com/v2/alerts", "Opsgenie alerts endpoint (use api.eu.opsgenie.com for EU accounts).")
+	rootCmd.PersistentFlags().StringVar(&slackWebhookURL, "slack-webhook-url", "", "Slack incoming webhook URL for notifications.")
+	rootCmd.PersistentFlags().StringVar(&smtpAddr, "smtp-addr", "", "SMTP server host:port for email notifications.")
+	rootCmd.PersistentFlags().StringVar(&smtpFrom, "smtp-from", "", "Sender address for email notifications.")
+	rootCmd.PersistentFlags().StringSliceVar(&smtpTo, "smtp-to", nil, "Recipient address(es) for email notifications.")
+	rootCmd.PersistentFlags().StringVar(&smtpUser, "smtp-user", "", "SMTP username; the password is read from SMTP_PASSWORD.")
+	rootCmd.AddCommand(monitorCmd)
+}
+
+func runMonitor() {
+	if storePath == "" {
+		fatal("--store-path is required for monitor.")
+	}
+	routes, err := parseNotifyRoutes(notifyRoutes)
+	if err != nil {
+		fatal(err)
+	}
+	if err := godotenv.Load(); err != nil {
+		log.Println("Warning: .env file not found, relying on environment variables.")
+	}
+
+	for {
+		db, err := openStore(storePath)
+		if err != nil {
+			fatalf("Failed to open store: %v", err)
+		}
+		err = forEachSiteOrSkip(func() error {
+			if err := runSite(); err != nil {
+				return fmt.Errorf("scan of %s failed: %w", dockerContainer, err)
+			}
+			queued, err := queueNotifications(db, dockerContainer)
+			if err != nil {
+				log.Printf("Warning: could not queue notifications: %v", err)
+			} else if queued > 0 {
+				log.Printf("Queued %d newly flagged item(s) for notification.", queued)
+			}
+			if overdue, err := queueOverdueNotifications(db, dockerContainer); err != nil {
+				log.Printf("Warning: could not queue overdue notifications: %v", err)
+			} else if overdue > 0 {
+				log.Printf("Queued %d finding(s) open past the %s SLA for notification.", overdue, formatAge(findingSLA))
+			}
+			checkIncidents(db)
+			return nil
+		}, func(err error) {
+			log.Printf("Warning: skipping the site: %v", err)
+		})
+		if err != nil {
+			log.Printf("Warning: skipping this scan: %v", err)
+		}
+		if err := dispatchNotifications(db, routes, time.Now()); err != nil {
+			log.Printf("Warning: could not dispatch notifications: %v", err)
+		}
+		db.Close()
+
+		awaitNextScan(time.Now().Add(monitorInterval))
+	}
+}
+
+// quotaResetMargin is added to a quota reset so the retry does not race the
+// provider's clock.
+const quotaResetMargin = time.Minute
+
+// awaitNextScan sleeps until next, first re-analyzing the retry queues after
+// any AI quota that resets before then.
+func awaitNextScan(next time.Time) {
+	for {
+		var resetAt time.Time
+		for _, q := range exhaustedQuotas() {
+			if t := q.exhaustedUntil(); resetAt.IsZero() || t.Before(resetAt) {
+				resetAt = t
+			}
+		}
+		if resetAt.IsZero() || resetAt.Add(quotaResetMargin).After(next) {
+			break
+		}
+		log.Printf("AI quota resets at %s; re-analyzing queued posts then.", resetAt.Format(time.RFC3339))
+		time.Sleep(time.Until(resetAt.Add(quotaResetMargin)))
+		err := forEachSiteOrSkip(func() error {
+			if _, err := os.Stat(retryFilePath); err == nil {
+				runAnalyze()
+			}
+			return nil
+		}, func(err error) {
+			log.Printf("Warning: skipping the site: %v", err)
+		})
+		if err != nil {
+			log.Printf("Warning: skipping the re-analysis: %v", err)
+		}
+	}
+	log.Printf("Next scan in %s.", time.Until(next).Round(time.Second))
+	time.Sleep(time.Until(next))
+}
+
+func checkIncidents(db *sql.DB) {
+	if inc, err := detectSpamBurst(db, dockerContainer, time.Now()); err != nil {
+		log.Printf("Warning: %v", err)
+	} else if inc != nil {
+		log.Printf("Active injection: %s", inc.Summary)
+		raiseIncident(*inc)
+	}
+
+	if inc, err := detectHoneytokenTampering(context.Background(), db, dockerContainer); err != nil {
+		log.Printf("Warning: could not verify the honeytoken: %v", err)
+	} else if inc != nil {
+		log.Printf("Honeytoken tampered: %s", inc.Summary)
+		raiseIncident(*inc)
+	}
+
+	if !checkCoreChecksums {
+		return
+	}
+	if inc, err := detectCoreModifications(context.Background(), dockerContainer); err != nil {
+		log.Printf("Warning: %v", err)
+	} else if inc != nil {
+		log.Printf("Active injection: %s", inc.Summary)
+		raiseIncident(*inc)
+	}
+}
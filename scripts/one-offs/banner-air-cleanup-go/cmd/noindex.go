@@ -0,0 +1,303 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	noindexOutputDir string
+	noindexStates    []string
+	noindexWhere     string
+	noindexApply     bool
+	noindexRemove    bool
+)
+
+// noindexPluginFile is the mu-plugin --apply installs; its fixed name lets
+// --remove find it again.
+const noindexPluginFile = "hubstack-spam-noindex.php"
+
+// removeNoindexPluginPHP deletes the installed mu-plugin, if any, and prints
+// its path.
+var removeNoindexPluginPHP = fmt.Sprintf(`$f = WPMU_PLUGIN_DIR . '/%s';
+if (file_exists($f) && !unlink($f)) { WP_CLI::error("could not delete $f"); }
+echo $f;`, noindexPluginFile)
+
+var noindexCmd = &cobra.Command{
+	Use:   "noindex",
+	Short: "Recommend robots.txt and noindex rules for spam awaiting cleanup.",
+	Long: `Limits the SEO damage of confirmed spam while cleanup is still being
+reviewed. For Spam findings in review state triaged or approved (see --states),
+and categories and tags found to be spam archives, it writes to --output-dir:
+
+  urls.txt                  the public URLs, e.g. for Search Console removals
+  robots.txt                Disallow rules to add to the site's robots.txt
+  ` + noindexPluginFile + `  a mu-plugin sending noindex for those pages
+
+Disallow only stops crawling: pages already indexed drop out only once a
+crawler sees noindex, which it cannot on a disallowed URL. Use the mu-plugin
+for indexed spam and robots.txt for spam not yet crawled.
+
+With --apply the mu-plugin is installed in the site's mu-plugins directory;
+remove it with --remove once cleanup is done. Permalinks are read from the
+live site.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if storePath == "" {
+			fatal("--store-path is required for noindex.")
+		}
+		for _, s := range noindexStates {
+			if !slices.Contains(reviewStates, s) {
+				fatalf("Unknown review state %q; expected one of %s.", s, strings.Join(reviewStates, ", "))
+			}
+		}
+		forEachSite(runNoindex)
+	},
+}
+
+func init() {
+	noindexCmd.Flags().StringVar(&noindexOutputDir, "output-dir", "noindex", "Directory for urls.txt, robots.txt and the mu-plugin (a subdirectory per site with --sites).")
+	noindexCmd.Flags().StringSliceVar(&noindexStates, "states", []string{"triaged", "approved"}, "Review states of the Spam findings to cover.")
+	noindexCmd.Flags().StringVar(&noindexWhere, "where", "", "Extra SQL filter over the findings.")
+	noindexCmd.Flags().BoolVar(&noindexApply, "apply", false, "Install the noindex mu-plugin on the site.")
+	noindexCmd.Flags().BoolVar(&noindexRemove, "remove", false, "Remove a previously installed noindex mu-plugin and write nothing else.")
+	rootCmd.AddCommand(noindexCmd)
+}
+
+// spamURL is a public URL to keep out of search results.
+type spamURL struct {
+	Kind string // "post" or a taxonomy
+	ID   int
+	URL  string
+}
+
+func runNoindex() {
+	ctx := context.Background()
+	if noindexRemove {
+		path, err := runWPScript(ctx, "remove-noindex.php", removeNoindexPluginPHP)
+		if err != nil {
+			fatalf("Failed to remove the noindex mu-plugin from %s: %v", dockerContainer, err)
+		}
+		log.Printf("Removed %s from %s.", strings.TrimSpace(path), dockerContainer)
+		return
+	}
+
+	db, err := openStoreReadOnly(storePath)
+	if err != nil {
+		fatalf("Failed to open store: %v", err)
+	}
+	defer db.Close()
+
+	states := make([]string, len(noindexStates))
+	for i, s := range noindexStates {
+		states[i] = "'" + s + "'"
+	}
+	where := siteFilter(dockerContainer) + " AND classification = 'Spam' AND review_state IN (" + strings.Join(states, ", ") + ")"
+	if strings.TrimSpace(noindexWhere) != "" {
+		where += " AND (" + noindexWhere + ")"
+	}
+	posts, err := queryFindings(db, where)
+	if err != nil {
+		fatalf("Failed to select findings: %v", err)
+	}
+	archives, err := queryTypedFindings(db, siteFilter(dockerContainer)+" AND type = 'spam-archive' AND classification = 'Spam'")
+	if err != nil {
+		fatalf("Failed to select spam archives: %v", err)
+	}
+	if len(posts) == 0 && len(archives) == 0 {
+		log.Printf("No confirmed spam awaiting cleanup on %s.", dockerContainer)
+		return
+	}
+
+	urls, err := spamURLs(ctx, posts, archives)
+	if err != nil {
+		fatalf("Failed to read permalinks from %s: %v", dockerContainer, err)
+	}
+	plugin, err := noindexPlugin(urls)
+	if err != nil {
+		fatalf("Failed to generate the noindex mu-plugin: %v", err)
+	}
+
+	dir := noindexOutputDir
+	if sitesManifestPath != "" {
+		dir = filepath.Join(dir, dockerContainer)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		fatalf("Failed to create %s: %v", dir, err)
+	}
+	var list strings.Builder
+	for _, u := range urls {
+		list.WriteString(u.URL + "\n")
+	}
+	files := map[string][]byte{
+		"urls.txt":        []byte(list.String()),
+		"robots.txt":      robotsRules(urls),
+		noindexPluginFile: plugin,
+	}
+	for _, name := range []string{"urls.txt", "robots.txt", noindexPluginFile} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, files[name], 0o644); err != nil {
+			fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	log.Printf("Wrote noindex recommendations for %d URL(s) on %s to %s.", len(urls), dockerContainer, dir)
+
+	if noindexApply {
+		php := fmt.Sprintf(`$f = WPMU_PLUGIN_DIR . '/%s';
+if (!wp_mkdir_p(WPMU_PLUGIN_DIR) || file_put_contents($f, base64_decode('%s')) === false) { WP_CLI::error("could not write $f"); }
+echo $f;`, noindexPluginFile, base64.StdEncoding.EncodeToString(plugin))
+		path, err := runWPScript(ctx, "install-noindex.php", php)
+		if err != nil {
+			fatalf("Failed to install the noindex mu-plugin on %s: %v", dockerContainer, err)
+		}
+		log.Printf("Installed %s on %s; remove it with noindex --remove once cleanup is done.", strings.TrimSpace(path), dockerContainer)
+	}
+}
+
+// spamURLs looks up the current permalinks of spam posts and archives. GUIDs
+// are not used: they keep the URL a post was created under.
+func spamURLs(ctx context.Context, posts []Post, archives []Finding) ([]spamURL, error) {
+	var urls []spamURL
+	if len(posts) > 0 {
+		ids := make([]string, len(posts))
+		for i, p := range posts {
+			ids[i] = strconv.Itoa(p.ID)
+		}
+		output, err := runWPCommand(ctx, []string{"post", "list", "--post__in=" + strings.Join(ids, ","),
+			"--post_type=any", "--post_status=any", "--fields=ID,url", "--format=json"})
+		if err != nil {
+			return nil, err
+		}
+		var links []struct {
+			ID  int    `json:"ID"`
+			URL string `json:"url"`
+		}
+		if err := json.Unmarshal([]byte(output), &links); err != nil {
+			return nil, fmt.Errorf("parsing permalinks: %w", err)
+		}
+		for _, l := range links {
+			urls = append(urls, spamURL{Kind: "post", ID: l.ID, URL: l.URL})
+		}
+	}
+	if len(archives) > 0 {
+		terms, err := getTerms(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range archives {
+			taxonomy, id, ok := parseTermSubject(f.Subject)
+			if !ok {
+				continue
+			}
+			for _, t := range terms {
+				if t.Taxonomy == taxonomy && t.ID == id && t.Link != "" {
+					urls = append(urls, spamURL{Kind: taxonomy, ID: id, URL: t.Link})
+				}
+			}
+		}
+	}
+	return urls, nil
+}
+
+// robotsRules returns Disallow rules for the URLs' paths, to merge into the
+// site's robots.txt.
+func robotsRules(urls []spamURL) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Temporary rules for spam awaiting cleanup on %s, generated %s.\n", dockerContainer, time.Now().Format("2006-01-02"))
+	b.WriteString("# Remove them once the URLs are deleted. Disallowed pages that are already\n")
+	b.WriteString("# indexed stay indexed; use the noindex mu-plugin for those instead.\n")
+	b.WriteString("User-agent: *\n")
+	seen := make(map[string]bool)
+	for _, s := range urls {
+		u, err := url.Parse(s.URL)
+		if err != nil {
+			continue
+		}
+		path := u.EscapedPath()
+		if u.RawQuery != "" {
+			// End-anchored, or /?p=12 would also block /?p=123
+			path = firstNonEmpty(path, "/") + "?" + u.RawQuery + "$"
+		}
+		if path == "" || path == "/" {
+			continue
+		}
+		if !seen[path] {
+			seen[path] = true
+			b.WriteString("Disallow: " + path + "\n")
+		}
+	}
+	return b.Bytes()
+}
+
+var noindexPluginTemplate = template.Must(template.New("noindex").Parse(`<?php
+/*
+ * Plugin Name: Hubstack spam noindex
+ * Description: Temporary noindex for spam awaiting cleanup on {{.Site}}, generated {{.Generated}} by banner-air-cleanup. Delete this file once cleanup is done.
+ */
+
+function hubstack_spam_noindex() {
+	$posts = array({{.Posts}});
+	$terms = array({{range $tax, $ids := .Terms}}'{{$tax}}' => array({{$ids}}), {{end}});
+	if (is_singular()) {
+		return in_array((int) get_queried_object_id(), $posts, true);
+	}
+	if (is_category() || is_tag()) {
+		$term = get_queried_object();
+		return isset($terms[$term->taxonomy]) && in_array((int) $term->term_id, $terms[$term->taxonomy], true);
+	}
+	return false;
+}
+
+add_filter('wp_robots', function ($robots) {
+	if (hubstack_spam_noindex()) {
+		$robots['noindex'] = true;
+		$robots['nofollow'] = true;
+	}
+	return $robots;
+});
+
+add_action('template_redirect', function () {
+	if (hubstack_spam_noindex()) {
+		header('X-Robots-Tag: noindex, nofollow', true);
+	}
+});
+`))
+
+// noindexPlugin generates the mu-plugin that marks the URLs' pages noindex,
+// both in the robots meta tag and the X-Robots-Tag header.
+func noindexPlugin(urls []spamURL) ([]byte, error) {
+	var posts []string
+	terms := make(map[string][]string)
+	for _, u := range urls {
+		if u.Kind == "post" {
+			posts = append(posts, strconv.Itoa(u.ID))
+		} else {
+			terms[u.Kind] = append(terms[u.Kind], strconv.Itoa(u.ID))
+		}
+	}
+	joined := make(map[string]string, len(terms))
+	for tax, ids := range terms {
+		joined[tax] = strings.Join(ids, ", ")
+	}
+	var b bytes.Buffer
+	err := noindexPluginTemplate.Execute(&b, map[string]any{
+		"Site":      dockerContainer,
+		"Generated": time.Now().Format("2006-01-02"),
+		"Posts":     strings.Join(posts, ", "),
+		"Terms":     joined,
+	})
+	return b.Bytes(), err
+}
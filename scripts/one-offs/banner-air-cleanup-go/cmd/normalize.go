@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// normalizers is the --normalizers flag; it replaces the profile's list.
+var normalizers []string
+
+func init() {
+	rootCmd.PersistentFlags().StringSliceVar(&normalizers, "normalizers", nil, "Steps applied, in order, to content before it is sent to the AI: "+strings.Join(normalizerNames(), ", ")+" (default: the profile's \"normalizers\", else none).")
+}
+
+// contentNormalizers are the steps a normalizer pipeline is built from. Each
+// rewrites the content sent to the AI only; heuristics, hashes and reports
+// always see the content as stored. Add a step by adding an entry.
+var contentNormalizers = map[string]func(string) string{
+	// strip-blocks removes the block editor's <!-- wp:... --> delimiters,
+	// which carry no content but use up the input limit.
+	"strip-blocks": func(s string) string {
+		return blockCommentPattern.ReplaceAllString(s, "")
+	},
+	// strip-shortcodes removes shortcode tags and keeps enclosed content.
+	"strip-shortcodes": func(s string) string {
+		return shortcodePattern.ReplaceAllString(s, " ")
+	},
+	// expand-shortcodes replaces shortcode tags with their attribute values,
+	// so a link or text passed to a shortcode is seen as content. It does
+	// not run WordPress's shortcode handlers.
+	"expand-shortcodes": func(s string) string {
+		return shortcodePattern.ReplaceAllStringFunc(s, func(tag string) string {
+			var values []string
+			for _, m := range shortcodeAttrPattern.FindAllStringSubmatch(tag, -1) {
+				values = append(values, firstNonEmpty(m[1], m[2], m[3]))
+			}
+			return " " + strings.Join(values, " ") + " "
+		})
+	},
+	// strip-html reduces markup to text, keeping each link's target after
+	// its text, since where content links to matters most for spam.
+	"strip-html": func(s string) string {
+		s = scriptStylePattern.ReplaceAllString(s, " ")
+		s = anchorPattern.ReplaceAllString(s, "$2 ($1)")
+		s = html.UnescapeString(tagPattern.ReplaceAllString(s, " "))
+		return strings.Join(strings.Fields(s), " ")
+	},
+	// redact-pii replaces email addresses and phone numbers, for engagements
+	// whose content must not reach a third-party model as is.
+	"redact-pii": func(s string) string {
+		s = emailPattern.ReplaceAllString(s, "[email]")
+		return phonePattern.ReplaceAllStringFunc(s, func(m string) string {
+			digits := 0
+			for _, r := range m {
+				if r >= '0' && r <= '9' {
+					digits++
+				}
+			}
+			if digits < 10 || digits > 15 {
+				return m // not a phone number, e.g. a date
+			}
+			return "[phone]"
+		})
+	},
+}
+
+var (
+	blockCommentPattern  = regexp.MustCompile(`<!--\s*/?wp:[\s\S]*?-->`)
+	shortcodePattern     = regexp.MustCompile(`\[/?[A-Za-z][\w-]*(?:\s[^\[\]]*)?/?\]`)
+	shortcodeAttrPattern = regexp.MustCompile(`=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'\]]+))`)
+	scriptStylePattern   = regexp.MustCompile(`(?is)<(script|style)\b.*?</(?:script|style)>`)
+	anchorPattern        = regexp.MustCompile(`(?is)<a\b[^>]*?\bhref\s*=\s*["']([^"']*)["'][^>]*>(.*?)</a>`)
+	emailPattern         = regexp.MustCompile(`[\w.+-]+@[\w-]+(?:\.[\w-]+)+`)
+	phonePattern         = regexp.MustCompile(`\+?\d[\d\s().-]{7,}\d`)
+)
+
+func normalizerNames() []string {
+	names := make([]string, 0, len(contentNormalizers))
+	for name := range contentNormalizers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func validateNormalizers(names []string) error {
+	for _, name := range names {
+		if _, ok := contentNormalizers[name]; !ok {
+			return fmt.Errorf("unknown normalizer %q; expected %s", name, strings.Join(normalizerNames(), ", "))
+		}
+	}
+	return nil
+}
+
+// normalizeContent runs content through the named steps in order.
+func normalizeContent(content string, names []string) string {
+	for _, name := range names {
+		content = contentNormalizers[name](content)
+	}
+	return content
+}
+
+// normalizerPipeline is the current site's pipeline: --normalizers, else
+// the profile's.
+func normalizerPipeline() []string {
+	if len(normalizers) > 0 {
+		return slices.Clone(normalizers)
+	}
+	return slices.Clone(activeProfile.Normalizers)
+}
@@ -0,0 +1,310 @@
+package cmd
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Notification settings shared by every command that sends notifications.
+var (
+	slackWebhookURL string
+	smtpAddr        string
+	smtpFrom        string
+	smtpTo          []string
+	smtpUser        string
+	notifyRoutes    []string
+)
+
+// notifySeverities are the severities a route can be written for.
+var notifySeverities = []string{"critical", "low", "overdue"}
+
+// digestSchedules maps a route schedule to how often it is flushed.
+var digestSchedules = map[string]time.Duration{
+	"immediate": 0,
+	"hourly":    time.Hour,
+	"daily":     24 * time.Hour,
+}
+
+// NotifyRoute sends findings of one severity to one channel on a schedule.
+type NotifyRoute struct {
+	Severity string
+	Channel  string
+	Schedule string
+}
+
+func (r NotifyRoute) String() string {
+	return fmt.Sprintf("%s=%s:%s", r.Severity, r.Channel, r.Schedule)
+}
+
+// QueuedNotification is a flagged finding waiting to be sent. Reason is
+// "flagged" when it was first flagged and "overdue" once it is open past the
+// SLA.
+type QueuedNotification struct {
+	Site           string
+	PostID         int
+	Title          string
+	GUID           string
+	Classification string
+	Severity       string
+	Reason         string
+	QueuedAt       string
+	FirstSeen      string
+	FlaggedAt      string
+}
+
+// findingSeverity maps a classification onto a notification severity; an
+// empty result means the finding is not flagged.
+func findingSeverity(classification string) string {
+	switch classification {
+	case "Spam":
+		return "critical"
+	case "Uncertain":
+		return "low"
+	}
+	return ""
+}
+
+// parseNotifyRoutes parses routes written as severity=channel:schedule, for
+// example critical=slack:immediate, low=email:daily or critical=webhook:immediate.
+func parseNotifyRoutes(specs []string) ([]NotifyRoute, error) {
+	var routes []NotifyRoute
+	for _, spec := range specs {
+		severity, rest, ok1 := strings.Cut(spec, "=")
+		channel, schedule, ok2 := strings.Cut(rest, ":")
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("invalid route %q, expected severity=channel:schedule", spec)
+		}
+		if !slices.Contains(notifySeverities, severity) {
+			return nil, fmt.Errorf("invalid route %q: severity must be %s", spec, strings.Join(notifySeverities, ", "))
+		}
+		if channel != "slack" && channel != "email" && channel != "webhook" {
+			return nil, fmt.Errorf("invalid route %q: unknown channel %q", spec, channel)
+		}
+		if _, ok := digestSchedules[schedule]; !ok {
+			return nil, fmt.Errorf("invalid route %q: schedule must be immediate, hourly or daily", spec)
+		}
+		routes = append(routes, NotifyRoute{Severity: severity, Channel: channel, Schedule: schedule})
+	}
+	return routes, nil
+}
+
+// queueNotifications queues every flagged finding of a site's latest run
+// that has not been queued before with the same classification.
+func queueNotifications(db *sql.DB, site string) (int, error) {
+	rows, err := db.Query(`SELECT post_id, classification FROM findings
+		WHERE site = ? AND run_id = (SELECT MAX(id) FROM runs WHERE site = ?)`, site, site)
+	if err != nil {
+		return 0, fmt.Errorf("reading latest findings: %w", err)
+	}
+	type candidate struct {
+		postID         int
+		classification string
+	}
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.postID, &c.classification); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	queued := 0
+	for _, c := range candidates {
+		severity := findingSeverity(c.classification)
+		if severity == "" {
+			continue
+		}
+		res, err := db.Exec(`INSERT OR IGNORE INTO notifications (site, post_id, severity, classification, queued_at)
+			VALUES (?, ?, ?, ?, ?)`, site, c.postID, severity, c.classification, now)
+		if err != nil {
+			return 0, fmt.Errorf("queueing post %d: %w", c.postID, err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			queued++
+		}
+	}
+	return queued, nil
+}
+
+// dispatchNotifications sends queued notifications whose route is due. Routes
+// with an immediate schedule send on every call; digest routes send at most
+// once per period. Each route delivers every notification of its severity
+// once, whatever other routes have sent.
+func dispatchNotifications(db *sql.DB, routes []NotifyRoute, now time.Time) error {
+	for _, route := range routes {
+		var lastSent string
+		err := db.QueryRow(`SELECT last_sent_at FROM notification_routes WHERE route = ?`, route.String()).Scan(&lastSent)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if period := digestSchedules[route.Schedule]; period > 0 && lastSent != "" {
+			if last, err := time.Parse(time.RFC3339, lastSent); err == nil && now.Sub(last) < period {
+				continue
+			}
+		}
+
+		pending, err := pendingNotifications(db, route)
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			continue
+		}
+
+		// Webhooks can deliver some batches and fail on a later one; only
+		// what was delivered is marked sent.
+		delivered := len(pending)
+		if route.Channel == "webhook" {
+			delivered, err = sendWebhook(route.Severity, pending)
+		} else {
+			subject, body := formatDigest(route, pending)
+			if err = sendNotification(route.Channel, subject, body); err != nil {
+				delivered = 0
+			}
+		}
+		if err != nil {
+			log.Printf("Warning: could not send %s notifications via %s: %v", route.Severity, route.Channel, err)
+		}
+		if delivered == 0 {
+			continue
+		}
+
+		sentAt := now.UTC().Format(time.RFC3339)
+		for _, n := range pending[:delivered] {
+			if _, err := db.Exec(`INSERT OR IGNORE INTO notification_deliveries (route, site, post_id, classification, reason, delivered_at)
+				VALUES (?, ?, ?, ?, ?, ?)`, route.String(), n.Site, n.PostID, n.Classification, n.Reason, sentAt); err != nil {
+				return err
+			}
+			// sent_at records the first delivery by any route.
+			if _, err := db.Exec(`UPDATE notifications SET sent_at = ? WHERE site = ? AND post_id = ? AND classification = ? AND reason = ? AND sent_at = ''`,
+				sentAt, n.Site, n.PostID, n.Classification, n.Reason); err != nil {
+				return err
+			}
+		}
+		log.Printf("Sent %d %s notification(s) via %s.", delivered, route.Severity, route.Channel)
+		if err != nil {
+			continue // retry the rest on the next dispatch, whatever the schedule
+		}
+		if _, err := db.Exec(`INSERT INTO notification_routes (route, last_sent_at) VALUES (?, ?)
+			ON CONFLICT (route) DO UPDATE SET last_sent_at = excluded.last_sent_at`, route.String(), sentAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pendingNotifications lists the notifications of route's severity that
+// route has not delivered.
+func pendingNotifications(db *sql.DB, route NotifyRoute) ([]QueuedNotification, error) {
+	rows, err := db.Query(`SELECT n.site, n.post_id, f.post_title, f.post_guid, n.classification, n.severity,
+			n.reason, n.queued_at, f.first_seen, f.flagged_at
+		FROM notifications n JOIN findings f ON f.site = n.site AND f.post_id = n.post_id
+		WHERE n.severity = ? AND NOT EXISTS (SELECT 1 FROM notification_deliveries d
+			WHERE d.route = ? AND d.site = n.site AND d.post_id = n.post_id
+				AND d.classification = n.classification AND d.reason = n.reason)
+		ORDER BY n.site, n.queued_at, n.post_id`, route.Severity, route.String())
+	if err != nil {
+		return nil, fmt.Errorf("reading notification queue: %w", err)
+	}
+	defer rows.Close()
+
+	var pending []QueuedNotification
+	for rows.Next() {
+		var n QueuedNotification
+		if err := rows.Scan(&n.Site, &n.PostID, &n.Title, &n.GUID, &n.Classification, &n.Severity,
+			&n.Reason, &n.QueuedAt, &n.FirstSeen, &n.FlaggedAt); err != nil {
+			return nil, err
+		}
+		pending = append(pending, n)
+	}
+	return pending, rows.Err()
+}
+
+// formatDigest summarizes pending notifications as a subject and plain-text
+// body, listing at most 50 items.
+func formatDigest(route NotifyRoute, pending []QueuedNotification) (string, string) {
+	const maxItems = 50
+	sites := make(map[string]int)
+	for _, n := range pending {
+		sites[n.Site]++
+	}
+	subject := fmt.Sprintf("[%s] %d new flagged item(s) on %d site(s)", route.Severity, len(pending), len(sites))
+	if route.Severity == "overdue" {
+		subject = fmt.Sprintf("[overdue] %d flagged item(s) open longer than %s on %d site(s)", len(pending), formatAge(findingSLA), len(sites))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", subject)
+	for i, n := range pending {
+		if i == maxItems {
+			fmt.Fprintf(&b, "... and %d more\n", len(pending)-maxItems)
+			break
+		}
+		if n.Reason == "overdue" {
+			fmt.Fprintf(&b, "- %s post %d (%s, open since %s): %s %s\n", n.Site, n.PostID, n.Classification, n.FlaggedAt, n.Title, n.GUID)
+			continue
+		}
+		fmt.Fprintf(&b, "- %s post %d (%s): %s %s\n", n.Site, n.PostID, n.Classification, n.Title, n.GUID)
+	}
+	return subject, b.String()
+}
+
+func sendNotification(channel, subject, body string) error {
+	switch channel {
+	case "slack":
+		return sendSlack(body)
+	case "email":
+		return sendEmail(subject, body)
+	}
+	return fmt.Errorf("unknown channel %q", channel)
+}
+
+func sendSlack(text string) error {
+	if slackWebhookURL == "" {
+		return fmt.Errorf("--slack-webhook-url is not set")
+	}
+	payload, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Post(slackWebhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("slack webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// sendEmail sends a plain-text email; the SMTP password is read from the
+// SMTP_PASSWORD environment variable so it never appears in process listings.
+func sendEmail(subject, body string) error {
+	if smtpAddr == "" || smtpFrom == "" || len(smtpTo) == 0 {
+		return fmt.Errorf("--smtp-addr, --smtp-from and --smtp-to must be set")
+	}
+	var auth smtp.Auth
+	if smtpUser != "" {
+		host, _, _ := strings.Cut(smtpAddr, ":")
+		auth = smtp.PlainAuth("", smtpUser, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		smtpFrom, strings.Join(smtpTo, ", "), subject, strings.ReplaceAll(body, "\n", "\r\n"))
+	return smtp.SendMail(smtpAddr, auth, smtpFrom, smtpTo, []byte(msg))
+}
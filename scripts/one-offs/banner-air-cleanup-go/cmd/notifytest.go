@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/spf13/cobra"
+)
+
+var notifyTestChannels []string
+
+// smtpTestTimeout bounds connecting to the SMTP server, and four times it the
+// whole exchange, so a firewalled port fails instead of hanging.
+const smtpTestTimeout = 15 * time.Second
+
+var notifyCmd = &cobra.Command{
+	Use:   "notify",
+	Short: "Check the notification channels monitor delivers to.",
+}
+
+var notifyTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Send a test message through each configured notification channel.",
+	Long: `Sends a test message through every configured channel: Slack with
+--slack-webhook-url, email with --smtp-addr, and webhooks with --webhook-url,
+or only the ones named with --channel. Email is sent step by step, connecting,
+STARTTLS, authentication, sender, then each recipient, so a failure says which
+step failed and what to change.
+
+A test that passes shows the configuration is accepted; check that the
+message actually arrived, since spam filters can still drop it. Exits 1 when
+any channel fails.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runNotifyTest()
+	},
+}
+
+func init() {
+	notifyTestCmd.Flags().StringSliceVar(&notifyTestChannels, "channel", nil, "Channels to test: slack, email and/or webhook (default: every configured channel).")
+	notifyCmd.AddCommand(notifyTestCmd)
+	rootCmd.AddCommand(notifyCmd)
+}
+
+func runNotifyTest() {
+	if err := godotenv.Load(); err != nil {
+		log.Println("Warning: .env file not found, relying on environment variables.")
+	}
+	channels := notifyTestChannels
+	if len(channels) == 0 {
+		if slackWebhookURL != "" {
+			channels = append(channels, "slack")
+		}
+		if smtpAddr != "" {
+			channels = append(channels, "email")
+		}
+		if webhookURL != "" {
+			channels = append(channels, "webhook")
+		}
+		if len(channels) == 0 {
+			fatal("No notification channel is configured; set --slack-webhook-url, --smtp-addr or --webhook-url.")
+		}
+	}
+
+	host, _ := os.Hostname()
+	subject := "[test] banner-air-cleanup notification test"
+	body := fmt.Sprintf("%s\n\nThis is a test message from banner-air-cleanup on %s at %s. Flagged findings will be delivered here.\n",
+		subject, firstNonEmpty(host, "unknown host"), time.Now().Format(time.RFC1123))
+	failed := 0
+	for _, channel := range channels {
+		var err error
+		switch channel {
+		case "slack":
+			err = testSlack(body)
+		case "email":
+			err = testEmail(subject, body)
+		case "webhook":
+			err = testWebhook()
+		default:
+			err = fmt.Errorf("unknown channel; expected slack, email or webhook")
+		}
+		if err != nil {
+			failed++
+			log.Printf("%s: FAILED: %v", channel, err)
+			continue
+		}
+		log.Printf("%s: OK", channel)
+	}
+	if failed > 0 {
+		fatalf("%d of %d notification channel(s) failed.", failed, len(channels))
+	}
+}
+
+func testSlack(text string) error {
+	if slackWebhookURL == "" {
+		return fmt.Errorf("--slack-webhook-url is not set")
+	}
+	payload, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Post(slackWebhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("%w; check the URL and that the proxy, if any, allows hooks.slack.com", err)
+	}
+	defer resp.Body.Close()
+	reply, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	switch {
+	case resp.StatusCode < 300:
+		log.Printf("slack: test message posted.")
+		return nil
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return fmt.Errorf("slack returned %s (%s): the webhook was revoked, its channel archived, or the URL is mistyped; create a new incoming webhook", resp.Status, strings.TrimSpace(string(reply)))
+	}
+	return fmt.Errorf("slack returned %s (%s)", resp.Status, strings.TrimSpace(string(reply)))
+}
+
+// testEmail does what sendEmail does through net/smtp's lower-level client,
+// one step at a time, so each failure can be explained.
+func testEmail(subject, body string) error {
+	if smtpAddr == "" || smtpFrom == "" || len(smtpTo) == 0 {
+		return fmt.Errorf("--smtp-addr, --smtp-from and --smtp-to must be set")
+	}
+	host, port, err := net.SplitHostPort(smtpAddr)
+	if err != nil {
+		return fmt.Errorf("--smtp-addr %q must be host:port, e.g. smtp.example.com:587", smtpAddr)
+	}
+	if port == "465" {
+		return fmt.Errorf("port 465 uses implicit TLS, which is not supported; use the submission port 587, which upgrades with STARTTLS")
+	}
+	for _, addr := range append([]string{smtpFrom}, smtpTo...) {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return fmt.Errorf("%q is not a valid email address: %v", addr, err)
+		}
+	}
+	if smtpUser != "" && os.Getenv("SMTP_PASSWORD") == "" {
+		return fmt.Errorf("--smtp-user is set but SMTP_PASSWORD is empty; set it in the environment or .env")
+	}
+
+	conn, err := net.DialTimeout("tcp", smtpAddr, smtpTestTimeout)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) {
+			return fmt.Errorf("cannot resolve %s: check the host in --smtp-addr", host)
+		}
+		return fmt.Errorf("cannot connect to %s: %v; check the port and that outbound SMTP is not blocked by a firewall (many hosts block port 25)", smtpAddr, err)
+	}
+	conn.SetDeadline(time.Now().Add(4 * smtpTestTimeout))
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("%s did not answer as an SMTP server: %v", smtpAddr, err)
+	}
+	defer c.Close()
+
+	tlsOK := false
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}); err != nil {
+			return fmt.Errorf("STARTTLS with %s failed: %v; the server's certificate may not match %s or may not be trusted", smtpAddr, err, host)
+		}
+		tlsOK = true
+	}
+	if smtpUser != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			if !tlsOK {
+				return fmt.Errorf("%s offers neither STARTTLS nor authentication on this port; use the submission port 587", smtpAddr)
+			}
+			return fmt.Errorf("%s does not accept authentication; drop --smtp-user or use the submission port 587", smtpAddr)
+		}
+		if err := c.Auth(smtp.PlainAuth("", smtpUser, os.Getenv("SMTP_PASSWORD"), host)); err != nil {
+			if !tlsOK && !slices.Contains([]string{"localhost", "127.0.0.1", "::1"}, host) {
+				return fmt.Errorf("%s does not offer STARTTLS, so the password would be sent in clear: %v", smtpAddr, err)
+			}
+			return fmt.Errorf("%s rejected --smtp-user %s with SMTP_PASSWORD: %v", smtpAddr, smtpUser, err)
+		}
+	}
+	if err := c.Mail(smtpFrom); err != nil {
+		return fmt.Errorf("%s rejected the sender %s: %v; it must usually be an address the account may send as", smtpAddr, smtpFrom, err)
+	}
+	for _, to := range smtpTo {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("%s rejected the recipient %s: %v; relaying may need --smtp-user", smtpAddr, to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("%s refused the message: %v", smtpAddr, err)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		smtpFrom, strings.Join(smtpTo, ", "), subject, strings.ReplaceAll(body, "\n", "\r\n"))
+	if _, err := io.WriteString(w, msg); err != nil {
+		return fmt.Errorf("sending the message to %s: %v", smtpAddr, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("%s did not accept the message: %v", smtpAddr, err)
+	}
+	c.Quit()
+	if !tlsOK {
+		log.Printf("Warning: email: %s does not offer STARTTLS; notifications travel unencrypted.", smtpAddr)
+	}
+	log.Printf("email: test message accepted by %s for %s.", smtpAddr, strings.Join(smtpTo, ", "))
+	return nil
+}
+
+// testWebhook posts a signed batch without findings, once and without
+// retries, so a misconfigured receiver fails fast.
+func testWebhook() error {
+	if webhookURL == "" {
+		return fmt.Errorf("--webhook-url is not set")
+	}
+	secret := os.Getenv(webhookSecretEnv)
+	if secret == "" {
+		return fmt.Errorf("%s is not set; set it in the environment or .env to the secret the receiver verifies", webhookSecretEnv)
+	}
+	batch := WebhookBatch{Delivery: newDeliveryID(), Severity: "test", Batch: 1, Batches: 1, Findings: []WebhookFinding{}}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	if werr := postWebhook(body, batch.Delivery, []byte(secret)); werr != nil {
+		if werr.status == http.StatusUnauthorized || werr.status == http.StatusForbidden {
+			return fmt.Errorf("%v: the receiver rejected the signature; check that it verifies with the same %s", werr, webhookSecretEnv)
+		}
+		return werr
+	}
+	log.Printf("webhook: test delivery %s accepted.", batch.Delivery)
+	return nil
+}
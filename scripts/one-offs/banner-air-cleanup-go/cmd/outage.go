@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+
+	"google.golang.org/genai"
+)
+
+// aiOutageAfter is how many AI requests in a row must fail for the provider
+// to count as unavailable.
+var aiOutageAfter int
+
+func init() {
+	rootCmd.PersistentFlags().IntVar(&aiOutageAfter, "ai-outage-after", 5, "Consecutive AI requests failing with network, 5xx or authentication errors after which the rest of the site's posts are scored heuristically and queued for retry (0 to never give up).")
+}
+
+// aiStatusError is an error status from an AI provider's HTTP API.
+type aiStatusError struct {
+	Code int
+	Err  error
+}
+
+func (e *aiStatusError) Error() string { return e.Err.Error() }
+func (e *aiStatusError) Unwrap() error { return e.Err }
+
+// aiOutage tracks whether the AI provider is reachable during the current
+// site's run. Once tripped it stays tripped until the next site, so a
+// provider that is down costs a few requests per site, not one per post.
+var aiOutage struct {
+	sync.Mutex
+	consecutive int
+	reason      string
+	fallbacks   int
+}
+
+func resetAIOutage() {
+	aiOutage.Lock()
+	defer aiOutage.Unlock()
+	aiOutage.consecutive, aiOutage.reason, aiOutage.fallbacks = 0, "", 0
+}
+
+// aiUnavailable reports whether the provider was found to be down.
+func aiUnavailable() bool {
+	aiOutage.Lock()
+	defer aiOutage.Unlock()
+	return aiOutage.reason != ""
+}
+
+// recordAIOutcome counts a request's result towards the outage threshold.
+// Only failures that say nothing about the post do: a refused connection,
+// a timeout, a 5xx or a rejected key. Quota exhaustion has its own queue.
+func recordAIOutcome(err error) {
+	aiOutage.Lock()
+	defer aiOutage.Unlock()
+	if aiOutage.reason != "" {
+		return
+	}
+	if !isOutageError(err) {
+		aiOutage.consecutive = 0
+		return
+	}
+	aiOutage.consecutive++
+	if aiOutageAfter > 0 && aiOutage.consecutive >= aiOutageAfter {
+		aiOutage.reason = fmt.Sprintf("%d requests in a row failed, the last with: %v", aiOutage.consecutive, err)
+		log.Printf("Warning: the AI provider looks unavailable (%s); scoring the remaining posts on %s heuristically and queueing them for retry.", aiOutage.reason, dockerContainer)
+	}
+}
+
+func isOutageError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var qe *quotaError
+	if errors.As(err, &qe) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	code := 0
+	var apiErr genai.APIError
+	var statusErr *aiStatusError
+	switch {
+	case errors.As(err, &apiErr):
+		code = apiErr.Code
+	case errors.As(err, &statusErr):
+		code = statusErr.Code
+	}
+	return code >= 500 || code == http.StatusUnauthorized || code == http.StatusForbidden
+}
+
+// scoreWithoutAI scores a post with the local heuristics in place of the
+// unavailable AI, marking it so it is reported as such and retried.
+func scoreWithoutAI(post *Post) {
+	classifyHeuristically(post)
+	post.AIJustification = "AI provider unavailable; " + post.AIJustification
+	post.AIFallback = true
+	aiOutage.Lock()
+	aiOutage.fallbacks++
+	aiOutage.Unlock()
+}
+
+// aiOutageAnalyzer describes the outage for the report and manifest, or
+// returns nil if the provider stayed available.
+func aiOutageAnalyzer() *Analyzer {
+	aiOutage.Lock()
+	defer aiOutage.Unlock()
+	if aiOutage.reason == "" {
+		return nil
+	}
+	return &Analyzer{
+		Name:   "AI classification",
+		Reason: fmt.Sprintf("provider unavailable (%s); %d post(s) scored by local heuristics and queued for retry", aiOutage.reason, aiOutage.fallbacks),
+	}
+}
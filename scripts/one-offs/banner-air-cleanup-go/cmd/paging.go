@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+var (
+	pageSize    int
+	pageTimeout time.Duration
+)
+
+// Bounds of the auto-tuned page size. Pages grow while they come back well
+// under pageTargetDuration and pageTargetBytes and shrink when they exceed
+// either, so small sites list in one or two calls and sites with huge posts
+// or a slow database do not hit timeouts or exhaust PHP's memory.
+const (
+	pageSizeStart      = 500
+	pageSizeMin        = 25
+	pageSizeMax        = 5000
+	pageTargetDuration = 10 * time.Second
+	pageTargetBytes    = 8 << 20
+)
+
+func init() {
+	rootCmd.PersistentFlags().IntVar(&pageSize, "page-size", 0, "Posts per wp post list call when listing a site (0 tunes it from observed response sizes and durations).")
+	rootCmd.PersistentFlags().DurationVar(&pageTimeout, "page-timeout", 2*time.Minute, "Longest a single page of wp post list may take; a page that times out is retried at half the size.")
+}
+
+// pageTuner picks the size of the next page from how the previous ones went.
+type pageTuner struct {
+	size  int
+	fixed bool
+}
+
+func newPageTuner() *pageTuner {
+	if pageSize > 0 {
+		return &pageTuner{size: pageSize, fixed: true}
+	}
+	return &pageTuner{size: pageSizeStart}
+}
+
+// observe adjusts the size after a full page that took d and returned n bytes.
+func (t *pageTuner) observe(d time.Duration, n int) {
+	switch {
+	case t.fixed:
+	case d > pageTargetDuration || n > pageTargetBytes:
+		t.size = max(t.size/2, pageSizeMin)
+	case d < pageTargetDuration/4 && n < pageTargetBytes/4:
+		t.size = min(t.size*2, pageSizeMax)
+	}
+}
+
+// failed halves the size after a failed page and reports whether a smaller
+// page is worth trying.
+func (t *pageTuner) failed() bool {
+	if t.fixed || t.size <= pageSizeMin {
+		return false
+	}
+	t.size = max(t.size/2, pageSizeMin)
+	return true
+}
+
+// listPostsPaged runs wp post list with args in pages, in ascending ID order
+// so posts are neither skipped nor repeated between pages, and decodes the
+// rows of every page. Posts created during the listing are picked up at the
+// end; a post deleted during it can shift one other post out of the listing.
+func listPostsPaged[T any](ctx context.Context, args []string) ([]T, error) {
+	tuner := newPageTuner()
+	var all []T
+	pages := 0
+	for offset := 0; ; {
+		page := append(append([]string(nil), args...), "--orderby=ID", "--order=ASC",
+			"--posts_per_page="+strconv.Itoa(tuner.size), "--offset="+strconv.Itoa(offset))
+		pageCtx, cancel := context.WithTimeout(ctx, pageTimeout)
+		started := time.Now()
+		output, err := runWPCommand(pageCtx, page)
+		timedOut := pageCtx.Err() != nil && ctx.Err() == nil
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if timedOut {
+				err = fmt.Errorf("page of %d post(s) timed out after %s", tuner.size, pageTimeout)
+			}
+			size := tuner.size
+			if !tuner.failed() {
+				return nil, err
+			}
+			log.Printf("Warning: listing %d post(s) from offset %d failed on %s; retrying with %d: %v", size, offset, dockerContainer, tuner.size, err)
+			continue
+		}
+
+		var rows []T
+		if err := json.Unmarshal([]byte(output), &rows); err != nil {
+			return nil, fmt.Errorf("parsing posts from offset %d: %w", offset, err)
+		}
+		all = append(all, rows...)
+		pages++
+		if len(rows) < tuner.size {
+			break
+		}
+		offset += len(rows)
+		tuner.observe(time.Since(started), len(output))
+	}
+	if pages > 1 {
+		log.Printf("Listed %d post(s) on %s in %d page(s); last page size %d.", len(all), dockerContainer, pages, tuner.size)
+	}
+	return all, nil
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Phases of a scan, in the order they are reported.
+const (
+	phaseList     = "list"     // listing posts and pages
+	phaseAuthors  = "authors"  // fetching their authors
+	phaseContent  = "content"  // fetching content and SEO meta
+	phaseAI       = "ai"       // classification and compliance calls
+	phaseFindings = "findings" // campaign, title, archive, redirect, media and admin analysis
+	phaseExport   = "export"   // CSVs, store, reports and issues
+)
+
+var phaseOrder = []string{phaseList, phaseAuthors, phaseContent, phaseAI, phaseFindings, phaseExport}
+
+// PhaseTiming is the time a run spent in one phase. Wall is the elapsed time
+// during which any work of the phase was under way; Total adds up the time of
+// each piece of work, so for work spread over --max-workers Total exceeds
+// Wall, and Total/Wall is the parallelism achieved.
+type PhaseTiming struct {
+	Phase        string  `json:"phase"`
+	WallSeconds  float64 `json:"wall_seconds"`
+	TotalSeconds float64 `json:"total_seconds"`
+	Count        int     `json:"count"`
+}
+
+type phaseClock struct {
+	active      int
+	since       time.Time
+	wall, total time.Duration
+	count       int
+}
+
+// phaseClocks times the phases of the site being scanned.
+var phaseClocks struct {
+	sync.Mutex
+	byPhase map[string]*phaseClock
+}
+
+func resetPhases() {
+	phaseClocks.Lock()
+	defer phaseClocks.Unlock()
+	phaseClocks.byPhase = make(map[string]*phaseClock)
+}
+
+// startPhase starts timing one piece of work of a phase; call the returned
+// func when it is done. Pieces may overlap, from concurrent workers.
+func startPhase(phase string) func() {
+	started := time.Now()
+	phaseClocks.Lock()
+	c := phaseClocks.byPhase[phase]
+	if c == nil {
+		c = &phaseClock{}
+		phaseClocks.byPhase[phase] = c
+	}
+	if c.active == 0 {
+		c.since = started
+	}
+	c.active++
+	phaseClocks.Unlock()
+
+	return func() {
+		ended := time.Now()
+		phaseClocks.Lock()
+		defer phaseClocks.Unlock()
+		c.active--
+		c.count++
+		c.total += ended.Sub(started)
+		if c.active == 0 {
+			c.wall += ended.Sub(c.since)
+		}
+	}
+}
+
+// phaseTimings returns the timed phases in phaseOrder.
+func phaseTimings() []PhaseTiming {
+	phaseClocks.Lock()
+	defer phaseClocks.Unlock()
+	var timings []PhaseTiming
+	for _, phase := range phaseOrder {
+		c := phaseClocks.byPhase[phase]
+		if c == nil || c.count == 0 {
+			continue
+		}
+		timings = append(timings, PhaseTiming{
+			Phase:        phase,
+			WallSeconds:  c.wall.Round(time.Millisecond).Seconds(),
+			TotalSeconds: c.total.Round(time.Millisecond).Seconds(),
+			Count:        c.count,
+		})
+	}
+	return timings
+}
+
+// formatPhaseTimings summarizes the timings in one line, showing the total
+// only where work overlapped.
+func formatPhaseTimings(timings []PhaseTiming) string {
+	parts := make([]string, len(timings))
+	for i, t := range timings {
+		parts[i] = fmt.Sprintf("%s %.1fs", t.Phase, t.WallSeconds)
+		if t.TotalSeconds > t.WallSeconds*1.05 {
+			parts[i] += fmt.Sprintf(" (%.1fs over %d item(s))", t.TotalSeconds, t.Count)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,338 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// phpSerialMaxDepth bounds nesting, including serialized strings inside
+// serialized values, so a hostile meta value cannot exhaust the stack.
+const phpSerialMaxDepth = 32
+
+// phpClassKey holds an unserialized object's class name in its JSON form.
+const phpClassKey = "__class"
+
+// unserializePHP decodes a value written by PHP's serialize(): arrays become
+// slices when their keys are 0..n-1 and maps otherwise, objects become maps
+// with their class under phpClassKey, and references become nil. Strings
+// that are themselves serialized, as WordPress leaves them when a plugin
+// serializes before update_post_meta, are decoded too.
+func unserializePHP(s string) (any, error) {
+	return unserializePHPDepth(s, 0)
+}
+
+func unserializePHPDepth(s string, depth int) (any, error) {
+	p := &phpParser{data: s, depth: depth}
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.data) {
+		return nil, fmt.Errorf("unexpected data at offset %d", p.pos)
+	}
+	return v, nil
+}
+
+// isPHPSerialized reports whether s looks like the output of serialize(),
+// much as WordPress's is_serialized() decides.
+func isPHPSerialized(s string) bool {
+	s = strings.TrimSpace(s)
+	if s == "N;" {
+		return true
+	}
+	if len(s) < 4 || s[1] != ':' {
+		return false
+	}
+	switch s[0] {
+	case 'a', 'O', 'C':
+		return s[len(s)-1] == '}'
+	case 's', 'S', 'b', 'i', 'd', 'E':
+		return s[len(s)-1] == ';'
+	}
+	return false
+}
+
+// phpMetaValue turns a serialized meta value into JSON for output, so CSVs
+// and reports show its contents instead of an opaque blob. Serialized
+// scalars become their plain value. Anything else, including values that
+// fail to parse, is returned unchanged.
+func phpMetaValue(raw string) string {
+	if !isPHPSerialized(raw) {
+		return raw
+	}
+	v, err := unserializePHP(strings.TrimSpace(raw))
+	if err != nil {
+		return raw
+	}
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []any, map[string]any:
+		var b bytes.Buffer
+		enc := json.NewEncoder(&b)
+		enc.SetEscapeHTML(false) // keep markup readable and matchable
+		if err := enc.Encode(v); err != nil {
+			return raw
+		}
+		return strings.TrimSpace(b.String())
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// structuredMetaText returns the string values nested in a meta value that
+// phpMetaValue turned into JSON, one per line, so links and scripts are
+// matched against the values themselves rather than their JSON escaping.
+// Other text is returned as is.
+func structuredMetaText(text string) string {
+	t := strings.TrimSpace(text)
+	if t == "" || (t[0] != '{' && t[0] != '[') {
+		return text
+	}
+	var v any
+	if err := json.Unmarshal([]byte(t), &v); err != nil {
+		return text
+	}
+	var leaves []string
+	collectStrings(v, &leaves)
+	return strings.Join(leaves, "\n")
+}
+
+func collectStrings(v any, out *[]string) {
+	switch v := v.(type) {
+	case string:
+		*out = append(*out, v)
+	case []any:
+		for _, e := range v {
+			collectStrings(e, out)
+		}
+	case map[string]any:
+		for k, e := range v {
+			if k != phpClassKey {
+				collectStrings(e, out)
+			}
+		}
+	}
+}
+
+type phpParser struct {
+	data  string
+	pos   int
+	depth int
+}
+
+var errPHPTruncated = errors.New("unexpected end of serialized data")
+
+func (p *phpParser) expect(c byte) error {
+	if p.pos >= len(p.data) {
+		return errPHPTruncated
+	}
+	if p.data[p.pos] != c {
+		return fmt.Errorf("expected %q at offset %d, found %q", c, p.pos, p.data[p.pos])
+	}
+	p.pos++
+	return nil
+}
+
+// until returns the text up to the next c and moves past c.
+func (p *phpParser) until(c byte) (string, error) {
+	i := strings.IndexByte(p.data[p.pos:], c)
+	if i < 0 {
+		return "", errPHPTruncated
+	}
+	s := p.data[p.pos : p.pos+i]
+	p.pos += i + 1
+	return s, nil
+}
+
+func (p *phpParser) length(end byte) (int, error) {
+	s, err := p.until(end)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > len(p.data)-p.pos {
+		return 0, fmt.Errorf("invalid length %q at offset %d", s, p.pos)
+	}
+	return n, nil
+}
+
+// quoted reads "<n bytes>" after a length prefix.
+func (p *phpParser) quoted(end byte) (string, error) {
+	n, err := p.length(':')
+	if err != nil {
+		return "", err
+	}
+	if err := p.expect('"'); err != nil {
+		return "", err
+	}
+	if p.pos+n > len(p.data) {
+		return "", errPHPTruncated
+	}
+	s := p.data[p.pos : p.pos+n]
+	p.pos += n
+	if err := p.expect('"'); err != nil {
+		return "", err
+	}
+	return s, p.expect(end)
+}
+
+func (p *phpParser) value() (any, error) {
+	if p.depth > phpSerialMaxDepth {
+		return nil, errors.New("serialized data nested too deeply")
+	}
+	if p.pos+1 >= len(p.data) {
+		return nil, errPHPTruncated
+	}
+	kind := p.data[p.pos]
+	if kind == 'N' {
+		p.pos++
+		return nil, p.expect(';')
+	}
+	p.pos++
+	if err := p.expect(':'); err != nil {
+		return nil, err
+	}
+	switch kind {
+	case 'b':
+		s, err := p.until(';')
+		if err != nil || (s != "0" && s != "1") {
+			return nil, fmt.Errorf("invalid boolean at offset %d", p.pos)
+		}
+		return s == "1", nil
+	case 'i':
+		s, err := p.until(';')
+		if err != nil {
+			return nil, err
+		}
+		return strconv.ParseInt(s, 10, 64)
+	case 'd':
+		s, err := p.until(';')
+		if err != nil {
+			return nil, err
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil && s != "INF" && s != "-INF" && s != "NAN" {
+			return f, nil
+		}
+		return s, nil // not representable in JSON
+	case 'r', 'R':
+		_, err := p.until(';')
+		return nil, err
+	case 's':
+		s, err := p.quoted(';')
+		if err != nil {
+			return nil, err
+		}
+		if isPHPSerialized(s) {
+			if v, err := unserializePHPDepth(strings.TrimSpace(s), p.depth+1); err == nil {
+				return v, nil
+			}
+		}
+		return s, nil
+	case 'E':
+		return p.quoted(';') // enum case, e.g. "Suit:Hearts"
+	case 'a':
+		n, err := p.length(':')
+		if err != nil {
+			return nil, err
+		}
+		return p.members(n, "")
+	case 'O':
+		class, err := p.quoted(':')
+		if err != nil {
+			return nil, err
+		}
+		n, err := p.length(':')
+		if err != nil {
+			return nil, err
+		}
+		return p.members(n, class)
+	case 'C':
+		// Objects with their own serialization keep it as an opaque payload.
+		class, err := p.quoted(':')
+		if err != nil {
+			return nil, err
+		}
+		n, err := p.length(':')
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect('{'); err != nil {
+			return nil, err
+		}
+		if p.pos+n > len(p.data) {
+			return nil, errPHPTruncated
+		}
+		payload := p.data[p.pos : p.pos+n]
+		p.pos += n
+		return map[string]any{phpClassKey: class, "data": payload}, p.expect('}')
+	}
+	return nil, fmt.Errorf("unsupported serialized type %q at offset %d", kind, p.pos-2)
+}
+
+// members reads the {key;value;...} body of an array, or of an object when
+// class is set.
+func (p *phpParser) members(n int, class string) (any, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+	keys := make([]string, 0, n)
+	values := make([]any, 0, n)
+	list := class == ""
+	for i := 0; i < n; i++ {
+		k, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		var key string
+		switch k := k.(type) {
+		case int64:
+			key = strconv.FormatInt(k, 10)
+			list = list && k == int64(i)
+		case string:
+			key = phpPropertyName(k)
+			list = false
+		default:
+			return nil, fmt.Errorf("invalid array key at offset %d", p.pos)
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		values = append(values, v)
+	}
+	if err := p.expect('}'); err != nil {
+		return nil, err
+	}
+	if list {
+		return values, nil
+	}
+	m := make(map[string]any, n+1)
+	for i, k := range keys {
+		m[k] = values[i]
+	}
+	if class != "" {
+		m[phpClassKey] = class
+	}
+	return m, nil
+}
+
+// phpPropertyName strips the "\0*\0" and "\0Class\0" prefixes PHP gives
+// protected and private properties.
+func phpPropertyName(k string) string {
+	if strings.HasPrefix(k, "\x00") {
+		if i := strings.IndexByte(k[1:], 0); i >= 0 {
+			return k[i+2:]
+		}
+	}
+	return k
+}
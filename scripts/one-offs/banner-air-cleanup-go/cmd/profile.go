@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+var profilePath string
+
+// Profile is a per-client configuration file selecting the analyzers that
+// apply to a site, e.g. medical-claim checks for a healthcare client but not
+// for an HVAC one.
+//
+//	{"name": "healthcare",
+//	 "compliance": ["medical-claims", "hipaa"],
+//	 "compliance_prompts": {"hipaa": "prompts/hipaa.txt"},
+//	 "industry": "legal",
+//	 "normalizers": ["strip-blocks", "expand-shortcodes", "strip-html", "redact-pii"],
+//	 "cleanup": [{"classification": "Uncertain", "method": "draft"}]}
+type Profile struct {
+	Name string `json:"name"`
+	// Compliance lists the compliance analyzers to run over every post.
+	Compliance []string `json:"compliance"`
+	// CompliancePrompts adds or overrides analyzers with a prompt file,
+	// relative to the profile. The post content is appended to the prompt.
+	CompliancePrompts map[string]string `json:"compliance_prompts"`
+	// Cleanup picks how the cleanup command removes each post, ahead of the
+	// built-in defaults.
+	Cleanup []CleanupRule `json:"cleanup"`
+	// Hooks are shell commands run around a phase for this site, keyed
+	// pre-<phase> or post-<phase>, e.g. "post-run" or "pre-cleanup".
+	Hooks map[string][]string `json:"hooks"`
+	// Industry selects the heuristics pack when --industry is not given.
+	Industry string `json:"industry"`
+	// Normalizers are the steps content goes through, in order, before it
+	// is sent to the AI, when --normalizers is not given.
+	Normalizers []string `json:"normalizers"`
+
+	dir string
+}
+
+// activeProfile is the profile of the site being processed; it is empty when
+// no --profile is given.
+var activeProfile = &Profile{}
+
+// compliancePromptFormat wraps a rule description into a prompt that answers
+// in the same JSON shape as the spam classification.
+const compliancePromptFormat = `
+Review the following website content for this compliance problem: %s
+
+Classify it as 'Violation', 'Compliant', or 'Uncertain'.
+
+**CRITICAL OUTPUT REQUIREMENTS:**
+1.  Your entire response MUST be a single, valid JSON object. Do not wrap it in markdown backticks.
+2.  The JSON object must contain exactly two keys: "classification" and "justification".
+3.  The "justification" value MUST be a string that names the offending claim, if any.
+4.  If you use any double-quotes (") inside the "justification" string, you MUST escape them with a backslash (\").
+
+**CONTENT TO ANALYZE:**
+`
+
+// complianceRules are the built-in compliance analyzers.
+var complianceRules = map[string]string{
+	"medical-claims":   "unsubstantiated medical or health claims, such as promising to cure, treat or prevent a disease or condition, or stating health benefits without evidence or the required disclaimers.",
+	"financial-claims": "misleading financial claims, such as guaranteed returns or savings, or financing and credit offers stated without the required terms, rates and disclosures.",
+}
+
+func loadProfile(path string) (*Profile, error) {
+	if path == "" {
+		return &Profile{}, nil
+	}
+	raw, err := readProfileFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading profile: %w", err)
+	}
+	profile := &Profile{dir: filepath.Dir(path)}
+	if err := json.Unmarshal(raw, profile); err != nil {
+		return nil, fmt.Errorf("parsing profile %s: %w", path, err)
+	}
+	for _, name := range profile.Compliance {
+		if _, ok := profile.CompliancePrompts[name]; !ok && complianceRules[name] == "" {
+			return nil, fmt.Errorf("profile %s: unknown compliance analyzer %q", path, name)
+		}
+	}
+	if err := validateHookPhases(profile.Hooks); err != nil {
+		return nil, fmt.Errorf("profile %s: %w", path, err)
+	}
+	if err := validateIndustry(profile.Industry); err != nil {
+		return nil, fmt.Errorf("profile %s: %w", path, err)
+	}
+	if err := validateNormalizers(profile.Normalizers); err != nil {
+		return nil, fmt.Errorf("profile %s: %w", path, err)
+	}
+	for i, rule := range profile.Cleanup {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("profile %s: cleanup rule %d: %w", path, i+1, err)
+		}
+	}
+	return profile, nil
+}
+
+// complianceVariants returns the AI variant for each compliance analyzer the
+// profile enables, keyed by analyzer name.
+func (p *Profile) complianceVariants() (map[string]AIVariant, error) {
+	variants := make(map[string]AIVariant, len(p.Compliance))
+	for _, name := range p.Compliance {
+		v := activeVariant
+		if file, ok := p.CompliancePrompts[name]; ok {
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(p.dir, file)
+			}
+			prompt, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("reading %s compliance prompt: %w", name, err)
+			}
+			v.Prompt = string(prompt)
+		} else {
+			v.Prompt = fmt.Sprintf(compliancePromptFormat, complianceRules[name])
+		}
+		variants[name] = v
+	}
+	return variants, nil
+}
+
+// runComplianceChecks classifies a post with every enabled compliance
+// analyzer, attaching a "compliance:<name>" finding for each violation or
+// uncertain result.
+func runComplianceChecks(ctx context.Context, client AIClient, variants map[string]AIVariant, post *Post) {
+	names := make([]string, 0, len(variants))
+	for name := range variants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		result, err := analyzeContentViaAI(ctx, client, variants[name], post.Content)
+		if err != nil {
+			log.Printf("Error running %s compliance check on %s: %v", name, post.ref(), err)
+			result = &AIResult{Classification: "Error", Justification: err.Error()}
+		}
+		if result.Classification != "Compliant" {
+			post.Findings = append(post.Findings, Finding{
+				Site:           post.Site,
+				Type:           "compliance:" + name,
+				Subject:        postSubject(post.ID),
+				PostID:         post.ID,
+				Title:          post.Title,
+				Classification: result.Classification,
+				Detail:         result.Justification,
+				PromptHash:     result.PromptHash,
+				ModelVersion:   result.ModelVersion,
+			})
+		}
+		time.Sleep(1 * time.Second) // Avoid hitting API rate limits
+	}
+}
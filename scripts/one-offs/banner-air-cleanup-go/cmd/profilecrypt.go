@@ -0,0 +1,405 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Encrypted profiles follow age's X25519 design: the profile is sealed with a
+// random file key, and the file key is wrapped once per operator with a key
+// agreed between a fresh ephemeral key and the operator's public key. Anyone
+// can encrypt to the team; only listed operators can decrypt.
+const (
+	encryptedProfileFormat = "banner-air-cleanup-encrypted-profile/v1"
+	publicKeyPrefix        = "hubstack-pub-"
+	secretKeyPrefix        = "HUBSTACK-SECRET-"
+	profileKeyInfo         = "banner-air-cleanup profile key wrap"
+)
+
+var (
+	identityPath      string
+	keygenOutput      string
+	encryptRecipients string
+	encryptRoles      []string
+	encryptOutput     string
+	decryptOutput     string
+)
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Encrypt client profiles to the operators allowed to use them.",
+	Long: `Client profiles can hold credentials (in hook commands, for example) and
+client context that not everyone with read access to the config repository
+should see. An encrypted profile (*.enc) is used like a plain one with
+--profile or a sites manifest entry; it is decrypted in memory with the
+operator's key from --identity and never written out in plain text.
+
+Each operator creates a key pair with "profile keygen" and adds the public key
+to a recipients file kept next to the profiles:
+
+  {"operators": [
+    {"name": "alice", "public_key": "hubstack-pub-...", "roles": ["admin"]},
+    {"name": "bob", "public_key": "hubstack-pub-...", "roles": ["oncall"]}
+  ]}
+
+"profile encrypt --role oncall" then encrypts a profile to the operators with
+that role only. Re-encrypt after changing the recipients file; operators who
+were removed keep access to copies they already have.
+
+Compliance prompt files referenced by a profile are read as they are and are
+not encrypted.`,
+}
+
+var profileKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Create an operator key pair for encrypted profiles.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runProfileKeygen()
+	},
+}
+
+var profileEncryptCmd = &cobra.Command{
+	Use:   "encrypt PROFILE",
+	Short: "Encrypt a profile to the operators in a recipients file.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runProfileEncrypt(args[0])
+	},
+}
+
+var profileDecryptCmd = &cobra.Command{
+	Use:   "decrypt PROFILE.enc",
+	Short: "Decrypt a profile for editing.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runProfileDecrypt(args[0])
+	},
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&identityPath, "identity", "", "Operator secret key for encrypted profiles (default $HUBSTACK_IDENTITY, then identity in the user config directory).")
+	profileKeygenCmd.Flags().StringVar(&keygenOutput, "output", "", "Where to write the secret key (default the --identity location).")
+	profileEncryptCmd.Flags().StringVar(&encryptRecipients, "recipients", "recipients.json", "JSON file listing the operators' public keys and roles.")
+	profileEncryptCmd.Flags().StringSliceVar(&encryptRoles, "role", nil, "Only encrypt to operators with one of these roles (default every operator).")
+	profileEncryptCmd.Flags().StringVar(&encryptOutput, "output", "", "Encrypted profile to write (default PROFILE.enc).")
+	profileDecryptCmd.Flags().StringVar(&decryptOutput, "output", "-", "Where to write the decrypted profile (- for standard output).")
+	profileCmd.AddCommand(profileKeygenCmd, profileEncryptCmd, profileDecryptCmd)
+	rootCmd.AddCommand(profileCmd)
+}
+
+// Operator is one entry of the recipients file.
+type Operator struct {
+	Name      string   `json:"name"`
+	PublicKey string   `json:"public_key"`
+	Roles     []string `json:"roles"`
+}
+
+// encryptedProfile is the on-disk form of an encrypted profile.
+type encryptedProfile struct {
+	Format     string             `json:"format"`
+	Recipients []profileRecipient `json:"recipients"`
+	Nonce      []byte             `json:"nonce"`
+	Ciphertext []byte             `json:"ciphertext"`
+}
+
+// profileRecipient holds the file key wrapped for one operator. Name is only
+// informational; decryption tries the stanza for the operator's public key.
+type profileRecipient struct {
+	Name       string `json:"name"`
+	PublicKey  string `json:"public_key"`
+	Ephemeral  []byte `json:"ephemeral"`
+	WrappedKey []byte `json:"wrapped_key"`
+}
+
+// isEncryptedProfile reports whether raw is an encrypted profile rather than
+// plain profile JSON.
+func isEncryptedProfile(raw []byte) bool {
+	var probe struct {
+		Format string `json:"format"`
+	}
+	return json.Unmarshal(raw, &probe) == nil && probe.Format == encryptedProfileFormat
+}
+
+func defaultIdentityPath() string {
+	if identityPath != "" {
+		return identityPath
+	}
+	if env := os.Getenv("HUBSTACK_IDENTITY"); env != "" {
+		return env
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "identity"
+	}
+	return filepath.Join(dir, "banner-air-cleanup", "identity")
+}
+
+func encodePublicKey(key *ecdh.PublicKey) string {
+	return publicKeyPrefix + base64.RawURLEncoding.EncodeToString(key.Bytes())
+}
+
+func parsePublicKey(s string) (*ecdh.PublicKey, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(strings.TrimSpace(s), publicKeyPrefix))
+	if err != nil || !strings.HasPrefix(strings.TrimSpace(s), publicKeyPrefix) {
+		return nil, fmt.Errorf("invalid public key %q", s)
+	}
+	return ecdh.X25519().NewPublicKey(raw)
+}
+
+// loadIdentity reads an operator's secret key. Lines starting with # are
+// comments, as keygen writes the public key there.
+func loadIdentity(path string) (*ecdh.PrivateKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading identity: %w", err)
+	}
+	for _, line := range strings.Split(string(raw), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(line, secretKeyPrefix))
+		if err != nil || !strings.HasPrefix(line, secretKeyPrefix) {
+			return nil, fmt.Errorf("identity %s does not hold a %s key", path, secretKeyPrefix)
+		}
+		return ecdh.X25519().NewPrivateKey(key)
+	}
+	return nil, fmt.Errorf("identity %s is empty", path)
+}
+
+// wrapKey derives the key that wraps the file key for one recipient from the
+// X25519 shared secret, bound to both public keys.
+func wrapKey(shared, ephemeral, recipient []byte) ([]byte, error) {
+	salt := append(append([]byte{}, ephemeral...), recipient...)
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(profileKeyInfo)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// encryptProfile seals plaintext to the given operators.
+func encryptProfile(plaintext []byte, operators []Operator) ([]byte, error) {
+	fileKey := make([]byte, chacha20poly1305.KeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, err
+	}
+	enc := encryptedProfile{Format: encryptedProfileFormat}
+	for _, op := range operators {
+		pub, err := parsePublicKey(op.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("operator %s: %w", op.Name, err)
+		}
+		ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		shared, err := ephemeral.ECDH(pub)
+		if err != nil {
+			return nil, fmt.Errorf("operator %s: %w", op.Name, err)
+		}
+		key, err := wrapKey(shared, ephemeral.PublicKey().Bytes(), pub.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		aead, err := chacha20poly1305.New(key)
+		if err != nil {
+			return nil, err
+		}
+		// Each wrapping key is used once, so a zero nonce is safe.
+		enc.Recipients = append(enc.Recipients, profileRecipient{
+			Name:       op.Name,
+			PublicKey:  encodePublicKey(pub),
+			Ephemeral:  ephemeral.PublicKey().Bytes(),
+			WrappedKey: aead.Seal(nil, make([]byte, aead.NonceSize()), fileKey, nil),
+		})
+	}
+
+	aead, err := chacha20poly1305.NewX(fileKey)
+	if err != nil {
+		return nil, err
+	}
+	enc.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(enc.Nonce); err != nil {
+		return nil, err
+	}
+	enc.Ciphertext = aead.Seal(nil, enc.Nonce, plaintext, []byte(encryptedProfileFormat))
+	return json.MarshalIndent(enc, "", "  ")
+}
+
+// decryptProfile opens an encrypted profile with the operator's secret key.
+func decryptProfile(raw []byte, identity *ecdh.PrivateKey) ([]byte, error) {
+	var enc encryptedProfile
+	if err := json.Unmarshal(raw, &enc); err != nil {
+		return nil, fmt.Errorf("parsing encrypted profile: %w", err)
+	}
+	if enc.Format != encryptedProfileFormat {
+		return nil, fmt.Errorf("not an encrypted profile")
+	}
+	mine := encodePublicKey(identity.PublicKey())
+	for _, r := range enc.Recipients {
+		if r.PublicKey != mine {
+			continue
+		}
+		ephemeral, err := ecdh.X25519().NewPublicKey(r.Ephemeral)
+		if err != nil {
+			return nil, err
+		}
+		shared, err := identity.ECDH(ephemeral)
+		if err != nil {
+			return nil, err
+		}
+		key, err := wrapKey(shared, r.Ephemeral, identity.PublicKey().Bytes())
+		if err != nil {
+			return nil, err
+		}
+		aead, err := chacha20poly1305.New(key)
+		if err != nil {
+			return nil, err
+		}
+		fileKey, err := aead.Open(nil, make([]byte, aead.NonceSize()), r.WrappedKey, nil)
+		if err != nil {
+			return nil, fmt.Errorf("unwrapping the profile key: %w", err)
+		}
+		body, err := chacha20poly1305.NewX(fileKey)
+		if err != nil {
+			return nil, err
+		}
+		plaintext, err := body.Open(nil, enc.Nonce, enc.Ciphertext, []byte(encryptedProfileFormat))
+		if err != nil {
+			return nil, errors.New("encrypted profile is corrupt or was tampered with")
+		}
+		return plaintext, nil
+	}
+	return nil, fmt.Errorf("profile is not encrypted to your key %s", mine)
+}
+
+// readProfileFile returns a profile's JSON, decrypting it with the operator's
+// identity if it is encrypted.
+func readProfileFile(path string) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !isEncryptedProfile(raw) {
+		return raw, nil
+	}
+	identity, err := loadIdentity(defaultIdentityPath())
+	if err != nil {
+		return nil, fmt.Errorf("%s is encrypted: %w", path, err)
+	}
+	plaintext, err := decryptProfile(raw, identity)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting %s: %w", path, err)
+	}
+	return plaintext, nil
+}
+
+func runProfileKeygen() {
+	path := firstNonEmpty(keygenOutput, defaultIdentityPath())
+	if _, err := os.Stat(path); err == nil {
+		fatalf("%s already exists; refusing to overwrite an operator key.", path)
+	}
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		fatalf("Failed to generate key: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# created: %s\n", time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "# public key: %s\n", encodePublicKey(key.PublicKey()))
+	fmt.Fprintf(&b, "%s%s\n", secretKeyPrefix, base64.RawURLEncoding.EncodeToString(key.Bytes()))
+	if err := os.WriteFile(path, b.Bytes(), 0o600); err != nil {
+		fatalf("Failed to write %s: %v", path, err)
+	}
+	log.Printf("Wrote secret key to %s; keep it private and add the public key to the recipients file.", path)
+	fmt.Println(encodePublicKey(key.PublicKey()))
+}
+
+func runProfileEncrypt(path string) {
+	plaintext, err := os.ReadFile(path)
+	if err != nil {
+		fatalf("Failed to read profile: %v", err)
+	}
+	if isEncryptedProfile(plaintext) {
+		fatalf("%s is already encrypted.", path)
+	}
+	var profile Profile
+	if err := json.Unmarshal(plaintext, &profile); err != nil {
+		fatalf("Failed to parse profile %s: %v", path, err)
+	}
+
+	raw, err := os.ReadFile(encryptRecipients)
+	if err != nil {
+		fatalf("Failed to read recipients: %v", err)
+	}
+	var recipients struct {
+		Operators []Operator `json:"operators"`
+	}
+	if err := json.Unmarshal(raw, &recipients); err != nil {
+		fatalf("Failed to parse recipients %s: %v", encryptRecipients, err)
+	}
+	var operators []Operator
+	for _, op := range recipients.Operators {
+		if len(encryptRoles) == 0 || slices.ContainsFunc(op.Roles, func(r string) bool { return slices.Contains(encryptRoles, r) }) {
+			operators = append(operators, op)
+		}
+	}
+	if len(operators) == 0 {
+		fatalf("No operator in %s has role %s.", encryptRecipients, strings.Join(encryptRoles, " or "))
+	}
+
+	sealed, err := encryptProfile(plaintext, operators)
+	if err != nil {
+		fatalf("Failed to encrypt profile: %v", err)
+	}
+	out := firstNonEmpty(encryptOutput, path+".enc")
+	if err := os.WriteFile(out, append(sealed, '\n'), 0o644); err != nil {
+		fatalf("Failed to write %s: %v", out, err)
+	}
+	names := make([]string, len(operators))
+	for i, op := range operators {
+		names[i] = op.Name
+	}
+	log.Printf("Encrypted %s to %s for %s. Remove the plain-text profile from the config repository.", path, out, strings.Join(names, ", "))
+}
+
+func runProfileDecrypt(path string) {
+	if raw, err := os.ReadFile(path); err != nil {
+		fatalf("Failed to read profile: %v", err)
+	} else if !isEncryptedProfile(raw) {
+		fatalf("%s is not encrypted.", path)
+	}
+	plaintext, err := readProfileFile(path)
+	if err != nil {
+		fatal(err)
+	}
+	if decryptOutput == "-" {
+		os.Stdout.Write(plaintext)
+		return
+	}
+	if err := os.WriteFile(decryptOutput, plaintext, 0o600); err != nil {
+		fatalf("Failed to write %s: %v", decryptOutput, err)
+	}
+	log.Printf("Decrypted %s to %s; do not commit it.", path, decryptOutput)
+}
@@ -0,0 +1,290 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/joho/godotenv"
+	"google.golang.org/genai"
+)
+
+// AI providers for --ai-provider and the sites manifest.
+const (
+	providerGemini = "gemini"
+	providerOpenAI = "openai"
+)
+
+// AI authentication modes for --ai-auth.
+const (
+	aiAuthAPIKey = "api-key"
+	aiAuthVertex = "vertex"
+)
+
+const openAIDefaultModel = "gpt-4o-mini"
+
+var (
+	aiProvider    string
+	aiModelName   string
+	aiAPIKeyEnv   string
+	openAIOrg     string
+	openAIBaseURL string
+)
+
+// AIClient is one provider account that posts are classified with.
+type AIClient interface {
+	// Generate returns the model's text answer to prompt and the model
+	// version that produced it.
+	Generate(ctx context.Context, model, prompt string) (string, string, error)
+	Provider() string
+	Usage() *AIUsage
+	// Quota is the account's quota, shared by every client using it.
+	Quota() *quotaState
+}
+
+// AIUsage counts what a client consumed, so each site's spend can be
+// attributed to the account that paid for it.
+type AIUsage struct {
+	Requests     atomic.Int64
+	Failures     atomic.Int64
+	PromptTokens atomic.Int64
+	OutputTokens atomic.Int64
+}
+
+func (u *AIUsage) String() string {
+	return fmt.Sprintf("%d request(s), %d failed, %d prompt token(s), %d output token(s)",
+		u.Requests.Load(), u.Failures.Load(), u.PromptTokens.Load(), u.OutputTokens.Load())
+}
+
+func validateProvider(provider string) error {
+	switch provider {
+	case providerGemini, providerOpenAI:
+		return nil
+	}
+	return fmt.Errorf("unknown AI provider %q; expected gemini or openai", provider)
+}
+
+// resolvedModel is the model to use for the current provider when --ai-model
+// (or the site's ai_model) is not set.
+func resolvedModel() string {
+	if aiModelName != "" {
+		return aiModelName
+	}
+	if aiProvider == providerOpenAI {
+		return openAIDefaultModel
+	}
+	return aiModel
+}
+
+// apiKeyEnv is the environment variable holding the current provider's key.
+func apiKeyEnv() string {
+	if aiAPIKeyEnv != "" {
+		return aiAPIKeyEnv
+	}
+	if aiProvider == providerOpenAI {
+		return "OPENAI_API_KEY"
+	}
+	return "GEMINI_API_KEY"
+}
+
+// newAIClient creates the client for the current provider, loading .env
+// first. Keys are always read from the environment, never from flags or the
+// sites manifest, so they stay out of process listings and config files.
+func newAIClient(ctx context.Context) (AIClient, error) {
+	if offline {
+		return nil, errors.New("this command needs the AI service, which --offline disables")
+	}
+	if err := godotenv.Load(); err != nil {
+		log.Println("Warning: .env file not found, relying on environment variables.")
+	}
+	// A failed client is returned as a nil AIClient, not a typed nil.
+	if aiProvider == providerOpenAI {
+		c, err := newOpenAIClient()
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	c, err := newGeminiClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newGeminiClient creates the Gemini client. With --ai-auth=api-key it uses
+// the API key; with --ai-auth=vertex it goes through Vertex AI using
+// Application Default Credentials, so service accounts and workload identity
+// work without a Developer API key.
+func newGeminiClient(ctx context.Context) (*geminiClient, error) {
+	config := &genai.ClientConfig{}
+	account := providerGemini + " via " + apiKeyEnv()
+	switch aiAuth {
+	case aiAuthVertex:
+		config.Backend = genai.BackendVertexAI
+		config.Project = gcpProject
+		config.Location = gcpLocation
+		if config.Project == "" {
+			config.Project = os.Getenv("GOOGLE_CLOUD_PROJECT")
+		}
+		if config.Location == "" {
+			config.Location = os.Getenv("GOOGLE_CLOUD_LOCATION")
+		}
+		if config.Project == "" || config.Location == "" {
+			return nil, errors.New("--ai-auth=vertex needs --gcp-project and --gcp-location (or GOOGLE_CLOUD_PROJECT and GOOGLE_CLOUD_LOCATION)")
+		}
+		log.Printf("Using Vertex AI in project %s (%s) with Application Default Credentials.", config.Project, config.Location)
+		account = providerGemini + " via Vertex AI project " + config.Project
+	default:
+		config.Backend = genai.BackendGeminiAPI
+		config.APIKey = os.Getenv(apiKeyEnv())
+		if config.APIKey == "" {
+			return nil, fmt.Errorf("%s environment variable is not set", apiKeyEnv())
+		}
+		log.Printf("%s is set.", apiKeyEnv())
+	}
+
+	client, err := genai.NewClient(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("creating AI client: %w", err)
+	}
+	return &geminiClient{client: client, quota: accountQuota(account)}, nil
+}
+
+type geminiClient struct {
+	client *genai.Client
+	usage  AIUsage
+	quota  *quotaState
+}
+
+func (c *geminiClient) Provider() string   { return providerGemini }
+func (c *geminiClient) Usage() *AIUsage    { return &c.usage }
+func (c *geminiClient) Quota() *quotaState { return c.quota }
+
+func (c *geminiClient) Generate(ctx context.Context, model, prompt string) (string, string, error) {
+	text, modelVersion, err := c.quota.do(ctx, func() (string, string, error) {
+		c.usage.Requests.Add(1)
+		text, modelVersion, err := streamAIResponse(ctx, c.client, model, prompt, &c.usage)
+		return text, modelVersion, geminiQuotaError(err)
+	})
+	if err != nil {
+		c.usage.Failures.Add(1)
+	}
+	return text, modelVersion, err
+}
+
+func newOpenAIClient() (*openAIClient, error) {
+	key := os.Getenv(apiKeyEnv())
+	if key == "" {
+		return nil, fmt.Errorf("%s environment variable is not set", apiKeyEnv())
+	}
+	log.Printf("%s is set.", apiKeyEnv())
+	return &openAIClient{apiKey: key, organization: openAIOrg, baseURL: strings.TrimRight(openAIBaseURL, "/"),
+		quota: accountQuota(providerOpenAI + " via " + apiKeyEnv())}, nil
+}
+
+// openAIClient talks to the OpenAI chat completions API. Responses are not
+// streamed; max_tokens caps the cost of an answer instead.
+type openAIClient struct {
+	apiKey       string
+	organization string
+	baseURL      string
+	usage        AIUsage
+	quota        *quotaState
+}
+
+func (c *openAIClient) Provider() string   { return providerOpenAI }
+func (c *openAIClient) Usage() *AIUsage    { return &c.usage }
+func (c *openAIClient) Quota() *quotaState { return c.quota }
+
+func (c *openAIClient) Generate(ctx context.Context, model, prompt string) (string, string, error) {
+	text, modelVersion, err := c.quota.do(ctx, func() (string, string, error) {
+		c.usage.Requests.Add(1)
+		return c.complete(ctx, model, prompt)
+	})
+	if err == nil {
+		if reason := offFormat(text, aiMaxOutputChars); reason != "" {
+			err = &abortedResponse{Reason: reason, Text: text}
+		}
+	}
+	if err != nil {
+		c.usage.Failures.Add(1)
+		return "", modelVersion, err
+	}
+	return text, modelVersion, nil
+}
+
+func (c *openAIClient) complete(ctx context.Context, model, prompt string) (string, string, error) {
+	body := map[string]any{
+		"model":           model,
+		"messages":        []map[string]string{{"role": "user", "content": prompt}},
+		"response_format": map[string]string{"type": "json_object"},
+	}
+	if aiMaxOutputChars > 0 {
+		// Roughly four characters per token, with headroom for the JSON.
+		body["max_tokens"] = aiMaxOutputChars/3 + 16
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return "", "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	if c.organization != "" {
+		req.Header.Set("OpenAI-Organization", c.organization)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return "", "", openAIQuotaError(resp.Header, raw, fmt.Errorf("OpenAI returned %s: %s", resp.Status, bytes.TrimSpace(raw)))
+	}
+	if resp.StatusCode >= 300 {
+		return "", "", &aiStatusError{Code: resp.StatusCode, Err: fmt.Errorf("OpenAI returned %s: %s", resp.Status, bytes.TrimSpace(raw))}
+	}
+	// Stop before the next request rather than spend it on a 429.
+	if reason, resetAt := openAIRateLimit(resp.Header); !resetAt.IsZero() {
+		c.quota.exhaust(reason, resetAt)
+	}
+
+	var result struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int64 `json:"prompt_tokens"`
+			CompletionTokens int64 `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return "", "", fmt.Errorf("decoding OpenAI response: %w", err)
+	}
+	c.usage.PromptTokens.Add(result.Usage.PromptTokens)
+	c.usage.OutputTokens.Add(result.Usage.CompletionTokens)
+	if len(result.Choices) == 0 {
+		return "", result.Model, fmt.Errorf("OpenAI response has no choices")
+	}
+	return result.Choices[0].Message.Content, result.Model, nil
+}
@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	publicSample   int
+	publicInterval time.Duration
+	publicWhere    string
+	publicOutput   string
+)
+
+// publicBodyLimit caps how much of a page is read when looking for spam.
+const publicBodyLimit = 5 << 20
+
+// Visibility of a sampled permalink.
+const (
+	visibilityPublic      = "publicly-visible" // serves the spam content
+	visibilityReachable   = "reachable"        // answers 2xx, but no spam content was found
+	visibilityNotPublic   = "not-public"       // 4xx/5xx, or redirects to a login
+	visibilityUnreachable = "unreachable"      // the request failed
+)
+
+var publicCheckCmd = &cobra.Command{
+	Use:   "public-check",
+	Short: "Check whether a sample of flagged posts serve their spam publicly.",
+	Long: `Samples --sample published posts among the open Spam and Uncertain findings
+in the store, fetches each permalink from the live site, --interval apart, and
+looks in the page for the finding's spam: the spam keywords and off-site link
+domains found in the post's content. Each post is reported as:
+
+  publicly-visible  the page answers 2xx and shows the spam
+  reachable         the page answers 2xx, but none of the spam was found in it
+                    (or the finding has no keyword or link to look for)
+  not-public        the page answers 4xx or 5xx, or redirects to a login
+  unreachable       the request failed
+
+Publicly visible spam is what search engines index and clients see, so it is
+logged and written to --output separately from the rest. The sample is drawn
+with --seed, like --sample for scans.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if storePath == "" {
+			fatal("--store-path is required for public-check.")
+		}
+		if publicSample <= 0 {
+			fatal("--sample must be positive.")
+		}
+		var report PublicCheckReport
+		forEachSite(func() {
+			report.Sites = append(report.Sites, runPublicCheck())
+		})
+		if publicOutput != "" {
+			report.CheckedAt = time.Now().UTC()
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				fatal(err)
+			}
+			if err := os.WriteFile(publicOutput, append(data, '\n'), 0o644); err != nil {
+				fatalf("Failed to write %s: %v", publicOutput, err)
+			}
+			log.Printf("Wrote public visibility results to %s", publicOutput)
+		}
+	},
+}
+
+func init() {
+	publicCheckCmd.Flags().IntVar(&publicSample, "sample", 20, "Flagged permalinks to check per site.")
+	publicCheckCmd.Flags().DurationVar(&publicInterval, "interval", 2*time.Second, "Pause between requests to a site, to stay clear of rate limits and firewalls.")
+	publicCheckCmd.Flags().StringVar(&publicWhere, "where", "", "Extra SQL filter over the findings, e.g. \"classification = 'Spam'\".")
+	publicCheckCmd.Flags().StringVar(&publicOutput, "output", "public-spam.json", "Output JSON with the publicly visible spam and the other results (empty to skip).")
+	rootCmd.AddCommand(publicCheckCmd)
+}
+
+// PublicCheckReport is the --output of public-check.
+type PublicCheckReport struct {
+	CheckedAt time.Time           `json:"checked_at"`
+	Sites     []PublicCheckResult `json:"sites"`
+}
+
+// PublicCheckResult is one site's sample, with the publicly visible spam
+// kept apart from the rest.
+type PublicCheckResult struct {
+	Site            string          `json:"site"`
+	Flagged         int             `json:"flagged"`
+	Sampled         int             `json:"sampled"`
+	PubliclyVisible []URLVisibility `json:"publicly_visible"`
+	Other           []URLVisibility `json:"other"`
+	Counts          map[string]int  `json:"counts"`
+}
+
+// URLVisibility is what a flagged permalink served.
+type URLVisibility struct {
+	PostID         int      `json:"post_id"`
+	Title          string   `json:"title"`
+	Classification string   `json:"classification"`
+	URL            string   `json:"url"`
+	FinalURL       string   `json:"final_url,omitempty"`
+	Status         int      `json:"status,omitempty"`
+	Visibility     string   `json:"visibility"`
+	Evidence       []string `json:"evidence,omitempty"`
+	Error          string   `json:"error,omitempty"`
+}
+
+func runPublicCheck() PublicCheckResult {
+	ctx := context.Background()
+	result := PublicCheckResult{Site: dockerContainer, Counts: map[string]int{}}
+	db, err := openStoreReadOnly(storePath)
+	if err != nil {
+		fatalf("Failed to open store: %v", err)
+	}
+	where := siteFilter(dockerContainer) + " AND classification IN ('Spam', 'Uncertain') AND review_state != 'cleaned'"
+	if strings.TrimSpace(publicWhere) != "" {
+		where += " AND (" + publicWhere + ")"
+	}
+	flagged, err := queryFindings(db, where)
+	db.Close()
+	if err != nil {
+		fatalf("Failed to select findings: %v", err)
+	}
+	result.Flagged = len(flagged)
+	if len(flagged) == 0 {
+		log.Printf("No open flagged findings on %s.", dockerContainer)
+		return result
+	}
+
+	// Only published posts have a public permalink; the rest cannot leak.
+	urls, err := publicURLs(ctx, flagged)
+	if err != nil {
+		fatalf("Failed to read permalinks from %s: %v", dockerContainer, err)
+	}
+	var published []Post
+	for _, p := range flagged {
+		if urls[p.ID] != "" {
+			published = append(published, p)
+		}
+	}
+	sort.Slice(published, func(i, j int) bool { return published[i].ID < published[j].ID })
+	siteRand("public-check").Shuffle(len(published), func(i, j int) { published[i], published[j] = published[j], published[i] })
+	sample := published[:min(publicSample, len(published))]
+	result.Sampled = len(sample)
+	log.Printf("Checking %d of %d published flagged post(s) on %s (%d flagged in all, seed %d).",
+		len(sample), len(published), dockerContainer, len(flagged), resolvedSeed())
+
+	for i, p := range sample {
+		if i > 0 && publicInterval > 0 {
+			time.Sleep(publicInterval)
+		}
+		v := checkPublicURL(ctx, p, urls[p.ID])
+		result.Counts[v.Visibility]++
+		if v.Visibility == visibilityPublic {
+			result.PubliclyVisible = append(result.PubliclyVisible, v)
+			log.Printf("%s: post %d %s: %s (%s)", v.Visibility, p.ID, v.URL, p.Title, strings.Join(v.Evidence, ", "))
+			continue
+		}
+		result.Other = append(result.Other, v)
+		log.Printf("%s: post %d %s: %s", v.Visibility, p.ID, v.URL, firstNonEmpty(v.Error, p.Title))
+	}
+	log.Printf("%d of %d sampled flagged post(s) on %s serve their spam publicly.", len(result.PubliclyVisible), len(sample), dockerContainer)
+	return result
+}
+
+// spamEvidence returns what identifies a post's spam on its page: the spam
+// keywords in its content and the off-site domains it links to.
+func spamEvidence(p Post) []string {
+	seen := map[string]bool{}
+	var evidence []string
+	for _, m := range spamKeywordPattern.FindAllString(p.Content, -1) {
+		if k := strings.ToLower(m); !seen[k] {
+			seen[k] = true
+			evidence = append(evidence, k)
+		}
+	}
+	own := ""
+	if u, err := url.Parse(p.GUID); err == nil {
+		own = strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	}
+	for _, d := range extractLinkDomains(p.Content) {
+		if d != own && !seen[d] {
+			seen[d] = true
+			evidence = append(evidence, d)
+		}
+	}
+	return evidence
+}
+
+// checkPublicURL fetches a permalink as an anonymous visitor and looks for
+// the post's spam in what it serves.
+func checkPublicURL(ctx context.Context, p Post, link string) URLVisibility {
+	v := URLVisibility{PostID: p.ID, Title: p.Title, Classification: p.AIClassification, URL: link}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		v.Visibility, v.Error = visibilityUnreachable, err.Error()
+		return v
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		v.Visibility, v.Error = visibilityUnreachable, err.Error()
+		return v
+	}
+	defer resp.Body.Close()
+	v.Status = resp.StatusCode
+	if final := resp.Request.URL.String(); final != link {
+		v.FinalURL = final
+	}
+	if resp.StatusCode >= 300 || strings.Contains(resp.Request.URL.Path, "wp-login.php") {
+		v.Visibility = visibilityNotPublic
+		return v
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, publicBodyLimit))
+	if err != nil {
+		v.Visibility, v.Error = visibilityUnreachable, fmt.Sprintf("reading the page: %v", err)
+		return v
+	}
+	page := strings.ToLower(string(body))
+	for _, e := range spamEvidence(p) {
+		if strings.Contains(page, e) {
+			v.Evidence = append(v.Evidence, e)
+		}
+	}
+	v.Visibility = visibilityReachable
+	if len(v.Evidence) > 0 {
+		v.Visibility = visibilityPublic
+	}
+	return v
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	queryWhere  string
+	queryFormat string
+	queryOutput string
+)
+
+var queryCmd = &cobra.Command{
+	Use:   "query",
+	Short: "Filter stored results and write them in any supported format.",
+	Long: `Runs a filter over the findings accumulated in --store-path and writes the
+matching rows as CSV, JSON, XLSX or an HTML report. The --where clause is plain
+SQLite, for example:
+
+  query --store-path results.db --where "classification='Spam' AND author_login='bob'"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runQuery()
+	},
+}
+
+func init() {
+	queryCmd.Flags().StringVar(&queryWhere, "where", "", "SQL filter over the findings table.")
+	queryCmd.Flags().StringVar(&queryFormat, "format", "csv", "Output format: csv, json, html or xlsx.")
+	queryCmd.Flags().StringVar(&queryOutput, "output", "-", "Output file, or - for stdout.")
+	rootCmd.AddCommand(queryCmd)
+}
+
+func runQuery() {
+	if storePath == "" {
+		fatal("--store-path is required for query.")
+	}
+	db, err := openStoreReadOnly(storePath)
+	if err != nil {
+		fatalf("Failed to open store: %v", err)
+	}
+	defer db.Close()
+
+	posts, err := queryFindings(db, queryWhere)
+	if err != nil {
+		fatalf("Query failed: %v", err)
+	}
+	posts = reportedPosts(posts)
+
+	if queryOutput != "-" && (queryFormat == "csv" || queryFormat == "xlsx") {
+		if _, err := writeTable(queryOutput, queryFormat, csvHeaders, postRecords(posts)); err != nil {
+			fatalf("Failed to write results: %v", err)
+		}
+		log.Printf("Query matched %d rows.", len(posts))
+		return
+	}
+
+	out := io.Writer(os.Stdout)
+	if queryOutput != "-" {
+		file, err := os.Create(queryOutput)
+		if err != nil {
+			fatalf("Error creating output file %s: %v", queryOutput, err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if err := writePosts(out, queryFormat, posts); err != nil {
+		fatalf("Failed to write results: %v", err)
+	}
+	log.Printf("Query matched %d rows.", len(posts))
+}
+
+// writePosts renders posts in one of the supported output formats.
+func writePosts(w io.Writer, format string, posts []Post) error {
+	switch format {
+	case "csv":
+		writer := csv.NewWriter(w)
+		if err := writer.Write(csvHeaders); err != nil {
+			return err
+		}
+		writeCSV(writer, posts)
+		writer.Flush()
+		return writer.Error()
+	case "json":
+		rows := make([]map[string]string, 0, len(posts))
+		for _, post := range posts {
+			row := make(map[string]string, len(csvHeaders))
+			for i, v := range postRecord(post) {
+				row[csvHeaders[i]] = v
+			}
+			rows = append(rows, row)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	case "html":
+		return renderHTMLReport(w, newReportData(posts))
+	case "xlsx":
+		return writeXLSX(w, "Results", csvHeaders, postRecords(posts))
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+}
@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	quickScan   bool
+	quickBudget time.Duration
+)
+
+// A day is a publishing burst when it has at least quickBurstMin posts and
+// quickBurstFactor times the median of the site's publishing days.
+const (
+	quickBurstMin    = 3
+	quickBurstFactor = 3
+)
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&quickScan, "quick", false, "Triage only: run the cheap signals (post metadata, keyword rules, link domains, publishing bursts) within --quick-budget and say whether a full audit is warranted. Nothing is written.")
+	rootCmd.PersistentFlags().DurationVar(&quickBudget, "quick-budget", 2*time.Minute, "Time budget of --quick; signals that do not finish in time are reported as not checked.")
+}
+
+// QuickScan is the outcome of --quick. Content-based counts are only
+// meaningful when ContentScanned is set.
+type QuickScan struct {
+	Posts          int
+	ContentScanned bool
+	Keywords       int
+	LinkingOff     int
+	Domains        map[string]int
+	Spam           int
+	Uncertain      int
+	Bursts         []PublishBurst
+	Elapsed        time.Duration
+}
+
+// PublishBurst is a day with far more new posts than the site usually
+// publishes, typical of a bulk injection.
+type PublishBurst struct {
+	Day    string
+	Posts  int
+	Median int
+}
+
+// runQuickScan triages the current site. The metadata pass is one wp post
+// list; content is fetched in a second one only if budget remains, and any
+// call still running when the budget ends is cancelled.
+func runQuickScan() {
+	ctx, cancel := context.WithTimeout(context.Background(), quickBudget)
+	defer cancel()
+	started := time.Now()
+	resetWPFallback()
+	defer closeWorkspace()
+	log.Printf("Quick scan of %s within %s; AI analysis, the store and reports are skipped.", dockerContainer, quickBudget)
+
+	posts, err := getPosts(ctx)
+	if err != nil {
+		fatalf("Quick scan failed to list posts: %v", err)
+	}
+	scan := &QuickScan{Posts: len(posts), Domains: make(map[string]int), Bursts: publishingBursts(posts)}
+	if contents, err := quickContents(ctx); err != nil {
+		log.Printf("Warning: content not scanned within the budget: %v", err)
+	} else {
+		scan.ContentScanned = true
+		quickContentSignals(scan, posts, contents)
+	}
+	scan.Elapsed = time.Since(started)
+	printQuickScan(scan)
+}
+
+// quickContents fetches every post's content in one call, keyed by ID.
+func quickContents(ctx context.Context) (map[int]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rows, err := listPostsPaged[struct {
+		ID      int    `json:"ID"`
+		Content string `json:"post_content"`
+	}](ctx, []string{"post", "list", "--post_type=" + strings.Join(postTypes, ","), "--fields=ID,post_content", "--format=json"})
+	if err != nil {
+		return nil, err
+	}
+	contents := make(map[int]string, len(rows))
+	for _, r := range rows {
+		contents[r.ID] = r.Content
+	}
+	return contents, nil
+}
+
+// quickContentSignals applies the keyword rules, link domains and local
+// heuristics to the fetched content.
+func quickContentSignals(scan *QuickScan, posts []Post, contents map[int]string) {
+	own := siteHosts(posts)
+	for i := range posts {
+		p := &posts[i]
+		p.Content = strings.TrimSpace(contents[p.ID])
+		if spamKeywordPattern.MatchString(p.Title + "\n" + p.Excerpt + "\n" + p.Content) {
+			scan.Keywords++
+		}
+		external := false
+		for _, d := range extractLinkDomains(p.Content) {
+			if !own[d] {
+				scan.Domains[d]++
+				external = true
+			}
+		}
+		if external {
+			scan.LinkingOff++
+		}
+		classifyHeuristically(p)
+		switch p.AIClassification {
+		case "Spam":
+			scan.Spam++
+		case "Uncertain":
+			scan.Uncertain++
+		}
+	}
+}
+
+// publishingBursts returns the days, oldest first, whose post count stands
+// out against the median of the days anything was published.
+func publishingBursts(posts []Post) []PublishBurst {
+	perDay := make(map[string]int)
+	for _, p := range posts {
+		if len(p.Date) >= 10 {
+			perDay[p.Date[:10]]++
+		}
+	}
+	if len(perDay) == 0 {
+		return nil
+	}
+	counts := make([]int, 0, len(perDay))
+	for _, n := range perDay {
+		counts = append(counts, n)
+	}
+	sort.Ints(counts)
+	median := counts[len(counts)/2]
+	var bursts []PublishBurst
+	for day, n := range perDay {
+		if n >= quickBurstMin && n >= quickBurstFactor*median {
+			bursts = append(bursts, PublishBurst{Day: day, Posts: n, Median: median})
+		}
+	}
+	sort.Slice(bursts, func(i, j int) bool { return bursts[i].Day < bursts[j].Day })
+	return bursts
+}
+
+// verdict lists the signals that warrant a full audit; none means the cheap
+// checks found nothing.
+func (s *QuickScan) verdict() []string {
+	var reasons []string
+	if s.Spam > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d post(s) look like spam", s.Spam))
+	}
+	if s.Keywords > 0 && s.Spam == 0 {
+		reasons = append(reasons, fmt.Sprintf("%d post(s) mention spam keywords", s.Keywords))
+	}
+	if len(s.Bursts) > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d publishing burst(s)", len(s.Bursts)))
+	}
+	return reasons
+}
+
+func printQuickScan(s *QuickScan) {
+	fmt.Printf("Quick scan of %s (%s of %s budget)\n", dockerContainer, s.Elapsed.Round(100*time.Millisecond), quickBudget)
+	fmt.Printf("%-32s %8d\n", "Posts and pages", s.Posts)
+	fmt.Printf("%-32s %8d\n", "Publishing bursts", len(s.Bursts))
+	for _, b := range s.Bursts {
+		fmt.Printf("  %s: %d posts (median %d a day)\n", b.Day, b.Posts, b.Median)
+	}
+	if s.ContentScanned {
+		fmt.Printf("%-32s %8d\n", "Mentioning spam keywords", s.Keywords)
+		fmt.Printf("%-32s %8d (%d domains)\n", "Linking off-site", s.LinkingOff, len(s.Domains))
+		for _, d := range topDomains(s.Domains, 5) {
+			fmt.Printf("  %s: %d post(s)\n", d, s.Domains[d])
+		}
+		fmt.Printf("%-32s %8d\n", "Heuristically Spam", s.Spam)
+		fmt.Printf("%-32s %8d\n", "Heuristically Uncertain", s.Uncertain)
+	} else {
+		fmt.Println("Content signals: not checked, the budget ran out")
+	}
+
+	reasons := s.verdict()
+	switch {
+	case len(reasons) > 0:
+		fmt.Printf("Verdict: full audit recommended (%s)\n", strings.Join(reasons, "; "))
+	case !s.ContentScanned:
+		fmt.Println("Verdict: inconclusive; rerun with a larger --quick-budget or run a full audit")
+	default:
+		fmt.Println("Verdict: no cheap signals of compromise; a full audit is optional")
+	}
+}
+
+// topDomains returns up to n domains by descending post count.
+func topDomains(domains map[string]int, n int) []string {
+	list := make([]string, 0, len(domains))
+	for d := range domains {
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if domains[list[i]] != domains[list[j]] {
+			return domains[list[i]] > domains[list[j]]
+		}
+		return list[i] < list[j]
+	})
+	return list[:min(n, len(list))]
+}
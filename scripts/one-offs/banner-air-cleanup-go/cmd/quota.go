@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// aiQuotaWait is the longest a request waits for a rate limit to reset. Per
+// minute limits are waited out; a daily quota fails the remaining posts fast
+// so they are queued for retry instead of each making a doomed request.
+var aiQuotaWait time.Duration
+
+// quotaUnknownReset is assumed when a provider reports exhaustion without a
+// reset time, e.g. an OpenAI account out of credit.
+const quotaUnknownReset = time.Hour
+
+// quotaAttempts caps how often one request is retried after waiting out a
+// rate limit.
+const quotaAttempts = 3
+
+func init() {
+	rootCmd.PersistentFlags().DurationVar(&aiQuotaWait, "ai-quota-wait", 2*time.Minute, "Longest wait for an AI rate limit to reset; past it, remaining posts go to the retry queue without being sent.")
+}
+
+// quotaError reports that an AI account is out of quota until ResetAt.
+type quotaError struct {
+	Account string
+	Reason  string
+	ResetAt time.Time
+	Err     error // the provider's error; nil when the request was not sent
+}
+
+func (e *quotaError) Error() string {
+	msg := fmt.Sprintf("AI quota for %s exhausted (%s) until %s", e.Account, e.Reason, e.ResetAt.Format(time.RFC3339))
+	if e.Err == nil {
+		return msg + "; not sent"
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *quotaError) Unwrap() error { return e.Err }
+
+// quotaState tracks one AI account's quota. It outlives the clients, which
+// are created per site, so every site and monitor scan sharing a key sees
+// that it is exhausted.
+type quotaState struct {
+	account string
+
+	mu      sync.Mutex
+	resetAt time.Time
+	reason  string
+	// logged is the reset last announced, and loggedLong whether it was
+	// past --ai-quota-wait; workers hitting the same limit log it once.
+	logged     time.Time
+	loggedLong bool
+}
+
+var (
+	quotasMu sync.Mutex
+	quotas   = make(map[string]*quotaState)
+)
+
+// accountQuota returns the quota of the account named by account, e.g.
+// "gemini via GEMINI_API_KEY".
+func accountQuota(account string) *quotaState {
+	quotasMu.Lock()
+	defer quotasMu.Unlock()
+	q, ok := quotas[account]
+	if !ok {
+		q = &quotaState{account: account}
+		quotas[account] = q
+	}
+	return q
+}
+
+// exhaustedQuotas returns the accounts that are out of quota now.
+func exhaustedQuotas() []*quotaState {
+	quotasMu.Lock()
+	defer quotasMu.Unlock()
+	var out []*quotaState
+	for _, q := range quotas {
+		if !q.exhaustedUntil().IsZero() {
+			out = append(out, q)
+		}
+	}
+	return out
+}
+
+// exhaustedUntil returns when the quota resets, or zero if it is not
+// exhausted.
+func (q *quotaState) exhaustedUntil() time.Time {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if time.Now().Before(q.resetAt) {
+		return q.resetAt
+	}
+	return time.Time{}
+}
+
+// exhaust records that the quota is used up until resetAt. The latest reset
+// wins, so a short per-minute retry delay does not mask a daily quota.
+func (q *quotaState) exhaust(reason string, resetAt time.Time) {
+	if resetAt.IsZero() {
+		resetAt = time.Now().Add(quotaUnknownReset)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if resetAt.After(q.resetAt) {
+		q.resetAt, q.reason = resetAt, reason
+	}
+}
+
+// wait blocks until the quota resets if that is within --ai-quota-wait, and
+// otherwise returns a quotaError so the caller can fail without a request.
+func (q *quotaState) wait(ctx context.Context) error {
+	q.mu.Lock()
+	resetAt, reason := q.resetAt, q.reason
+	d := time.Until(resetAt)
+	if d <= 0 {
+		q.mu.Unlock()
+		return nil
+	}
+	long := d > aiQuotaWait
+	announce := time.Now().After(q.logged) || long && !q.loggedLong
+	if announce {
+		q.logged, q.loggedLong = resetAt, long
+	}
+	q.mu.Unlock()
+
+	if long {
+		if announce {
+			log.Printf("Warning: AI quota for %s is exhausted (%s) until %s; remaining posts are queued for retry without being sent.",
+				q.account, reason, resetAt.Format(time.RFC3339))
+		}
+		return &quotaError{Account: q.account, Reason: reason, ResetAt: resetAt}
+	}
+	if announce {
+		log.Printf("AI rate limit for %s reached (%s); waiting %s.", q.account, reason, d.Round(time.Second))
+	}
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// do runs one request under the quota, waiting out short rate limits and
+// retrying the request once they reset.
+func (q *quotaState) do(ctx context.Context, call func() (string, string, error)) (string, string, error) {
+	for attempt := 1; ; attempt++ {
+		if err := q.wait(ctx); err != nil {
+			return "", "", err
+		}
+		text, modelVersion, err := call()
+		var qe *quotaError
+		if !errors.As(err, &qe) {
+			return text, modelVersion, err
+		}
+		q.exhaust(qe.Reason, qe.ResetAt)
+		qe.Account, qe.ResetAt = q.account, q.exhaustedUntil()
+		if attempt == quotaAttempts {
+			return text, modelVersion, err
+		}
+	}
+}
+
+// geminiQuotaError turns a Gemini 429 into a quotaError. The API sends no
+// rate limit headers; the error details name the quota that ran out and how
+// long to back off. Daily quotas reset at midnight Pacific time, whatever
+// retry delay accompanies them.
+func geminiQuotaError(err error) error {
+	var apiErr genai.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusTooManyRequests {
+		return err
+	}
+	qe := &quotaError{Reason: "rate limit", Err: err}
+	daily := false
+	for _, d := range apiErr.Details {
+		switch d["@type"] {
+		case "type.googleapis.com/google.rpc.RetryInfo":
+			if s, ok := d["retryDelay"].(string); ok {
+				if delay, err := time.ParseDuration(s); err == nil {
+					qe.ResetAt = time.Now().Add(delay)
+				}
+			}
+		case "type.googleapis.com/google.rpc.QuotaFailure":
+			violations, _ := d["violations"].([]any)
+			for _, v := range violations {
+				m, _ := v.(map[string]any)
+				if id, _ := m["quotaId"].(string); id != "" {
+					qe.Reason = id
+					daily = daily || strings.Contains(id, "PerDay")
+				}
+			}
+		}
+	}
+	if daily {
+		qe.ResetAt = nextPacificMidnight(time.Now())
+	}
+	return qe
+}
+
+func nextPacificMidnight(now time.Time) time.Time {
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		loc = time.FixedZone("PST", -8*60*60)
+	}
+	t := now.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+}
+
+// openAIRateLimit reads the x-ratelimit headers OpenAI sends with every
+// response and returns when the account runs out of requests or tokens, or
+// zero while both remain.
+func openAIRateLimit(h http.Header) (reason string, resetAt time.Time) {
+	for _, kind := range []string{"requests", "tokens"} {
+		if h.Get("x-ratelimit-remaining-"+kind) != "0" {
+			continue
+		}
+		if d, err := time.ParseDuration(h.Get("x-ratelimit-reset-" + kind)); err == nil {
+			if t := time.Now().Add(d); t.After(resetAt) {
+				reason, resetAt = fmt.Sprintf("%s limit of %s", kind, h.Get("x-ratelimit-limit-"+kind)), t
+			}
+		}
+	}
+	return reason, resetAt
+}
+
+// openAIQuotaError describes a 429 from OpenAI. An account out of credit
+// (insufficient_quota) has no reset time.
+func openAIQuotaError(h http.Header, body []byte, err error) *quotaError {
+	qe := &quotaError{Reason: "rate limit", Err: err}
+	var payload struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &payload) == nil && payload.Error.Code == "insufficient_quota" {
+		qe.Reason = "insufficient_quota"
+		return qe
+	}
+	if reason, resetAt := openAIRateLimit(h); !resetAt.IsZero() {
+		qe.Reason, qe.ResetAt = reason, resetAt
+	} else if secs, err := strconv.Atoi(h.Get("Retry-After")); err == nil {
+		qe.ResetAt = time.Now().Add(time.Duration(secs) * time.Second)
+	}
+	return qe
+}
+
+// logQuota tells how posts left unanalyzed by an exhausted quota will be
+// picked up.
+func logQuota(client AIClient, queued int) {
+	resetAt := client.Quota().exhaustedUntil()
+	if resetAt.IsZero() || queued == 0 {
+		return
+	}
+	log.Printf("AI quota for %s resets at %s; monitor re-analyzes the queued posts then, or run analyze --retry-file=%s after it.",
+		client.Quota().account, resetAt.Format(time.RFC3339), retryFilePath)
+}
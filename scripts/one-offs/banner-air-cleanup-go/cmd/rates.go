@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var rateMonths int
+
+const (
+	// A day is a spike when it has at least spikeMinimum items and
+	// spikeFactor times its trailing baseline.
+	spikeMinimum  = 5
+	spikeFactor   = 4
+	baselineDays  = 28
+	rateDayLayout = "2006-01-02"
+)
+
+// DayRate is the number of posts and comments created on one day.
+type DayRate struct {
+	Date         string
+	Posts        int
+	Comments     int
+	PostSpike    bool
+	CommentSpike bool
+	Note         string
+}
+
+func (d DayRate) Spike() bool {
+	return d.PostSpike || d.CommentSpike
+}
+
+// RateReport is the per-day creation rate over the last Months months, with
+// spikes annotated so the report answers "when did this start".
+type RateReport struct {
+	Months     int
+	Since      string
+	Days       []DayRate // days with any activity
+	Spikes     int
+	FirstSpike string
+}
+
+// rateQuery counts posts and comments per day since a date. Trashed posts
+// are included: spam that was already cleaned up still dates the campaign.
+func rateQuery(since string) func(prefix string) string {
+	return func(prefix string) string {
+		return fmt.Sprintf(`SELECT d, SUM(p), SUM(c) FROM (
+			SELECT DATE(post_date) AS d, 1 AS p, 0 AS c FROM %[1]sposts
+				WHERE post_type IN ('post', 'page') AND post_status NOT IN ('auto-draft', 'inherit') AND post_date >= '%[2]s'
+			UNION ALL
+			SELECT DATE(comment_date), 0, 1 FROM %[1]scomments WHERE comment_date >= '%[2]s'
+		) t GROUP BY d ORDER BY d`, prefix, since)
+	}
+}
+
+// getCreationRates reads the daily counts for the last months months and
+// annotates spikes.
+func getCreationRates(ctx context.Context, months int, now time.Time) (*RateReport, error) {
+	start := now.AddDate(0, -months, 0)
+	output, err := dbQuery(ctx, rateQuery(start.Format(rateDayLayout)))
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]DayRate)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		posts, err1 := strconv.Atoi(fields[1])
+		comments, err2 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("unexpected rate output %q", line)
+		}
+		counts[fields[0]] = DayRate{Date: fields[0], Posts: posts, Comments: comments}
+	}
+
+	var series []DayRate
+	for d := start; !d.After(now); d = d.AddDate(0, 0, 1) {
+		key := d.Format(rateDayLayout)
+		day := counts[key]
+		day.Date = key
+		series = append(series, day)
+	}
+	return annotateSpikes(series, months), nil
+}
+
+// annotateSpikes marks days whose posts or comments far exceed the median
+// of the preceding baselineDays days.
+func annotateSpikes(series []DayRate, months int) *RateReport {
+	report := &RateReport{Months: months}
+	if len(series) > 0 {
+		report.Since = series[0].Date
+	}
+	for i := range series {
+		day := &series[i]
+		from := max(0, i-baselineDays)
+		var notes []string
+		for _, kind := range []struct {
+			name  string
+			count func(DayRate) int
+			spike *bool
+		}{
+			{"posts", func(d DayRate) int { return d.Posts }, &day.PostSpike},
+			{"comments", func(d DayRate) int { return d.Comments }, &day.CommentSpike},
+		} {
+			var window []int
+			for _, d := range series[from:i] {
+				window = append(window, kind.count(d))
+			}
+			baseline := median(window)
+			n := kind.count(*day)
+			if n >= spikeMinimum && n >= spikeFactor*max(baseline, 1) {
+				notes = append(notes, fmt.Sprintf("%s spike: %d vs typical %d/day", kind.name, n, baseline))
+				*kind.spike = true
+			}
+		}
+		if len(notes) == 0 {
+			continue
+		}
+		report.Spikes++
+		if i == 0 || !series[i-1].Spike() {
+			notes = append(notes, "start of spike")
+		}
+		if report.FirstSpike == "" {
+			report.FirstSpike = day.Date
+			notes = append(notes, "earliest anomaly in range")
+		}
+		day.Note = strings.Join(notes, "; ")
+	}
+	for _, day := range series {
+		if day.Posts+day.Comments > 0 {
+			report.Days = append(report.Days, day)
+		}
+	}
+	return report
+}
+
+func median(values []int) int {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]int(nil), values...)
+	sort.Ints(sorted)
+	return sorted[len(sorted)/2]
+}
+
+// runRateReport builds the creation-rate table for the HTML report. A
+// failure only leaves the table out.
+func runRateReport(ctx context.Context) *RateReport {
+	rates, err := getCreationRates(ctx, rateMonths, time.Now())
+	if err != nil {
+		log.Printf("Warning: could not build the creation-rate table: %v", err)
+		return nil
+	}
+	if rates.FirstSpike != "" {
+		log.Printf("Creation rate: %d spike day(s) in the last %d month(s), earliest on %s.", rates.Spikes, rates.Months, rates.FirstSpike)
+	}
+	return rates
+}
@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	disableRedirects     []string
+	disableSpamRedirects bool
+)
+
+// Redirect-manager plugins whose rules are checked. Injected rules send
+// visitors of a legitimate-looking URL on the site to the spammer's domain,
+// and survive the removal of every spam post.
+const (
+	pluginRedirection = "redirection"
+	pluginPrettyLinks = "pretty-links"
+)
+
+// redirectsPHP lists the rules of the Redirection and Pretty Links plugins,
+// whichever are installed. Columns are read by name so older plugin
+// versions without a status column still list their rules.
+const redirectsPHP = `global $wpdb;
+$out = array();
+$table = $wpdb->prefix . 'redirection_items';
+if ($wpdb->get_var($wpdb->prepare('SHOW TABLES LIKE %s', $table)) === $table) {
+	foreach ($wpdb->get_results("SELECT * FROM $table") as $r) {
+		$out[] = array(
+			'plugin' => 'redirection',
+			'id' => (int) $r->id,
+			'source' => (string) $r->url,
+			'target' => (string) $r->action_data,
+			'enabled' => !isset($r->status) || 'enabled' === $r->status,
+			'hits' => isset($r->last_count) ? (int) $r->last_count : 0,
+		);
+	}
+}
+$table = $wpdb->prefix . 'prli_links';
+if ($wpdb->get_var($wpdb->prepare('SHOW TABLES LIKE %s', $table)) === $table) {
+	foreach ($wpdb->get_results("SELECT * FROM $table") as $r) {
+		$out[] = array(
+			'plugin' => 'pretty-links',
+			'id' => (int) $r->id,
+			'name' => isset($r->name) ? (string) $r->name : '',
+			'source' => '/' . $r->slug,
+			'target' => (string) $r->url,
+			'enabled' => !isset($r->link_status) || 'enabled' === $r->link_status,
+		);
+	}
+}
+echo wp_json_encode($out);`
+
+// RedirectRule is one rule of a redirect-manager plugin. Target is the
+// plugin's raw action data, which Redirection serializes for rules with
+// several possible targets.
+type RedirectRule struct {
+	Plugin  string `json:"plugin"`
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Source  string `json:"source"`
+	Target  string `json:"target"`
+	Enabled bool   `json:"enabled"`
+	Hits    int    `json:"hits"`
+}
+
+// targets returns the URLs the rule can redirect to, decoding Redirection's
+// serialized action data.
+func (r RedirectRule) targets() []string {
+	var targets []string
+	for _, t := range strings.Split(structuredMetaText(phpMetaValue(r.Target)), "\n") {
+		if t = strings.TrimSpace(t); t != "" {
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+// redirectSubject identifies a rule in typed findings and on the command
+// line, e.g. redirect:redirection:12.
+func redirectSubject(plugin string, id int) string {
+	return fmt.Sprintf("redirect:%s:%d", plugin, id)
+}
+
+// parseRedirectSubject is the inverse of redirectSubject; the "redirect:"
+// prefix is optional, so --disable-redirect takes "redirection:12".
+func parseRedirectSubject(subject string) (plugin string, id int, ok bool) {
+	plugin, rest, found := strings.Cut(strings.TrimPrefix(subject, "redirect:"), ":")
+	if !found || (plugin != pluginRedirection && plugin != pluginPrettyLinks) {
+		return "", 0, false
+	}
+	id, err := strconv.Atoi(rest)
+	return plugin, id, err == nil && id > 0
+}
+
+func getRedirectRules(ctx context.Context) ([]RedirectRule, error) {
+	output, err := runWPScript(ctx, "redirects.php", redirectsPHP)
+	if err != nil {
+		return nil, err
+	}
+	var rules []RedirectRule
+	if err := json.Unmarshal([]byte(output), &rules); err != nil {
+		return nil, fmt.Errorf("parsing redirect rules: %w", err)
+	}
+	return rules, nil
+}
+
+// shortenerPattern and spamTLDPattern match hosts the sweep counts as
+// suspicious.
+var (
+	shortenerPattern = regexp.MustCompile(`^(` + strings.Join(sweepShorteners, "|") + `)$`)
+	spamTLDPattern   = regexp.MustCompile(`[.](` + strings.Join(sweepSpamTLDs, "|") + `)$`)
+)
+
+// detectSpamRedirects flags enabled redirect rules that send visitors off
+// the site to a domain the site's spam links to, or whose source or target
+// uses spam keywords; those are Spam. Rules to URL shorteners or spam-heavy
+// TLDs are Uncertain. Other off-site redirects, such as affiliate links, are
+// left alone.
+func detectSpamRedirects(ctx context.Context, posts []Post) []Finding {
+	rules, err := getRedirectRules(ctx)
+	if err != nil {
+		log.Printf("Warning: could not check redirect rules: %v", err)
+		return nil
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	own := siteHosts(posts)
+	spamDomains := make(map[string]bool)
+	for _, p := range posts {
+		if p.AIClassification == "Spam" {
+			for _, d := range extractLinkDomains(p.Content) {
+				if !own[d] {
+					spamDomains[d] = true
+				}
+			}
+		}
+	}
+
+	var findings []Finding
+	for _, r := range rules {
+		if !r.Enabled {
+			continue
+		}
+		targets := strings.Join(r.targets(), ", ")
+		var reasons []string
+		class := ""
+		for _, d := range extractLinkDomains(targets) {
+			switch {
+			case own[d]:
+			case spamDomains[d]:
+				class = "Spam"
+				reasons = append(reasons, d+" is linked from spam posts")
+			case shortenerPattern.MatchString(d):
+				class = firstNonEmpty(class, "Uncertain")
+				reasons = append(reasons, d+" is a URL shortener")
+			case spamTLDPattern.MatchString(d):
+				class = firstNonEmpty(class, "Uncertain")
+				reasons = append(reasons, d+" is on a spam-heavy TLD")
+			}
+		}
+		if words := spamKeywordPattern.FindAllString(r.Name+"\n"+r.Source+"\n"+targets, -1); len(words) > 0 {
+			class = "Spam"
+			reasons = append(reasons, "spam keywords: "+strings.ToLower(strings.Join(words, ", ")))
+		}
+		if class == "" {
+			continue
+		}
+		detail := fmt.Sprintf("%s redirects to %s: %s", r.Source, targets, strings.Join(reasons, "; "))
+		if r.Hits > 0 {
+			detail += fmt.Sprintf("; %d hit(s)", r.Hits)
+		}
+		findings = append(findings, Finding{
+			Site:           dockerContainer,
+			Type:           "spam-redirect",
+			Subject:        redirectSubject(r.Plugin, r.ID),
+			Title:          fmt.Sprintf("%s rule %d: %s", r.Plugin, r.ID, firstNonEmpty(r.Name, r.Source)),
+			Classification: class,
+			Detail:         detail,
+		})
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Subject < findings[j].Subject })
+	if len(findings) > 0 {
+		log.Printf("%d redirect rule(s) on %s point to suspicious destinations.", len(findings), dockerContainer)
+	}
+	return findings
+}
+
+// cleanRedirects disables the rules named by --disable-redirect and, with
+// --disable-spam-redirects, every rule stored as a Spam redirect finding.
+// Rules are disabled rather than deleted, so a mistake is undone from the
+// plugin's own screen.
+func cleanRedirects(ctx context.Context, db *sql.DB) {
+	subjects := make(map[string]bool)
+	for _, name := range disableRedirects {
+		plugin, id, _ := parseRedirectSubject(name) // validated before the first site
+		subjects[redirectSubject(plugin, id)] = true
+	}
+	if disableSpamRedirects {
+		spam, err := queryTypedFindings(db, siteFilter(dockerContainer)+" AND type = 'spam-redirect' AND classification = 'Spam'")
+		if err != nil {
+			log.Printf("Warning: could not load spam redirects: %v", err)
+		}
+		for _, f := range spam {
+			subjects[f.Subject] = true
+		}
+	}
+	if len(subjects) == 0 {
+		return
+	}
+	rules, err := getRedirectRules(ctx)
+	if err != nil {
+		log.Printf("Warning: could not list redirect rules on %s: %v", dockerContainer, err)
+		return
+	}
+	enabled := make(map[string]RedirectRule)
+	for _, r := range rules {
+		if r.Enabled {
+			enabled[redirectSubject(r.Plugin, r.ID)] = r
+		}
+	}
+
+	list := make([]string, 0, len(subjects))
+	for s := range subjects {
+		list = append(list, s)
+	}
+	sort.Strings(list)
+	for _, subject := range list {
+		r, ok := enabled[subject]
+		if !ok {
+			log.Printf("Redirect %s is already disabled or gone on %s.", subject, dockerContainer)
+			continue
+		}
+		rule := fmt.Sprintf("%s rule %d (%s -> %s)", r.Plugin, r.ID, r.Source, strings.Join(r.targets(), ", "))
+		if cleanupDryRun {
+			log.Printf("Would disable %s.", rule)
+			continue
+		}
+		if _, err := dbQuery(ctx, disableRedirectQuery(r.Plugin, r.ID)); err != nil {
+			log.Printf("Warning: could not disable %s: %v", rule, err)
+			continue
+		}
+		log.Printf("Disabled %s.", rule)
+	}
+}
+
+// disableRedirectQuery builds the statement that turns a rule off the way
+// the plugin's own admin screen does.
+func disableRedirectQuery(plugin string, id int) func(prefix string) string {
+	return func(prefix string) string {
+		if plugin == pluginPrettyLinks {
+			return fmt.Sprintf("UPDATE %sprli_links SET link_status = 'disabled' WHERE id = %d", prefix, id)
+		}
+		return fmt.Sprintf("UPDATE %sredirection_items SET status = 'disabled' WHERE id = %d", prefix, id)
+	}
+}
+
+func validateRedirectNames(names []string) error {
+	for _, name := range names {
+		if _, _, ok := parseRedirectSubject(name); !ok {
+			return fmt.Errorf("invalid --disable-redirect %q; expected redirection:ID or pretty-links:ID", name)
+		}
+	}
+	return nil
+}
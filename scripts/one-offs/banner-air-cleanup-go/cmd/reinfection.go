@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// cleanedPost is what the store remembers of a post removed by cleanup.
+type cleanedPost struct {
+	ID          int
+	GUID        string
+	ContentHash string
+	CleanedAt   string
+}
+
+// detectReinfection flags posts that came back after cleanup: a cleaned post
+// listed again under its own ID, or a new post with the GUID or content of a
+// cleaned one. Scheduled malware (cron jobs, must-use plugins, injected
+// options) commonly re-publishes the spam it placed once it is removed.
+func detectReinfection(posts []Post) []Finding {
+	if storePath == "" {
+		return nil
+	}
+	if _, err := os.Stat(storePath); err != nil {
+		return nil // nothing has been cleaned through a store that does not exist yet
+	}
+	db, err := openStoreReadOnly(storePath)
+	if err != nil {
+		log.Printf("Warning: could not check for reinfection: %v", err)
+		return nil
+	}
+	defer db.Close()
+	cleaned, err := loadCleanedPosts(db, dockerContainer)
+	if err != nil {
+		log.Printf("Warning: could not check for reinfection: %v", err)
+		return nil
+	}
+	if len(cleaned) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]cleanedPost)
+	byHash := make(map[string]cleanedPost)
+	byGUID := make(map[string]cleanedPost)
+	for _, c := range cleaned {
+		byID[c.ID] = c
+		if c.ContentHash != "" {
+			byHash[c.ContentHash] = c
+		}
+		if c.GUID != "" {
+			byGUID[c.GUID] = c
+		}
+	}
+
+	var findings []Finding
+	for _, p := range posts {
+		var detail string
+		if c, ok := byID[p.ID]; ok {
+			detail = fmt.Sprintf("post %d was cleaned on %s and is listed again", c.ID, c.CleanedAt)
+		} else if c, ok := byHash[p.ContentHash]; ok && p.ContentHash != "" {
+			detail = fmt.Sprintf("same content as post %d, cleaned on %s", c.ID, c.CleanedAt)
+		} else if c, ok := byGUID[p.GUID]; ok && p.GUID != "" {
+			detail = fmt.Sprintf("same GUID as post %d, cleaned on %s", c.ID, c.CleanedAt)
+		} else {
+			continue
+		}
+		findings = append(findings, Finding{
+			Site:           dockerContainer,
+			Type:           "reinfection",
+			Subject:        fmt.Sprintf("post:%d", p.ID),
+			PostID:         p.ID,
+			Title:          p.Title,
+			Classification: "Spam",
+			Detail:         detail + "; look for a cron event, mu-plugin or option that re-creates it",
+		})
+	}
+	if len(findings) > 0 {
+		log.Printf("Warning: %d cleaned post(s) reappeared on %s; the site is likely still infected.", len(findings), dockerContainer)
+	}
+	return findings
+}
+
+func loadCleanedPosts(db *sql.DB, site string) ([]cleanedPost, error) {
+	rows, err := db.Query(`SELECT post_id, post_guid, content_hash, review_updated_at FROM findings
+		WHERE site = ? AND review_state = 'cleaned'`, site)
+	if err != nil {
+		return nil, fmt.Errorf("loading cleaned posts: %w", err)
+	}
+	defer rows.Close()
+	var cleaned []cleanedPost
+	for rows.Next() {
+		var c cleanedPost
+		if err := rows.Scan(&c.ID, &c.GUID, &c.ContentHash, &c.CleanedAt); err != nil {
+			return nil, err
+		}
+		cleaned = append(cleaned, c)
+	}
+	return cleaned, rows.Err()
+}
+
+// reopenReinfected puts cleaned findings whose post is back under review
+// again, so the next cleanup removes it again.
+func reopenReinfected(db *sql.DB, site string, findings []Finding) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, f := range findings {
+		if f.Type != "reinfection" {
+			continue
+		}
+		if _, err := db.Exec(`UPDATE findings SET review_state = 'new', review_updated_at = ?
+			WHERE site = ? AND post_id = ? AND review_state = 'cleaned'`, now, site, f.PostID); err != nil {
+			return fmt.Errorf("reopening post %d: %w", f.PostID, err)
+		}
+	}
+	return nil
+}
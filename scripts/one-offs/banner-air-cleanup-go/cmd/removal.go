@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Removal methods the cleanup command can apply to a post.
+const (
+	removeTrash   = "trash"   // wp post delete: recoverable from the trash
+	removeDelete  = "delete"  // wp post delete --force: permanent
+	removeDraft   = "draft"   // unpublish but keep, e.g. products with order history
+	removeCommand = "command" // a plugin's own wp-cli command
+)
+
+// CleanupRule selects a removal method for posts of a classification and
+// post type; an empty field matches anything. The first matching rule wins.
+//
+//	{"classification": "Uncertain", "post_type": "product", "method": "draft"}
+//	{"post_type": "product", "method": "command", "command": "wc product delete {{.ID}} --force=true --user=1"}
+type CleanupRule struct {
+	Classification string `json:"classification,omitempty"`
+	PostType       string `json:"post_type,omitempty"`
+	Method         string `json:"method"`
+	// Command is the wp-cli command for the command method, a template over
+	// the post, e.g. "wc product delete {{.ID}} --force=true --user=1".
+	Command string `json:"command,omitempty"`
+}
+
+// defaultCleanupRules apply after the profile's rules. Products, extracted
+// with --post-types product, are only unpublished because orders and reports
+// still reference them.
+var defaultCleanupRules = []CleanupRule{
+	{PostType: "product", Method: removeDraft},
+	{Method: removeTrash},
+}
+
+func (r CleanupRule) validate() error {
+	switch r.Method {
+	case removeTrash, removeDelete, removeDraft:
+		if r.Command != "" {
+			return fmt.Errorf("command is only used with method %q", removeCommand)
+		}
+	case removeCommand:
+		if strings.TrimSpace(r.Command) == "" {
+			return fmt.Errorf("method %q needs a command", removeCommand)
+		}
+		if _, err := template.New("command").Parse(r.Command); err != nil {
+			return fmt.Errorf("parsing command: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown method %q; expected trash, delete, draft or command", r.Method)
+	}
+	return nil
+}
+
+func (r CleanupRule) matches(p Post) bool {
+	return (r.Classification == "" || r.Classification == p.AIClassification) &&
+		(r.PostType == "" || r.PostType == p.Type)
+}
+
+// cleanupRule returns the rule for a post from the site's profile, falling
+// back to the defaults. --force turns trashing into permanent deletion.
+func cleanupRule(p Post) CleanupRule {
+	var rule CleanupRule
+	for _, r := range append(append([]CleanupRule(nil), activeProfile.Cleanup...), defaultCleanupRules...) {
+		if r.matches(p) {
+			rule = r // the last default matches every post
+			break
+		}
+	}
+	if cleanupForce && rule.Method == removeTrash {
+		rule.Method = removeDelete
+	}
+	return rule
+}
+
+// wpArgs returns the wp-cli command that removes the post.
+func (r CleanupRule) wpArgs(p Post) ([]string, error) {
+	id := strconv.Itoa(p.ID)
+	switch r.Method {
+	case removeTrash:
+		return []string{"post", "delete", id}, nil
+	case removeDelete:
+		return []string{"post", "delete", id, "--force"}, nil
+	case removeDraft:
+		return []string{"post", "update", id, "--post_status=draft"}, nil
+	}
+	tmpl, err := template.New("command").Parse(r.Command)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, p); err != nil {
+		return nil, fmt.Errorf("expanding cleanup command: %w", err)
+	}
+	return strings.Fields(b.String()), nil
+}
+
+// describe names what the rule does to a post, for dry runs.
+func (r CleanupRule) describe(p Post) string {
+	if r.Method != removeCommand {
+		return r.Method
+	}
+	args, err := r.wpArgs(p)
+	if err != nil {
+		return "fail to run a command on"
+	}
+	return fmt.Sprintf("run %q for", strings.Join(args, " "))
+}
+
+// removePost removes a post with the method its rule selects. Trashing,
+// deleting and unpublishing go through the companion plugin when the site has
+// it, which refuses with errContentChanged if the post was edited since it
+// was reviewed.
+func removePost(ctx context.Context, p Post, rule CleanupRule) error {
+	if c, err := activeCompanion(ctx); err != nil {
+		return err
+	} else if rule.Method != removeCommand && c != nil {
+		return companionRemove(ctx, p, rule.Method)
+	}
+	args, err := rule.wpArgs(p)
+	if err != nil {
+		return err
+	}
+	_, err = runWPCommand(ctx, args)
+	return err
+}
@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates/report.html.tmpl
+var reportHTMLTemplate string
+
+var (
+	onlyFlagged       bool
+	reportTemplateDir string
+	// reportTemplates is loaded from --report-template; nil means the
+	// built-in report only.
+	reportTemplates *ReportTemplates
+)
+
+// ReportData is the model passed to the report template.
+type ReportData struct {
+	Container       string
+	GeneratedAt     time.Time
+	Posts           []Post
+	Classifications map[string]int
+	Graph           *AuthorGraph
+	Skipped         []Analyzer
+	Findings        []Finding
+	WPFallback      *WPFallback
+	Rates           *RateReport
+	Campaigns       []*Campaign
+	TitleGroups     []*TitleGroup
+	// Omitted is how many Legitimate posts --only-flagged left out of Posts;
+	// they are still counted in Classifications.
+	Omitted  int
+	Criteria *ReportCriteria
+	// IncidentID and Note are the run's --incident-id and --note.
+	IncidentID string
+	Note       string
+	// Screenshots are --screenshots captures of flagged posts' pages, as
+	// PNG data URLs by post ID.
+	Screenshots map[int]template.URL
+}
+
+func newReportData(posts []Post) *ReportData {
+	counts := make(map[string]int)
+	for _, p := range posts {
+		counts[p.AIClassification]++
+	}
+
+	sorted := reportedPosts(posts)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	return &ReportData{
+		Container:       dockerContainer,
+		GeneratedAt:     time.Now(),
+		Posts:           sorted,
+		Classifications: counts,
+		Graph:           buildAuthorGraph(sorted),
+		Omitted:         len(posts) - len(sorted),
+		Criteria:        newReportCriteria(posts),
+		IncidentID:      incidentID,
+		Note:            runNote,
+	}
+}
+
+// Total is the number of posts the report covers, listed or not.
+func (d *ReportData) Total() int {
+	return len(d.Posts) + d.Omitted
+}
+
+// reportedPosts returns a copy of the posts that belong in reports and
+// exports: all of them, or with --only-flagged only those not classified
+// Legitimate. The store always receives every post.
+func reportedPosts(posts []Post) []Post {
+	reported := make([]Post, 0, len(posts))
+	for _, p := range posts {
+		if !onlyFlagged || p.AIClassification != "Legitimate" {
+			reported = append(reported, p)
+		}
+	}
+	return reported
+}
+
+func writeHTMLReport(path string, data *ReportData) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating report file %s: %w", path, err)
+	}
+	defer file.Close()
+	return renderHTMLReport(file, data)
+}
+
+func renderHTMLReport(w io.Writer, data *ReportData) error {
+	templates := reportTemplates
+	if templates == nil {
+		var err error
+		if templates, err = loadReportTemplates(""); err != nil {
+			return err
+		}
+	}
+	if err := templates.html.ExecuteTemplate(w, templates.main, data); err != nil {
+		return fmt.Errorf("rendering report: %w", err)
+	}
+	return nil
+}
+
+// customReportTemplate is the file in --report-template that replaces the
+// built-in HTML report.
+const customReportTemplate = "report.html.tmpl"
+
+// ReportTemplates are the parsed report templates: the built-in HTML report,
+// or its replacement, plus any extra reports from --report-template.
+type ReportTemplates struct {
+	html  *template.Template
+	text  *texttemplate.Template
+	main  string
+	extra []string // extra report templates, rendered next to the HTML report
+}
+
+// reportFuncs are available to every report template.
+var reportFuncs = map[string]any{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"date":  func(t time.Time, layout string) string { return t.Format(layout) },
+}
+
+// loadReportTemplates parses the built-in report and the *.tmpl files in
+// dir. Files ending in .html.tmpl are HTML-escaped, the rest (e.g.
+// summary.md.tmpl) are plain text. Files starting with _ only hold shared
+// {{define}} blocks and are not rendered themselves.
+func loadReportTemplates(dir string) (*ReportTemplates, error) {
+	t := &ReportTemplates{
+		html: template.New("report").Funcs(reportFuncs),
+		text: texttemplate.New("").Funcs(reportFuncs),
+		main: "report",
+	}
+	if _, err := t.html.Parse(reportHTMLTemplate); err != nil {
+		return nil, fmt.Errorf("parsing report template: %w", err)
+	}
+	if dir == "" {
+		return t, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no *.tmpl files in report template directory %s", dir)
+	}
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading report template: %w", err)
+		}
+		name := filepath.Base(file)
+		if strings.HasSuffix(name, ".html.tmpl") {
+			_, err = t.html.New(name).Parse(string(raw))
+		} else {
+			_, err = t.text.New(name).Parse(string(raw))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing report template %s: %w", file, err)
+		}
+		switch {
+		case name == customReportTemplate:
+			t.main = name
+		case !strings.HasPrefix(name, "_"):
+			t.extra = append(t.extra, name)
+		}
+	}
+	return t, nil
+}
+
+// writeExtraReports renders the extra report templates next to the HTML
+// report: summary.md.tmpl becomes report.summary.md for report.html, and
+// report.md.tmpl becomes report.md.
+func writeExtraReports(htmlPath string, data *ReportData) ([]string, error) {
+	if reportTemplates == nil {
+		return nil, nil
+	}
+	stem := strings.TrimSuffix(htmlPath, filepath.Ext(htmlPath))
+	var paths []string
+	for _, name := range reportTemplates.extra {
+		out := strings.TrimSuffix(name, ".tmpl")
+		if rest, ok := strings.CutPrefix(out, "report."); ok {
+			out = stem + "." + rest
+		} else {
+			out = stem + "." + out
+		}
+		if err := writeExtraReport(out, name, data); err != nil {
+			return paths, err
+		}
+		paths = append(paths, out)
+	}
+	return paths, nil
+}
+
+func writeExtraReport(path, name string, data *ReportData) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating report file %s: %w", path, err)
+	}
+	defer file.Close()
+	if strings.HasSuffix(name, ".html.tmpl") {
+		err = reportTemplates.html.ExecuteTemplate(file, name, data)
+	} else {
+		err = reportTemplates.text.ExecuteTemplate(file, name, data)
+	}
+	if err != nil {
+		return fmt.Errorf("rendering %s: %w", name, err)
+	}
+	return file.Close()
+}
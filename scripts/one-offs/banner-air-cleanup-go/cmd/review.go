@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	reviewWhere    string
+	reviewPostIDs  []int
+	reviewState    string
+	reviewAssignee string
+)
+
+var reviewCmd = &cobra.Command{
+	Use:   "review",
+	Short: "Track assignees and review state of stored findings.",
+	Long: `Findings move through the review states new -> triaged -> approved -> cleaned.
+Use "review set" to bulk-update state and assignee for the site given by
+--container-name, and "review status" to see how the work is split.`,
+}
+
+var reviewSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Bulk update review state and/or assignee.",
+	Long: `Updates every finding matching --where and/or --post-id. Passing several
+comma-separated assignees splits the matching findings between them in
+contiguous blocks of post IDs, for example:
+
+  review set --where "classification='Spam'" --state triaged --assignee alice,bob`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runReviewSet()
+	},
+}
+
+var reviewStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Summarize findings by assignee and review state.",
+	Run: func(cmd *cobra.Command, args []string) {
+		runReviewStatus()
+	},
+}
+
+func init() {
+	reviewSetCmd.Flags().StringVar(&reviewWhere, "where", "", "SQL filter over the findings table.")
+	reviewSetCmd.Flags().IntSliceVar(&reviewPostIDs, "post-id", nil, "Post ID(s) to update.")
+	reviewSetCmd.Flags().StringVar(&reviewState, "state", "", fmt.Sprintf("New review state (%s).", strings.Join(reviewStates, ", ")))
+	reviewSetCmd.Flags().StringVar(&reviewAssignee, "assignee", "", "Assignee, or a comma-separated list to split the findings between.")
+	reviewCmd.AddCommand(reviewSetCmd, reviewStatusCmd)
+	rootCmd.AddCommand(reviewCmd)
+}
+
+func runReviewSet() {
+	if storePath == "" {
+		fatal("--store-path is required for review.")
+	}
+	if reviewState == "" && reviewAssignee == "" {
+		fatal("Nothing to update: pass --state and/or --assignee.")
+	}
+	if reviewState != "" && !slices.Contains(reviewStates, reviewState) {
+		fatalf("Unknown review state %q; expected one of %s.", reviewState, strings.Join(reviewStates, ", "))
+	}
+	if reviewWhere == "" && len(reviewPostIDs) == 0 {
+		fatal("Select findings with --where and/or --post-id.")
+	}
+
+	db, err := openStore(storePath)
+	if err != nil {
+		fatalf("Failed to open store: %v", err)
+	}
+	defer db.Close()
+
+	ids, err := matchingPostIDs(db, dockerContainer, reviewWhere)
+	if err != nil {
+		fatalf("Failed to select findings: %v", err)
+	}
+	if len(reviewPostIDs) > 0 {
+		ids = slices.DeleteFunc(ids, func(id int) bool { return !slices.Contains(reviewPostIDs, id) })
+	}
+
+	assignees := []string{reviewAssignee}
+	if strings.Contains(reviewAssignee, ",") {
+		assignees = strings.Split(reviewAssignee, ",")
+	}
+	chunk := (len(ids) + len(assignees) - 1) / len(assignees)
+	for i, assignee := range assignees {
+		start := min(i*chunk, len(ids))
+		end := min(start+chunk, len(ids))
+		updated, err := updateReview(db, dockerContainer, ids[start:end], reviewState, strings.TrimSpace(assignee))
+		if err != nil {
+			fatalf("Failed to update findings: %v", err)
+		}
+		if assignee != "" {
+			log.Printf("Updated %d finding(s) assigned to %s.", updated, strings.TrimSpace(assignee))
+		} else {
+			log.Printf("Updated %d finding(s).", updated)
+		}
+	}
+}
+
+func runReviewStatus() {
+	if storePath == "" {
+		fatal("--store-path is required for review.")
+	}
+	db, err := openStoreReadOnly(storePath)
+	if err != nil {
+		fatalf("Failed to open store: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT assignee, review_state, COUNT(*) FROM findings
+		WHERE site = ? GROUP BY assignee, review_state ORDER BY assignee, review_state`, dockerContainer)
+	if err != nil {
+		fatalf("Failed to summarize findings: %v", err)
+	}
+	defer rows.Close()
+
+	fmt.Printf("%-20s %-10s %s\n", "ASSIGNEE", "STATE", "FINDINGS")
+	for rows.Next() {
+		var assignee, state string
+		var count int
+		if err := rows.Scan(&assignee, &state, &count); err != nil {
+			fatalf("Failed to read summary: %v", err)
+		}
+		if assignee == "" {
+			assignee = "(unassigned)"
+		}
+		fmt.Printf("%-20s %-10s %d\n", assignee, state, count)
+	}
+}
@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// ReviewExport is the file exchanged by "review export" and "review import".
+type ReviewExport struct {
+	ExportedAt string        `json:"exported_at"`
+	Entries    []ReviewEntry `json:"entries"`
+}
+
+// ReviewEntry carries the human decisions made on one finding.
+type ReviewEntry struct {
+	Site            string   `json:"site"`
+	PostID          int      `json:"post_id"`
+	Tags            []string `json:"tags,omitempty"`
+	Assignee        string   `json:"assignee"`
+	ReviewState     string   `json:"review_state"`
+	ReviewUpdatedAt string   `json:"review_updated_at"`
+}
+
+// ReviewConflict is a finding whose review fields were changed on both sides.
+type ReviewConflict struct {
+	Entry     ReviewEntry
+	Canonical ReviewEntry
+	Resolved  string
+}
+
+var (
+	reviewFile       string
+	reviewOnConflict string
+)
+
+var reviewExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export tags, assignees and review states to a file.",
+	Long: `Writes the review annotations of every site in --store-path to a JSON file
+that another operator can merge into the canonical store with "review import".`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runReviewExport()
+	},
+}
+
+var reviewImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Merge an exported review file into the store.",
+	Long: `Merges a file written by "review export" into --store-path. Tags are always
+merged. Review state and assignee are applied when the canonical finding has
+not been reviewed yet; when both sides changed them to different values the
+finding is reported as a conflict and resolved per --on-conflict:
+
+  keep      keep the canonical values (default)
+  incoming  take the values from the file
+  newer     take whichever side was updated last`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runReviewImport()
+	},
+}
+
+func init() {
+	reviewExportCmd.Flags().StringVar(&reviewFile, "file", "review.json", "Review file to write.")
+	reviewImportCmd.Flags().StringVar(&reviewFile, "file", "review.json", "Review file to read.")
+	reviewImportCmd.Flags().StringVar(&reviewOnConflict, "on-conflict", "keep", "Conflict resolution: keep, incoming or newer.")
+	reviewCmd.AddCommand(reviewExportCmd, reviewImportCmd)
+}
+
+func runReviewExport() {
+	if storePath == "" {
+		fatal("--store-path is required for review.")
+	}
+	db, err := openStoreReadOnly(storePath)
+	if err != nil {
+		fatalf("Failed to open store: %v", err)
+	}
+	defer db.Close()
+
+	entries, err := loadReviewEntries(db)
+	if err != nil {
+		fatalf("Failed to read review annotations: %v", err)
+	}
+	export := ReviewExport{ExportedAt: time.Now().UTC().Format(time.RFC3339)}
+	for _, e := range entries {
+		if e.ReviewUpdatedAt != "" || len(e.Tags) > 0 {
+			export.Entries = append(export.Entries, e)
+		}
+	}
+
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		fatalf("Failed to encode review file: %v", err)
+	}
+	if err := os.WriteFile(reviewFile, data, 0o644); err != nil {
+		fatalf("Failed to write review file %s: %v", reviewFile, err)
+	}
+	log.Printf("Exported %d reviewed finding(s) to %s", len(export.Entries), reviewFile)
+}
+
+func runReviewImport() {
+	if storePath == "" {
+		fatal("--store-path is required for review.")
+	}
+	switch reviewOnConflict {
+	case "keep", "incoming", "newer":
+	default:
+		fatalf("Unknown --on-conflict %q; expected keep, incoming or newer.", reviewOnConflict)
+	}
+
+	data, err := os.ReadFile(reviewFile)
+	if err != nil {
+		fatalf("Failed to read review file %s: %v", reviewFile, err)
+	}
+	var export ReviewExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		fatalf("Failed to parse review file %s: %v", reviewFile, err)
+	}
+
+	db, err := openStore(storePath)
+	if err != nil {
+		fatalf("Failed to open store: %v", err)
+	}
+	defer db.Close()
+
+	applied, missing, invalid, conflicts, err := importReviewEntries(db, export.Entries, reviewOnConflict)
+	if err != nil {
+		fatalf("Failed to import review file: %v", err)
+	}
+
+	for _, e := range missing {
+		log.Printf("Skipped %s post %d: not in the canonical store.", e.Site, e.PostID)
+	}
+	for _, e := range invalid {
+		log.Printf("Warning: skipped %s post %d: unknown review state %q; expected one of %s.", e.Site, e.PostID, e.ReviewState, strings.Join(reviewStates, ", "))
+	}
+	if len(conflicts) > 0 {
+		fmt.Printf("%-20s %-8s %-24s %-24s %s\n", "SITE", "POST", "CANONICAL", "INCOMING", "RESOLVED")
+		for _, c := range conflicts {
+			fmt.Printf("%-20s %-8d %-24s %-24s %s\n", c.Entry.Site, c.Entry.PostID,
+				describeReview(c.Canonical), describeReview(c.Entry), c.Resolved)
+		}
+	}
+	log.Printf("Imported %d finding(s) from %s: %d conflict(s), %d unknown, %d invalid.", applied, reviewFile, len(conflicts), len(missing), len(invalid))
+}
+
+func describeReview(e ReviewEntry) string {
+	if e.Assignee == "" {
+		return e.ReviewState
+	}
+	return fmt.Sprintf("%s/%s", e.ReviewState, e.Assignee)
+}
+
+func loadReviewEntries(db *sql.DB) ([]ReviewEntry, error) {
+	rows, err := db.Query(`SELECT site, post_id, assignee, review_state, review_updated_at,
+		(SELECT group_concat(tag, ';' ORDER BY tag) FROM tags t
+			WHERE t.site = findings.site AND t.post_id = findings.post_id)
+		FROM findings ORDER BY site, post_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []ReviewEntry
+	for rows.Next() {
+		var e ReviewEntry
+		var tags sql.NullString
+		if err := rows.Scan(&e.Site, &e.PostID, &e.Assignee, &e.ReviewState, &e.ReviewUpdatedAt, &tags); err != nil {
+			return nil, err
+		}
+		if tags.String != "" {
+			e.Tags = strings.Split(tags.String, ";")
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// importReviewEntries merges exported review entries into the store,
+// returning how many findings changed, the entries with no matching finding,
+// the entries rejected for a review state outside reviewStates and the
+// conflicts encountered.
+func importReviewEntries(db *sql.DB, entries []ReviewEntry, onConflict string) (int, []ReviewEntry, []ReviewEntry, []ReviewConflict, error) {
+	canonical, err := loadReviewEntries(db)
+	if err != nil {
+		return 0, nil, nil, nil, err
+	}
+	current := make(map[string]ReviewEntry, len(canonical))
+	for _, e := range canonical {
+		current[fmt.Sprintf("%s/%d", e.Site, e.PostID)] = e
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, nil, nil, nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		applied   int
+		missing   []ReviewEntry
+		invalid   []ReviewEntry
+		conflicts []ReviewConflict
+	)
+	for _, in := range entries {
+		have, ok := current[fmt.Sprintf("%s/%d", in.Site, in.PostID)]
+		if !ok {
+			missing = append(missing, in)
+			continue
+		}
+		// A hand-edited export must not write states cleanup and serve
+		// don't handle; the whole entry is rejected, tags included.
+		if !slices.Contains(reviewStates, in.ReviewState) {
+			invalid = append(invalid, in)
+			continue
+		}
+		changed := false
+
+		for _, tag := range in.Tags {
+			res, err := tx.Exec(`INSERT OR IGNORE INTO tags (site, post_id, tag, created_at) VALUES (?, ?, ?, ?)`,
+				in.Site, in.PostID, tag, time.Now().UTC().Format(time.RFC3339))
+			if err != nil {
+				return 0, nil, nil, nil, fmt.Errorf("tagging %s post %d: %w", in.Site, in.PostID, err)
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				changed = true
+			}
+		}
+
+		same := in.ReviewState == have.ReviewState && in.Assignee == have.Assignee
+		take := false
+		switch {
+		case in.ReviewUpdatedAt == "" || same:
+		case have.ReviewUpdatedAt == "":
+			take = true
+		default:
+			c := ReviewConflict{Entry: in, Canonical: have, Resolved: "canonical"}
+			if onConflict == "incoming" || (onConflict == "newer" && in.ReviewUpdatedAt > have.ReviewUpdatedAt) {
+				take = true
+				c.Resolved = "incoming"
+			}
+			conflicts = append(conflicts, c)
+		}
+		if take {
+			if _, err := tx.Exec(`UPDATE findings SET review_state = ?, assignee = ?, review_updated_at = ?
+				WHERE site = ? AND post_id = ?`,
+				in.ReviewState, in.Assignee, in.ReviewUpdatedAt, in.Site, in.PostID); err != nil {
+				return 0, nil, nil, nil, fmt.Errorf("updating %s post %d: %w", in.Site, in.PostID, err)
+			}
+			changed = true
+		}
+		if changed {
+			applied++
+		}
+	}
+	return applied, missing, invalid, conflicts, tx.Commit()
+}
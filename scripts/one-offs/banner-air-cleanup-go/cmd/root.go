@@ -3,20 +3,23 @@ package cmd
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/joho/godotenv"
 	"github.com/spf13/cobra"
-	"google.golang.org/genai"
 )
 
 // Roles is a custom type to handle JSON that may be a string or an array of strings.
@@ -49,10 +52,26 @@ type Post struct {
 	Date             string `json:"post_date"`
 	Type             string `json:"post_type"`
 	GUID             string `json:"guid"`
+	Excerpt          string `json:"post_excerpt"`
+	Site             string
+	Content          string
+	SEOTitle         string
+	SEODescription   string
 	ContentExcerpt   string
 	Author           Author
 	AIClassification string
 	AIJustification  string
+	AIPromptHash     string
+	AIModelVersion   string
+	AIFallback       bool // scored heuristically while the AI provider was down
+	ContentHash      string
+	CorrelationID    string
+	Tags             []string
+	Assignee         string
+	ReviewState      string
+	FirstSeen        string
+	FlaggedAt        string
+	Findings         []Finding
 }
 
 type Author struct {
@@ -66,13 +85,24 @@ type Author struct {
 type AIResult struct {
 	Classification string `json:"classification"`
 	Justification  string `json:"justification"`
+	PromptHash     string `json:"-"`
+	ModelVersion   string `json:"-"`
 }
 
 // Global variables for flags
 var (
 	dockerContainer string
+	wpFlags         string
 	outputCSVPath   string
+	postTypes       []string
+	reportHTMLPath  string
+	storePath       string
+	retryFilePath   string
+	reanalyzeStale  bool
 	analyzeContent  bool
+	aiAuth          string
+	gcpProject      string
+	gcpLocation     string
 	maxWorkers      = 10
 )
 
@@ -81,14 +111,115 @@ var rootCmd = &cobra.Command{
 	Short: "A tool to extract and analyze WordPress content from a Docker container.",
 	Long: `Extracts post and page data from a WordPress site running in a Docker
 container, saves it to a CSV, and optionally analyzes the content for
-spam using the Gemini AI API.`,
+spam using the Gemini AI API.
+
+Every flag can also be set from an environment variable named after it,
+e.g. HUBSTACK_CONTAINER_NAME for --container-name or HUBSTACK_AUDIT_MEDIA=true
+for --audit-media. HUBSTACK_OUTPUT, HUBSTACK_REPORT and HUBSTACK_STORE are
+short for the output CSV, HTML report and store paths. Flags on the command
+line take precedence.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := applyEnv(cmd); err != nil {
+			return err
+		}
+		hookPhase = cmd.Name()
+		if !cmd.HasParent() {
+			hookPhase = "run"
+		}
+		if simulate {
+			if !cmd.Flags().Changed("container-name") {
+				dockerContainer = simulatedContainer
+			}
+			if !analyzeContent {
+				offline = true
+			}
+		}
+		if aiAuth != aiAuthAPIKey && aiAuth != aiAuthVertex {
+			return fmt.Errorf("unknown --ai-auth %q; expected api-key or vertex", aiAuth)
+		}
+		if err := configureHTTP(); err != nil {
+			return err
+		}
+		if err := validateWPFlags(wpFlags); err != nil {
+			return err
+		}
+		if err := validateCompanionMode(companionMode); err != nil {
+			return err
+		}
+		if len(postTypes) == 0 || slices.Contains(postTypes, "any") {
+			return fmt.Errorf("--post-types must name the post types to extract")
+		}
+		if maintenanceWindow != "" {
+			if _, err := parseWindow(maintenanceWindow); err != nil {
+				return err
+			}
+		}
+		if editorialHours != "" {
+			if _, err := parseHourRange(editorialHours); err != nil {
+				return fmt.Errorf("--editorial-hours: %w", err)
+			}
+		}
+		if err := validateProvider(aiProvider); err != nil {
+			return err
+		}
+		activeVariant.Model = resolvedModel()
+		profile, err := loadProfile(profilePath)
+		if err != nil {
+			return err
+		}
+		activeProfile = profile
+		if err := applyIndustry(firstNonEmpty(industry, activeProfile.Industry)); err != nil {
+			return err
+		}
+		if err := validateInputStrategy(aiInputStrategy); err != nil {
+			return err
+		}
+		if err := validateExcerptStrategy(excerptStrategy); err != nil {
+			return err
+		}
+		if err := validateGraphPath(graphPath); err != nil {
+			return err
+		}
+		if err := validateIncidentID(incidentID); err != nil {
+			return err
+		}
+		if quickScan && quickBudget <= 0 {
+			return fmt.Errorf("--quick-budget must be positive")
+		}
+		if err := validateNormalizers(normalizers); err != nil {
+			return err
+		}
+		activeVariant.MaxInputChars = aiMaxInputChars
+		activeVariant.InputStrategy = aiInputStrategy
+		activeVariant.Normalizers = normalizerPipeline()
+		if err := validateIssueTracker(); err != nil {
+			return err
+		}
+		if attestationKeyPath != "" {
+			if runManifestPath == "" {
+				return fmt.Errorf("--attestation-key needs --run-manifest-path, whose file it signs")
+			}
+			if attestationKey, err = loadAttestationKey(attestationKeyPath); err != nil {
+				return err
+			}
+		}
+		if reportTemplateDir != "" {
+			if reportTemplates, err = loadReportTemplates(reportTemplateDir); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		runApp()
 	},
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	handleSignals()
+	err := rootCmd.Execute()
+	runExitHooks()
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
@@ -96,57 +227,154 @@ func Execute() {
 
 func init() {
 	rootCmd.PersistentFlags().StringVar(&dockerContainer, "container-name", "wordpress", "The name of the Docker container running WordPress.")
+	rootCmd.PersistentFlags().StringVar(&wpFlags, "wp-flags", "", `Global wp-cli flags added to every wp invocation, e.g. "--allow-root --skip-plugins=broken-plugin".`)
 	rootCmd.PersistentFlags().StringVar(&outputCSVPath, "output-csv-path", "wp_content.csv", "The path for the output CSV file.")
+	rootCmd.PersistentFlags().StringSliceVar(&postTypes, "post-types", []string{"post", "page"}, "Post types to extract and analyze, e.g. post,page,product to also cover WooCommerce products.")
+	rootCmd.PersistentFlags().IntVar(&maxRowsPerFile, "max-rows-per-file", 0, "Split result CSV/XLSX files with more rows than this into numbered parts plus an index file (0 to never split; Excel's limit is 1048575 data rows).")
+	rootCmd.PersistentFlags().StringVar(&reportHTMLPath, "report-html-path", "", "Optional path for an HTML report including the author network graph.")
+	rootCmd.PersistentFlags().BoolVar(&onlyFlagged, "only-flagged", false, "Leave Legitimate posts out of the CSV, reports and exports; the store still receives every post.")
+	rootCmd.PersistentFlags().StringVar(&reportTemplateDir, "report-template", "", "Directory of Go templates: report.html.tmpl replaces the HTML report, other *.tmpl files (e.g. summary.md.tmpl) are rendered next to it.")
+	rootCmd.PersistentFlags().StringVar(&storePath, "store-path", "", "Optional SQLite database that accumulates results across runs.")
+	rootCmd.PersistentFlags().StringVar(&retryFilePath, "retry-file", "failed.jsonl", "JSONL queue of posts whose AI analysis failed.")
 	rootCmd.PersistentFlags().BoolVar(&analyzeContent, "analyze-post-content-via-ai", false, "Enable AI analysis of post content.")
+	rootCmd.PersistentFlags().BoolVar(&simulate, "simulate", false, "Run against a built-in fake WordPress site with known spam instead of a Docker container; implies --offline unless --analyze-post-content-via-ai is set.")
+	rootCmd.PersistentFlags().IntVar(&sampleSize, "sample", 0, "Process only this many randomly chosen posts per site (0 for all), e.g. to compare models or prompts cheaply.")
+	rootCmd.PersistentFlags().Uint64Var(&seed, "seed", 0, "Seed for --sample; runs with the same seed pick the same posts (default: random, logged).")
+	rootCmd.PersistentFlags().BoolVar(&offline, "offline", false, "Skip every network-dependent analyzer (AI, lookups) and classify with local heuristics over wp-cli data only.")
+	rootCmd.PersistentFlags().StringVar(&caBundlePath, "ca-bundle", "", "PEM file of extra CA certificates to trust for outbound HTTPS (e.g. a TLS-inspecting proxy). Proxies come from HTTPS_PROXY/NO_PROXY.")
+	rootCmd.PersistentFlags().StringVar(&profilePath, "profile", "", "JSON client profile selecting extra analyzers, e.g. compliance checks.")
+	rootCmd.PersistentFlags().StringVar(&findingsCSVPath, "findings-csv-path", "findings.csv", "Output CSV for findings other than the spam classification (written when there are any).")
+	rootCmd.PersistentFlags().BoolVar(&auditMedia, "audit-media", false, "Audit media uploads: write an inventory with EXIF metadata and flag off-hours uploads and uploads by flagged users.")
+	rootCmd.PersistentFlags().StringVar(&mediaCSVPath, "media-csv-path", "media.csv", "Output CSV for the media inventory.")
+	rootCmd.PersistentFlags().StringVar(&editorialHours, "editorial-hours", "", "Normal publishing hours in site time, e.g. 8-18 (default: learned from legitimate posts).")
+	rootCmd.PersistentFlags().BoolVar(&scanAdmin, "scan-admin", false, "Scan for hidden admin pages (any status) and admin notices injected by plugins or themes.")
+	rootCmd.PersistentFlags().BoolVar(&renderAdminNotices, "render-admin-notices", false, "With --scan-admin, call each admin_notices callback and check what it prints, rather than only reading its source. This runs plugin and theme code, possibly malware, in the container.")
+	rootCmd.PersistentFlags().IntVar(&rateMonths, "rate-months", 6, "Months of daily post and comment creation rates to chart in the HTML report (0 to skip).")
+	rootCmd.PersistentFlags().StringVar(&runManifestPath, "run-manifest-path", "run-manifest.json", "Output JSON describing the run (empty to skip).")
+	rootCmd.PersistentFlags().StringVar(&maintenanceWindow, "window", "", `Maintenance window for destructive phases such as cleanup, e.g. "Sat 01:00-05:00 America/Los_Angeles"; read-only phases run any time.`)
+	rootCmd.PersistentFlags().StringArrayVar(&preHooks, "pre-hook", nil, "Shell command run before each site is processed, with run metadata in HUBSTACK_* variables; the site is skipped if it fails. Repeatable.")
+	rootCmd.PersistentFlags().StringArrayVar(&postHooks, "post-hook", nil, "Shell command run after each site is processed, with HUBSTACK_STATUS=ok or failed. Repeatable.")
+	rootCmd.PersistentFlags().StringVar(&sitesManifestPath, "sites", "", "JSON manifest of sites to process, each optionally with its own AI provider and key.")
+	rootCmd.PersistentFlags().StringVar(&aiProvider, "ai-provider", providerGemini, "AI provider: gemini or openai.")
+	rootCmd.PersistentFlags().StringVar(&aiModelName, "ai-model", "", "AI model (default "+aiModel+" for gemini, "+openAIDefaultModel+" for openai).")
+	rootCmd.PersistentFlags().StringVar(&aiAPIKeyEnv, "ai-api-key-env", "", "Environment variable holding the AI API key (default GEMINI_API_KEY or OPENAI_API_KEY).")
+	rootCmd.PersistentFlags().StringVar(&openAIOrg, "openai-organization", "", "OpenAI organization ID to bill requests to.")
+	rootCmd.PersistentFlags().StringVar(&openAIBaseURL, "openai-base-url", "https://api.openai.com/v1", "Base URL of the OpenAI-compatible API.")
+	rootCmd.PersistentFlags().StringVar(&aiAuth, "ai-auth", aiAuthAPIKey, "AI authentication: api-key (GEMINI_API_KEY) or vertex (Application Default Credentials).")
+	rootCmd.PersistentFlags().StringVar(&gcpProject, "gcp-project", "", "Google Cloud project for --ai-auth=vertex (default $GOOGLE_CLOUD_PROJECT).")
+	rootCmd.PersistentFlags().StringVar(&gcpLocation, "gcp-location", "", "Vertex AI location for --ai-auth=vertex, e.g. us-central1 (default $GOOGLE_CLOUD_LOCATION).")
+	rootCmd.PersistentFlags().IntVar(&aiMaxInputChars, "ai-max-input-chars", 300, "Maximum characters of content sent to the AI per post (0 for no limit).")
+	rootCmd.PersistentFlags().IntVar(&aiMaxOutputChars, "ai-max-output-chars", 1000, "Abort a streamed AI response once it exceeds this many characters (0 for no limit).")
+	rootCmd.PersistentFlags().StringVar(&aiInputStrategy, "ai-input-strategy", inputStrategyHead, "How content over the limit is cut: head, head+tail, or smart (keeps text around links and spam keywords).")
+	rootCmd.PersistentFlags().DurationVar(&statsInterval, "stats-interval", 5*time.Second, "How often to sample the site container's CPU and memory with docker stats (0 to disable).")
+	rootCmd.PersistentFlags().Float64Var(&throttleCPU, "throttle-cpu", 90, "Pause extraction while the container's CPU, as docker stats reports it, is at or above this percentage (0 to never pause).")
+	rootCmd.PersistentFlags().Float64Var(&abortMemPercent, "abort-mem-percent", 95, "Stop extraction once the container uses this percentage of its memory limit (0 to never stop).")
+	rootCmd.PersistentFlags().BoolVar(&reanalyzeStale, "reanalyze-if-prompt-changed", false, "With --store-path, reuse stored AI results and only re-analyze posts whose prompt, model or content changed.")
 }
 
+// runApp processes the --container-name site, or every site in --sites.
 func runApp() {
+	if quickScan {
+		forEachSite(runQuickScan)
+		return
+	}
+	forEachSite(func() {
+		if err := runSite(); err != nil {
+			fatalf("Failed to scan %s: %v", dockerContainer, err)
+		}
+	})
+}
+
+// runSite scans the current site. Errors are returned rather than fatal, so
+// monitor can carry on with the rest of a fleet.
+func runSite() error {
 	log.Println("Welcome to the Banner Air Cleanup Tool!")
 	ctx := context.Background()
+	startedAt := time.Now()
+	resetWPFallback()
+	defer closeWorkspace()
+	runTag := newRunTag()
+	runManifest = &RunManifest{Site: dockerContainer, RunTag: runTag, StartedAt: startedAt, IncidentID: incidentID, Note: runNote}
+	resetPhases()
+	resetAIOutage()
+	log.Printf("Run %s on %s; log lines and output rows for each post carry cid=%s-<post ID>.", runTag, dockerContainer, runTag)
 
 	// Check if container is running
-	cmd := exec.CommandContext(ctx, "docker", "inspect", dockerContainer)
-	if err := cmd.Run(); err != nil {
-		log.Fatalf("Docker container '%s' not found or not running. Error: %v", dockerContainer, err)
+	if simulate {
+		log.Printf("Simulating: '%s' is the built-in fixture site, not a Docker container", dockerContainer)
+	} else {
+		cmd := exec.CommandContext(ctx, "docker", "inspect", dockerContainer)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("docker container '%s' not found or not running: %w", dockerContainer, err)
+		}
+		log.Printf("Successfully connected to Docker and found container '%s'", dockerContainer)
 	}
-	log.Printf("Successfully connected to Docker and found container '%s'", dockerContainer)
+	if preflight {
+		logPreflight(ctx)
+	}
+	sampler := startStatsSampler(ctx)
+	defer sampler.stop() // on an early error return; stopping twice is harmless
 
 	// Initialize AI Client if needed
-	var genaiClient *genai.Client
-	if analyzeContent {
-		if err := godotenv.Load(); err != nil {
-			log.Println("Warning: .env file not found, relying on environment variables.")
-		}
-		apiKey := os.Getenv("GEMINI_API_KEY")
-		if apiKey == "" {
-			log.Fatal("GEMINI_API_KEY environment variable is not set.")
-		}
-		log.Println("GEMINI_API_KEY is set.")
-		client, err := genai.NewClient(ctx, &genai.ClientConfig{
-			APIKey: apiKey,
-		})
+	var genaiClient AIClient
+	if offline {
+		for _, a := range skippedAnalyzers() {
+			log.Printf("Offline: skipping %s (%s).", a.Name, a.Reason)
+		}
+	} else if analyzeContent {
+		client, err := newAIClient(ctx)
 		if err != nil {
-			log.Fatalf("Failed to create AI client: %v", err)
+			return err
 		}
 		genaiClient = client
 	}
 
-	// Initialize CSV file
-	csvFile, csvWriter := initializeCSV()
-	defer csvFile.Close()
-	defer csvWriter.Flush()
+	var compliance map[string]AIVariant
+	if genaiClient != nil && len(activeProfile.Compliance) > 0 {
+		variants, err := activeProfile.complianceVariants()
+		if err != nil {
+			return fmt.Errorf("loading compliance analyzers: %w", err)
+		}
+		compliance = variants
+	}
+
+	if reanalyzeStale && analyzeContent && !offline {
+		if storePath == "" {
+			return fmt.Errorf("--reanalyze-if-prompt-changed requires --store-path")
+		}
+		previousResults = loadPreviousResults(storePath)
+	}
+
+	// Create the CSV up front so an unwritable path fails before extraction
+	if file, err := os.Create(outputCSVPath); err != nil {
+		return fmt.Errorf("creating CSV file %s: %w", outputCSVPath, err)
+	} else {
+		file.Close()
+	}
 
 	// Get all posts
 	log.Println("Extracting posts and pages...")
+	done := startPhase(phaseList)
 	posts, err := getPosts(ctx)
+	done()
 	if err != nil {
-		log.Fatalf("Failed to retrieve posts: %v", err)
+		return fmt.Errorf("retrieving posts: %w", err)
 	}
+	if sampleSize > 0 {
+		posts = samplePosts(posts)
+		runManifest.Seed = resolvedSeed()
+		runManifest.Sample = sampleSize
+	}
+	done = startPhase(phaseContent)
+	loadSEOMeta(ctx, posts)
+	done()
 
 	// Get unique authors
+	done = startPhase(phaseAuthors)
 	authors, err := getAuthors(ctx, posts)
+	done()
 	if err != nil {
-		log.Fatalf("Failed to retrieve authors: %v", err)
+		return fmt.Errorf("retrieving authors: %w", err)
 	}
 
 	// Create channels and sync primitives
@@ -155,14 +383,22 @@ func runApp() {
 	var wg sync.WaitGroup
 
 	// Start workers
+	done = startPhase(phaseContent)
+	contents, err := exportContent(ctx, posts)
+	done()
+	if err != nil {
+		return err
+	}
 	log.Printf("Fetching content for %d posts (this may take a moment)...", len(posts))
 	for i := 0; i < maxWorkers; i++ {
 		wg.Add(1)
-		go worker(ctx, &wg, postChan, resultChan, genaiClient)
+		go worker(ctx, &wg, postChan, resultChan, genaiClient, compliance, sampler, contents)
 	}
 
 	// Distribute work
 	for _, p := range posts {
+		p.Site = dockerContainer
+		p.CorrelationID = correlationID(runTag, p.ID)
 		if author, ok := authors[p.AuthorID]; ok {
 			p.Author = author
 		}
@@ -185,36 +421,273 @@ func runApp() {
 	close(resultChan)
 	resultWg.Wait()
 
+	// Restore extraction order, whichever worker finished first
+	order := make(map[int]int, len(posts))
+	for i, p := range posts {
+		order[p.ID] = i
+	}
+	sort.SliceStable(combinedData, func(i, j int) bool { return order[combinedData[i].ID] < order[combinedData[j].ID] })
+
 	// Write to CSV
-	writeCSV(csvWriter, combinedData)
-	log.Printf("Processing complete! Wrote %d rows to %s", len(combinedData), outputCSVPath)
+	done = startPhase(phaseExport)
+	reported := reportedPosts(combinedData)
+	csvPaths, err := writeTable(outputCSVPath, "csv", csvHeaders, postRecords(reported))
+	if err != nil {
+		return fmt.Errorf("writing CSV: %w", err)
+	}
+	for _, path := range csvPaths {
+		recordOutput(path)
+	}
+	log.Printf("Processing complete! Wrote %d rows to %s", len(reported), outputCSVPath)
+	done()
+
+	done = startPhase(phaseFindings)
+	findings := collectFindings(combinedData)
+	campaigns := runCampaignAnalysis(ctx, combinedData)
+	findings = append(findings, campaignFindings(campaigns)...)
+	if graphPath != "" {
+		graph := buildNetworkGraph(combinedData, networkIPs(ctx, combinedData, campaigns))
+		if err := writeNetworkGraph(graphPath, graph); err != nil {
+			return fmt.Errorf("writing network graph: %w", err)
+		}
+		recordOutput(graphPath)
+		log.Printf("Wrote network graph of %d node(s) and %d edge(s) to %s", len(graph.Nodes), len(graph.Edges), graphPath)
+	}
+	titleGroups := runTitleAnalysis(combinedData)
+	findings = append(findings, titleGroupFindings(titleGroups)...)
+	findings = append(findings, detectReinfection(combinedData)...)
+	findings = append(findings, detectSpamArchives(ctx, combinedData)...)
+	findings = append(findings, detectSpamRedirects(ctx, combinedData)...)
+	if err := sampler.wait(ctx); err != nil && (auditMedia || scanAdmin) {
+		log.Printf("Warning: skipping media audit and admin scan: %v", err)
+	} else {
+		if auditMedia {
+			findings = append(findings, runMediaAudit(ctx, combinedData, authors)...)
+		}
+		if scanAdmin {
+			findings = append(findings, runAdminScan(ctx, combinedData)...)
+		}
+	}
+	done()
+	impact := sampler.stop()
+	if impact != nil {
+		log.Printf("Container impact for %s: %s", dockerContainer, impact)
+		if impact.Aborted != "" {
+			log.Printf("Warning: %d of %d post(s) were not processed; re-run when the site is less loaded.", len(posts)-len(combinedData), len(posts))
+		}
+	}
+	done = startPhase(phaseExport)
+	sortFindings(findings)
+	for _, f := range findings {
+		emit(Event{Type: FindingCreated, Finding: &f})
+	}
+	if len(findings) > 0 {
+		if err := writeFindingsCSV(findingsCSVPath, findings); err != nil {
+			return fmt.Errorf("writing findings: %w", err)
+		}
+		recordOutput(findingsCSVPath)
+		log.Printf("Wrote %d other finding(s) to %s", len(findings), findingsCSVPath)
+	}
+	if genaiClient != nil {
+		log.Printf("AI usage for %s (%s via %s): %s", dockerContainer, genaiClient.Provider(), apiKeyEnv(), genaiClient.Usage())
+	}
+
+	if outage := aiOutageAnalyzer(); outage != nil {
+		log.Printf("Warning: AI classification on %s: %s.", dockerContainer, outage.Reason)
+	}
+	if failed := failedAnalyses(combinedData); len(failed) > 0 {
+		if err := writeRetryFile(retryFilePath, failed, genaiClient.Quota().exhaustedUntil()); err != nil {
+			return fmt.Errorf("writing retry queue: %w", err)
+		}
+		recordOutput(retryFilePath)
+		log.Printf("%d post(s) failed AI analysis; re-run them with: analyze --retry-file=%s", len(failed), retryFilePath)
+		logQuota(genaiClient, len(failed))
+	}
+
+	if storePath != "" {
+		db, err := openStore(storePath)
+		if err != nil {
+			return fmt.Errorf("opening store: %w", err)
+		}
+		defer db.Close()
+		runID, err := saveRun(db, dockerContainer, startedAt, combinedData)
+		if err != nil {
+			return fmt.Errorf("saving results to store: %w", err)
+		}
+		log.Printf("Saved run %d to %s", runID, storePath)
+		if err := saveTypedFindings(db, runID, findings); err != nil {
+			return fmt.Errorf("saving findings to store: %w", err)
+		}
+		if err := reopenReinfected(db, dockerContainer, findings); err != nil {
+			log.Printf("Warning: could not reopen reinfected findings: %v", err)
+		}
+		if err := saveCampaigns(db, runID, campaigns); err != nil {
+			log.Printf("Warning: could not save campaigns to store: %v", err)
+		}
+		if err := recordRunFallback(db, runID, activeWPFallback()); err != nil {
+			log.Printf("Warning: could not record wp-cli fallback: %v", err)
+		}
+		if err := recordRunNote(db, runID, incidentID, runNote); err != nil {
+			log.Printf("Warning: could not record the run's note and incident ID: %v", err)
+		}
+		if genaiClient != nil {
+			if err := recordRunUsage(db, runID, genaiClient, activeVariant.Model); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}
+		if err := attachAnnotations(db, dockerContainer, combinedData); err != nil {
+			log.Printf("Warning: could not load review annotations from store: %v", err)
+		}
+	}
+
+	if reportHTMLPath != "" {
+		data := newReportData(combinedData)
+		data.Skipped = skippedAnalyzers()
+		data.Findings = findings
+		data.WPFallback = activeWPFallback()
+		data.Campaigns = campaigns
+		data.TitleGroups = titleGroups
+		if screenshots && !offline {
+			data.Screenshots = captureScreenshots(ctx, combinedData)
+		}
+		if rateMonths > 0 {
+			data.Rates = runRateReport(ctx)
+		}
+		if err := writeHTMLReport(reportHTMLPath, data); err != nil {
+			return fmt.Errorf("writing HTML report: %w", err)
+		}
+		recordOutput(reportHTMLPath)
+		log.Printf("Wrote HTML report to %s", reportHTMLPath)
+		extra, err := writeExtraReports(reportHTMLPath, data)
+		for _, path := range extra {
+			recordOutput(path)
+			log.Printf("Wrote report to %s", path)
+		}
+		if err != nil {
+			return fmt.Errorf("writing report: %w", err)
+		}
+	}
+
+	if issueTracker != "" {
+		data := newReportData(combinedData)
+		data.Findings = findings
+		if err := fileSiteIssue(ctx, data); err != nil {
+			log.Printf("Warning: could not file the %s issue for %s: %v", issueTracker, dockerContainer, err)
+		}
+	}
+
+	done()
+
+	runManifest.FinishedAt = time.Now()
+	runManifest.Phases = phaseTimings()
+	log.Printf("Phase timing for %s: %s", dockerContainer, formatPhaseTimings(runManifest.Phases))
+	runManifest.Posts = len(combinedData)
+	runManifest.Findings = len(findings)
+	runManifest.SkippedAnalyzers = skippedAnalyzers()
+	runManifest.WPFallback = activeWPFallback()
+	runManifest.Companion, _ = activeCompanion(ctx) // a required one was checked before the export
+	runManifest.WPLayout = activeWPLayout(ctx)
+	runManifest.ContainerImpact = impact
+	if runManifestPath != "" {
+		if err := writeRunManifest(runManifestPath, runManifest); err != nil {
+			log.Printf("Warning: %v", err)
+		} else {
+			log.Printf("Wrote run manifest to %s", runManifestPath)
+		}
+		if attestationKey != nil {
+			path, err := writeAttestation(runManifestPath, runManifest)
+			if err != nil {
+				return fmt.Errorf("attesting the run: %w", err)
+			}
+			log.Printf("Wrote signed attestation to %s", path)
+		}
+	}
+	manifest := *runManifest
+	emit(Event{Type: RunCompleted, Manifest: &manifest})
+	return nil
+}
+
+// validateWPFlags checks that --wp-flags only holds wp-cli global flags, so a
+// stray subcommand cannot be smuggled into every invocation.
+func validateWPFlags(flags string) error {
+	for _, f := range strings.Fields(flags) {
+		if !strings.HasPrefix(f, "--") {
+			return fmt.Errorf("invalid wp-cli flag %q in --wp-flags; every entry must start with --", f)
+		}
+	}
+	return nil
 }
 
+// runWPCommand runs wp-cli in the container. If WordPress dies with a PHP
+// fatal, the call is retried without plugins and themes, and so are all later
+// calls for the site; see activateWPFallback.
 func runWPCommand(ctx context.Context, command []string) (string, error) {
-	fullCmd := append([]string{"exec", dockerContainer, "wp"}, command...)
-	cmd := exec.CommandContext(ctx, "docker", fullCmd...)
+	out, stderr, err := execWP(ctx, command)
+	if err != nil && shouldFallBack(stderr) {
+		activateWPFallback(command, stderr)
+		out, stderr, err = execWP(ctx, command)
+	}
+	if err != nil {
+		return "", fmt.Errorf("command failed: %w. Stderr: %s", err, stderr)
+	}
+	return out, nil
+}
+
+// runWPScript runs a PHP script with wp eval-file from the site's workspace.
+// If the workspace cannot be used, the script is passed inline to wp eval.
+func runWPScript(ctx context.Context, name, php string) (string, error) {
+	if simulate {
+		return simulatedScript(name)
+	}
+	ws, err := containerWorkspace(ctx)
+	if err == nil {
+		var path string
+		if path, err = ws.Upload(ctx, name, []byte("<?php\n"+php+"\n")); err == nil {
+			return runWPCommand(ctx, []string{"eval-file", path})
+		}
+	}
+	log.Printf("Warning: %v; running %s inline.", err, name)
+	return runWPCommand(ctx, []string{"eval", php})
+}
+
+func execWP(ctx context.Context, command []string) (string, string, error) {
+	if simulate {
+		return simulatedWP(command)
+	}
+	cmd := exec.CommandContext(ctx, "docker", wpCommandLine(ctx, command)...)
 	var out bytes.Buffer
 	var stderr bytes.Buffer
 	cmd.Stdout = &out
 	cmd.Stderr = &stderr
 	err := cmd.Run()
-	if err != nil {
-		return "", fmt.Errorf("command failed: %w. Stderr: %s", err, stderr.String())
+	return out.String(), stderr.String(), err
+}
+
+// wpCommandLine returns the docker arguments that run a wp-cli command in the
+// current site's container.
+func wpCommandLine(ctx context.Context, command []string) []string {
+	fullCmd := append([]string{"exec", dockerContainer, "wp"}, strings.Fields(wpFlags)...)
+	fullCmd = append(fullCmd, wpPathFlags(ctx)...)
+	if activeWPFallback() != nil {
+		fullCmd = append(fullCmd, fallbackFlags...)
 	}
-	return out.String(), nil
+	return append(fullCmd, command...)
 }
 
 func getPosts(ctx context.Context) ([]Post, error) {
-	fields := "ID,post_title,post_author,post_date,post_type,guid"
-	cmd := []string{"post", "list", "--post_type=post,page", fmt.Sprintf("--fields=%s", fields), "--format=json"}
-	output, err := runWPCommand(ctx, cmd)
+	fields := "ID,post_title,post_author,post_date,post_type,guid,post_excerpt"
+	cmd := []string{"post", "list", "--post_type=" + strings.Join(postTypes, ","), fmt.Sprintf("--fields=%s", fields), "--format=json"}
+	posts, err := listPostsPaged[Post](ctx, cmd)
 	if err != nil {
 		return nil, err
 	}
-	var posts []Post
-	if err := json.Unmarshal([]byte(output), &posts); err != nil {
-		return nil, err
-	}
+	// Newest first, as wp post list orders them by default
+	sort.SliceStable(posts, func(i, j int) bool {
+		if posts[i].Date != posts[j].Date {
+			return posts[i].Date > posts[j].Date
+		}
+		return posts[i].ID > posts[j].ID
+	})
 	return posts, nil
 }
 
@@ -244,44 +717,95 @@ func getAuthors(ctx context.Context, posts []Post) (map[string]Author, error) {
 	return authorsData, nil
 }
 
-func worker(ctx context.Context, wg *sync.WaitGroup, postChan <-chan Post, resultChan chan<- Post, genaiClient *genai.Client) {
+// worker fetches, analyzes and checks posts. Content already exported
+// through the companion plugin is taken from contents; the rest is fetched
+// with wp-cli.
+func worker(ctx context.Context, wg *sync.WaitGroup, postChan <-chan Post, resultChan chan<- Post, genaiClient AIClient, compliance map[string]AIVariant, sampler *statsSampler, contents map[int]string) {
 	defer wg.Done()
 	for post := range postChan {
+		// Leave remaining posts unprocessed once the container is starved
+		if err := sampler.wait(ctx); err != nil {
+			continue
+		}
 		// Fetch content
-		content, err := runWPCommand(ctx, []string{"post", "get", strconv.Itoa(post.ID), "--field=content"})
+		content, ok := contents[post.ID]
+		var err error
+		if !ok {
+			done := startPhase(phaseContent)
+			content, err = runWPCommand(ctx, []string{"post", "get", strconv.Itoa(post.ID), "--field=content"})
+			done()
+		}
 		if err != nil {
-			log.Printf("Error fetching content for post %d: %v", post.ID, err)
+			log.Printf("Error fetching content for %s: %v", post.ref(), err)
 		} else {
 			content = strings.TrimSpace(content)
-			if len(content) > 300 {
-				post.ContentExcerpt = content[:300] + "..."
-			} else {
-				post.ContentExcerpt = content
-			}
+			// Hash the content as stored, so cleanup can still match it.
+			post.ContentHash = contentHash(content)
+			post.Content = validUTF8(content)
+			post.ContentExcerpt = contentExcerpt(post.Content)
+			emitPost(PostFetched, post)
 		}
+		post.Findings = append(post.Findings, seoMetaFindings(post)...)
 
 		// Analyze content if enabled
 		post.AIClassification = "N/A"
 		post.AIJustification = "N/A"
-		if analyzeContent && genaiClient != nil && post.ContentExcerpt != "" {
-			log.Printf("Analyzing content for post ID: %d...", post.ID)
-			aiResult, err := analyzeContentViaAI(ctx, genaiClient, post.ContentExcerpt)
-			if err != nil {
-				log.Printf("Error analyzing post %d: %v", post.ID, err)
-				post.AIClassification = "Error"
-				post.AIJustification = err.Error()
+		if offline && post.Content != "" {
+			classifyHeuristically(&post)
+		} else if analyzeContent && genaiClient != nil && post.ContentExcerpt != "" {
+			if prev, ok := previousResults[post.ID]; ok && isCurrentResult(prev, post) {
+				post.AIClassification = prev.AIClassification
+				post.AIJustification = prev.AIJustification
+				post.AIPromptHash = prev.AIPromptHash
+				post.AIModelVersion = prev.AIModelVersion
+			} else if aiUnavailable() {
+				scoreWithoutAI(&post)
 			} else {
-				post.AIClassification = aiResult.Classification
-				post.AIJustification = aiResult.Justification
+				done := startPhase(phaseAI)
+				analyzePost(ctx, genaiClient, &post)
+				done()
 			}
-			time.Sleep(1 * time.Second) // Avoid hitting API rate limits
 		}
+		if len(compliance) > 0 && post.Content != "" && !aiUnavailable() {
+			done := startPhase(phaseAI)
+			runComplianceChecks(ctx, genaiClient, compliance, &post)
+			done()
+		}
+		emitPost(PostAnalyzed, post)
 		resultChan <- post
 	}
 }
 
-func analyzeContentViaAI(ctx context.Context, client *genai.Client, content string) (*AIResult, error) {
-	prompt := `
+// analyzePost classifies a post's content, recording failures as "Error" so
+// they can be written to the retry queue.
+func analyzePost(ctx context.Context, genaiClient AIClient, post *Post) {
+	log.Printf("Analyzing content for %s...", post.ref())
+	aiResult, err := analyzeContentViaAI(ctx, genaiClient, activeVariant, post.Content)
+	recordAIOutcome(err)
+	if err != nil {
+		log.Printf("Error analyzing %s: %v", post.ref(), err)
+		post.AIClassification = "Error"
+		post.AIJustification = err.Error()
+	} else {
+		post.AIClassification = aiResult.Classification
+		post.AIJustification = aiResult.Justification
+		post.AIPromptHash = aiResult.PromptHash
+		post.AIModelVersion = aiResult.ModelVersion
+		post.AIFallback = false
+	}
+	var quotaErr *quotaError
+	if errors.As(err, &quotaErr) && quotaErr.Err == nil {
+		return // never sent, so no need to pace
+	}
+	time.Sleep(1 * time.Second) // Avoid hitting API rate limits
+}
+
+// aiModel is the Gemini model requested for classification.
+const aiModel = "gemini-1.5-flash"
+
+// classificationPrompt is the instruction sent ahead of each post's content.
+// Its hash is recorded with every result, so edit it deliberately.
+const classificationPrompt = `
 Analyze the following content to determine if it is 'Spam', 'Legitimate', or 'Uncertain' based on the website's purpose.
 
 **CRITICAL OUTPUT REQUIREMENTS:**
@@ -313,22 +837,55 @@ The website belongs to "Greer’s Banner Air of Bakersfield, Inc.", which is an
 **CONTENT TO ANALYZE:**
 `
 
-	fullPrompt := fmt.Sprintf("%s\n%s", prompt, content)
+// AIVariant is a model, prompt template and input preparation used for
+// classification.
+type AIVariant struct {
+	Model         string
+	Prompt        string
+	MaxInputChars int
+	InputStrategy string
+	Normalizers   []string
+}
 
-	result, err := client.Models.GenerateContent(
-		ctx,
-		"gemini-1.5-flash",
-		genai.Text(fullPrompt),
-		nil,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("AI generation failed: %w", err)
+// Hash identifies the prompt template, requested model and input preparation
+// a result was produced with. Without normalizers it is what it was before
+// they existed, so stored results stay current.
+func (v AIVariant) Hash() string {
+	key := fmt.Sprintf("%s\x00%s\x00%d\x00%s", v.Model, v.Prompt, v.MaxInputChars, v.InputStrategy)
+	if len(v.Normalizers) > 0 {
+		key += "\x00" + strings.Join(v.Normalizers, ",")
 	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// Input prepares content for this variant's model: normalized, then cut to
+// the input limit.
+func (v AIVariant) Input(content string) string {
+	return prepareAIInput(normalizeContent(content, v.Normalizers), v.MaxInputChars, v.InputStrategy)
+}
 
-	rawJSON, err := result.Text()
+// activeVariant is what the extraction pipeline classifies posts with; the
+// input settings are filled in from flags before any analysis runs.
+var activeVariant = AIVariant{Model: aiModel, Prompt: classificationPrompt}
+
+func promptHash() string {
+	return activeVariant.Hash()
+}
+
+func analyzeContentViaAI(ctx context.Context, client AIClient, variant AIVariant, content string) (*AIResult, error) {
+	fullPrompt := fmt.Sprintf("%s\n%s", variant.Prompt, variant.Input(content))
+
+	rawJSON, modelVersion, err := client.Generate(ctx, variant.Model, fullPrompt)
+	var aborted *abortedResponse
+	if errors.As(err, &aborted) {
+		log.Printf("Warning: AI %s; retrying with a stricter instruction.", aborted.Error())
+		rawJSON, modelVersion, err = client.Generate(ctx, variant.Model, fullPrompt+strictInstruction)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to extract text from AI response: %w", err)
+		return nil, fmt.Errorf("AI generation failed: %w", err)
 	}
+
 	if rawJSON == "" {
 		return nil, fmt.Errorf("received an empty response from the AI")
 	}
@@ -348,44 +905,54 @@ The website belongs to "Greer’s Banner Air of Bakersfield, Inc.", which is an
 		return nil, fmt.Errorf("AI response has incorrect format. Raw: %s", rawJSON)
 	}
 
+	aiResult.PromptHash = variant.Hash()
+	aiResult.ModelVersion = modelVersion
+	if aiResult.ModelVersion == "" {
+		aiResult.ModelVersion = variant.Model
+	}
 	return &aiResult, nil
 }
 
-func initializeCSV() (*os.File, *csv.Writer) {
-	file, err := os.Create(outputCSVPath)
-	if err != nil {
-		log.Fatalf("Error creating CSV file %s: %v", outputCSVPath, err)
-	}
-	writer := csv.NewWriter(file)
-	headers := []string{
-		"post_id", "post_title", "post_type", "post_date", "post_guid",
-		"content_excerpt", "author_id", "author_display_name", "author_email",
-		"author_login", "ai_classification", "ai_justification",
-	}
-	if err := writer.Write(headers); err != nil {
-		log.Fatalf("Error writing CSV headers: %v", err)
-	}
-	return file, writer
+// csvHeaders are the output columns, in the order written by postRecord.
+var csvHeaders = []string{
+	"post_id", "post_title", "post_type", "post_date", "post_guid",
+	"content_excerpt", "author_id", "author_display_name", "author_email",
+	"author_login", "ai_classification", "ai_justification", "tags",
+	"assignee", "review_state", "ai_prompt_hash", "ai_model_version",
+	"correlation_id", "post_excerpt", "seo_title", "seo_description",
+}
+
+// postRecord flattens a post into one output row.
+func postRecord(post Post) []string {
+	return validRecord([]string{
+		strconv.Itoa(post.ID),
+		post.Title,
+		post.Type,
+		post.Date,
+		post.GUID,
+		post.ContentExcerpt,
+		post.AuthorID,
+		post.Author.DisplayName,
+		post.Author.Email,
+		post.Author.Login,
+		post.AIClassification,
+		post.AIJustification,
+		strings.Join(post.Tags, ";"),
+		post.Assignee,
+		post.ReviewState,
+		post.AIPromptHash,
+		post.AIModelVersion,
+		post.CorrelationID,
+		post.Excerpt,
+		post.SEOTitle,
+		post.SEODescription,
+	})
 }
 
 func writeCSV(writer *csv.Writer, data []Post) {
 	for _, post := range data {
-		row := []string{
-			strconv.Itoa(post.ID),
-			post.Title,
-			post.Type,
-			post.Date,
-			post.GUID,
-			post.ContentExcerpt,
-			post.AuthorID,
-			post.Author.DisplayName,
-			post.Author.Email,
-			post.Author.Login,
-			post.AIClassification,
-			post.AIJustification,
-		}
-		if err := writer.Write(row); err != nil {
-			log.Printf("Error writing row to CSV for post %d: %v", post.ID, err)
+		if err := writer.Write(postRecord(post)); err != nil {
+			log.Printf("Error writing row to CSV for %s: %v", post.ref(), err)
 		}
 	}
 }
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// runNote and incidentID annotate a run so its manifest, report and stored
+// run can be traced back to the incident that prompted it.
+var (
+	runNote    string
+	incidentID string
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&runNote, "note", "", `Operator note recorded with the run in the run manifest, reports and store, e.g. "rescan after plugin update".`)
+	rootCmd.PersistentFlags().StringVar(&incidentID, "incident-id", "", "Incident tracker ID the run belongs to, e.g. INC-1234; recorded like --note (a site in --sites can set its own).")
+}
+
+// validateIncidentID rejects IDs that would not survive being a CSV cell,
+// a log line or an environment variable intact.
+func validateIncidentID(id string) error {
+	if len(id) > 100 {
+		return fmt.Errorf("incident ID %q is longer than 100 characters", id)
+	}
+	if strings.IndexFunc(id, unicode.IsControl) >= 0 || strings.TrimSpace(id) != id {
+		return fmt.Errorf("incident ID %q contains control characters or surrounding spaces", id)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	screenshots     bool
+	screenshotLimit int
+	browserPath     string
+)
+
+// screenshotTimeout bounds one page capture, including the browser start.
+const screenshotTimeout = 45 * time.Second
+
+// browserNames are tried in order when --browser is not given.
+var browserNames = []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome", "microsoft-edge"}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&screenshots, "screenshots", false, "Capture the public pages of flagged posts with a headless Chromium and embed them in the HTML report.")
+	rootCmd.PersistentFlags().IntVar(&screenshotLimit, "screenshot-limit", 20, "Most pages to capture per site with --screenshots, Spam before Uncertain.")
+	rootCmd.PersistentFlags().StringVar(&browserPath, "browser", "", "Chromium or Chrome binary for --screenshots (default: the first of "+strings.Join(browserNames, ", ")+" on PATH).")
+}
+
+// findBrowser resolves --browser, or the first known browser on PATH.
+func findBrowser() (string, error) {
+	if browserPath != "" {
+		return exec.LookPath(browserPath)
+	}
+	for _, name := range browserNames {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no headless browser found; install Chromium or set --browser")
+}
+
+// captureScreenshots photographs the published pages of flagged posts and
+// returns them by post ID as PNG data URLs, so the report stays a single
+// file. Posts that are not published have no public page and are skipped;
+// pages that fail to load are logged and left out.
+func captureScreenshots(ctx context.Context, posts []Post) map[int]template.URL {
+	var flagged []Post
+	for _, class := range []string{"Spam", "Uncertain"} {
+		for _, p := range posts {
+			if p.AIClassification == class {
+				flagged = append(flagged, p)
+			}
+		}
+	}
+	if len(flagged) == 0 || screenshotLimit <= 0 {
+		return nil
+	}
+	flagged = flagged[:min(screenshotLimit, len(flagged))]
+
+	browser, err := findBrowser()
+	if err != nil {
+		log.Printf("Warning: skipping screenshots: %v", err)
+		return nil
+	}
+	urls, err := publicURLs(ctx, flagged)
+	if err != nil {
+		log.Printf("Warning: skipping screenshots: could not look up permalinks: %v", err)
+		return nil
+	}
+	dir, err := os.MkdirTemp("", "banner-air-cleanup-shots-")
+	if err != nil {
+		log.Printf("Warning: skipping screenshots: %v", err)
+		return nil
+	}
+	defer os.RemoveAll(dir)
+
+	shots := make(map[int]template.URL)
+	log.Printf("Capturing %d flagged page(s) with %s...", len(urls), filepath.Base(browser))
+	for _, p := range flagged {
+		url, ok := urls[p.ID]
+		if !ok {
+			continue
+		}
+		png, err := screenshot(ctx, browser, dir, url)
+		if err != nil {
+			log.Printf("Warning: could not capture %s (%s): %v", p.ref(), url, err)
+			continue
+		}
+		shots[p.ID] = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+	}
+	log.Printf("Captured %d of %d flagged page(s).", len(shots), len(urls))
+	return shots
+}
+
+// publicURLs returns the permalinks of the posts that are published.
+func publicURLs(ctx context.Context, posts []Post) (map[int]string, error) {
+	ids := make([]string, len(posts))
+	for i, p := range posts {
+		ids[i] = strconv.Itoa(p.ID)
+	}
+	output, err := runWPCommand(ctx, []string{"post", "list", "--post__in=" + strings.Join(ids, ","),
+		"--post_type=any", "--post_status=publish", "--fields=ID,url", "--format=json"})
+	if err != nil {
+		return nil, err
+	}
+	var links []struct {
+		ID  int    `json:"ID"`
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal([]byte(output), &links); err != nil {
+		return nil, fmt.Errorf("parsing permalinks: %w", err)
+	}
+	urls := make(map[int]string, len(links))
+	for _, l := range links {
+		if strings.HasPrefix(l.URL, "http://") || strings.HasPrefix(l.URL, "https://") {
+			urls[l.ID] = l.URL
+		}
+	}
+	return urls, nil
+}
+
+// screenshot captures one page in a fresh, throwaway browser profile, so
+// nothing a spam page stores or installs outlives the capture.
+func screenshot(ctx context.Context, browser, dir, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, screenshotTimeout)
+	defer cancel()
+	profile, err := os.MkdirTemp(dir, "profile-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(profile)
+	out := filepath.Join(dir, "page.png")
+	os.Remove(out)
+	cmd := exec.CommandContext(ctx, browser, "--headless=new", "--disable-gpu", "--disable-extensions",
+		"--no-first-run", "--hide-scrollbars", "--mute-audio", "--user-data-dir="+profile,
+		"--window-size=1280,1600", "--virtual-time-budget=10000", "--screenshot="+out, url)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("timed out after %s", screenshotTimeout)
+		}
+		return nil, fmt.Errorf("%v: %s", err, lastLine(string(output)))
+	}
+	return os.ReadFile(out)
+}
+
+// lastLine returns the last non-empty line of output, usually the error.
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"hash/fnv"
+	"log"
+	"math/rand/v2"
+	"sort"
+	"sync"
+)
+
+var (
+	seed       uint64
+	sampleSize int
+)
+
+var resolvedSeed = sync.OnceValue(func() uint64 {
+	if seed != 0 {
+		return seed
+	}
+	s := rand.Uint64()
+	log.Printf("Random seed %d; pass --seed=%d to repeat this run's selections.", s, s)
+	return s
+})
+
+// siteRand returns a random source for one purpose on the current site,
+// derived from --seed. Each site and purpose gets its own stream, so a
+// selection does not change with the order sites are processed in, the
+// number of workers, or other consumers being added.
+func siteRand(purpose string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(dockerContainer + "\x00" + purpose))
+	return rand.New(rand.NewPCG(resolvedSeed(), h.Sum64()))
+}
+
+// samplePosts picks --sample posts at random, keeping their extraction
+// order. The pick depends only on the seed, the site and the set of post
+// IDs, not on the order wp-cli listed them in.
+func samplePosts(posts []Post) []Post {
+	if sampleSize <= 0 || sampleSize >= len(posts) {
+		return posts
+	}
+	ids := make([]int, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+	sort.Ints(ids)
+	r := siteRand("sample")
+	r.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+	picked := make(map[int]bool, sampleSize)
+	for _, id := range ids[:sampleSize] {
+		picked[id] = true
+	}
+	var sample []Post
+	for _, p := range posts {
+		if picked[p.ID] {
+			sample = append(sample, p)
+		}
+	}
+	log.Printf("Sampling %d of %d posts on %s (seed %d).", len(sample), len(posts), dockerContainer, resolvedSeed())
+	return sample
+}
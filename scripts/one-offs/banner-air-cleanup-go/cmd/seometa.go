@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// seoMetaFields maps the post meta keys of common SEO plugins to the field
+// they fill. Yoast's value wins when both plugins have left one.
+var seoMetaFields = []struct{ key, field string }{
+	{"_yoast_wpseo_title", "title"},
+	{"_yoast_wpseo_metadesc", "description"},
+	{"rank_math_title", "title"},
+	{"rank_math_description", "description"},
+}
+
+// seoMetaPHP reads every non-empty SEO title and description in one query;
+// fetching them post by post would cost a wp-cli call each.
+var seoMetaPHP = func() string {
+	keys := make([]string, len(seoMetaFields))
+	for i, f := range seoMetaFields {
+		keys[i] = "'" + f.key + "'"
+	}
+	return `global $wpdb;
+echo wp_json_encode($wpdb->get_results("SELECT post_id, meta_key, meta_value FROM {$wpdb->postmeta}
+	WHERE meta_key IN (` + strings.Join(keys, ", ") + `) AND meta_value <> ''"));`
+}()
+
+// loadSEOMeta fills in the SEO title and description of posts that have one.
+// Sites without an SEO plugin simply have none. Serialized values are kept as
+// JSON; see phpMetaValue.
+func loadSEOMeta(ctx context.Context, posts []Post) {
+	output, err := runWPScript(ctx, "seo-meta.php", seoMetaPHP)
+	if err != nil {
+		log.Printf("Warning: could not read SEO meta; only excerpts are audited: %v", err)
+		return
+	}
+	var rows []struct {
+		PostID looseString `json:"post_id"`
+		Key    string      `json:"meta_key"`
+		Value  string      `json:"meta_value"`
+	}
+	if err := json.Unmarshal([]byte(output), &rows); err != nil {
+		log.Printf("Warning: could not parse SEO meta: %v", err)
+		return
+	}
+	byKey := make(map[string]map[int]string)
+	for _, r := range rows {
+		id, err := strconv.Atoi(string(r.PostID))
+		if err != nil {
+			continue
+		}
+		if byKey[r.Key] == nil {
+			byKey[r.Key] = make(map[int]string)
+		}
+		byKey[r.Key][id] = phpMetaValue(strings.TrimSpace(r.Value))
+	}
+	found := 0
+	for i := range posts {
+		p := &posts[i]
+		for _, f := range seoMetaFields {
+			v := byKey[f.key][p.ID]
+			switch {
+			case f.field == "title" && p.SEOTitle == "":
+				p.SEOTitle = v
+			case f.field == "description" && p.SEODescription == "":
+				p.SEODescription = v
+			}
+		}
+		if p.SEOTitle != "" || p.SEODescription != "" {
+			found++
+		}
+	}
+	log.Printf("Read SEO meta for %d of %d posts.", found, len(posts))
+}
+
+// metaFields are the parts of a post shown in search results rather than on
+// the page: injected text there damages listings even when the content is
+// clean. SEO meta that was serialized PHP is scanned by its nested values.
+func (p Post) metaFields() []struct{ name, text string } {
+	return []struct{ name, text string }{
+		{"excerpt", p.Excerpt},
+		{"SEO title", structuredMetaText(p.SEOTitle)},
+		{"SEO description", structuredMetaText(p.SEODescription)},
+	}
+}
+
+// metaSignals lists the spam signals in a post's excerpt and SEO meta, each
+// naming the field it was found in, and whether any is a spam keyword.
+func metaSignals(p Post) (signals []string, keywords bool) {
+	for _, f := range p.metaFields() {
+		if strings.TrimSpace(f.text) == "" {
+			continue
+		}
+		words := make(map[string]bool)
+		for _, m := range spamKeywordPattern.FindAllString(f.text, -1) {
+			words[strings.ToLower(m)] = true
+		}
+		if len(words) > 0 {
+			list := make([]string, 0, len(words))
+			for w := range words {
+				list = append(list, w)
+			}
+			sort.Strings(list)
+			signals = append(signals, fmt.Sprintf("%s mentions %s", f.name, strings.Join(list, ", ")))
+			keywords = true
+		}
+		if hiddenMarkupPattern.MatchString(f.text) {
+			signals = append(signals, f.name+" contains hidden or scripted markup")
+		}
+		if domains := extractLinkDomains(f.text); len(domains) > 0 {
+			signals = append(signals, fmt.Sprintf("%s links to %s", f.name, strings.Join(domains, ", ")))
+		}
+	}
+	return signals, keywords
+}
+
+// seoMetaFindings flags a post whose excerpt or SEO meta carries spam
+// signals. Links in meta are suspect on their own: search engines show meta
+// descriptions as plain text, so only an injection puts URLs there.
+func seoMetaFindings(p Post) []Finding {
+	signals, keywords := metaSignals(p)
+	if len(signals) == 0 {
+		return nil
+	}
+	classification := "Uncertain"
+	if keywords {
+		classification = "Spam"
+	}
+	return []Finding{{
+		Site:           p.Site,
+		Type:           "seo-meta",
+		Subject:        postSubject(p.ID),
+		PostID:         p.ID,
+		Title:          p.Title,
+		Classification: classification,
+		Detail:         strings.Join(signals, "; "),
+	}}
+}
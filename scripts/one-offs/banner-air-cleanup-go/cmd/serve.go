@@ -0,0 +1,462 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveListen     string
+	serveTokensPath string
+	serveTLSCert    string
+	serveTLSKey     string
+	serveScanArgs   string
+	tokenName       string
+	tokenScopes     []string
+	tokenSites      []string
+)
+
+// API token scopes. Every token can read its sites' status and findings;
+// trigger starts scans and approve approves findings for cleanup. No scope
+// runs cleanup itself, which stays with the operators.
+var apiScopes = []string{"read", "trigger", "approve"}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the results store to automation such as a client portal.",
+	Long: `Serves a small JSON API over --store-path for third-party automation:
+
+  GET  /v1/sites/{site}/status                      latest run, counts, scan state
+  GET  /v1/sites/{site}/findings                    flagged findings (?classification=, ?state=)
+  POST /v1/sites/{site}/scans                       start a scan (scope trigger)
+  POST /v1/sites/{site}/findings/{post_id}/approve  approve for cleanup (scope approve)
+
+Requests authenticate with "Authorization: Bearer <token>". Tokens are listed
+by SHA-256 in --tokens-file, each with its scopes and the sites it may see
+("*" for all):
+
+  {"tokens": [
+    {"name": "portal-acme", "token_sha256": "...", "scopes": ["read", "approve"], "sites": ["acme-wp"]}
+  ]}
+
+Create entries with "serve token". Approving moves a Spam or Uncertain finding
+from new or triaged to approved, recording the token, the optional
+"approved_by" of the JSON body and the client address; the next cleanup run
+removes it. No token can run cleanup.
+
+Scans run this tool for the site with --store-path and --scan-args, one at a
+time per site, and only for sites the store already has runs of. Serve over
+HTTPS with --tls-cert and --tls-key unless --listen is loopback behind a
+TLS-terminating proxy.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runServe()
+	},
+}
+
+var serveTokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Create an API token and its --tokens-file entry.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runServeToken()
+	},
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveListen, "listen", "127.0.0.1:8377", "Address to listen on.")
+	serveCmd.Flags().StringVar(&serveTokensPath, "tokens-file", "api-tokens.json", "JSON file of API token hashes, scopes and sites.")
+	serveCmd.Flags().StringVar(&serveTLSCert, "tls-cert", "", "TLS certificate to serve HTTPS with.")
+	serveCmd.Flags().StringVar(&serveTLSKey, "tls-key", "", "TLS private key for --tls-cert.")
+	serveCmd.Flags().StringVar(&serveScanArgs, "scan-args", "", `Extra arguments for scans started through the API, e.g. "--enable-ai-analysis --report-html-path=/srv/reports/latest.html".`)
+	serveTokenCmd.Flags().StringVar(&tokenName, "name", "", "Name of the token, recorded with approvals.")
+	serveTokenCmd.Flags().StringSliceVar(&tokenScopes, "scope", []string{"read"}, "Scopes: "+strings.Join(apiScopes, ", ")+".")
+	serveTokenCmd.Flags().StringSliceVar(&tokenSites, "site", nil, `Sites the token may access ("*" for all).`)
+	serveTokenCmd.MarkFlagRequired("name")
+	serveTokenCmd.MarkFlagRequired("site")
+	serveCmd.AddCommand(serveTokenCmd)
+	rootCmd.AddCommand(serveCmd)
+}
+
+// APIToken is one entry of the tokens file.
+type APIToken struct {
+	Name        string   `json:"name"`
+	TokenSHA256 string   `json:"token_sha256"`
+	Scopes      []string `json:"scopes"`
+	Sites       []string `json:"sites"`
+}
+
+func (t *APIToken) allows(scope, site string) bool {
+	return (scope == "read" || slices.Contains(t.Scopes, scope)) &&
+		(slices.Contains(t.Sites, "*") || slices.Contains(t.Sites, site))
+}
+
+func loadAPITokens(path string) ([]APIToken, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading tokens file: %w", err)
+	}
+	var file struct {
+		Tokens []APIToken `json:"tokens"`
+	}
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("parsing tokens file %s: %w", path, err)
+	}
+	for _, t := range file.Tokens {
+		if t.Name == "" || len(t.TokenSHA256) != sha256.Size*2 {
+			return nil, fmt.Errorf("tokens file %s: every token needs a name and a hex token_sha256", path)
+		}
+		if err := validateScopes(t.Scopes); err != nil {
+			return nil, fmt.Errorf("token %s: %w", t.Name, err)
+		}
+		if len(t.Sites) == 0 {
+			return nil, fmt.Errorf("token %s has no sites; list them or use \"*\"", t.Name)
+		}
+	}
+	if len(file.Tokens) == 0 {
+		return nil, fmt.Errorf("tokens file %s lists no tokens", path)
+	}
+	return file.Tokens, nil
+}
+
+func validateScopes(scopes []string) error {
+	for _, s := range scopes {
+		if !slices.Contains(apiScopes, s) {
+			return fmt.Errorf("unknown scope %q; expected %s", s, strings.Join(apiScopes, ", "))
+		}
+	}
+	return nil
+}
+
+func runServeToken() {
+	if err := validateScopes(tokenScopes); err != nil {
+		fatal(err)
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		fatalf("Failed to create token: %v", err)
+	}
+	token := "hubstack-api-" + hex.EncodeToString(b)
+	sum := sha256.Sum256([]byte(token))
+	entry, err := json.Marshal(APIToken{Name: tokenName, TokenSHA256: hex.EncodeToString(sum[:]), Scopes: tokenScopes, Sites: tokenSites})
+	if err != nil {
+		fatal(err)
+	}
+	fmt.Printf("Token (shown once; give it to the client):\n  %s\n\nAdd to the tokens file:\n  %s\n", token, entry)
+}
+
+// apiServer serves the API. Scans are tracked in memory, so a restart
+// forgets scans it started; their runs still land in the store.
+type apiServer struct {
+	db     *sql.DB
+	tokens []APIToken
+	scans  struct {
+		sync.Mutex
+		bySite map[string]*apiScan
+	}
+}
+
+// apiScan is the state of the latest scan started for a site.
+type apiScan struct {
+	State      string `json:"state"` // running, finished or failed
+	StartedAt  string `json:"started_at"`
+	FinishedAt string `json:"finished_at,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+func runServe() {
+	if storePath == "" {
+		fatal("--store-path is required for serve.")
+	}
+	if (serveTLSCert == "") != (serveTLSKey == "") {
+		fatal("--tls-cert and --tls-key must be given together.")
+	}
+	tokens, err := loadAPITokens(serveTokensPath)
+	if err != nil {
+		fatal(err)
+	}
+	// Scans started through the API write to the store while it is served,
+	// so wait for their locks instead of failing.
+	db, err := openStore(fmt.Sprintf("file:%s?_pragma=busy_timeout(10000)", storePath))
+	if err != nil {
+		fatalf("Failed to open store: %v", err)
+	}
+	defer db.Close()
+
+	s := &apiServer{db: db, tokens: tokens}
+	s.scans.bySite = make(map[string]*apiScan)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/sites/{site}/status", s.auth("read", s.handleStatus))
+	mux.HandleFunc("GET /v1/sites/{site}/findings", s.auth("read", s.handleFindings))
+	mux.HandleFunc("POST /v1/sites/{site}/scans", s.auth("trigger", s.handleScan))
+	mux.HandleFunc("POST /v1/sites/{site}/findings/{post_id}/approve", s.auth("approve", s.handleApprove))
+
+	host, _, _ := net.SplitHostPort(serveListen)
+	if serveTLSCert == "" && host != "127.0.0.1" && host != "localhost" && host != "::1" {
+		log.Printf("Warning: serving plain HTTP on %s; tokens travel unencrypted unless a TLS proxy is in front.", serveListen)
+	}
+	srv := &http.Server{Addr: serveListen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	log.Printf("Serving %s for %d token(s) on %s", storePath, len(tokens), serveListen)
+	if serveTLSCert != "" {
+		err = srv.ListenAndServeTLS(serveTLSCert, serveTLSKey)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	fatalf("Server stopped: %v", err)
+}
+
+// auth wraps a handler with bearer token authentication and the scope and
+// site checks. Tokens are compared by hash in constant time.
+func (s *apiServer) auth(scope string, next func(w http.ResponseWriter, r *http.Request, t *APIToken)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || bearer == "" {
+			apiError(w, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+		sum := sha256.Sum256([]byte(bearer))
+		given := hex.EncodeToString(sum[:])
+		var token *APIToken
+		for i := range s.tokens {
+			if subtle.ConstantTimeCompare([]byte(strings.ToLower(s.tokens[i].TokenSHA256)), []byte(given)) == 1 {
+				token = &s.tokens[i]
+			}
+		}
+		if token == nil {
+			apiError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		if !token.allows(scope, r.PathValue("site")) {
+			log.Printf("API: token %s denied %s %s", token.Name, r.Method, r.URL.Path)
+			apiError(w, http.StatusForbidden, fmt.Sprintf("token is not allowed to %s this site", scope))
+			return
+		}
+		next(w, r, token)
+	}
+}
+
+func (s *apiServer) handleStatus(w http.ResponseWriter, r *http.Request, _ *APIToken) {
+	site := r.PathValue("site")
+	type run struct {
+		ID         int64  `json:"id"`
+		StartedAt  string `json:"started_at"`
+		FinishedAt string `json:"finished_at"`
+		Posts      int    `json:"posts"`
+		IncidentID string `json:"incident_id,omitempty"`
+	}
+	status := struct {
+		Site            string         `json:"site"`
+		LatestRun       *run           `json:"latest_run"`
+		Classifications map[string]int `json:"classifications"`
+		ReviewStates    map[string]int `json:"review_states"`
+		Scan            *apiScan       `json:"scan,omitempty"`
+	}{Site: site, Classifications: map[string]int{}, ReviewStates: map[string]int{}}
+
+	var latest run
+	err := s.db.QueryRow(`SELECT id, started_at, finished_at, posts, incident_id FROM runs
+		WHERE site = ? ORDER BY id DESC LIMIT 1`, site).Scan(&latest.ID, &latest.StartedAt, &latest.FinishedAt, &latest.Posts, &latest.IncidentID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	default:
+		status.LatestRun = &latest
+	}
+	rows, err := s.db.Query(`SELECT classification, review_state, COUNT(*) FROM findings
+		WHERE site = ? GROUP BY classification, review_state`, site)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var class, state string
+		var n int
+		if err := rows.Scan(&class, &state, &n); err != nil {
+			apiError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		status.Classifications[class] += n
+		status.ReviewStates[state] += n
+	}
+	s.scans.Lock()
+	if scan, ok := s.scans.bySite[site]; ok {
+		copied := *scan
+		status.Scan = &copied
+	}
+	s.scans.Unlock()
+	writeJSON(w, http.StatusOK, status)
+}
+
+// APIFinding is a finding as the API returns it.
+type APIFinding struct {
+	PostID         int    `json:"post_id"`
+	Title          string `json:"title"`
+	URL            string `json:"url"`
+	Type           string `json:"type"`
+	Date           string `json:"date"`
+	Classification string `json:"classification"`
+	Justification  string `json:"justification"`
+	ReviewState    string `json:"review_state"`
+	FirstSeen      string `json:"first_seen"`
+}
+
+// handleFindings lists the site's Spam and Uncertain findings, or those of
+// ?classification=; ?state= filters by review state.
+func (s *apiServer) handleFindings(w http.ResponseWriter, r *http.Request, _ *APIToken) {
+	where := siteFilter(r.PathValue("site"))
+	if class := r.URL.Query().Get("classification"); class != "" {
+		if !slices.Contains(classifications, class) {
+			apiError(w, http.StatusBadRequest, "unknown classification "+class)
+			return
+		}
+		where += " AND classification = '" + class + "'"
+	} else {
+		where += " AND classification IN ('Spam', 'Uncertain')"
+	}
+	if state := r.URL.Query().Get("state"); state != "" {
+		if !slices.Contains(reviewStates, state) {
+			apiError(w, http.StatusBadRequest, "unknown review state "+state)
+			return
+		}
+		where += " AND review_state = '" + state + "'"
+	}
+	posts, err := queryFindings(s.db, where)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	findings := make([]APIFinding, 0, len(posts))
+	for _, p := range posts {
+		findings = append(findings, APIFinding{PostID: p.ID, Title: p.Title, URL: p.GUID, Type: p.Type, Date: p.Date,
+			Classification: p.AIClassification, Justification: p.AIJustification, ReviewState: p.ReviewState, FirstSeen: p.FirstSeen})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"site": r.PathValue("site"), "findings": findings})
+}
+
+// handleScan starts a scan of a site the store knows, unless one is running.
+func (s *apiServer) handleScan(w http.ResponseWriter, r *http.Request, t *APIToken) {
+	site := r.PathValue("site")
+	var known int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM runs WHERE site = ?`, site).Scan(&known); err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if known == 0 {
+		apiError(w, http.StatusNotFound, "no runs of this site in the store; scan it from the command line first")
+		return
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.scans.Lock()
+	defer s.scans.Unlock()
+	if scan, ok := s.scans.bySite[site]; ok && scan.State == "running" {
+		writeJSON(w, http.StatusConflict, scan)
+		return
+	}
+	// The site flags come last and --sites is set empty on the command line,
+	// where it wins over HUBSTACK_SITES in the environment or .env: a token
+	// scoped to one site must never start a scan of the whole fleet.
+	args := append([]string{"--store-path", storePath}, strings.Fields(serveScanArgs)...)
+	args = append(args, "--container-name", site, "--sites=")
+	if simulate {
+		args = append(args, "--simulate")
+	}
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Start(); err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	scan := &apiScan{State: "running", StartedAt: time.Now().UTC().Format(time.RFC3339)}
+	s.scans.bySite[site] = scan
+	log.Printf("API: token %s started a scan of %s", t.Name, site)
+	go func() {
+		err := cmd.Wait()
+		s.scans.Lock()
+		defer s.scans.Unlock()
+		scan.State, scan.FinishedAt = "finished", time.Now().UTC().Format(time.RFC3339)
+		if err != nil {
+			scan.State, scan.Error = "failed", err.Error()
+		}
+		log.Printf("API: scan of %s %s", site, scan.State)
+	}()
+	writeJSON(w, http.StatusAccepted, scan)
+}
+
+// handleApprove approves one Spam or Uncertain finding for cleanup and
+// records who approved it.
+func (s *apiServer) handleApprove(w http.ResponseWriter, r *http.Request, t *APIToken) {
+	site := r.PathValue("site")
+	postID, err := strconv.Atoi(r.PathValue("post_id"))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "post_id must be a number")
+		return
+	}
+	var body struct {
+		ApprovedBy string `json:"approved_by"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&body); err != nil {
+			apiError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+			return
+		}
+	}
+
+	var class, state string
+	err = s.db.QueryRow(`SELECT classification, review_state FROM findings WHERE site = ? AND post_id = ?`, site, postID).Scan(&class, &state)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		apiError(w, http.StatusNotFound, "no such finding")
+		return
+	case err != nil:
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	case class != "Spam" && class != "Uncertain":
+		apiError(w, http.StatusUnprocessableEntity, "only Spam and Uncertain findings can be approved for cleanup")
+		return
+	case state == "cleaned":
+		apiError(w, http.StatusConflict, "finding was already cleaned")
+		return
+	}
+	if state != "approved" {
+		if err := recordApproval(s.db, site, postID, t.Name, body.ApprovedBy, r.RemoteAddr); err != nil {
+			apiError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		log.Printf("API: token %s approved %s post %d for cleanup (by %q)", t.Name, site, postID, body.ApprovedBy)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"site": site, "post_id": postID, "review_state": "approved"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func apiError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,798 @@
+package cmd
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// simulate answers wp-cli from an embedded fixture site instead of Docker, so
+// the whole pipeline can run without a container or API keys.
+var simulate bool
+
+// simulatedSiteJSON is a small HVAC company site with known spam mixed in:
+// keyword and hidden-link posts from two recently registered accounts sharing
+// an IP, a templated payday loan campaign, a hidden admin page, a comment
+// spam burst, an off-hours upload, an injected admin notice and clean posts
+// with spam in their excerpt or SEO meta description.
+//
+//go:embed fixtures/simulated-site.json
+var simulatedSiteJSON []byte
+
+// simulatedContainer names the site when --simulate is used without
+// --container-name.
+const simulatedContainer = "simulated-site"
+
+// simulatedLayout is how the fixture and wp-cli write dates.
+const simulatedLayout = "2006-01-02 15:04:05"
+
+type simulatedUser struct {
+	ID            string          `json:"ID"`
+	Login         string          `json:"user_login"`
+	DisplayName   string          `json:"display_name"`
+	Email         string          `json:"user_email"`
+	Roles         string          `json:"roles"`
+	Registered    string          `json:"user_registered"`
+	SessionTokens json.RawMessage `json:"session_tokens,omitempty"`
+	// Resets counts password resets, standing in for a changed user_pass.
+	Resets int `json:"-"`
+}
+
+// simulatedRoleCaps are the capabilities of WordPress's default roles, cut
+// down to a few each.
+var simulatedRoleCaps = map[string][]string{
+	"administrator": {"activate_plugins", "edit_others_posts", "edit_posts", "manage_options", "publish_posts", "read"},
+	"editor":        {"edit_others_posts", "edit_posts", "publish_posts", "read"},
+	"author":        {"edit_posts", "publish_posts", "read"},
+	"contributor":   {"edit_posts", "read"},
+	"subscriber":    {"read"},
+}
+
+type simulatedFixture struct {
+	Home  string          `json:"home"`
+	Users []simulatedUser `json:"users"`
+	Posts []struct {
+		ID       int    `json:"ID"`
+		Title    string `json:"post_title"`
+		AuthorID string `json:"post_author"`
+		Date     string `json:"post_date"`
+		Type     string `json:"post_type"`
+		Status   string `json:"post_status"`
+		GUID     string `json:"guid"`
+		Content  string `json:"post_content"`
+		Excerpt  string `json:"post_excerpt"`
+	} `json:"posts"`
+	Comments []struct {
+		ID       int    `json:"comment_ID"`
+		PostID   int    `json:"comment_post_ID"`
+		Author   string `json:"comment_author"`
+		Date     string `json:"comment_date"`
+		Content  string `json:"comment_content"`
+		Approved string `json:"comment_approved"`
+	} `json:"comments"`
+	Terms []struct {
+		ID       int    `json:"term_id"`
+		Taxonomy string `json:"taxonomy"`
+		Name     string `json:"name"`
+		Slug     string `json:"slug"`
+		PostIDs  []int  `json:"post_ids"`
+	} `json:"terms"`
+	// Redirects are rules of the Redirection and Pretty Links plugins, kept
+	// in their tables so cleanup can disable them.
+	Redirects []struct {
+		Plugin string `json:"plugin"`
+		ID     int    `json:"id"`
+		Name   string `json:"name"`
+		Source string `json:"source"`
+		Target string `json:"target"`
+		Status string `json:"status"`
+		Hits   int    `json:"hits"`
+	} `json:"redirects"`
+	// Scripts holds the output of the PHP scripts run with wp eval-file,
+	// keyed by script name.
+	Scripts map[string]json.RawMessage `json:"scripts"`
+}
+
+// simulatedSite is one site's copy of the fixture. Posts, comments and options
+// live in an in-memory SQLite database with WordPress's table names, so wp db
+// query and cleanup's changes behave as on a real site.
+type simulatedSite struct {
+	db      *sql.DB
+	users   map[string]simulatedUser
+	scripts map[string]json.RawMessage
+}
+
+var simulatedSites struct {
+	sync.Mutex
+	byContainer map[string]*simulatedSite
+}
+
+var registerRegexp sync.Once
+
+// currentSimulatedSite returns the fixture copy for the current site, loading
+// it on first use. Every site, and every run of the tool, starts from the same
+// fixture, moved forward so its newest content is from yesterday.
+func currentSimulatedSite() (*simulatedSite, error) {
+	simulatedSites.Lock()
+	defer simulatedSites.Unlock()
+	if s := simulatedSites.byContainer[dockerContainer]; s != nil {
+		return s, nil
+	}
+	s, err := loadSimulatedSite(time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("loading simulated site: %w", err)
+	}
+	if simulatedSites.byContainer == nil {
+		simulatedSites.byContainer = make(map[string]*simulatedSite)
+	}
+	simulatedSites.byContainer[dockerContainer] = s
+	return s, nil
+}
+
+func loadSimulatedSite(now time.Time) (*simulatedSite, error) {
+	var f simulatedFixture
+	if err := json.Unmarshal(simulatedSiteJSON, &f); err != nil {
+		return nil, err
+	}
+
+	// Shift every date by whole days, keeping times of day for the
+	// off-hours checks.
+	var latest time.Time
+	for _, p := range f.Posts {
+		if t, err := time.Parse(simulatedLayout, p.Date); err == nil && t.After(latest) {
+			latest = t
+		}
+	}
+	for _, c := range f.Comments {
+		if t, err := time.Parse(simulatedLayout, c.Date); err == nil && t.After(latest) {
+			latest = t
+		}
+	}
+	days := int(now.Truncate(24*time.Hour).Sub(latest.Truncate(24*time.Hour)).Hours()/24) - 1
+	shift := func(date string) string {
+		t, err := time.Parse(simulatedLayout, date)
+		if err != nil {
+			return date
+		}
+		return t.AddDate(0, 0, days).Format(simulatedLayout)
+	}
+
+	registerRegexp.Do(func() {
+		// MySQL's REGEXP, case-insensitive as under WordPress's collations
+		err := sqlite.RegisterDeterministicScalarFunction("regexp", 2, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			pattern, _ := args[0].(string)
+			value, _ := args[1].(string)
+			re, err := regexp.Compile("(?i)" + pattern)
+			if err != nil {
+				return nil, err
+			}
+			if re.MatchString(value) {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		})
+		if err != nil {
+			panic(err)
+		}
+	})
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1) // every connection to :memory: is a separate database
+
+	if _, err := db.Exec(`
+		CREATE TABLE wp_posts (ID INTEGER PRIMARY KEY, post_author TEXT, post_date TEXT, post_title TEXT,
+			post_type TEXT, post_status TEXT, guid TEXT, post_content TEXT, post_excerpt TEXT);
+		CREATE TABLE wp_comments (comment_ID INTEGER PRIMARY KEY, comment_post_ID INTEGER, comment_author TEXT,
+			comment_date TEXT, comment_content TEXT, comment_approved TEXT);
+		CREATE TABLE wp_options (option_name TEXT PRIMARY KEY, option_value TEXT);
+		CREATE TABLE wp_terms (term_id INTEGER PRIMARY KEY, taxonomy TEXT, name TEXT, slug TEXT);
+		CREATE TABLE wp_term_relationships (object_id INTEGER, term_id INTEGER);
+		CREATE TABLE wp_redirection_items (id INTEGER PRIMARY KEY, url TEXT, action_data TEXT, status TEXT, last_count INTEGER);
+		CREATE TABLE wp_prli_links (id INTEGER PRIMARY KEY, name TEXT, slug TEXT, url TEXT, link_status TEXT)`); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := db.Exec(`INSERT INTO wp_options VALUES ('home', ?), ('siteurl', ?)`, f.Home, f.Home); err != nil {
+		db.Close()
+		return nil, err
+	}
+	for _, p := range f.Posts {
+		if _, err := db.Exec(`INSERT INTO wp_posts VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			p.ID, p.AuthorID, shift(p.Date), p.Title, p.Type, p.Status, p.GUID, p.Content, p.Excerpt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("post %d: %w", p.ID, err)
+		}
+	}
+	for _, c := range f.Comments {
+		if _, err := db.Exec(`INSERT INTO wp_comments VALUES (?, ?, ?, ?, ?, ?)`,
+			c.ID, c.PostID, c.Author, shift(c.Date), c.Content, c.Approved); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("comment %d: %w", c.ID, err)
+		}
+	}
+
+	for _, t := range f.Terms {
+		if _, err := db.Exec(`INSERT INTO wp_terms VALUES (?, ?, ?, ?)`, t.ID, t.Taxonomy, t.Name, t.Slug); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("term %d: %w", t.ID, err)
+		}
+		for _, id := range t.PostIDs {
+			if _, err := db.Exec(`INSERT INTO wp_term_relationships VALUES (?, ?)`, id, t.ID); err != nil {
+				db.Close()
+				return nil, err
+			}
+		}
+	}
+
+	for _, r := range f.Redirects {
+		query := `INSERT INTO wp_redirection_items VALUES (?, ?, ?, ?, ?)`
+		args := []any{r.ID, r.Source, r.Target, r.Status, r.Hits}
+		if r.Plugin == pluginPrettyLinks {
+			query = `INSERT INTO wp_prli_links VALUES (?, ?, ?, ?, ?)`
+			args = []any{r.ID, r.Name, strings.TrimPrefix(r.Source, "/"), r.Target, r.Status}
+		}
+		if _, err := db.Exec(query, args...); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("redirect %s:%d: %w", r.Plugin, r.ID, err)
+		}
+	}
+
+	s := &simulatedSite{db: db, users: make(map[string]simulatedUser), scripts: make(map[string]json.RawMessage)}
+	for name, out := range f.Scripts {
+		// Script output listing posts, such as attachments, moves with them
+		var records []map[string]any
+		if json.Unmarshal(out, &records) == nil {
+			for _, r := range records {
+				if date, ok := r["post_date"].(string); ok {
+					r["post_date"] = shift(date)
+				}
+			}
+			if out, err = json.Marshal(records); err != nil {
+				db.Close()
+				return nil, err
+			}
+		}
+		s.scripts[name] = out
+	}
+	for _, u := range f.Users {
+		u.Registered = shift(u.Registered)
+		s.users[u.ID] = u
+	}
+	return s, nil
+}
+
+// simulatedWP answers a wp-cli command the way execWP would, with stdout,
+// stderr and an error for a non-zero exit.
+func simulatedWP(command []string) (string, string, error) {
+	s, err := currentSimulatedSite()
+	if err != nil {
+		return "", err.Error(), err
+	}
+	args, flags := parseWPArgs(command)
+	out, err := s.run(args, flags)
+	if err != nil {
+		return "", "Error: " + err.Error(), errors.New("exit status 1")
+	}
+	return out, "", nil
+}
+
+// parseWPArgs splits wp-cli arguments into positional ones and --name=value
+// flags; a bare --name is "true".
+func parseWPArgs(command []string) ([]string, map[string]string) {
+	var args []string
+	flags := make(map[string]string)
+	for _, a := range command {
+		if !strings.HasPrefix(a, "--") {
+			args = append(args, a)
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimPrefix(a, "--"), "=")
+		if !ok {
+			value = "true"
+		}
+		flags[name] = value
+	}
+	return args, flags
+}
+
+func (s *simulatedSite) run(args []string, flags map[string]string) (string, error) {
+	cmd := strings.Join(args[:min(2, len(args))], " ")
+	switch {
+	case cmd == "post list":
+		return s.listPosts(flags)
+	case cmd == "post get" && len(args) == 3 && flags["fields"] != "":
+		return s.postFields(args[2], flags["fields"])
+	case cmd == "post get" && len(args) == 3:
+		return s.postField(args[2], flags["field"])
+	case cmd == "post create":
+		return s.createPost(flags)
+	case cmd == "post delete" && len(args) == 3:
+		if flags["force"] != "" {
+			return s.exec(fmt.Sprintf("Deleted post %s.", args[2]), `DELETE FROM wp_posts WHERE ID = ?`, args[2])
+		}
+		return s.exec(fmt.Sprintf("Trashed post %s.", args[2]), `UPDATE wp_posts SET post_status = 'trash' WHERE ID = ?`, args[2])
+	case cmd == "post update" && len(args) == 3 && flags["post_status"] != "":
+		return s.exec(fmt.Sprintf("Updated post %s.", args[2]), `UPDATE wp_posts SET post_status = ? WHERE ID = ?`, flags["post_status"], args[2])
+	case cmd == "term get" && len(args) == 4 && flags["field"] == "count":
+		var count int
+		err := s.db.QueryRow(`SELECT COUNT(p.ID) FROM wp_terms t
+			LEFT JOIN wp_term_relationships r ON r.term_id = t.term_id
+			LEFT JOIN wp_posts p ON p.ID = r.object_id AND p.post_status = 'publish'
+			WHERE t.taxonomy = ? AND t.term_id = ? GROUP BY t.term_id`, args[2], args[3]).Scan(&count)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("term doesn't exist")
+		}
+		return strconv.Itoa(count) + "\n", err
+	case cmd == "term delete" && len(args) == 4:
+		out, err := s.exec(fmt.Sprintf("Deleted %s %s.", args[2], args[3]), `DELETE FROM wp_terms WHERE taxonomy = ? AND term_id = ?`, args[2], args[3])
+		if err == nil {
+			_, err = s.db.Exec(`DELETE FROM wp_term_relationships WHERE term_id = ?`, args[3])
+		}
+		return out, err
+	case cmd == "user get" && len(args) == 3:
+		return s.user(args[2], flags)
+	case cmd == "user meta" && len(args) == 5 && args[2] == "get":
+		u, ok := s.users[args[3]]
+		if !ok || args[4] != "session_tokens" || len(u.SessionTokens) == 0 {
+			return "", nil
+		}
+		return string(u.SessionTokens), nil
+	case cmd == "user meta" && len(args) == 5 && args[2] == "delete":
+		u, ok := s.users[args[3]]
+		if !ok || args[4] != "session_tokens" || len(u.SessionTokens) == 0 {
+			return "", fmt.Errorf("failed to delete custom field")
+		}
+		u.SessionTokens = nil
+		s.users[u.ID] = u
+		return "Success: Deleted custom field.\n", nil
+	case cmd == "user reset-password" && len(args) > 2:
+		var out strings.Builder
+		for _, id := range args[2:] {
+			u, ok := s.users[id]
+			if !ok {
+				return "", fmt.Errorf("invalid user ID, email or login: '%s'", id)
+			}
+			u.Resets++
+			s.users[id] = u
+			fmt.Fprintf(&out, "Reset password for user %s.\n", id)
+		}
+		return out.String() + "Success: Passwords reset.\n", nil
+	case cmd == "user list-caps" && len(args) == 3:
+		u, ok := s.users[args[2]]
+		if !ok {
+			return "", fmt.Errorf("invalid user ID, email or login: '%s'", args[2])
+		}
+		caps := []map[string]string{}
+		for _, role := range strings.Split(u.Roles, ",") {
+			caps = append(caps, map[string]string{"name": role})
+			for _, c := range simulatedRoleCaps[role] {
+				caps = append(caps, map[string]string{"name": c})
+			}
+		}
+		out, err := json.Marshal(caps)
+		return string(out), err
+	case cmd == "option add" && len(args) == 4:
+		if _, err := s.db.Exec(`INSERT INTO wp_options VALUES (?, ?)`, args[2], args[3]); err != nil {
+			return "", fmt.Errorf("could not add option '%s'. Does it already exist?", args[2])
+		}
+		return fmt.Sprintf("Success: Added '%s' option.\n", args[2]), nil
+	case cmd == "option list" && flags["search"] != "":
+		var value string
+		err := s.db.QueryRow(`SELECT option_value FROM wp_options WHERE option_name = ?`, flags["search"]).Scan(&value)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "[]", nil
+		} else if err != nil {
+			return "", err
+		}
+		out, err := json.Marshal([]map[string]string{{"option_name": flags["search"], "option_value": value}})
+		return string(out), err
+	case cmd == "option delete" && len(args) == 3:
+		res, err := s.db.Exec(`DELETE FROM wp_options WHERE option_name = ?`, args[2])
+		if err != nil {
+			return "", err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return "", fmt.Errorf("could not delete '%s' option. Does it exist?", args[2])
+		}
+		return fmt.Sprintf("Success: Deleted '%s' option.\n", args[2]), nil
+	case cmd == "db prefix":
+		return "wp_\n", nil
+	case cmd == "db query" && len(args) == 3:
+		return s.query(args[2])
+	case cmd == "cache flush":
+		return "Success: The cache was flushed.\n", nil
+	case cmd == "core verify-checksums":
+		return "Success: WordPress installation verifies against checksums.\n", nil
+	}
+	return "", fmt.Errorf("the simulated site does not support 'wp %s'", strings.Join(args, " "))
+}
+
+func (s *simulatedSite) exec(success, query string, args ...any) (string, error) {
+	res, err := s.db.Exec(query, args...)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", fmt.Errorf("could not find the post with ID %v", args[len(args)-1])
+	}
+	return "Success: " + success + "\n", nil
+}
+
+// simulatedPostColumns are the wp_posts columns wp post list can return.
+var simulatedPostColumns = map[string]bool{
+	"ID": true, "post_author": true, "post_date": true, "post_title": true,
+	"post_type": true, "post_status": true, "guid": true, "post_content": true,
+	"post_excerpt": true,
+}
+
+// listPosts implements wp post list --format=json. Without --post_status only
+// published posts are listed, and "any" excludes trashed ones, as in wp-cli.
+func (s *simulatedSite) listPosts(flags map[string]string) (string, error) {
+	fields := strings.Split(firstNonEmpty(flags["fields"], "ID,post_title,post_date,post_status"), ",")
+	columns := make([]string, len(fields))
+	for i, f := range fields {
+		switch {
+		case f == "url":
+			columns[i] = "guid" // the fixture's permalinks are plain ?p= links
+		case simulatedPostColumns[f]:
+			columns[i] = f
+		default:
+			return "", fmt.Errorf("invalid field: %s", f)
+		}
+	}
+	var where []string
+	var params []any
+	in := func(column, list string) {
+		values := strings.Split(list, ",")
+		where = append(where, column+" IN ("+strings.TrimSuffix(strings.Repeat("?,", len(values)), ",")+")")
+		for _, v := range values {
+			params = append(params, v)
+		}
+	}
+	if t := firstNonEmpty(flags["post_type"], "post"); t != "any" {
+		in("post_type", t)
+	}
+	if ids := flags["post__in"]; ids != "" {
+		in("ID", ids)
+	}
+	switch status := flags["post_status"]; status {
+	case "any":
+		where = append(where, "post_status NOT IN ('trash', 'auto-draft')")
+	case "":
+		in("post_status", "publish")
+	default:
+		in("post_status", status)
+	}
+
+	order := "post_date DESC"
+	if flags["orderby"] == "ID" {
+		order = "ID DESC"
+		if flags["order"] == "ASC" {
+			order = "ID ASC"
+		}
+	}
+	limit := ""
+	if n, err := strconv.Atoi(flags["posts_per_page"]); err == nil && n > 0 {
+		offset, _ := strconv.Atoi(flags["offset"])
+		limit = fmt.Sprintf(" LIMIT %d OFFSET %d", n, offset)
+	}
+	rows, err := s.db.Query("SELECT "+strings.Join(columns, ", ")+" FROM wp_posts WHERE "+
+		strings.Join(where, " AND ")+" ORDER BY "+order+limit, params...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var posts []map[string]any
+	for rows.Next() {
+		values := make([]any, len(fields))
+		ptrs := make([]any, len(fields))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return "", err
+		}
+		post := make(map[string]any, len(fields))
+		for i, f := range fields {
+			post[f] = values[i]
+		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if posts == nil {
+		return "[]", nil
+	}
+	out, err := json.Marshal(posts)
+	return string(out), err
+}
+
+func (s *simulatedSite) postField(id, field string) (string, error) {
+	if !simulatedPostColumns[field] {
+		field = "post_" + field // wp-cli accepts content for post_content
+	}
+	if !simulatedPostColumns[field] {
+		return "", fmt.Errorf("invalid field: %s", field)
+	}
+	var value string
+	err := s.db.QueryRow("SELECT "+field+" FROM wp_posts WHERE ID = ?", id).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("could not find the post with ID %s", id)
+	}
+	return value, err
+}
+
+// postFields implements wp post get --fields with --format=json.
+func (s *simulatedSite) postFields(id, fields string) (string, error) {
+	post := map[string]string{}
+	for _, f := range strings.Split(fields, ",") {
+		value, err := s.postField(id, f)
+		if err != nil {
+			return "", err
+		}
+		post[f] = value
+	}
+	out, err := json.Marshal(post)
+	return string(out), err
+}
+
+// createPost implements wp post create --porcelain, dated now.
+func (s *simulatedSite) createPost(flags map[string]string) (string, error) {
+	res, err := s.db.Exec(`INSERT INTO wp_posts (ID, post_author, post_date, post_title, post_type, post_status, guid, post_content, post_excerpt)
+		SELECT COALESCE(MAX(ID), 0) + 1, 1, ?, ?, ?, ?, '', ?, '' FROM wp_posts`,
+		time.Now().Format(simulatedLayout), flags["post_title"], firstNonEmpty(flags["post_type"], "post"),
+		firstNonEmpty(flags["post_status"], "draft"), flags["post_content"])
+	if err != nil {
+		return "", err
+	}
+	id, _ := res.LastInsertId()
+	if flags["porcelain"] != "" {
+		return fmt.Sprintf("%d\n", id), nil
+	}
+	return fmt.Sprintf("Success: Created post %d.\n", id), nil
+}
+
+// user implements wp user get with --field or --fields and --format=json.
+func (s *simulatedSite) user(id string, flags map[string]string) (string, error) {
+	u, ok := s.users[id]
+	if !ok {
+		return "", fmt.Errorf("invalid user ID, email or login: '%s'", id)
+	}
+	all := map[string]string{
+		"ID": u.ID, "user_login": u.Login, "display_name": u.DisplayName,
+		"user_email": u.Email, "roles": u.Roles, "user_registered": u.Registered,
+		"user_pass": fmt.Sprintf("$wp$2y$10$simulated.%s.%d", u.ID, u.Resets),
+	}
+	if field := flags["field"]; field != "" {
+		v, ok := all[field]
+		if !ok {
+			return "", fmt.Errorf("invalid field: %s", field)
+		}
+		return v + "\n", nil
+	}
+	selected := make(map[string]string)
+	for _, f := range strings.Split(firstNonEmpty(flags["fields"], "ID,user_login,display_name,user_email,user_registered,roles"), ",") {
+		v, ok := all[f]
+		if !ok {
+			return "", fmt.Errorf("invalid field: %s", f)
+		}
+		selected[f] = v
+	}
+	out, err := json.Marshal(selected)
+	return string(out), err
+}
+
+// query implements wp db query --skip-column-names --batch: tab-separated rows.
+func (s *simulatedSite) query(q string) (string, error) {
+	rows, err := s.db.Query(q)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for rows.Next() {
+		values := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return "", err
+		}
+		for i, v := range values {
+			if i > 0 {
+				b.WriteByte('\t')
+			}
+			switch v := v.(type) {
+			case nil:
+				b.WriteString("NULL")
+			case []byte:
+				b.Write(v)
+			case int64:
+				b.WriteString(strconv.FormatInt(v, 10))
+			default:
+				fmt.Fprint(&b, v)
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String(), rows.Err()
+}
+
+// simulatedScript returns the fixture's output for a PHP script run with
+// runWPScript.
+func simulatedScript(name string) (string, error) {
+	s, err := currentSimulatedSite()
+	if err != nil {
+		return "", err
+	}
+	switch name {
+	case "terms.php":
+		return s.terms() // changes as cleanup removes posts and terms
+	case "redirects.php":
+		return s.redirects() // changes as cleanup disables rules
+	}
+	out, ok := s.scripts[name]
+	if !ok {
+		return "", fmt.Errorf("the simulated site cannot run %s", name)
+	}
+	return string(out), nil
+}
+
+// terms implements the output of termsPHP.
+func (s *simulatedSite) terms() (string, error) {
+	var home string
+	if err := s.db.QueryRow(`SELECT option_value FROM wp_options WHERE option_name = 'home'`).Scan(&home); err != nil {
+		return "", err
+	}
+	rows, err := s.db.Query(`SELECT t.term_id, t.taxonomy, t.name, t.slug, r.object_id, p.post_status
+		FROM wp_terms t LEFT JOIN wp_term_relationships r ON r.term_id = t.term_id
+		LEFT JOIN wp_posts p ON p.ID = r.object_id ORDER BY t.term_id, r.object_id`)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var terms []*Term
+	for rows.Next() {
+		var t Term
+		var postID sql.NullInt64
+		var status sql.NullString
+		if err := rows.Scan(&t.ID, &t.Taxonomy, &t.Name, &t.Slug, &postID, &status); err != nil {
+			return "", err
+		}
+		if len(terms) == 0 || terms[len(terms)-1].ID != t.ID {
+			base := "tag"
+			if t.Taxonomy == "category" {
+				base = "category"
+			}
+			t.Link = fmt.Sprintf("%s/%s/%s/", home, base, t.Slug)
+			t.PostIDs = []int{}
+			terms = append(terms, &t)
+		}
+		last := terms[len(terms)-1]
+		if postID.Valid {
+			last.PostIDs = append(last.PostIDs, int(postID.Int64))
+			if status.String == "publish" {
+				last.Count++
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	out, err := json.Marshal(terms)
+	return string(out), err
+}
+
+// redirects implements the output of redirectsPHP.
+func (s *simulatedSite) redirects() (string, error) {
+	rows, err := s.db.Query(`SELECT 'redirection', id, '', url, action_data, status, last_count FROM wp_redirection_items
+		UNION ALL SELECT 'pretty-links', id, name, '/' || slug, url, link_status, 0 FROM wp_prli_links
+		ORDER BY 1 DESC, 2`)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	rules := []RedirectRule{}
+	for rows.Next() {
+		var r RedirectRule
+		var status string
+		if err := rows.Scan(&r.Plugin, &r.ID, &r.Name, &r.Source, &r.Target, &status, &r.Hits); err != nil {
+			return "", err
+		}
+		r.Enabled = status == "enabled"
+		rules = append(rules, r)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	out, err := json.Marshal(rules)
+	return string(out), err
+}
+
+// simulatedCompanion answers hubstack/v1 requests as the companion plugin
+// would; the simulated site has it installed, so --companion=off is how the
+// wp-cli paths are exercised.
+func simulatedCompanion(method, route string, params map[string]any) (string, error) {
+	s, err := currentSimulatedSite()
+	if err != nil {
+		return "", err
+	}
+	status, data := 200, any(nil)
+	fail := func(code int, name, message string) {
+		status, data = code, map[string]any{"code": name, "message": message, "data": map[string]int{"status": code}}
+	}
+	contents := func() map[int]string {
+		posts := make(map[int]string)
+		for _, id := range strings.Split(fmt.Sprint(params["ids"]), ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(id))
+			if err != nil {
+				continue
+			}
+			if content, err := s.postField(strconv.Itoa(n), "post_content"); err == nil {
+				posts[n] = content
+			}
+		}
+		return posts
+	}
+	switch method + " " + route {
+	case "GET /status":
+		data = CompanionStatus{Plugin: "hubstack-companion", Version: "1.0.0", APIVersion: companionAPIVersion}
+	case "GET /export":
+		exported := []map[string]any{}
+		for id, content := range contents() {
+			exported = append(exported, map[string]any{"id": id, "content": content, "hash": contentHash(strings.TrimSpace(content))})
+		}
+		data = exported
+	case "GET /hashes":
+		hashes := make(map[string]string)
+		for id, content := range contents() {
+			hashes[strconv.Itoa(id)] = contentHash(strings.TrimSpace(content))
+		}
+		data = hashes
+	case "POST /delete":
+		id := fmt.Sprint(params["id"])
+		content, err := s.postField(id, "post_content")
+		expected, _ := params["expected_hash"].(string)
+		switch {
+		case err != nil:
+			fail(404, "hubstack_not_found", fmt.Sprintf("Post %s does not exist.", id))
+		case expected != "" && expected != contentHash(strings.TrimSpace(content)):
+			fail(409, "hubstack_content_changed", fmt.Sprintf("Post %s changed since it was reviewed.", id))
+		default:
+			args, flags := []string{"post", "delete", id}, map[string]string{}
+			switch params["method"] {
+			case removeDelete:
+				flags["force"] = "true"
+			case removeDraft:
+				args[1], flags["post_status"] = "update", "draft"
+			}
+			if _, err := s.run(args, flags); err != nil {
+				fail(500, "hubstack_failed", err.Error())
+			} else {
+				data = map[string]any{"id": params["id"], "method": params["method"]}
+			}
+		}
+	default:
+		fail(404, "rest_no_route", "No route was found matching the URL and request method.")
+	}
+	out, err := json.Marshal(map[string]any{"status": status, "data": data})
+	return string(out), err
+}
@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var sitesManifestPath string
+
+// SitesManifest lists the sites one invocation processes. Each site can send
+// its content to its own AI provider account, e.g. a client's own OpenAI
+// organization, so one client's data never goes through another's key.
+//
+//	{"sites": [
+//	  {"container": "client-a-wp", "ai_provider": "openai",
+//	   "ai_api_key_env": "CLIENT_A_OPENAI_API_KEY", "openai_organization": "org-..."},
+//	  {"container": "client-b-wp"}
+//	]}
+type SitesManifest struct {
+	Sites []SiteConfig `json:"sites"`
+}
+
+// SiteConfig is one site in the manifest. Empty fields fall back to the
+// command-line flags. API keys are named by environment variable, never
+// stored in the manifest.
+type SiteConfig struct {
+	Container          string `json:"container"`
+	AIProvider         string `json:"ai_provider,omitempty"`
+	AIModel            string `json:"ai_model,omitempty"`
+	AIAPIKeyEnv        string `json:"ai_api_key_env,omitempty"`
+	OpenAIOrganization string `json:"openai_organization,omitempty"`
+	OutputCSVPath      string `json:"output_csv_path,omitempty"`
+	ReportHTMLPath     string `json:"report_html_path,omitempty"`
+	// Profile is a client profile file, relative to the manifest.
+	Profile string `json:"profile,omitempty"`
+	// WPFlags replaces --wp-flags for this site, e.g. "--allow-root".
+	WPFlags string `json:"wp_flags,omitempty"`
+	// WPPath replaces --wp-path for this site, e.g. "/srv/www/site/web/wp".
+	WPPath string `json:"wp_path,omitempty"`
+	// Window replaces --window for this site, e.g. in the client's time zone.
+	Window string `json:"window,omitempty"`
+	// SLA replaces --sla for this site, e.g. "72h" for a client with a
+	// tighter contract.
+	SLA string `json:"sla,omitempty"`
+	// IncidentID replaces --incident-id for this site, when each compromised
+	// site has its own ticket.
+	IncidentID string `json:"incident_id,omitempty"`
+}
+
+func loadSitesManifest(path string) (*SitesManifest, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading sites manifest: %w", err)
+	}
+	var manifest SitesManifest
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, fmt.Errorf("parsing sites manifest %s: %w", path, err)
+	}
+	seen := make(map[string]bool)
+	for i, site := range manifest.Sites {
+		if site.Container == "" {
+			return nil, fmt.Errorf("sites manifest entry %d has no container", i+1)
+		}
+		if seen[site.Container] {
+			return nil, fmt.Errorf("sites manifest lists %s twice", site.Container)
+		}
+		seen[site.Container] = true
+		if err := validateWPFlags(site.WPFlags); err != nil {
+			return nil, fmt.Errorf("site %s: %w", site.Container, err)
+		}
+		if site.Window != "" {
+			if _, err := parseWindow(site.Window); err != nil {
+				return nil, fmt.Errorf("site %s: %w", site.Container, err)
+			}
+		}
+		if site.SLA != "" {
+			if _, err := time.ParseDuration(site.SLA); err != nil {
+				return nil, fmt.Errorf("site %s: invalid sla: %w", site.Container, err)
+			}
+		}
+		if err := validateIncidentID(site.IncidentID); err != nil {
+			return nil, fmt.Errorf("site %s: %w", site.Container, err)
+		}
+		if site.AIProvider != "" {
+			if err := validateProvider(site.AIProvider); err != nil {
+				return nil, fmt.Errorf("site %s: %w", site.Container, err)
+			}
+		}
+	}
+	return &manifest, nil
+}
+
+// sitePath derives a per-site output path from a global one by prefixing the
+// file name with the container, so sites never overwrite each other's files.
+func sitePath(path, container string) string {
+	if path == "" || path == "-" {
+		return path
+	}
+	return filepath.Join(filepath.Dir(path), container+"-"+filepath.Base(path))
+}
+
+// forEachSite runs fn once for the --container-name site, or once per site in
+// --sites, with the global settings switched to that site for the duration
+// and the site's hooks run around it. A manifest or profile that fails to
+// load is fatal.
+func forEachSite(fn func()) {
+	err := forEachSiteOrSkip(func() error {
+		fn()
+		return nil
+	}, func(err error) {
+		fatal(err)
+	})
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// forEachSiteOrSkip is forEachSite for long-running commands that carry on
+// past a broken site: when a site's profile fails to load or fn returns an
+// error, skip is called with it and the next site runs. Only a manifest that
+// fails to load is returned.
+func forEachSiteOrSkip(fn func() error, skip func(error)) error {
+	if sitesManifestPath == "" {
+		var err error
+		withHooks(func() { err = fn() })
+		if err != nil {
+			skip(err)
+		}
+		return nil
+	}
+	manifest, err := loadSitesManifest(sitesManifestPath)
+	if err != nil {
+		return err
+	}
+
+	container, csvPath, htmlPath, retryPath, findingsPath, mediaPath := dockerContainer, outputCSVPath, reportHTMLPath, retryFilePath, findingsCSVPath, mediaCSVPath
+	manifestPath, graph, incident := runManifestPath, graphPath, incidentID
+	profile, flags, corePath, window, sla := activeProfile, wpFlags, wpPath, maintenanceWindow, findingSLA
+	provider, model, keyEnv, org := aiProvider, aiModelName, aiAPIKeyEnv, openAIOrg
+	defer func() {
+		dockerContainer, outputCSVPath, reportHTMLPath, retryFilePath, findingsCSVPath, mediaCSVPath = container, csvPath, htmlPath, retryPath, findingsPath, mediaPath
+		activeProfile, wpFlags, wpPath, runManifestPath, maintenanceWindow, findingSLA = profile, flags, corePath, manifestPath, window, sla
+		graphPath, incidentID = graph, incident
+		aiProvider, aiModelName, aiAPIKeyEnv, openAIOrg = provider, model, keyEnv, org
+		activeVariant.Model = resolvedModel()
+		applyIndustry(firstNonEmpty(industry, profile.Industry)) // validated before the first site
+		activeVariant.Normalizers = normalizerPipeline()
+	}()
+
+	for _, site := range manifest.Sites {
+		dockerContainer = site.Container
+		wpFlags = firstNonEmpty(site.WPFlags, flags)
+		wpPath = firstNonEmpty(site.WPPath, corePath)
+		maintenanceWindow = firstNonEmpty(site.Window, window)
+		findingSLA = sla
+		if site.SLA != "" {
+			findingSLA, _ = time.ParseDuration(site.SLA) // validated on load
+		}
+		outputCSVPath = firstNonEmpty(site.OutputCSVPath, sitePath(csvPath, site.Container))
+		reportHTMLPath = firstNonEmpty(site.ReportHTMLPath, sitePath(htmlPath, site.Container))
+		retryFilePath = sitePath(retryPath, site.Container)
+		findingsCSVPath = sitePath(findingsPath, site.Container)
+		mediaCSVPath = sitePath(mediaPath, site.Container)
+		runManifestPath = sitePath(manifestPath, site.Container)
+		graphPath = sitePath(graph, site.Container)
+		incidentID = firstNonEmpty(site.IncidentID, incident)
+		activeProfile = profile
+		if site.Profile != "" {
+			path := site.Profile
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(filepath.Dir(sitesManifestPath), path)
+			}
+			if activeProfile, err = loadProfile(path); err != nil {
+				skip(fmt.Errorf("site %s: %w", site.Container, err))
+				continue
+			}
+		}
+		aiProvider = firstNonEmpty(site.AIProvider, provider)
+		aiModelName = firstNonEmpty(site.AIModel, model)
+		aiAPIKeyEnv = firstNonEmpty(site.AIAPIKeyEnv, keyEnv)
+		openAIOrg = firstNonEmpty(site.OpenAIOrganization, org)
+		if site.AIProvider != "" && site.AIProvider != provider && site.AIModel == "" {
+			aiModelName = "" // the global model belongs to the other provider
+		}
+		activeVariant.Model = resolvedModel()
+		applyIndustry(firstNonEmpty(industry, activeProfile.Industry)) // validated by loadProfile
+		activeVariant.Normalizers = normalizerPipeline()
+
+		log.Printf("=== Site %s ===", site.Container)
+		withHooks(func() { err = fn() })
+		if err != nil {
+			skip(err)
+		}
+	}
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// findingSLA is how long a flagged finding may stay open before reports and
+// notifications call it out; 0 disables the SLA. --sites can set it per site.
+var findingSLA time.Duration
+
+func init() {
+	rootCmd.PersistentFlags().DurationVar(&findingSLA, "sla", 7*24*time.Hour, "How long Spam and Uncertain findings may stay open before they are reported as overdue (0 to disable).")
+}
+
+// OpenFor is how long a flagged finding has been open since the store saw it
+// become Spam or Uncertain, or 0 if it is cleaned, not flagged, or has never
+// been stored.
+func (p Post) OpenFor() time.Duration {
+	if findingSeverity(p.AIClassification) == "" || p.ReviewState == "cleaned" {
+		return 0
+	}
+	first, err := time.Parse(time.RFC3339, p.FlaggedAt)
+	if err != nil {
+		return 0
+	}
+	return time.Since(first)
+}
+
+// Overdue is whether the finding has been open longer than the SLA.
+func (p Post) Overdue() bool {
+	return findingSLA > 0 && p.OpenFor() > findingSLA
+}
+
+// Age is OpenFor in days, or hours for findings opened within the last day.
+func (p Post) Age() string {
+	if d := p.OpenFor(); d > 0 {
+		return formatAge(d)
+	}
+	return ""
+}
+
+func formatAge(d time.Duration) string {
+	if d < 24*time.Hour {
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+// Overdue counts the listed findings open past the SLA.
+func (d *ReportData) Overdue() int {
+	n := 0
+	for _, p := range d.Posts {
+		if p.Overdue() {
+			n++
+		}
+	}
+	return n
+}
+
+// SLA is the SLA as shown in reports, e.g. "7d".
+func (d *ReportData) SLA() string {
+	return formatAge(findingSLA)
+}
+
+// queueOverdueNotifications queues, once per finding, the flagged findings of
+// a site's latest run that have been open past the SLA. They are sent to the
+// routes for the "overdue" severity.
+func queueOverdueNotifications(db *sql.DB, site string) (int, error) {
+	if findingSLA <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-findingSLA).UTC().Format(time.RFC3339)
+	res, err := db.Exec(`INSERT OR IGNORE INTO notifications (site, post_id, severity, classification, queued_at, reason)
+		SELECT site, post_id, 'overdue', classification, ?, 'overdue' FROM findings
+		WHERE site = ? AND run_id = (SELECT MAX(id) FROM runs WHERE site = ?)
+			AND classification IN ('Spam', 'Uncertain') AND review_state <> 'cleaned'
+			AND flagged_at != '' AND flagged_at < ?`,
+		time.Now().UTC().Format(time.RFC3339), site, site, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("queueing overdue findings: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
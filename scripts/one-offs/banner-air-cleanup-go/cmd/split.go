@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var maxRowsPerFile int
+
+// writeTable writes header and rows to path as CSV or XLSX. With more rows
+// than --max-rows-per-file, it instead writes numbered parts of at most that
+// many rows each, results.part001.csv, results.part002.csv, ..., each with
+// the header, plus results.index.csv (in the same format) listing them. It
+// returns the files written.
+func writeTable(path, format string, header []string, rows [][]string) ([]string, error) {
+	if maxRowsPerFile <= 0 || len(rows) <= maxRowsPerFile {
+		return []string{path}, writeTableFile(path, format, header, rows)
+	}
+
+	// A single file from an earlier run would look like the complete output.
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	parts := (len(rows) + maxRowsPerFile - 1) / maxRowsPerFile
+	var index [][]string
+	var written []string
+	for part := 1; part <= parts; part++ {
+		first := (part - 1) * maxRowsPerFile
+		last := min(first+maxRowsPerFile, len(rows))
+		partFile := partPath(path, part, parts)
+		if err := writeTableFile(partFile, format, header, rows[first:last]); err != nil {
+			return written, err
+		}
+		written = append(written, partFile)
+		index = append(index, []string{strconv.Itoa(part), filepath.Base(partFile),
+			strconv.Itoa(last - first), strconv.Itoa(first + 1), strconv.Itoa(last)})
+	}
+
+	indexFile := indexPath(path)
+	if err := writeTableFile(indexFile, format, []string{"part", "file", "rows", "first_row", "last_row"}, index); err != nil {
+		return written, err
+	}
+	log.Printf("Split %d rows into %d files of at most %d rows; see %s", len(rows), parts, maxRowsPerFile, indexFile)
+	return append(written, indexFile), nil
+}
+
+// partPath numbers a part of a split output, zero-padded so parts sort in
+// order: results.csv becomes results.part001.csv.
+func partPath(path string, part, parts int) string {
+	ext := filepath.Ext(path)
+	width := max(3, len(strconv.Itoa(parts)))
+	return fmt.Sprintf("%s.part%0*d%s", strings.TrimSuffix(path, ext), width, part, ext)
+}
+
+// indexPath names the index of a split output: results.csv becomes
+// results.index.csv.
+func indexPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".index" + ext
+}
+
+func writeTableFile(path, format string, header []string, rows [][]string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", path, err)
+	}
+	defer file.Close()
+	if err := encodeTable(file, format, header, rows); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return file.Close()
+}
+
+func encodeTable(w io.Writer, format string, header []string, rows [][]string) error {
+	switch format {
+	case "csv":
+		writer := csv.NewWriter(w)
+		if err := writer.Write(header); err != nil {
+			return err
+		}
+		if err := writer.WriteAll(rows); err != nil {
+			return err
+		}
+		return writer.Error()
+	case "xlsx":
+		return writeXLSX(w, "Results", header, rows)
+	default:
+		return fmt.Errorf("unsupported table format %q", format)
+	}
+}
+
+// postRecords flattens posts into output rows.
+func postRecords(posts []Post) [][]string {
+	rows := make([][]string, 0, len(posts))
+	for _, post := range posts {
+		rows = append(rows, postRecord(post))
+	}
+	return rows
+}
@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	statsInterval   time.Duration
+	throttleCPU     float64
+	abortMemPercent float64
+)
+
+// errContainerStarved stops extraction once the site container is close to
+// running out of memory.
+var errContainerStarved = errors.New("site container is resource-starved")
+
+// ContainerImpact is the peak load on the site container while the tool ran.
+type ContainerImpact struct {
+	Samples      int     `json:"samples"`
+	PeakCPU      float64 `json:"peak_cpu_percent"`
+	PeakMem      float64 `json:"peak_mem_percent"`
+	PeakMemUsage string  `json:"peak_mem_usage,omitempty"`
+	ThrottledFor string  `json:"throttled_for,omitempty"`
+	Aborted      string  `json:"aborted,omitempty"`
+}
+
+func (c *ContainerImpact) String() string {
+	s := fmt.Sprintf("peak CPU %.1f%%, peak memory %.1f%%", c.PeakCPU, c.PeakMem)
+	if c.PeakMemUsage != "" {
+		s += " (" + c.PeakMemUsage + ")"
+	}
+	s += fmt.Sprintf(" over %d sample(s)", c.Samples)
+	if c.ThrottledFor != "" {
+		s += "; throttled for " + c.ThrottledFor
+	}
+	if c.Aborted != "" {
+		s += "; aborted: " + c.Aborted
+	}
+	return s
+}
+
+// dockerStats is the part of `docker stats --format '{{json .}}'` we use.
+type dockerStats struct {
+	CPUPerc  string `json:"CPUPerc"`
+	MemPerc  string `json:"MemPerc"`
+	MemUsage string `json:"MemUsage"`
+}
+
+// statsSampler polls docker stats for the site container in the background.
+// Workers call wait before each post: it pauses them while CPU is above
+// --throttle-cpu and fails once memory passes --abort-mem-percent. A nil
+// sampler never throttles.
+type statsSampler struct {
+	container string
+	cancel    context.CancelFunc
+	done      chan struct{}
+
+	mu        sync.Mutex
+	impact    ContainerImpact
+	busy      bool
+	busySince time.Time
+	throttled time.Duration
+}
+
+// startStatsSampler starts sampling the current site's container, or returns
+// nil when --stats-interval is 0.
+func startStatsSampler(ctx context.Context) *statsSampler {
+	if statsInterval <= 0 || simulate {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s := &statsSampler{container: dockerContainer, cancel: cancel, done: make(chan struct{})}
+	go s.run(ctx)
+	return s
+}
+
+func (s *statsSampler) run(ctx context.Context) {
+	defer close(s.done)
+	defer func() {
+		// Never leave workers paused on a stale sample
+		s.mu.Lock()
+		s.setBusy(false)
+		s.mu.Unlock()
+	}()
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+	for {
+		stats, err := sampleContainer(ctx, s.container)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Warning: container stats unavailable, not monitoring load: %v", err)
+			}
+			return
+		}
+		s.record(stats)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *statsSampler) record(stats dockerStats) {
+	cpu := parsePercent(stats.CPUPerc)
+	mem := parsePercent(stats.MemPerc)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.impact.Samples++
+	if cpu > s.impact.PeakCPU {
+		s.impact.PeakCPU = cpu
+	}
+	if mem > s.impact.PeakMem {
+		s.impact.PeakMem = mem
+		s.impact.PeakMemUsage = stats.MemUsage
+	}
+	if abortMemPercent > 0 && mem >= abortMemPercent && s.impact.Aborted == "" {
+		s.impact.Aborted = fmt.Sprintf("memory at %.1f%% (%s)", mem, stats.MemUsage)
+		log.Printf("Warning: %s: %s; stopping extraction.", s.container, s.impact.Aborted)
+	}
+	busy := throttleCPU > 0 && cpu >= throttleCPU
+	if busy && !s.busy {
+		log.Printf("Container %s at %.1f%% CPU; pausing extraction until it drops below %.0f%%.", s.container, cpu, throttleCPU)
+	}
+	s.setBusy(busy)
+}
+
+// setBusy records a change of throttling state, adding up the time spent
+// paused. s.mu must be held.
+func (s *statsSampler) setBusy(busy bool) {
+	switch {
+	case busy && !s.busy:
+		s.busySince = time.Now()
+	case !busy && s.busy:
+		s.throttled += time.Since(s.busySince)
+	}
+	s.busy = busy
+}
+
+// wait blocks while the container is busy and returns errContainerStarved
+// once the run has been aborted.
+func (s *statsSampler) wait(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	for {
+		s.mu.Lock()
+		aborted, busy := s.impact.Aborted != "", s.busy
+		s.mu.Unlock()
+		if aborted {
+			return errContainerStarved
+		}
+		if !busy {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// stop ends sampling and returns the container's peak load.
+func (s *statsSampler) stop() *ContainerImpact {
+	if s == nil {
+		return nil
+	}
+	s.cancel()
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	impact := s.impact
+	if s.throttled > 0 {
+		impact.ThrottledFor = s.throttled.Round(time.Second).String()
+	}
+	return &impact
+}
+
+func sampleContainer(ctx context.Context, container string) (dockerStats, error) {
+	var stats dockerStats
+	out, err := exec.CommandContext(ctx, "docker", "stats", "--no-stream", "--format", "{{json .}}", container).Output()
+	if err != nil {
+		return stats, err
+	}
+	if err := json.Unmarshal(out, &stats); err != nil {
+		return stats, fmt.Errorf("parsing docker stats: %w", err)
+	}
+	return stats, nil
+}
+
+// parsePercent parses docker's "12.34%", returning 0 for "--" and the like.
+func parsePercent(s string) float64 {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
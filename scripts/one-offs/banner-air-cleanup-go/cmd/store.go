@@ -0,0 +1,508 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// storeMigrations are applied in order; PRAGMA user_version records how many
+// have run. Append new migrations, never edit existing ones.
+var storeMigrations = []string{
+	`CREATE TABLE runs (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		site        TEXT NOT NULL,
+		started_at  TEXT NOT NULL,
+		finished_at TEXT NOT NULL,
+		posts       INTEGER NOT NULL
+	);
+	CREATE TABLE findings (
+		site                TEXT NOT NULL,
+		post_id             INTEGER NOT NULL,
+		post_title          TEXT NOT NULL,
+		post_type           TEXT NOT NULL,
+		post_date           TEXT NOT NULL,
+		post_guid           TEXT NOT NULL,
+		content_excerpt     TEXT NOT NULL,
+		author_id           TEXT NOT NULL,
+		author_display_name TEXT NOT NULL,
+		author_email        TEXT NOT NULL,
+		author_login        TEXT NOT NULL,
+		classification      TEXT NOT NULL,
+		justification       TEXT NOT NULL,
+		run_id              INTEGER NOT NULL REFERENCES runs(id),
+		first_seen          TEXT NOT NULL,
+		last_seen           TEXT NOT NULL,
+		PRIMARY KEY (site, post_id)
+	);`,
+	`CREATE TABLE tags (
+		site       TEXT NOT NULL,
+		post_id    INTEGER NOT NULL,
+		tag        TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		PRIMARY KEY (site, post_id, tag)
+	);`,
+	`ALTER TABLE findings ADD COLUMN assignee TEXT NOT NULL DEFAULT '';
+	ALTER TABLE findings ADD COLUMN review_state TEXT NOT NULL DEFAULT 'new';
+	ALTER TABLE findings ADD COLUMN review_updated_at TEXT NOT NULL DEFAULT '';`,
+	`CREATE TABLE notifications (
+		site           TEXT NOT NULL,
+		post_id        INTEGER NOT NULL,
+		severity       TEXT NOT NULL,
+		classification TEXT NOT NULL,
+		queued_at      TEXT NOT NULL,
+		sent_at        TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (site, post_id, classification)
+	);
+	CREATE TABLE notification_routes (
+		route        TEXT PRIMARY KEY,
+		last_sent_at TEXT NOT NULL
+	);`,
+	`ALTER TABLE findings ADD COLUMN first_run_id INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE findings ADD COLUMN prompt_hash TEXT NOT NULL DEFAULT '';
+	ALTER TABLE findings ADD COLUMN model_version TEXT NOT NULL DEFAULT '';
+	ALTER TABLE findings ADD COLUMN content_hash TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE findings ADD COLUMN content TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE runs ADD COLUMN ai_provider TEXT NOT NULL DEFAULT '';
+	ALTER TABLE runs ADD COLUMN ai_key_env TEXT NOT NULL DEFAULT '';
+	ALTER TABLE runs ADD COLUMN ai_model TEXT NOT NULL DEFAULT '';
+	ALTER TABLE runs ADD COLUMN ai_requests INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE runs ADD COLUMN ai_failures INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE runs ADD COLUMN ai_prompt_tokens INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE runs ADD COLUMN ai_output_tokens INTEGER NOT NULL DEFAULT 0;`,
+	`CREATE TABLE typed_findings (
+		site           TEXT NOT NULL,
+		type           TEXT NOT NULL,
+		subject        TEXT NOT NULL,
+		post_id        INTEGER NOT NULL DEFAULT 0,
+		title          TEXT NOT NULL DEFAULT '',
+		classification TEXT NOT NULL,
+		detail         TEXT NOT NULL,
+		prompt_hash    TEXT NOT NULL DEFAULT '',
+		model_version  TEXT NOT NULL DEFAULT '',
+		run_id         INTEGER NOT NULL REFERENCES runs(id),
+		first_seen     TEXT NOT NULL,
+		last_seen      TEXT NOT NULL,
+		PRIMARY KEY (site, type, subject)
+	);`,
+	`ALTER TABLE runs ADD COLUMN wp_fallback TEXT NOT NULL DEFAULT '';`,
+	`CREATE TABLE campaign_indicators (
+		site       TEXT NOT NULL,
+		campaign   TEXT NOT NULL,
+		indicator  TEXT NOT NULL,
+		posts      INTEGER NOT NULL,
+		started    TEXT NOT NULL,
+		run_id     INTEGER NOT NULL REFERENCES runs(id),
+		first_seen TEXT NOT NULL,
+		last_seen  TEXT NOT NULL,
+		PRIMARY KEY (site, campaign, indicator)
+	);
+	CREATE INDEX campaign_indicators_indicator ON campaign_indicators (indicator);`,
+	`ALTER TABLE findings ADD COLUMN correlation_id TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE findings ADD COLUMN post_excerpt TEXT NOT NULL DEFAULT '';
+	ALTER TABLE findings ADD COLUMN seo_title TEXT NOT NULL DEFAULT '';
+	ALTER TABLE findings ADD COLUMN seo_description TEXT NOT NULL DEFAULT '';`,
+	// SQLite cannot change a primary key in place, so the table is rebuilt to
+	// let a finding be notified both when flagged and when overdue.
+	`CREATE TABLE notifications_new (
+		site           TEXT NOT NULL,
+		post_id        INTEGER NOT NULL,
+		severity       TEXT NOT NULL,
+		classification TEXT NOT NULL,
+		queued_at      TEXT NOT NULL,
+		sent_at        TEXT NOT NULL DEFAULT '',
+		reason         TEXT NOT NULL DEFAULT 'flagged',
+		PRIMARY KEY (site, post_id, classification, reason)
+	);
+	INSERT INTO notifications_new (site, post_id, severity, classification, queued_at, sent_at)
+		SELECT site, post_id, severity, classification, queued_at, sent_at FROM notifications;
+	DROP TABLE notifications;
+	ALTER TABLE notifications_new RENAME TO notifications;`,
+	`ALTER TABLE runs ADD COLUMN incident_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE runs ADD COLUMN note TEXT NOT NULL DEFAULT '';
+	CREATE INDEX runs_incident_id ON runs (incident_id);`,
+	`CREATE TABLE approvals (
+		site        TEXT NOT NULL,
+		post_id     INTEGER NOT NULL,
+		token       TEXT NOT NULL,
+		approved_by TEXT NOT NULL,
+		remote_addr TEXT NOT NULL,
+		approved_at TEXT NOT NULL
+	);
+	CREATE INDEX approvals_site_post ON approvals (site, post_id);`,
+	`CREATE TABLE honeytokens (
+		site         TEXT PRIMARY KEY,
+		post_id      INTEGER NOT NULL,
+		post_date    TEXT NOT NULL,
+		option_name  TEXT NOT NULL,
+		token        TEXT NOT NULL,
+		content_hash TEXT NOT NULL,
+		planted_at   TEXT NOT NULL,
+		verified_at  TEXT NOT NULL DEFAULT '',
+		tampered     TEXT NOT NULL DEFAULT ''
+	);`,
+	// Deliveries are recorded per route, so two routes for one severity both
+	// send. Notifications already sent count as delivered by every route
+	// that had sent that severity.
+	`CREATE TABLE notification_deliveries (
+		route          TEXT NOT NULL,
+		site           TEXT NOT NULL,
+		post_id        INTEGER NOT NULL,
+		classification TEXT NOT NULL,
+		reason         TEXT NOT NULL,
+		delivered_at   TEXT NOT NULL,
+		PRIMARY KEY (route, site, post_id, classification, reason)
+	);
+	INSERT INTO notification_deliveries (route, site, post_id, classification, reason, delivered_at)
+		SELECT r.route, n.site, n.post_id, n.classification, n.reason, n.sent_at
+		FROM notifications n JOIN notification_routes r ON substr(r.route, 1, instr(r.route, '=') - 1) = n.severity
+		WHERE n.sent_at != '';`,
+	// flagged_at is when a finding last became Spam or Uncertain, for SLA
+	// ages and spam bursts. Findings flagged before it existed can only be
+	// dated from when they were first stored.
+	`ALTER TABLE findings ADD COLUMN flagged_at TEXT NOT NULL DEFAULT '';
+	UPDATE findings SET flagged_at = first_seen WHERE classification IN ('Spam', 'Uncertain');`,
+}
+
+// flaggedAtUpdate sets findings.flagged_at for a new classification: kept
+// while the finding stays flagged, set to the second parameter when it
+// becomes flagged and cleared when it no longer is. The first parameter is
+// the new classification.
+const flaggedAtUpdate = `flagged_at = CASE
+			WHEN ? NOT IN ('Spam', 'Uncertain') THEN ''
+			WHEN flagged_at = '' THEN ?
+			ELSE flagged_at END`
+
+// reviewStates are the allowed values of findings.review_state, in workflow
+// order.
+var reviewStates = []string{"new", "triaged", "approved", "cleaned"}
+
+// findingColumns are the findings columns that map onto a Post, in the order
+// of findingValues.
+const findingColumns = `post_id, post_title, post_type, post_date, post_guid,
+	content_excerpt, author_id, author_display_name, author_email,
+	author_login, classification, justification, prompt_hash,
+	model_version, content_hash, content, correlation_id, post_excerpt,
+	seo_title, seo_description`
+
+func findingValues(post Post) []any {
+	return []any{
+		post.ID, post.Title, post.Type, post.Date, post.GUID,
+		post.ContentExcerpt, post.AuthorID, post.Author.DisplayName, post.Author.Email,
+		post.Author.Login, post.AIClassification, post.AIJustification, post.AIPromptHash,
+		post.AIModelVersion, post.ContentHash, post.Content, post.CorrelationID, post.Excerpt,
+		post.SEOTitle, post.SEODescription,
+	}
+}
+
+// openStore opens (creating if needed) the results database and brings its
+// schema up to date.
+func openStore(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("opening store %s: %w", path, err)
+	}
+	if err := migrateStore(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// openStoreReadOnly opens an existing results database for queries only.
+func openStoreReadOnly(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?mode=ro&_pragma=query_only(1)", path))
+	if err != nil {
+		return nil, fmt.Errorf("opening store %s: %w", path, err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opening store %s: %w", path, err)
+	}
+	return db, nil
+}
+
+func migrateStore(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("reading store schema version: %w", err)
+	}
+	for i := version; i < len(storeMigrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(storeMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("applying store migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("recording store migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveRun records a run and upserts one finding per post, keeping the time
+// each post was first seen on the site.
+func saveRun(db *sql.DB, site string, startedAt time.Time, posts []Post) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := tx.Exec(`INSERT INTO runs (site, started_at, finished_at, posts) VALUES (?, ?, ?, ?)`,
+		site, startedAt.UTC().Format(time.RFC3339), now, len(posts))
+	if err != nil {
+		return 0, fmt.Errorf("recording run: %w", err)
+	}
+	runID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO findings (site, ` + findingColumns + `, run_id, first_run_id, first_seen, last_seen, flagged_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (site, post_id) DO UPDATE SET
+			post_title = excluded.post_title,
+			post_type = excluded.post_type,
+			post_date = excluded.post_date,
+			post_guid = excluded.post_guid,
+			content_excerpt = excluded.content_excerpt,
+			author_id = excluded.author_id,
+			author_display_name = excluded.author_display_name,
+			author_email = excluded.author_email,
+			author_login = excluded.author_login,
+			classification = excluded.classification,
+			justification = excluded.justification,
+			prompt_hash = excluded.prompt_hash,
+			model_version = excluded.model_version,
+			content_hash = excluded.content_hash,
+			content = excluded.content,
+			correlation_id = excluded.correlation_id,
+			post_excerpt = excluded.post_excerpt,
+			seo_title = excluded.seo_title,
+			seo_description = excluded.seo_description,
+			run_id = excluded.run_id,
+			last_seen = excluded.last_seen,
+			flagged_at = CASE
+				WHEN excluded.classification NOT IN ('Spam', 'Uncertain') THEN ''
+				WHEN findings.flagged_at = '' THEN excluded.flagged_at
+				ELSE findings.flagged_at END`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for _, post := range posts {
+		args := append([]any{site}, findingValues(post)...)
+		flaggedAt := ""
+		if findingSeverity(post.AIClassification) != "" {
+			flaggedAt = now
+		}
+		args = append(args, runID, runID, now, now, flaggedAt)
+		if _, err := stmt.Exec(args...); err != nil {
+			return 0, fmt.Errorf("saving post %d: %w", post.ID, err)
+		}
+	}
+	return runID, tx.Commit()
+}
+
+// recordRunFallback notes on a run that wp-cli had to skip plugins and
+// themes.
+func recordRunFallback(db *sql.DB, runID int64, fb *WPFallback) error {
+	if fb == nil {
+		return nil
+	}
+	_, err := db.Exec(`UPDATE runs SET wp_fallback = ? WHERE id = ?`, firstNonEmpty(fb.Culprit, fb.Error), runID)
+	return err
+}
+
+// recordRunNote stores the operator's incident ID and note on a run.
+func recordRunNote(db *sql.DB, runID int64, incident, note string) error {
+	if incident == "" && note == "" {
+		return nil
+	}
+	_, err := db.Exec(`UPDATE runs SET incident_id = ?, note = ? WHERE id = ?`, incident, note, runID)
+	return err
+}
+
+// recordApproval approves a finding for cleanup through the API and keeps
+// who approved it, and from where, in the approvals table.
+func recordApproval(db *sql.DB, site string, postID int, token, approvedBy, remoteAddr string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := tx.Exec(`UPDATE findings SET review_state = 'approved', review_updated_at = ?
+		WHERE site = ? AND post_id = ? AND review_state IN ('new', 'triaged')`, now, site, postID)
+	if err != nil {
+		return fmt.Errorf("approving post %d: %w", postID, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil // approved or cleaned meanwhile
+	}
+	if _, err := tx.Exec(`INSERT INTO approvals (site, post_id, token, approved_by, remote_addr, approved_at)
+		VALUES (?, ?, ?, ?, ?, ?)`, site, postID, token, approvedBy, remoteAddr, now); err != nil {
+		return fmt.Errorf("recording approval of post %d: %w", postID, err)
+	}
+	return tx.Commit()
+}
+
+// queryFindings returns the stored findings matching an optional SQL filter.
+func queryFindings(db *sql.DB, where string) ([]Post, error) {
+	query := `SELECT site, ` + findingColumns + `,
+		(SELECT group_concat(tag, ';' ORDER BY tag) FROM tags t
+			WHERE t.site = findings.site AND t.post_id = findings.post_id) AS tags,
+		assignee, review_state, first_seen, flagged_at
+		FROM findings`
+	if strings.TrimSpace(where) != "" {
+		query += " WHERE " + where
+	}
+	query += " ORDER BY site, post_id"
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("querying findings: %w", err)
+	}
+	defer rows.Close()
+
+	var posts []Post
+	for rows.Next() {
+		var p Post
+		var tags sql.NullString
+		if err := rows.Scan(&p.Site, &p.ID, &p.Title, &p.Type, &p.Date, &p.GUID,
+			&p.ContentExcerpt, &p.AuthorID, &p.Author.DisplayName, &p.Author.Email,
+			&p.Author.Login, &p.AIClassification, &p.AIJustification, &p.AIPromptHash,
+			&p.AIModelVersion, &p.ContentHash, &p.Content, &p.CorrelationID, &p.Excerpt,
+			&p.SEOTitle, &p.SEODescription, &tags,
+			&p.Assignee, &p.ReviewState, &p.FirstSeen, &p.FlaggedAt); err != nil {
+			return nil, err
+		}
+		p.Author.ID = p.AuthorID
+		if tags.String != "" {
+			p.Tags = strings.Split(tags.String, ";")
+		}
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
+
+// addTags tags a finding; tags that already exist are left alone.
+func addTags(db *sql.DB, site string, postID int, tags []string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, tag := range tags {
+		if _, err := db.Exec(`INSERT OR IGNORE INTO tags (site, post_id, tag, created_at) VALUES (?, ?, ?, ?)`,
+			site, postID, tag, now); err != nil {
+			return fmt.Errorf("tagging post %d: %w", postID, err)
+		}
+	}
+	return nil
+}
+
+func removeTags(db *sql.DB, site string, postID int, tags []string) error {
+	for _, tag := range tags {
+		if _, err := db.Exec(`DELETE FROM tags WHERE site = ? AND post_id = ? AND tag = ?`,
+			site, postID, tag); err != nil {
+			return fmt.Errorf("untagging post %d: %w", postID, err)
+		}
+	}
+	return nil
+}
+
+// attachAnnotations fills in the stored tags and review fields for posts
+// from one site.
+func attachAnnotations(db *sql.DB, site string, posts []Post) error {
+	stored, err := queryFindings(db, siteFilter(site))
+	if err != nil {
+		return fmt.Errorf("loading annotations: %w", err)
+	}
+	byID := make(map[int]Post, len(stored))
+	for _, p := range stored {
+		byID[p.ID] = p
+	}
+	for i := range posts {
+		if p, ok := byID[posts[i].ID]; ok {
+			posts[i].Tags = p.Tags
+			posts[i].Assignee = p.Assignee
+			posts[i].ReviewState = p.ReviewState
+			posts[i].FirstSeen = p.FirstSeen
+			posts[i].FlaggedAt = p.FlaggedAt
+		}
+	}
+	return nil
+}
+
+// siteFilter is a findings filter selecting a single site.
+func siteFilter(site string) string {
+	return fmt.Sprintf("site = '%s'", strings.ReplaceAll(site, "'", "''"))
+}
+
+// matchingPostIDs returns the IDs of a site's findings matching a SQL filter.
+func matchingPostIDs(db *sql.DB, site, where string) ([]int, error) {
+	query := `SELECT post_id FROM findings WHERE site = ?`
+	if strings.TrimSpace(where) != "" {
+		query += " AND (" + where + ")"
+	}
+	query += " ORDER BY post_id"
+
+	rows, err := db.Query(query, site)
+	if err != nil {
+		return nil, fmt.Errorf("selecting findings: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// updateReview sets the review state and/or assignee of findings. Empty
+// values leave the corresponding field unchanged.
+func updateReview(db *sql.DB, site string, postIDs []int, state, assignee string) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`UPDATE findings SET
+		review_state = CASE WHEN ? = '' THEN review_state ELSE ? END,
+		assignee = CASE WHEN ? = '' THEN assignee ELSE ? END,
+		review_updated_at = ?
+		WHERE site = ? AND post_id = ?`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	var updated int64
+	for _, id := range postIDs {
+		res, err := stmt.Exec(state, state, assignee, assignee, now, site, id)
+		if err != nil {
+			return 0, fmt.Errorf("updating post %d: %w", id, err)
+		}
+		n, _ := res.RowsAffected()
+		updated += n
+	}
+	return updated, tx.Commit()
+}
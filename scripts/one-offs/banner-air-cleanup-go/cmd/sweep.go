@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	preflight          bool
+	sweepExtraPatterns []string
+)
+
+// URL shorteners hide the real target of injected links; legitimate HVAC
+// content has no reason to use them.
+var sweepShorteners = []string{
+	"bit[.]ly", "tinyurl[.]com", "goo[.]gl", "is[.]gd", "cutt[.]ly", "ow[.]ly",
+	"rebrand[.]ly", "shorturl[.]at", "t[.]ly", "rb[.]gy", "tiny[.]cc", "v[.]gd",
+}
+
+// sweepSpamTLDs are top-level domains that dominate link-spam campaigns.
+var sweepSpamTLDs = []string{
+	"ru", "cn", "top", "xyz", "click", "loan", "casino", "bet", "win", "icu", "buzz", "cyou", "rest", "sbs",
+}
+
+// SweepResult is the outcome of the pre-flight sweep.
+type SweepResult struct {
+	Total        int
+	Shortlinks   int
+	SpamTLDs     int
+	Keywords     int
+	Extra        int
+	ForeignGUIDs int
+	AnyMatch     int
+}
+
+var sweepCmd = &cobra.Command{
+	Use:   "sweep",
+	Short: "Count likely spam posts with a single database query before a full extraction.",
+	Long: `Runs one wp db query over the posts table counting posts and pages whose
+content links to URL shorteners or spam-heavy TLDs, mentions spam keywords,
+or whose GUID points at another domain. It takes seconds even on large sites,
+so the operator knows the scale of an infection before committing to a full
+extraction and AI analysis.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := runSweep(context.Background())
+		if err != nil {
+			fatalf("Sweep failed: %v", err)
+		}
+		printSweep(result)
+	},
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&preflight, "preflight", false, "Run the database sweep before extraction and log the expected scale.")
+	rootCmd.PersistentFlags().StringSliceVar(&sweepExtraPatterns, "spam-domain-pattern", nil, "Extra MySQL regular expression(s) for spam domains counted by the sweep, e.g. 'cheap-pills[.]'.")
+	rootCmd.AddCommand(sweepCmd)
+}
+
+// sweepQuery builds the sweep as a single statement against the site's
+// table prefix.
+func sweepQuery(prefix string) string {
+	link := func(hosts string) string {
+		return fmt.Sprintf("post_content REGEXP 'https?://([a-z0-9-]+[.])*(%s)(/|\"|''| |$)'", hosts)
+	}
+	shorteners := link(strings.Join(sweepShorteners, "|"))
+	tlds := fmt.Sprintf("post_content REGEXP 'https?://[a-z0-9.-]+[.](%s)(/|\"|''| |:|$)'", strings.Join(sweepSpamTLDs, "|"))
+	// The keywords of spamKeywordPattern, with the industry pack applied, as
+	// whole words; MySQL has no \b, and the comparison ignores case.
+	keywords := fmt.Sprintf("post_content REGEXP '(^|[^a-z])(%s)([^a-z]|$)'", strings.ReplaceAll(strings.Join(activeSpamKeywords, "|"), "'", "''"))
+	extra := "0"
+	if len(sweepExtraPatterns) > 0 {
+		extra = fmt.Sprintf("post_content REGEXP '%s'", strings.ReplaceAll(strings.Join(sweepExtraPatterns, "|"), "'", "''"))
+	}
+	foreign := fmt.Sprintf("guid NOT LIKE CONCAT((SELECT option_value FROM %soptions WHERE option_name = 'home'), '%%')", prefix)
+
+	return fmt.Sprintf(`SELECT COUNT(*),
+		COALESCE(SUM(%[1]s), 0), COALESCE(SUM(%[2]s), 0), COALESCE(SUM(%[3]s), 0),
+		COALESCE(SUM(%[4]s), 0), COALESCE(SUM(%[5]s), 0),
+		COALESCE(SUM((%[1]s) OR (%[2]s) OR (%[3]s) OR (%[4]s) OR (%[5]s)), 0)
+		FROM %[6]sposts
+		WHERE post_type IN ('post', 'page') AND post_status NOT IN ('auto-draft', 'inherit', 'trash')`,
+		shorteners, tlds, keywords, extra, foreign, prefix)
+}
+
+// dbQuery runs a read-only SQL statement built for the site's table prefix
+// and returns its tab-separated rows. Only the prefix lookup and the query
+// itself go through wp-cli.
+func dbQuery(ctx context.Context, build func(prefix string) string) (string, error) {
+	prefix, err := runWPCommand(ctx, []string{"db", "prefix"})
+	if err != nil {
+		return "", fmt.Errorf("reading table prefix: %w", err)
+	}
+	return runWPCommand(ctx, []string{"db", "query", build(strings.TrimSpace(prefix)), "--skip-column-names", "--batch"})
+}
+
+// runSweep runs the sweep query.
+func runSweep(ctx context.Context) (*SweepResult, error) {
+	output, err := dbQuery(ctx, sweepQuery)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(output)
+	if len(fields) != 7 {
+		return nil, fmt.Errorf("unexpected sweep output %q", output)
+	}
+	var n [7]int
+	for i, f := range fields {
+		if n[i], err = strconv.Atoi(f); err != nil {
+			return nil, fmt.Errorf("unexpected sweep output %q", output)
+		}
+	}
+	return &SweepResult{Total: n[0], Shortlinks: n[1], SpamTLDs: n[2], Keywords: n[3],
+		Extra: n[4], ForeignGUIDs: n[5], AnyMatch: n[6]}, nil
+}
+
+func printSweep(r *SweepResult) {
+	fmt.Printf("%-32s %8d\n", "Posts and pages", r.Total)
+	fmt.Printf("%-32s %8d\n", "Linking to URL shorteners", r.Shortlinks)
+	fmt.Printf("%-32s %8d\n", "Linking to spam-heavy TLDs", r.SpamTLDs)
+	fmt.Printf("%-32s %8d\n", "Mentioning spam keywords", r.Keywords)
+	if len(sweepExtraPatterns) > 0 {
+		fmt.Printf("%-32s %8d\n", "Matching --spam-domain-pattern", r.Extra)
+	}
+	fmt.Printf("%-32s %8d\n", "GUID on another domain", r.ForeignGUIDs)
+	fmt.Printf("%-32s %8d (%s)\n", "Any of the above", r.AnyMatch, percent(r.AnyMatch, r.Total))
+}
+
+func percent(n, total int) string {
+	if total == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(n)/float64(total))
+}
+
+// logPreflight runs the sweep ahead of a full extraction. A failed sweep is
+// only a warning; the extraction does not depend on it.
+func logPreflight(ctx context.Context) {
+	result, err := runSweep(ctx)
+	if err != nil {
+		log.Printf("Warning: pre-flight sweep failed: %v", err)
+		return
+	}
+	log.Printf("Pre-flight: %d posts and pages, %d (%s) look like spam (%d shortlinks, %d spam TLDs, %d keywords, %d foreign GUIDs).",
+		result.Total, result.AnyMatch, percent(result.AnyMatch, result.Total),
+		result.Shortlinks, result.SpamTLDs, result.Keywords, result.ForeignGUIDs)
+}
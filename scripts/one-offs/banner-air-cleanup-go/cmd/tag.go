@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var tagPostIDs []int
+
+var tagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "Tag findings in the results store for review.",
+	Long: `Attaches free-form tags such as "reviewed" or "false-positive" to stored
+findings so several people can work through a large result set. Tags are
+scoped to the site given by --container-name and show up in query output and
+HTML reports.`,
+}
+
+var tagAddCmd = &cobra.Command{
+	Use:   "add TAG...",
+	Short: "Add tags to findings.",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runTagUpdate(args, addTags, "Tagged")
+	},
+}
+
+var tagRemoveCmd = &cobra.Command{
+	Use:   "remove TAG...",
+	Short: "Remove tags from findings.",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runTagUpdate(args, removeTags, "Untagged")
+	},
+}
+
+var tagListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List tagged findings.",
+	Run: func(cmd *cobra.Command, args []string) {
+		runTagList()
+	},
+}
+
+func init() {
+	for _, c := range []*cobra.Command{tagAddCmd, tagRemoveCmd, tagListCmd} {
+		c.Flags().IntSliceVar(&tagPostIDs, "post-id", nil, "Post ID(s) of the findings.")
+		tagCmd.AddCommand(c)
+	}
+	tagAddCmd.MarkFlagRequired("post-id")
+	tagRemoveCmd.MarkFlagRequired("post-id")
+	rootCmd.AddCommand(tagCmd)
+}
+
+func runTagUpdate(tags []string, update func(db *sql.DB, site string, postID int, tags []string) error, verb string) {
+	if storePath == "" {
+		fatal("--store-path is required for tag.")
+	}
+	db, err := openStore(storePath)
+	if err != nil {
+		fatalf("Failed to open store: %v", err)
+	}
+	defer db.Close()
+
+	for _, id := range tagPostIDs {
+		if err := update(db, dockerContainer, id, tags); err != nil {
+			fatalf("Failed to update tags: %v", err)
+		}
+	}
+	log.Printf("%s %d finding(s) on %s: %s", verb, len(tagPostIDs), dockerContainer, strings.Join(tags, ", "))
+}
+
+func runTagList() {
+	if storePath == "" {
+		fatal("--store-path is required for tag.")
+	}
+	db, err := openStoreReadOnly(storePath)
+	if err != nil {
+		fatalf("Failed to open store: %v", err)
+	}
+	defer db.Close()
+
+	where := siteFilter(dockerContainer) + " AND tags IS NOT NULL"
+	if len(tagPostIDs) > 0 {
+		ids := make([]string, len(tagPostIDs))
+		for i, id := range tagPostIDs {
+			ids[i] = fmt.Sprint(id)
+		}
+		where += fmt.Sprintf(" AND post_id IN (%s)", strings.Join(ids, ","))
+	}
+	posts, err := queryFindings(db, where)
+	if err != nil {
+		fatalf("Failed to list tags: %v", err)
+	}
+	for _, p := range posts {
+		fmt.Printf("%d\t%s\t%s\n", p.ID, p.Title, strings.Join(p.Tags, ", "))
+	}
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var usageSince time.Duration
+
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Show AI usage per site and provider account from the store.",
+	Long: `Totals the AI requests and tokens recorded for each run in --store-path,
+grouped by site, provider, API key variable and model, so usage can be
+attributed to the client account that paid for it.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runUsage()
+	},
+}
+
+func init() {
+	usageCmd.Flags().DurationVar(&usageSince, "since", 30*24*time.Hour, "Only count runs started within this long ago.")
+	rootCmd.AddCommand(usageCmd)
+}
+
+// recordRunUsage stores what a run's AI client consumed against the run.
+func recordRunUsage(db *sql.DB, runID int64, client AIClient, model string) error {
+	u := client.Usage()
+	_, err := db.Exec(`UPDATE runs SET ai_provider = ?, ai_key_env = ?, ai_model = ?, ai_requests = ?,
+		ai_failures = ?, ai_prompt_tokens = ?, ai_output_tokens = ? WHERE id = ?`,
+		client.Provider(), apiKeyEnv(), model, u.Requests.Load(), u.Failures.Load(),
+		u.PromptTokens.Load(), u.OutputTokens.Load(), runID)
+	if err != nil {
+		return fmt.Errorf("recording AI usage: %w", err)
+	}
+	return nil
+}
+
+func runUsage() {
+	if storePath == "" {
+		fatal("--store-path is required for usage.")
+	}
+	db, err := openStoreReadOnly(storePath)
+	if err != nil {
+		fatalf("Failed to open store: %v", err)
+	}
+	defer db.Close()
+
+	since := time.Now().Add(-usageSince).UTC().Format(time.RFC3339)
+	rows, err := db.Query(`SELECT site, ai_provider, ai_key_env, ai_model, COUNT(*), SUM(ai_requests),
+		SUM(ai_failures), SUM(ai_prompt_tokens), SUM(ai_output_tokens)
+		FROM runs WHERE started_at >= ? AND ai_requests > 0
+		GROUP BY site, ai_provider, ai_key_env, ai_model ORDER BY site, ai_provider`, since)
+	if err != nil {
+		fatalf("Failed to summarize usage: %v", err)
+	}
+	defer rows.Close()
+
+	fmt.Printf("%-24s %-8s %-26s %-20s %5s %9s %7s %13s %13s\n",
+		"SITE", "PROVIDER", "KEY", "MODEL", "RUNS", "REQUESTS", "FAILED", "PROMPT_TOKENS", "OUTPUT_TOKENS")
+	for rows.Next() {
+		var site, provider, keyEnv, model string
+		var runs, requests, failures, promptTokens, outputTokens int64
+		if err := rows.Scan(&site, &provider, &keyEnv, &model, &runs, &requests,
+			&failures, &promptTokens, &outputTokens); err != nil {
+			fatalf("Failed to read usage: %v", err)
+		}
+		fmt.Printf("%-24s %-8s %-26s %-20s %5d %9d %7d %13d %13d\n",
+			site, provider, keyEnv, model, runs, requests, failures, promptTokens, outputTokens)
+	}
+	if err := rows.Err(); err != nil {
+		fatalf("Failed to read usage: %v", err)
+	}
+}
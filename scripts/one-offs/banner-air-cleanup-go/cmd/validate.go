@@ -0,0 +1,306 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var validateFormat string
+
+// maxProblemsShown caps how many problems are listed per file; the rest are
+// only counted.
+const maxProblemsShown = 20
+
+// classifications are the values ai_classification may take.
+var classifications = []string{"Spam", "Legitimate", "Uncertain", "Error", "N/A"}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate FILE...",
+	Short: "Check output files and stores against the expected schema.",
+	Long: `Checks result files before a pipeline consumes them. CSV and JSON files
+must have exactly the columns this version writes, and every row must have a
+numeric post ID that is not repeated, a parseable date, a known classification
+and review state, and a resolved author. A SQLite store must be fully
+migrated, pass SQLite's integrity check, and have no finding, tag,
+notification or campaign that points at a run or finding that does not exist.
+
+The format is taken from the file extension unless --format is given. Exits
+with status 1 if any file has a problem.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runValidate(args)
+	},
+}
+
+func init() {
+	validateCmd.Flags().StringVar(&validateFormat, "format", "", "Format of every file: csv, json or sqlite (default: from the extension).")
+	rootCmd.AddCommand(validateCmd)
+}
+
+func runValidate(paths []string) {
+	failed := 0
+	for _, path := range paths {
+		rows, problems, err := validateFile(path)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		if len(problems) == 0 {
+			fmt.Printf("%s: ok (%d rows)\n", path, rows)
+			continue
+		}
+		failed++
+		fmt.Printf("%s: %d problem(s)\n", path, len(problems))
+		for i, p := range problems {
+			if i == maxProblemsShown {
+				fmt.Printf("  ... and %d more\n", len(problems)-i)
+				break
+			}
+			fmt.Printf("  %s\n", p)
+		}
+	}
+	if failed > 0 {
+		fatalf("%d of %d file(s) failed validation.", failed, len(paths))
+	}
+}
+
+// validateFile checks one file and returns how many rows it holds and what
+// is wrong with it.
+func validateFile(path string) (int, []string, error) {
+	format := validateFormat
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			format = "csv"
+		case ".json":
+			format = "json"
+		case ".db", ".sqlite", ".sqlite3":
+			format = "sqlite"
+		default:
+			return 0, nil, fmt.Errorf("cannot tell the format of %s; pass --format", path)
+		}
+	}
+	if format == "sqlite" {
+		return validateStore(path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.Close()
+	var rows []map[string]string
+	var problems []string
+	switch format {
+	case "csv":
+		rows, problems, err = readCSVRows(file)
+	case "json":
+		rows, problems, err = readJSONRows(file)
+	default:
+		return 0, nil, fmt.Errorf("unsupported format %q", format)
+	}
+	if err != nil {
+		return 0, problems, err
+	}
+	return len(rows), append(problems, validatePostRows(rows)...), nil
+}
+
+// readCSVRows reads a results CSV, requiring the header to match csvHeaders
+// exactly.
+func readCSVRows(r io.Reader) ([]map[string]string, []string, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading header: %w", err)
+	}
+	if !slices.Equal(header, csvHeaders) {
+		return nil, []string{fmt.Sprintf("header is %s, want %s", strings.Join(header, ","), strings.Join(csvHeaders, ","))}, nil
+	}
+	var rows []map[string]string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return rows, nil, err
+		}
+		row := make(map[string]string, len(header))
+		for i, v := range record {
+			row[header[i]] = v
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil, nil
+}
+
+// readJSONRows reads the JSON written by query --format json: an array of
+// objects with exactly the csvHeaders keys, all strings.
+func readJSONRows(r io.Reader) ([]map[string]string, []string, error) {
+	var raw []map[string]any
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, nil, fmt.Errorf("parsing JSON: %w", err)
+	}
+	var rows []map[string]string
+	var problems []string
+	for i, obj := range raw {
+		row := make(map[string]string, len(obj))
+		for key, v := range obj {
+			if !slices.Contains(csvHeaders, key) {
+				problems = append(problems, fmt.Sprintf("row %d: unexpected key %q", i+1, key))
+				continue
+			}
+			s, ok := v.(string)
+			if !ok {
+				problems = append(problems, fmt.Sprintf("row %d: %s is %T, want string", i+1, key, v))
+			}
+			row[key] = s
+		}
+		for _, key := range csvHeaders {
+			if _, ok := obj[key]; !ok {
+				problems = append(problems, fmt.Sprintf("row %d: missing key %q", i+1, key))
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, problems, nil
+}
+
+// validatePostRows checks the values of each result row and that post IDs
+// are unique and each author has one login throughout.
+func validatePostRows(rows []map[string]string) []string {
+	var problems []string
+	seen := make(map[int]int)
+	logins := make(map[string]string)
+	for i, row := range rows {
+		n := i + 1
+		add := func(format string, args ...any) {
+			problems = append(problems, fmt.Sprintf("row %d: ", n)+fmt.Sprintf(format, args...))
+		}
+		id, err := strconv.Atoi(row["post_id"])
+		switch {
+		case err != nil || id <= 0:
+			add("post_id %q is not a positive integer", row["post_id"])
+		case seen[id] != 0:
+			add("duplicate post_id %d (first on row %d)", id, seen[id])
+		default:
+			seen[id] = n
+		}
+		if _, err := time.Parse("2006-01-02 15:04:05", row["post_date"]); err != nil {
+			add("post_date %q is not YYYY-MM-DD HH:MM:SS", row["post_date"])
+		}
+		if !slices.Contains(classifications, row["ai_classification"]) {
+			add("unknown ai_classification %q", row["ai_classification"])
+		}
+		if state := row["review_state"]; state != "" && !slices.Contains(reviewStates, state) {
+			add("unknown review_state %q", state)
+		}
+		author := row["author_id"]
+		switch {
+		case author == "":
+			add("no author_id")
+		case row["author_login"] == "":
+			add("author %s is missing", author)
+		case logins[author] != "" && logins[author] != row["author_login"]:
+			add("author %s is %s here but %s elsewhere", author, row["author_login"], logins[author])
+		default:
+			logins[author] = row["author_login"]
+		}
+	}
+	return problems
+}
+
+// storeChecks are queries returning one description per violation of the
+// store's referential integrity.
+var storeChecks = []struct {
+	name, query string
+}{
+	{"finding without an author", `SELECT site || ' post ' || post_id FROM findings WHERE author_id = '' OR author_login = ''`},
+	{"finding with an unknown review state", `SELECT site || ' post ' || post_id || ': ' || review_state FROM findings
+		WHERE review_state NOT IN ('` + strings.Join(reviewStates, `', '`) + `')`},
+	{"finding from a missing run", `SELECT site || ' post ' || post_id || ': run ' || run_id FROM findings
+		WHERE run_id NOT IN (SELECT id FROM runs) OR (first_run_id != 0 AND first_run_id NOT IN (SELECT id FROM runs))`},
+	{"typed finding from a missing run", `SELECT site || ' ' || type || ' ' || subject || ': run ' || run_id FROM typed_findings
+		WHERE run_id NOT IN (SELECT id FROM runs)`},
+	{"campaign indicator from a missing run", `SELECT site || ' ' || campaign || ': run ' || run_id FROM campaign_indicators
+		WHERE run_id NOT IN (SELECT id FROM runs)`},
+	{"tag on a missing finding", `SELECT site || ' post ' || post_id || ': ' || tag FROM tags t
+		WHERE NOT EXISTS (SELECT 1 FROM findings f WHERE f.site = t.site AND f.post_id = t.post_id)`},
+	{"notification for a missing finding", `SELECT site || ' post ' || post_id FROM notifications n
+		WHERE NOT EXISTS (SELECT 1 FROM findings f WHERE f.site = n.site AND f.post_id = n.post_id)`},
+}
+
+// validateStore checks a results store's schema version, integrity and
+// references.
+func validateStore(path string) (int, []string, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, nil, err
+	}
+	db, err := openStoreReadOnly(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer db.Close()
+
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, nil, fmt.Errorf("reading schema version: %w", err)
+	}
+	switch {
+	case version < len(storeMigrations):
+		return 0, []string{fmt.Sprintf("schema version %d, want %d; run the tool against it once to migrate", version, len(storeMigrations))}, nil
+	case version > len(storeMigrations):
+		return 0, []string{fmt.Sprintf("schema version %d is newer than this tool (%d)", version, len(storeMigrations))}, nil
+	}
+
+	var problems []string
+	var integrity string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&integrity); err != nil {
+		return 0, nil, fmt.Errorf("checking integrity: %w", err)
+	}
+	if integrity != "ok" {
+		problems = append(problems, "integrity check: "+integrity)
+	}
+	for _, check := range storeChecks {
+		violations, err := queryStrings(db, check.query)
+		if err != nil {
+			return 0, problems, fmt.Errorf("checking %s: %w", check.name, err)
+		}
+		for _, v := range violations {
+			problems = append(problems, check.name+": "+v)
+		}
+	}
+
+	var rows int
+	if err := db.QueryRow("SELECT COUNT(*) FROM findings").Scan(&rows); err != nil {
+		return 0, problems, err
+	}
+	return rows, problems, nil
+}
+
+func queryStrings(db *sql.DB, query string) ([]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
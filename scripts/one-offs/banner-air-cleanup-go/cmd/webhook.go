@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Webhook settings; the signing secret is read from webhookSecretEnv so it
+// never appears in process listings.
+var (
+	webhookURL       string
+	webhookBatchSize int
+	webhookRetries   int
+)
+
+const webhookSecretEnv = "HUBSTACK_WEBHOOK_SECRET"
+
+// Headers of a webhook delivery. The delivery ID stays the same across
+// retries of a batch, so receivers can drop duplicates.
+const (
+	webhookSignatureHeader = "X-Hubstack-Signature"
+	webhookTimestampHeader = "X-Hubstack-Timestamp"
+	webhookDeliveryHeader  = "X-Hubstack-Delivery"
+)
+
+// webhookMaxBackoff caps the wait between delivery attempts, including
+// waits a receiver asks for with Retry-After.
+const webhookMaxBackoff = 5 * time.Minute
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&webhookURL, "webhook-url", "", "Endpoint for webhook notifications: findings are POSTed as JSON batches signed with HMAC-SHA256 using "+webhookSecretEnv+".")
+	rootCmd.PersistentFlags().IntVar(&webhookBatchSize, "webhook-batch-size", 100, "Most findings per webhook request.")
+	rootCmd.PersistentFlags().IntVar(&webhookRetries, "webhook-retries", 5, "Retries of a webhook batch that fails with a network error, 429 or 5xx, with exponential backoff.")
+}
+
+// WebhookBatch is the JSON body of one webhook request.
+type WebhookBatch struct {
+	Delivery string           `json:"delivery"`
+	Severity string           `json:"severity"`
+	Batch    int              `json:"batch"`
+	Batches  int              `json:"batches"`
+	Findings []WebhookFinding `json:"findings"`
+}
+
+// WebhookFinding is one queued finding as receivers see it.
+type WebhookFinding struct {
+	Site           string `json:"site"`
+	PostID         int    `json:"post_id"`
+	Title          string `json:"title"`
+	URL            string `json:"url"`
+	Classification string `json:"classification"`
+	Severity       string `json:"severity"`
+	Reason         string `json:"reason"`
+	QueuedAt       string `json:"queued_at"`
+	FirstSeen      string `json:"first_seen"`
+	FlaggedAt      string `json:"flagged_at"`
+}
+
+// webhookError is a failed delivery attempt; retry says whether another
+// attempt may succeed, and after how long the receiver asked to wait. Status
+// is the receiver's HTTP status, if it answered.
+type webhookError struct {
+	err    error
+	retry  bool
+	after  time.Duration
+	status int
+}
+
+func (e *webhookError) Error() string { return e.err.Error() }
+
+// sendWebhook delivers pending notifications in batches of
+// --webhook-batch-size and returns how many were delivered. Batches go out
+// in order and delivery stops at the first batch that fails for good, so the
+// undelivered rest stays queued for the next dispatch.
+func sendWebhook(severity string, pending []QueuedNotification) (int, error) {
+	if webhookURL == "" {
+		return 0, fmt.Errorf("--webhook-url is not set")
+	}
+	secret := os.Getenv(webhookSecretEnv)
+	if secret == "" {
+		return 0, fmt.Errorf("%s is not set", webhookSecretEnv)
+	}
+	size := max(webhookBatchSize, 1)
+	batches := (len(pending) + size - 1) / size
+	delivered := 0
+	for i := 0; i < batches; i++ {
+		chunk := pending[i*size : min((i+1)*size, len(pending))]
+		batch := WebhookBatch{Delivery: newDeliveryID(), Severity: severity, Batch: i + 1, Batches: batches}
+		for _, n := range chunk {
+			batch.Findings = append(batch.Findings, WebhookFinding{Site: n.Site, PostID: n.PostID, Title: n.Title,
+				URL: n.GUID, Classification: n.Classification, Severity: n.Severity, Reason: n.Reason,
+				QueuedAt: n.QueuedAt, FirstSeen: n.FirstSeen, FlaggedAt: n.FlaggedAt})
+		}
+		body, err := json.Marshal(batch)
+		if err != nil {
+			return delivered, err
+		}
+		if err := deliverWebhook(body, batch.Delivery, []byte(secret)); err != nil {
+			return delivered, fmt.Errorf("batch %d of %d: %w", i+1, batches, err)
+		}
+		delivered += len(chunk)
+	}
+	return delivered, nil
+}
+
+// deliverWebhook POSTs one batch, retrying with exponential backoff from one
+// second. Every attempt is signed afresh, since the signature covers the
+// timestamp.
+func deliverWebhook(body []byte, delivery string, secret []byte) error {
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		err := postWebhook(body, delivery, secret)
+		if err == nil {
+			return nil
+		}
+		if !err.retry || attempt >= webhookRetries {
+			return err
+		}
+		wait := min(max(backoff, err.after), webhookMaxBackoff)
+		log.Printf("Warning: webhook delivery %s failed (%v); retrying in %s.", delivery, err, wait)
+		time.Sleep(wait)
+		backoff *= 2
+	}
+}
+
+func postWebhook(body []byte, delivery string, secret []byte) *webhookError {
+	req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return &webhookError{err: err}
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookDeliveryHeader, delivery)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, "sha256="+webhookSignature(secret, timestamp, body))
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return &webhookError{err: err, retry: true}
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	werr := &webhookError{err: fmt.Errorf("webhook returned %s", resp.Status), status: resp.StatusCode,
+		retry: resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		werr.after = time.Duration(secs) * time.Second
+	}
+	return werr
+}
+
+// webhookSignature is the hex HMAC-SHA256 of "<timestamp>.<body>". Binding
+// the timestamp lets receivers reject replays of old deliveries.
+func webhookSignature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newDeliveryID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // IANA zones for --window in minimal containers
+)
+
+var maintenanceWindow string
+
+// Window is a recurring weekly maintenance window, e.g.
+// "Sat 01:00-05:00 America/Los_Angeles". Destructive phases only run inside
+// it; read-only phases ignore it.
+type Window struct {
+	Days       [7]bool // by time.Weekday, the day the window opens
+	Start, End int     // minutes after midnight; End <= Start wraps past midnight
+	Location   *time.Location
+	spec       string
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseWindow parses "DAYS HH:MM-HH:MM [ZONE]". DAYS is a day name, a
+// comma-separated list or range of them (Sat,Sun or Mon-Fri), or "daily".
+// The zone defaults to the local time zone.
+func parseWindow(spec string) (*Window, error) {
+	fields := strings.Fields(spec)
+	if len(fields) < 2 || len(fields) > 3 {
+		return nil, fmt.Errorf("invalid window %q; expected e.g. \"Sat 01:00-05:00 America/Los_Angeles\"", spec)
+	}
+	w := &Window{Location: time.Local, spec: spec}
+	if err := w.parseDays(fields[0]); err != nil {
+		return nil, fmt.Errorf("invalid window %q: %w", spec, err)
+	}
+	from, to, ok := strings.Cut(fields[1], "-")
+	start, err1 := parseClock(from)
+	end, err2 := parseClock(to)
+	if !ok || err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("invalid window %q: times must be HH:MM-HH:MM", spec)
+	}
+	w.Start, w.End = start, end
+	if len(fields) == 3 {
+		loc, err := time.LoadLocation(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid window %q: %w", spec, err)
+		}
+		w.Location = loc
+	}
+	return w, nil
+}
+
+func (w *Window) parseDays(spec string) error {
+	if strings.EqualFold(spec, "daily") {
+		for d := range w.Days {
+			w.Days[d] = true
+		}
+		return nil
+	}
+	for _, part := range strings.Split(strings.ToLower(spec), ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, ok1 := weekdays[from]
+		last, ok2 := weekdays[to]
+		if !ok1 || (isRange && !ok2) {
+			return fmt.Errorf("unknown day %q", part)
+		}
+		if !isRange {
+			last = first
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			w.Days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Contains reports whether t falls inside the window.
+func (w *Window) Contains(t time.Time) bool {
+	t = t.In(w.Location)
+	minute := t.Hour()*60 + t.Minute()
+	today, yesterday := t.Weekday(), (t.Weekday()+6)%7
+	if w.Start < w.End {
+		return w.Days[today] && minute >= w.Start && minute < w.End
+	}
+	return (w.Days[today] && minute >= w.Start) || (w.Days[yesterday] && minute < w.End)
+}
+
+// Next returns when the window next opens after t.
+func (w *Window) Next(t time.Time) time.Time {
+	t = t.In(w.Location)
+	for i := 0; i <= 7; i++ {
+		day := t.AddDate(0, 0, i)
+		open := time.Date(day.Year(), day.Month(), day.Day(), w.Start/60, w.Start%60, 0, 0, w.Location)
+		if w.Days[open.Weekday()] && open.After(t) {
+			return open
+		}
+	}
+	return time.Time{}
+}
+
+func (w *Window) String() string {
+	return w.spec
+}
+
+// checkWindow returns an error when --window is set and closed. Destructive
+// phases call it before starting and before every change, so they stop
+// when the window closes mid-run.
+func checkWindow(now time.Time) error {
+	if maintenanceWindow == "" {
+		return nil
+	}
+	w, err := parseWindow(maintenanceWindow)
+	if err != nil {
+		return err
+	}
+	if w.Contains(now) {
+		return nil
+	}
+	return fmt.Errorf("outside maintenance window %q; it next opens %s", w, w.Next(now).Format("Mon 2006-01-02 15:04 MST"))
+}
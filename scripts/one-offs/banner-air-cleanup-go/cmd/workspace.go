@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+)
+
+// workspacePrefix names every directory the tool creates in a container, so
+// leftovers can always be found.
+const workspacePrefix = "/tmp/banner-air-cleanup."
+
+// Workspace is a private temporary directory inside a site's container for
+// files that in-container operations need (scripts, file lists, ...). Each
+// run gets its own directory, so concurrent runs against one container never
+// share files.
+type Workspace struct {
+	Container string
+	Dir       string
+
+	mu      sync.Mutex
+	cleanup func()
+}
+
+var workspaces struct {
+	sync.Mutex
+	byContainer map[string]*Workspace
+}
+
+// containerWorkspace returns the current site's workspace, creating it on
+// first use. It is removed when the site's run ends or the process exits.
+func containerWorkspace(ctx context.Context) (*Workspace, error) {
+	workspaces.Lock()
+	defer workspaces.Unlock()
+	if ws := workspaces.byContainer[dockerContainer]; ws != nil {
+		return ws, nil
+	}
+
+	out, err := dockerExec(ctx, dockerContainer, "mktemp", "-d", workspacePrefix+"XXXXXXXX")
+	if err != nil {
+		return nil, fmt.Errorf("creating workspace in %s: %w", dockerContainer, err)
+	}
+	ws := &Workspace{Container: dockerContainer, Dir: strings.TrimSpace(out)}
+	ws.cleanup = onExit(func() { ws.remove() })
+	if workspaces.byContainer == nil {
+		workspaces.byContainer = make(map[string]*Workspace)
+	}
+	workspaces.byContainer[dockerContainer] = ws
+	log.Printf("Created workspace %s in %s", ws.Dir, ws.Container)
+	return ws, nil
+}
+
+// closeWorkspace removes the current site's workspace, if one was created.
+func closeWorkspace() {
+	workspaces.Lock()
+	ws := workspaces.byContainer[dockerContainer]
+	delete(workspaces.byContainer, dockerContainer)
+	workspaces.Unlock()
+	if ws != nil {
+		ws.cleanup()
+	}
+}
+
+// Upload copies data into the workspace as name and returns its path inside
+// the container.
+func (ws *Workspace) Upload(ctx context.Context, name string, data []byte) (string, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	local, err := os.CreateTemp("", "banner-air-cleanup-upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(local.Name())
+	if _, err := local.Write(data); err != nil {
+		local.Close()
+		return "", err
+	}
+	if err := local.Close(); err != nil {
+		return "", err
+	}
+	// docker cp keeps the file mode but not the owner, and wp-cli often runs
+	// as a different user than the one the copy is owned by.
+	if err := os.Chmod(local.Name(), 0o644); err != nil {
+		return "", err
+	}
+
+	target := path.Join(ws.Dir, path.Base(name))
+	cmd := exec.CommandContext(ctx, "docker", "cp", local.Name(), ws.Container+":"+target)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("copying %s into %s: %w: %s", name, ws.Container, err, bytes.TrimSpace(out))
+	}
+	return target, nil
+}
+
+// remove deletes the workspace directory. It only ever removes paths under
+// workspacePrefix.
+func (ws *Workspace) remove() {
+	if !strings.HasPrefix(ws.Dir, workspacePrefix) {
+		log.Printf("Warning: refusing to remove unexpected workspace path %q", ws.Dir)
+		return
+	}
+	if _, err := dockerExec(context.Background(), ws.Container, "rm", "-rf", ws.Dir); err != nil {
+		log.Printf("Warning: could not remove workspace %s from %s: %v", ws.Dir, ws.Container, err)
+		return
+	}
+	log.Printf("Removed workspace %s from %s", ws.Dir, ws.Container)
+}
+
+// dockerExec runs a plain command (not wp-cli) in a container.
+func dockerExec(ctx context.Context, container string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "docker", append([]string{"exec", container}, args...)...)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out.String(), nil
+}
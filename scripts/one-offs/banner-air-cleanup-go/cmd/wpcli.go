@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// phpFatalPattern matches the ways a PHP fatal error surfaces through
+// wp-cli, usually caused by a broken plugin or theme loading with WordPress.
+var phpFatalPattern = regexp.MustCompile(`PHP Fatal error|Fatal error:|There has been a critical error on this website`)
+
+// culpritPattern finds the plugin or theme in a fatal's file path under any
+// content directory, e.g. wp-content or Bedrock's app.
+var culpritPattern = regexp.MustCompile(`/(plugins|themes|mu-plugins)/([^/\s]+)`)
+
+// WPFallback records that wp-cli was switched to --skip-plugins
+// --skip-themes after a PHP fatal, and what triggered it.
+type WPFallback struct {
+	Command string `json:"command"`
+	Error   string `json:"error"`
+	Culprit string `json:"culprit,omitempty"`
+}
+
+// fallbackFlags are added to every wp call once a fatal has been seen.
+var fallbackFlags = []string{"--skip-plugins", "--skip-themes"}
+
+var wpFallbackState struct {
+	sync.Mutex
+	fallback *WPFallback
+}
+
+// activeWPFallback returns the fallback in effect for the current site, or
+// nil.
+func activeWPFallback() *WPFallback {
+	wpFallbackState.Lock()
+	defer wpFallbackState.Unlock()
+	return wpFallbackState.fallback
+}
+
+func resetWPFallback() {
+	wpFallbackState.Lock()
+	wpFallbackState.fallback = nil
+	wpFallbackState.Unlock()
+}
+
+// shouldFallBack reports whether a failed wp call is worth retrying without
+// plugins and themes: it failed with a PHP fatal, no fallback is active yet
+// and the operator has not already chosen what to skip.
+func shouldFallBack(stderr string) bool {
+	if !phpFatalPattern.MatchString(stderr) || activeWPFallback() != nil {
+		return false
+	}
+	for _, f := range strings.Fields(wpFlags) {
+		if strings.HasPrefix(f, "--skip-plugins") || strings.HasPrefix(f, "--skip-themes") {
+			return false
+		}
+	}
+	return true
+}
+
+// activateWPFallback switches the rest of the site's wp calls to skip plugins
+// and themes. Content is still read from the database as-is, but shortcodes
+// and filters from the skipped code no longer run.
+func activateWPFallback(command []string, stderr string) {
+	wpFallbackState.Lock()
+	defer wpFallbackState.Unlock()
+	if wpFallbackState.fallback != nil {
+		return
+	}
+	fb := &WPFallback{Command: strings.Join(command, " "), Error: firstLine(phpFatalPattern, stderr)}
+	if m := culpritPattern.FindStringSubmatch(stderr); m != nil {
+		fb.Culprit = strings.TrimSuffix(m[1], "s") + ":" + m[2]
+	}
+	wpFallbackState.fallback = fb
+	log.Printf("Warning: wp-cli hit a PHP fatal (%s); retrying this and all further calls with %s.",
+		firstNonEmpty(fb.Culprit, fb.Error), strings.Join(fallbackFlags, " "))
+}
+
+// firstLine returns the first line of text matching pattern, or the first
+// line of text.
+func firstLine(pattern *regexp.Regexp, text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for _, line := range lines {
+		if pattern.MatchString(line) {
+			return strings.TrimSpace(line)
+		}
+	}
+	return strings.TrimSpace(lines[0])
+}
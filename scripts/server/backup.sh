@@ -10,13 +10,14 @@ set -auo pipefail # Exit immediately if a command exits with a non-zero status.
 
 # Display usage information
 function display_help() {
-    echo "Usage: $0 [--backup-dir /path/to/backups] [--selection <number>] [--db-password <password>] [--dry-run] [--wp-db-export]"
+    echo "Usage: $0 [--backup-dir /path/to/backups] [--selection <number> | --container-name <name>] [--db-password <password>] [--dry-run] [--wp-db-export]"
     echo
     echo "This script finds running WordPress containers and backs up a selected site."
     echo
     echo "Parameters:"
     echo "  --backup-dir <path>  Set the directory to save the backup tarball. If not provided, the script will prompt for it."
     echo "  --selection <number> Pre-select the site by number (1-based index). If not provided, the script will prompt for selection."
+    echo "  --container-name <name> Select the site by its container name, without prompting. Exits 1 if no such site is found."
     echo "  --db-password <pass> Set the database password. If not provided, will attempt to extract from container."
     echo "  --dry-run            Display the commands that would be executed without performing the backup."
     echo "  --wp-db-export       Use WP-CLI inside the WordPress container to export the database (wp db export)."
@@ -29,6 +30,7 @@ function display_help() {
 # Set default values
 BACKUP_DIR="backups"
 SELECTION=""
+CONTAINER_SELECTION=""
 DB_PASSWORD=""
 DRY_RUN=false
 WP_DB_EXPORT=false
@@ -44,6 +46,10 @@ while [[ "$#" -gt 0 ]]; do
             SELECTION="$2"
             shift
             ;;
+        --container-name)
+            CONTAINER_SELECTION="$2"
+            shift
+            ;;
         --db-password)
             DB_PASSWORD="$2"
             shift
@@ -58,8 +64,10 @@ while [[ "$#" -gt 0 ]]; do
             display_help
             ;;
         *)
-            echo "Unknown parameter: $1"
-            display_help
+            # Exit non-zero, so callers checking the status never mistake a typo for a backup.
+            echo "Unknown parameter: $1" >&2
+            echo "Run $0 --help for usage." >&2
+            exit 2
             ;;
     esac
     shift
@@ -109,7 +117,22 @@ for site_details in "${sites[@]}"; do
 done
 
 # Step 3: Get user's selection
-if [ -n "$SELECTION" ]; then
+if [ -n "$CONTAINER_SELECTION" ]; then
+    selection=""
+    i=1
+    for site_details in "${sites[@]}"; do
+        if [ "$(echo "$site_details" | cut -d':' -f1)" = "$CONTAINER_SELECTION" ]; then
+            selection=$i
+            break
+        fi
+        i=$((i+1))
+    done
+    if [ -z "$selection" ]; then
+        echo "Error: no running WordPress container named '$CONTAINER_SELECTION' with a site directory in /var/opt/."
+        exit 1
+    fi
+    echo "Using container: $CONTAINER_SELECTION"
+elif [ -n "$SELECTION" ]; then
     selection="$SELECTION"
     echo "Using pre-selected site: $selection"
 else
@@ -219,7 +242,11 @@ else
     # b) Save the target dir as a tarball
     echo "2. Creating tarball of '$SITE_DIR'..."
     # Use -C to change directory so the paths in the tarball are relative
-    tar -czf "$FINAL_TARBALL" -C "$SITE_DIR" .
+    if ! tar -czf "$FINAL_TARBALL" -C "$SITE_DIR" .; then
+        echo "Error creating tarball $FINAL_TARBALL"
+        rm "$SITE_DIR/$DB_BACKUP_FILE" 2>/dev/null || true
+        exit 1
+    fi
     
     # Clean up the SQL file from the live site directory
     echo "3. Cleaning up temporary database file..."
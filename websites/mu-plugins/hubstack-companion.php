@@ -0,0 +1,188 @@
+<?php
+/**
+ * Plugin Name:       HubStack Companion
+ * Description:       REST endpoints for the banner-air-cleanup scanner: bulk content export, content hashing and hash-guarded deletes. Lets the scanner replace one wp-cli call per post with a single request. This is a Must-Use plugin.
+ * Version:           1.0.0
+ * Author:            Maximillian Heth
+ */
+
+if ( ! defined( 'ABSPATH' ) ) {
+	exit; // Exit if accessed directly.
+}
+
+/**
+ * Registers the hubstack/v1 routes.
+ *
+ * The scanner calls them from inside the container through wp eval and
+ * rest_do_request(), so no HTTP authentication is involved. Over HTTP they
+ * require an administrator, e.g. with an Application Password.
+ */
+class HubStack_Companion {
+
+	/**
+	 * Bumped when a route or response changes incompatibly; the scanner
+	 * ignores the plugin when it does not know the version.
+	 */
+	const API_VERSION = 1;
+
+	const PLUGIN_VERSION = '1.0.0';
+
+	/**
+	 * The most posts one export or hashes request may ask for.
+	 */
+	const MAX_IDS = 500;
+
+	public function __construct() {
+		add_action( 'rest_api_init', [ $this, 'register_routes' ] );
+	}
+
+	public function register_routes() {
+		register_rest_route( 'hubstack/v1', '/status', [
+			'methods'             => 'GET',
+			'callback'            => [ $this, 'status' ],
+			'permission_callback' => [ $this, 'can_manage' ],
+		] );
+		register_rest_route( 'hubstack/v1', '/export', [
+			'methods'             => 'GET',
+			'callback'            => [ $this, 'export' ],
+			'permission_callback' => [ $this, 'can_manage' ],
+			'args'                => [ 'ids' => [ 'type' => 'string', 'required' => true ] ],
+		] );
+		register_rest_route( 'hubstack/v1', '/hashes', [
+			'methods'             => 'GET',
+			'callback'            => [ $this, 'hashes' ],
+			'permission_callback' => [ $this, 'can_manage' ],
+			'args'                => [ 'ids' => [ 'type' => 'string', 'required' => true ] ],
+		] );
+		register_rest_route( 'hubstack/v1', '/delete', [
+			'methods'             => 'POST',
+			'callback'            => [ $this, 'delete' ],
+			'permission_callback' => [ $this, 'can_manage' ],
+			'args'                => [
+				'id'            => [ 'type' => 'integer', 'required' => true ],
+				'method'        => [ 'type' => 'string', 'required' => true, 'enum' => [ 'trash', 'delete', 'draft' ] ],
+				'expected_hash' => [ 'type' => 'string', 'required' => false ],
+			],
+		] );
+	}
+
+	/**
+	 * Allows wp-cli, which runs as no user, and administrators.
+	 */
+	public function can_manage() {
+		return ( defined( 'WP_CLI' ) && WP_CLI ) || current_user_can( 'manage_options' );
+	}
+
+	public function status() {
+		return [
+			'plugin'      => 'hubstack-companion',
+			'version'     => self::PLUGIN_VERSION,
+			'api_version' => self::API_VERSION,
+		];
+	}
+
+	/**
+	 * Returns the raw content and content hash of each requested post that
+	 * exists, whatever its status.
+	 */
+	public function export( WP_REST_Request $request ) {
+		$ids = $this->ids( $request );
+		if ( is_wp_error( $ids ) ) {
+			return $ids;
+		}
+		$posts = [];
+		foreach ( $ids as $id ) {
+			$post = get_post( $id );
+			if ( ! $post ) {
+				continue;
+			}
+			$posts[] = [
+				'id'      => $post->ID,
+				'content' => $post->post_content,
+				'hash'    => $this->content_hash( $post->post_content ),
+			];
+		}
+		return $posts;
+	}
+
+	/**
+	 * Returns the content hash of each requested post that exists, keyed by
+	 * post ID.
+	 */
+	public function hashes( WP_REST_Request $request ) {
+		$ids = $this->ids( $request );
+		if ( is_wp_error( $ids ) ) {
+			return $ids;
+		}
+		$hashes = new stdClass();
+		foreach ( $ids as $id ) {
+			$post = get_post( $id );
+			if ( $post ) {
+				$hashes->{$post->ID} = $this->content_hash( $post->post_content );
+			}
+		}
+		return $hashes;
+	}
+
+	/**
+	 * Trashes, deletes or unpublishes a post, but only if its content still
+	 * has the expected hash, so a post edited since it was reviewed is never
+	 * removed.
+	 */
+	public function delete( WP_REST_Request $request ) {
+		$id     = absint( $request['id'] );
+		$method = $request['method'];
+		$post   = get_post( $id );
+		if ( ! $post ) {
+			return new WP_Error( 'hubstack_not_found', "Post {$id} does not exist.", [ 'status' => 404 ] );
+		}
+		$expected = (string) $request['expected_hash'];
+		if ( '' !== $expected && ! hash_equals( $expected, $this->content_hash( $post->post_content ) ) ) {
+			return new WP_Error( 'hubstack_content_changed', "Post {$id} changed since it was reviewed.", [ 'status' => 409 ] );
+		}
+
+		switch ( $method ) {
+			case 'trash':
+				$done = wp_trash_post( $id );
+				break;
+			case 'delete':
+				$done = wp_delete_post( $id, true );
+				break;
+			default:
+				$done = wp_update_post( [ 'ID' => $id, 'post_status' => 'draft' ], true );
+				if ( is_wp_error( $done ) ) {
+					return $done;
+				}
+		}
+		if ( ! $done ) {
+			return new WP_Error( 'hubstack_failed', "Could not {$method} post {$id}.", [ 'status' => 500 ] );
+		}
+		return [ 'id' => $id, 'method' => $method ];
+	}
+
+	/**
+	 * Parses the ids parameter, a comma-separated list of post IDs.
+	 */
+	private function ids( WP_REST_Request $request ) {
+		$ids = wp_parse_id_list( $request['ids'] );
+		if ( count( $ids ) > self::MAX_IDS ) {
+			return new WP_Error( 'hubstack_too_many', sprintf( 'At most %d posts per request.', self::MAX_IDS ), [ 'status' => 400 ] );
+		}
+		return $ids;
+	}
+
+	/**
+	 * Hashes content the way the scanner does: SHA-256 of the content with
+	 * leading and trailing whitespace removed as Go's strings.TrimSpace
+	 * removes it, including Unicode spaces.
+	 */
+	private function content_hash( $content ) {
+		$trimmed = preg_replace( '/^[\s\p{Z}\x{85}]+|[\s\p{Z}\x{85}]+$/u', '', $content );
+		if ( null === $trimmed ) {
+			$trimmed = trim( $content ); // not valid UTF-8
+		}
+		return hash( 'sha256', $trimmed );
+	}
+}
+
+new HubStack_Companion();